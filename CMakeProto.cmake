@@ -57,6 +57,7 @@ protoc_cc("gapis/memory" "gapis/memory" "memory.proto")
 protoc_go("github.com/google/gapid/gapis/memory/memory_pb" "gapis/memory/memory_pb" "memory.proto")
 protoc_cc("gapis/memory/memory_pb" "gapis/memory/memory_pb" "memory.proto")
 protoc_go("github.com/google/gapid/gapis/replay/protocol" "gapis/replay/protocol" "replay_protocol.proto")
+protoc_cc("gapis/replay/protocol" "gapis/replay/protocol" "replay_protocol.proto")
 protoc_go("github.com/google/gapid/gapis/replay" "gapis/replay" "replay.proto")
 protoc_go("github.com/google/gapid/gapis/resolve" "gapis/resolve" "resolvables.proto")
 protoc_go("github.com/google/gapid/gapis/resolve/dependencygraph" "gapis/resolve/dependencygraph" "resolvables.proto")
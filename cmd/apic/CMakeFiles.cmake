@@ -18,7 +18,9 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    doc.go
     format.go
+    lint.go
     main.go
     template.go
     validate.go
@@ -0,0 +1,69 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The doc command generates reference pages for the commands, classes, enums
+// and constants of an API.
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/file"
+	"github.com/google/gapid/gapil"
+	"github.com/google/gapid/gapil/docgen"
+)
+
+func init() {
+	app.AddVerb(&app.Verb{
+		Name:      "doc",
+		ShortHelp: "Generates reference documentation for an api file",
+		Action: &docVerb{
+			Dir:    cwd(),
+			Format: docgen.Markdown.Name,
+		},
+	})
+}
+
+type docVerb struct {
+	Dir    string        `help:"The output directory"`
+	Format string        `help:"The output format: markdown or html"`
+	Search file.PathList `help:"The set of paths to search for includes"`
+}
+
+func (v *docVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	args := flags.Args()
+	if len(args) < 1 {
+		app.Usage(ctx, "Missing api file")
+		return nil
+	}
+	format, err := docgen.FormatByName(v.Format)
+	if err != nil {
+		return err
+	}
+	apiName := args[0]
+	processor := gapil.NewProcessor()
+	if len(v.Search) > 0 {
+		processor.Loader = gapil.NewSearchLoader(v.Search)
+	}
+	compiled, errs := processor.Resolve(apiName)
+	if err := gapil.CheckErrors(apiName, errs, maxErrors); err != nil {
+		return err
+	}
+	log.I(ctx, "Writing %v documentation for %v to %v", format.Name, apiName, v.Dir)
+	ref := docgen.Build(compiled, processor.Mappings)
+	return docgen.Write(v.Dir, ref, format)
+}
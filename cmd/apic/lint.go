@@ -0,0 +1,144 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The lint command runs the configurable lint rules over the specified APIs,
+// reporting any issues found.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapil"
+	"github.com/google/gapid/gapil/lint"
+)
+
+func init() {
+	app.AddVerb(&app.Verb{
+		Name:      "lint",
+		ShortHelp: "Checks api files for style and correctness issues",
+		Action: &lintVerb{
+			Format: "text",
+			FailOn: "warning",
+		},
+	})
+}
+
+type lintVerb struct {
+	Config  string        `help:"The JSON lint configuration file"`
+	Enable  flags.Strings `help:"Rules to enable, in addition to the configuration"`
+	Disable flags.Strings `help:"Rules to disable, in addition to the configuration"`
+	Format  string        `help:"The output format: text, json or sarif"`
+	Out     string        `help:"The output file. Defaults to stdout"`
+	FailOn  string        `help:"The lowest severity that fails the lint: info, warning, error or off"`
+	List    bool          `help:"List the available rules and exit"`
+}
+
+func (v *lintVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if v.List {
+		for _, r := range lint.Rules() {
+			fmt.Printf("%-20s %-8v %v\n", r.Name(), r.Severity(), r.Description())
+		}
+		return nil
+	}
+
+	args := flags.Args()
+	if len(args) < 1 {
+		app.Usage(ctx, "Missing api file")
+		return nil
+	}
+
+	config := &lint.Config{}
+	if v.Config != "" {
+		var err error
+		if config, err = lint.LoadConfig(v.Config); err != nil {
+			return err
+		}
+	}
+	defaults := map[string]lint.Severity{}
+	for _, r := range lint.Rules() {
+		defaults[r.Name()] = r.Severity()
+	}
+	for _, name := range v.Enable.Strings() {
+		s, ok := defaults[name]
+		if !ok {
+			return fmt.Errorf("Unknown lint rule '%v'", name)
+		}
+		if s == lint.Off {
+			s = lint.Warning
+		}
+		config.Set(name, s)
+	}
+	for _, name := range v.Disable.Strings() {
+		config.Set(name, lint.Off)
+	}
+	failOn, err := lint.ParseSeverity(v.FailOn)
+	if err != nil {
+		return err
+	}
+
+	var write func(io.Writer, lint.Issues) error
+	switch v.Format {
+	case "text":
+		write = lint.WriteText
+	case "json":
+		write = lint.WriteJSON
+	case "sarif":
+		write = lint.WriteSARIF
+	default:
+		app.Usage(ctx, "Unknown format '%v'", v.Format)
+		return nil
+	}
+
+	all := lint.Issues{}
+	for _, apiName := range args {
+		processor := gapil.NewProcessor()
+		compiled, errs := processor.Resolve(apiName)
+		if err := gapil.CheckErrors(apiName, errs, maxErrors); err != nil {
+			return err
+		}
+		log.I(ctx, "Linting %v", apiName)
+		issues, err := lint.Run(compiled, processor.Mappings, config)
+		if err != nil {
+			return err
+		}
+		all = append(all, issues...)
+	}
+
+	out := os.Stdout
+	if v.Out != "" {
+		f, err := os.Create(v.Out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := write(out, all); err != nil {
+		return err
+	}
+
+	if failOn != lint.Off {
+		if c := all.Count(failOn); c > 0 {
+			return fmt.Errorf("%d issues found", c)
+		}
+	}
+	return nil
+}
@@ -20,17 +20,29 @@
 set(files
     commands.go
     common.go
+    compare_devices.go
+    compat.go
+    convert.go
+    determinism.go
     devices.go
     dump.go
     dump_shaders.go
+    export_cpp.go
     flags.go
+    footprint.go
     info.go
     inputs.go
     main.go
     packages.go
+    pixel_history.go
+    replay_dump.go
+    replay_payload.go
     report.go
     screenshot.go
+    script.go
+    splice.go
     state.go
+    stats.go
     stresstest.go
     sxs_video.go
     trace.go
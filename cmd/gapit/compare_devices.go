@@ -0,0 +1,139 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type compareDevicesVerb struct{ CompareDevicesFlags }
+
+func init() {
+	verb := &compareDevicesVerb{
+		CompareDevicesFlags{
+			At: flags.U64Slice{},
+		},
+	}
+
+	app.AddVerb(&app.Verb{
+		Name:      "compare-devices",
+		ShortHelp: "Replays a .gfxtrace file on all the compatible devices and compares their framebuffers",
+		Action:    verb,
+	})
+}
+
+func (verb *compareDevicesVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	if len(verb.At) == 0 {
+		boxedCapture, err := client.Get(ctx, capture.Path())
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture")
+		}
+		verb.At = []uint64{uint64(boxedCapture.(*service.Capture).NumCommands) - 1}
+	}
+
+	attachment := uint32(api.FramebufferAttachment_Color0) + uint32(verb.Attachment)
+	p := capture.Command(verb.At[0], verb.At[1:]...).FramebufferComparison(attachment)
+
+	boxedComparison, err := client.Get(ctx, p.Path())
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to compare the framebuffers at: %v", p.Text())
+	}
+	comparison := boxedComparison.(*service.FramebufferComparison)
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tDevice\tFramebuffer")
+	for i, fb := range comparison.Framebuffers {
+		status := "ok"
+		if fb.Image == nil {
+			status = fb.Error
+		} else if verb.Out != "" {
+			if status, err = verb.save(ctx, client, i, fb.Image); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%d\t%v\t%v\n", i, deviceName(ctx, client, fb.Device), status)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Devices\tMean square error\tMax difference\tDifferent pixels")
+	for _, d := range comparison.Differences {
+		fmt.Fprintf(w, "%d-%d\t%g\t%g\t%d/%d\n", d.A, d.B, d.MeanSquareError, d.MaxDifference, d.DifferentPixels, d.Pixels)
+	}
+	return w.Flush()
+}
+
+// save writes the framebuffer image of the i'th device to the output
+// directory, returning the path of the written file.
+func (verb *compareDevicesVerb) save(ctx context.Context, client client.Client, i int, iip *path.ImageInfo) (string, error) {
+	frame, err := getFrameImage(ctx, iip, client)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(verb.Out, 0755); err != nil {
+		return "", log.Err(ctx, err, "Failed to create the output directory")
+	}
+	name := filepath.Join(verb.Out, fmt.Sprintf("device%d.png", i))
+	out, err := os.Create(name)
+	if err != nil {
+		return "", log.Errf(ctx, err, "Failed to create %v", name)
+	}
+	defer out.Close()
+	return name, png.Encode(out, flipImg(frame))
+}
+
+// deviceName returns the name of the device d, or its identifier if the
+// device can't be resolved.
+func deviceName(ctx context.Context, client client.Client, d *path.Device) string {
+	boxedDevice, err := client.Get(ctx, d.Path())
+	if err != nil {
+		return d.Id.ID().String()
+	}
+	return boxedDevice.(*device.Instance).Name
+}
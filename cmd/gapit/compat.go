@@ -0,0 +1,88 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type compatVerb struct{ CompatFlags }
+
+func init() {
+	verb := &compatVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "compat",
+		ShortHelp: "Lists the commands and extensions of a .gfxtrace file that the compatibility layer does not handle for replay on a device",
+		Action:    verb,
+	})
+}
+
+func (verb *compatVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	device, err := getDevice(ctx, client, capture, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	p := capture.CompatCoverage(device)
+	boxedCoverage, err := client.Get(ctx, p.Path())
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to get the compatibility coverage: %v", p.Text())
+	}
+	coverage := boxedCoverage.(*service.CompatCoverage)
+
+	fmt.Fprintf(os.Stdout, "Device: %v\n", deviceName(ctx, client, coverage.Device))
+	if len(coverage.Commands) == 0 && len(coverage.Extensions) == 0 {
+		fmt.Fprintln(os.Stdout, "All the commands and extensions are handled")
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "Unhandled extensions (%d):\n", len(coverage.Extensions))
+	for _, ext := range coverage.Extensions {
+		fmt.Fprintf(os.Stdout, "  %v\n", ext)
+	}
+	fmt.Fprintf(os.Stdout, "Unhandled commands (%d):\n", len(coverage.Commands))
+	for _, cmd := range coverage.Commands {
+		fmt.Fprintf(os.Stdout, "  %v\n", cmd)
+	}
+	return nil
+}
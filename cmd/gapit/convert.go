@@ -0,0 +1,75 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type convertVerb struct{ ConvertFlags }
+
+func init() {
+	verb := &convertVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "convert",
+		ShortHelp: "Converts a capture between the .gfxtrace and line-oriented JSON formats",
+		Action:    verb,
+	})
+}
+
+func (verb *convertVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 2 {
+		app.Usage(ctx, "Exactly one input capture and one output file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	in, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+	out := flags.Arg(1)
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, in)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", in)
+	}
+
+	format := service.CaptureFormat_PackFormat
+	if verb.Json {
+		format = service.CaptureFormat_JsonFormat
+	}
+	data, err := client.ExportCapture(ctx, capture, format)
+	if err != nil {
+		return log.Errf(ctx, err, "ExportCapture(%v)", in)
+	}
+
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write %v", out)
+	}
+	return nil
+}
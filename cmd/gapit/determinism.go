@@ -0,0 +1,115 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+type determinismVerb struct{ DeterminismFlags }
+
+func init() {
+	verb := &determinismVerb{
+		DeterminismFlags{
+			Runs: 3,
+		},
+	}
+
+	app.AddVerb(&app.Verb{
+		Name:      "determinism",
+		ShortHelp: "Replays a .gfxtrace file several times and finds the first command whose framebuffer differs between the replays",
+		Action:    verb,
+	})
+}
+
+func (verb *determinismVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	device, err := getDevice(ctx, client, capture, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	if verb.To == 0 {
+		boxedCapture, err := client.Get(ctx, capture.Path())
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture")
+		}
+		verb.To = uint64(boxedCapture.(*service.Capture).NumCommands) - 1
+	}
+
+	attachment := uint32(api.FramebufferAttachment_Color0) + uint32(verb.Attachment)
+	p := capture.CommandRange(verb.From, verb.To).ReplayDeterminism(device, uint32(verb.Runs), attachment)
+
+	boxedDeterminism, err := client.Get(ctx, p.Path())
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to check the determinism of: %v", p.Text())
+	}
+	determinism := boxedDeterminism.(*service.ReplayDeterminism)
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Device:\t%v\n", deviceName(ctx, client, determinism.Device))
+	fmt.Fprintf(w, "Runs:\t%d\n", determinism.Runs)
+	fmt.Fprintf(w, "Checkpoints:\t%d\n", len(determinism.Checkpoints))
+	if determinism.DivergedAfter == nil {
+		fmt.Fprintln(w, "Result:\tdeterministic")
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Result:\trun %d diverged from run 0 after command %v\n", determinism.DivergedRun, determinism.DivergedAfter.Indices)
+	if d := determinism.Difference; d != nil {
+		fmt.Fprintf(w, "Mean square error:\t%g\n", d.MeanSquareError)
+		fmt.Fprintf(w, "Max difference:\t%g\n", d.MaxDifference)
+		fmt.Fprintf(w, "Different pixels:\t%d/%d\n", d.DifferentPixels, d.Pixels)
+	}
+	if len(determinism.FirstRunIssues) > 0 || len(determinism.DivergedRunIssues) > 0 {
+		fmt.Fprintf(w, "Issues of run 0:\t%d\n", len(determinism.FirstRunIssues))
+		for _, issue := range determinism.FirstRunIssues {
+			fmt.Fprintf(w, "\t%v\n", issue)
+		}
+		fmt.Fprintf(w, "Issues of run %d:\t%d\n", determinism.DivergedRun, len(determinism.DivergedRunIssues))
+		for _, issue := range determinism.DivergedRunIssues {
+			fmt.Fprintf(w, "\t%v\n", issue)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type exportCppVerb struct{ ExportCppFlags }
+
+func init() {
+	verb := &exportCppVerb{
+		ExportCppFlags{
+			Out: "replay",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "export-cpp",
+		ShortHelp: "Exports a .gfxtrace file as a standalone C++ program replaying its commands",
+		Action:    verb,
+	})
+}
+
+func (verb *exportCppVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	boxedExport, err := client.Get(ctx, capture.CppExport().Path())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to export the capture")
+	}
+	export := boxedExport.(*service.CppExport)
+
+	for _, f := range export.Files {
+		data := f.Data
+		if f.Resource != nil {
+			boxedData, err := client.Get(ctx, f.Resource.Path())
+			if err != nil {
+				return log.Errf(ctx, err, "Failed to get the data of %v", f.Name)
+			}
+			data = boxedData.([]byte)
+		}
+		if err := verb.write(f.Name, data); err != nil {
+			return log.Errf(ctx, err, "Failed to write %v", f.Name)
+		}
+	}
+
+	log.I(ctx, "Exported %d files to %v", len(export.Files), verb.Out)
+	return nil
+}
+
+func (verb *exportCppVerb) write(name string, data []byte) error {
+	path := filepath.Join(verb.Out, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
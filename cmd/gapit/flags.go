@@ -215,9 +215,85 @@ type (
 		DataHeader  string         `help:"marker to write before package data"`
 		ADB         string         `help: "Path to the adb executable; leave empty to search the environment"`
 	}
+	PixelHistoryFlags struct {
+		Gapis      GapisFlags
+		Gapir      GapirFlags
+		At         flags.U64Slice `help:"command index in the frame to inspect. Empty for last"`
+		Attachment int            `help:"index of the color attachment to inspect"`
+		X          int            `help:"x coordinate of the pixel, from the left of the framebuffer"`
+		Y          int            `help:"y coordinate of the pixel, from the bottom of the framebuffer"`
+	}
+	SpliceFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		Out   string `help:"output capture file"`
+	}
+	StatsFlags struct {
+		Gapis    GapisFlags
+		Gapir    GapirFlags
+		Json     bool   `help:"output the statistics as JSON, for regression tracking"`
+		Frames   bool   `help:"print the statistics of each frame"`
+		Commands int    `help:"the number of most frequent commands to print. 0 for all"`
+		Out      string `help:"output file, standard output if none"`
+	}
+	FootprintFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		Range int    `help:"the number of commands of each range. 0 for a range per frame"`
+		At    int    `help:"the index of the range to list the live objects of. -1 for none"`
+		Json  bool   `help:"output the footprint as JSON"`
+		Out   string `help:"output file, standard output if none"`
+	}
+	ConvertFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		Json  bool `help:"write the capture as line-oriented JSON instead of .gfxtrace"`
+	}
+	ScriptFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		File  string `help:"file to read the script from, instead of the second argument"`
+		Json  bool   `help:"output the result as JSON"`
+		Out   string `help:"output file, standard output if none"`
+	}
+	ExportCppFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		Out   string `help:"output directory of the C++ program"`
+	}
+	ReplayDumpFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		At    flags.U64Slice `help:"command/subcommand index to read the framebuffer after. Empty to look for replay issues"`
+		Stats bool           `help:"only print the size statistics of the payload"`
+		Out   string         `help:"output file, standard output if none"`
+		Save  string         `help:"file to save the payload and its resources to, to replay them with replay-payload"`
+	}
+	ReplayPayloadFlags struct {
+		Gapir GapirFlags
+	}
 	ScreenshotFlags struct {
 		Gapis GapisFlags
 		Gapir GapirFlags
 		At    flags.U64Slice `help:"command/subcommand index for the screenshot. Empty for last"`
 	}
+	CompareDevicesFlags struct {
+		Gapis      GapisFlags
+		Gapir      GapirFlags
+		At         flags.U64Slice `help:"command/subcommand index to compare the framebuffer after. Empty for last"`
+		Attachment int            `help:"index of the color attachment to compare"`
+		Out        string         `help:"directory to save the framebuffer of each device to, as PNG files"`
+	}
+	CompatFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+	}
+	DeterminismFlags struct {
+		Gapis      GapisFlags
+		Gapir      GapirFlags
+		From       uint64 `help:"index of the first command to compare the framebuffer after"`
+		To         uint64 `help:"index of the last command to compare the framebuffer after. 0 for last"`
+		Runs       int    `help:"number of times to replay the capture"`
+		Attachment int    `help:"index of the color attachment to compare"`
+	}
 )
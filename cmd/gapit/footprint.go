@@ -0,0 +1,163 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+type footprintVerb struct{ FootprintFlags }
+
+func init() {
+	verb := &footprintVerb{
+		FootprintFlags{
+			At: -1,
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "footprint",
+		ShortHelp: "Prints the memory held by the resources of a .gfxtrace file over time",
+		Action:    verb,
+	})
+}
+
+func (verb *footprintVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Range < 0 {
+		app.Usage(ctx, "Invalid range size: %d", verb.Range)
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	boxedFootprint, err := client.Get(ctx, capture.Footprint(uint64(verb.Range)).Path())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get the memory footprint")
+	}
+	footprint := boxedFootprint.(*service.MemoryFootprint)
+
+	if verb.At >= len(footprint.Ranges) {
+		return log.Errf(ctx, nil, "Range %d out of bounds: the capture has %d ranges", verb.At, len(footprint.Ranges))
+	}
+
+	var w io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open footprint output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if verb.Json {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		if err := e.Encode(footprint); err != nil {
+			return log.Err(ctx, err, "marshal json")
+		}
+		return nil
+	}
+
+	verb.writeTables(w, footprint)
+	return nil
+}
+
+func (verb *footprintVerb) writeTables(out io.Writer, footprint *service.MemoryFootprint) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Objects:\t%d\n", len(footprint.Objects))
+	fmt.Fprintf(w, "Peak:\t%d bytes after command %d\n", footprint.PeakBytes, footprint.PeakCommand)
+
+	// Use a column for each kind of object of the capture.
+	kinds := []api.MemoryKind{}
+	seen := map[api.MemoryKind]bool{}
+	for _, r := range footprint.Ranges {
+		for _, t := range r.Live {
+			if !seen[t.Kind] {
+				seen[t.Kind] = true
+				kinds = append(kinds, t.Kind)
+			}
+		}
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	fmt.Fprintf(w, "\nRange\tCommands\tLive bytes\tPeak bytes\tCreated\tDeleted")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "\t%v", k)
+	}
+	fmt.Fprintf(w, "\n")
+	for i, r := range footprint.Ranges {
+		fmt.Fprintf(w, "%d\t[%d, %d]\t%d\t%d\t%d\t%d", i, r.FirstCommand, r.LastCommand,
+			r.LiveBytes, r.PeakBytes, r.Created, r.Deleted)
+		live := map[api.MemoryKind]*service.FootprintTotal{}
+		for _, t := range r.Live {
+			live[t.Kind] = t
+		}
+		for _, k := range kinds {
+			if t, ok := live[k]; ok {
+				fmt.Fprintf(w, "\t%d (%d)", t.Bytes, t.Count)
+			} else {
+				fmt.Fprintf(w, "\t0 (0)")
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	if verb.At < 0 {
+		return
+	}
+	last := footprint.Ranges[verb.At].LastCommand
+	fmt.Fprintf(w, "\nObjects alive after command %d:\n", last)
+	fmt.Fprintf(w, "Kind\tHandle\tLabel\tFinal size\tCreated\tAliased\n")
+	for _, o := range footprint.Objects {
+		created := o.Created.Indices[0]
+		if created > last || (o.Deleted != nil && o.Deleted.Indices[0] <= last) {
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%d\t%d\t%v\n", o.Kind, o.Handle, o.Label, o.Size, created, o.Aliased)
+	}
+}
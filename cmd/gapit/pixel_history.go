@@ -0,0 +1,129 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+type pixelHistoryVerb struct{ PixelHistoryFlags }
+
+func init() {
+	verb := &pixelHistoryVerb{
+		PixelHistoryFlags{
+			At: flags.U64Slice{},
+		},
+	}
+
+	app.AddVerb(&app.Verb{
+		Name:      "pixel-history",
+		ShortHelp: "Prints the draw calls that wrote to a pixel in a frame of a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+func (verb *pixelHistoryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.X < 0 || verb.Y < 0 {
+		app.Usage(ctx, "Pixel coordinates must not be negative, got (%d, %d)", verb.X, verb.Y)
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	if len(verb.At) == 0 {
+		boxedCapture, err := client.Get(ctx, capture.Path())
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture")
+		}
+		verb.At = []uint64{uint64(boxedCapture.(*service.Capture).NumCommands) - 1}
+	}
+
+	attachment := uint32(api.FramebufferAttachment_Color0) + uint32(verb.Attachment)
+	p := capture.Command(verb.At[0]).PixelHistory(attachment, uint32(verb.X), uint32(verb.Y))
+
+	boxedHistory, err := client.Get(ctx, p.Path())
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to get the pixel history at: %v", p.Text())
+	}
+	history := boxedHistory.(*service.PixelHistory)
+
+	for _, e := range history.Entries {
+		cmd, err := getCommand(ctx, client, e.Command)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "%v %v\n", e.Command.Indices, cmd.Name)
+		fmt.Fprintf(os.Stdout, "    pre:  %v\n", pixelValueString(e.Pre))
+		fmt.Fprintf(os.Stdout, "    post: %v\n", pixelValueString(e.Post))
+		if e.TestsKnown {
+			fmt.Fprintf(os.Stdout, "    stencil test: %v, depth test: %v\n",
+				passOrFail(e.StencilPassed), passOrFail(e.DepthPassed))
+		} else {
+			fmt.Fprintln(os.Stdout, "    fragment tests: unknown")
+		}
+	}
+
+	if len(history.Entries) == 0 {
+		fmt.Fprintln(os.Stdout, "No draw calls wrote to the pixel")
+	}
+
+	return nil
+}
+
+func pixelValueString(v *service.PixelValue) string {
+	if v == nil {
+		return "unknown"
+	}
+	s := fmt.Sprintf("R:% 6f, G:% 6f, B:% 6f, A:% 6f", v.Red, v.Green, v.Blue, v.Alpha)
+	if v.HasDepth {
+		s += fmt.Sprintf(", D:% 6f", v.Depth)
+	}
+	return s
+}
+
+func passOrFail(passed bool) string {
+	if passed {
+		return "passed"
+	}
+	return "failed"
+}
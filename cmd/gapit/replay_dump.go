@@ -0,0 +1,201 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type replayDumpVerb struct{ ReplayDumpFlags }
+
+func init() {
+	verb := &replayDumpVerb{
+		ReplayDumpFlags{
+			At: flags.U64Slice{},
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "replay-dump",
+		ShortHelp: "Prints the disassembled replay payload built for a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+func (verb *replayDumpVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	device, err := getDevice(ctx, client, capture, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	var after *path.Command
+	if len(verb.At) > 0 {
+		after = capture.Command(verb.At[0], verb.At[1:]...)
+	}
+
+	boxedPayload, err := client.Get(ctx, capture.ReplayPayload(device, after).Path())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to build the replay payload")
+	}
+	payload := boxedPayload.(*service.ReplayPayload)
+
+	if verb.Save != "" {
+		if err := verb.save(ctx, client, payload); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open replay dump output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if !verb.Stats {
+		verb.writeDisassembly(w, payload)
+		fmt.Fprintln(w)
+	}
+	verb.writeStats(w, payload)
+	return nil
+}
+
+// save writes the encoded payload and the resources it uses to the file of
+// the Save flag, as a SavedPayload protobuf.
+func (verb *replayDumpVerb) save(ctx context.Context, client service.Service, payload *service.ReplayPayload) error {
+	boxedData, err := client.Get(ctx, payload.Data.Path())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get the encoded replay payload")
+	}
+	saved := &protocol.SavedPayload{
+		Abi:       payload.Abi.GetName(),
+		Payload:   boxedData.([]byte),
+		Resources: make([][]byte, len(payload.Resources)),
+	}
+	for i, r := range payload.Resources {
+		rID, err := id.Parse(r.Id)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to parse resource id: %v", r.Id)
+		}
+		boxedResource, err := client.Get(ctx, path.NewBlob(rID).Path())
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to get the replay resource %v", r.Id)
+		}
+		saved.Resources[i] = boxedResource.([]byte)
+	}
+	data, err := proto.Marshal(saved)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to encode the saved replay payload")
+	}
+	if err := ioutil.WriteFile(verb.Save, data, 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to save the replay payload to %v", verb.Save)
+	}
+	return nil
+}
+
+func (verb *replayDumpVerb) writeDisassembly(out io.Writer, payload *service.ReplayPayload) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	for _, i := range payload.Instructions {
+		if i.Opcode == "Label" {
+			fmt.Fprintf(w, "command %d:\n", i.Command)
+			continue
+		}
+		if i.Annotation != "" {
+			fmt.Fprintf(w, "    %s\t%s\t; %s\n", i.Opcode, i.Operands, i.Annotation)
+		} else {
+			fmt.Fprintf(w, "    %s\t%s\t\n", i.Opcode, i.Operands)
+		}
+	}
+}
+
+func (verb *replayDumpVerb) writeStats(out io.Writer, payload *service.ReplayPayload) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	defer w.Flush()
+
+	resources := uint64(0)
+	for _, r := range payload.Resources {
+		resources += uint64(r.Size)
+	}
+
+	fmt.Fprintf(w, "Section\tSize\t\n")
+	fmt.Fprintf(w, "Stack\t%d\t\n", payload.StackSize)
+	fmt.Fprintf(w, "Volatile memory\t%d\t\n", payload.VolatileMemorySize)
+	fmt.Fprintf(w, "Constant memory\t%d\t\n", payload.ConstantMemorySize)
+	fmt.Fprintf(w, "Opcodes\t%d\t\n", payload.OpcodesSize)
+	fmt.Fprintf(w, "Resources (%d)\t%d\t\n", len(payload.Resources), resources)
+	fmt.Fprintf(w, "\t\t\n")
+
+	counts := map[string]int{}
+	for _, i := range payload.Instructions {
+		counts[i.Opcode]++
+	}
+	opcodes := make([]string, 0, len(counts))
+	for op := range counts {
+		opcodes = append(opcodes, op)
+	}
+	sort.Slice(opcodes, func(i, j int) bool {
+		if counts[opcodes[i]] != counts[opcodes[j]] {
+			return counts[opcodes[i]] > counts[opcodes[j]]
+		}
+		return opcodes[i] < opcodes[j]
+	})
+
+	fmt.Fprintf(w, "Opcode\tCount\t\n")
+	for _, op := range opcodes {
+		fmt.Fprintf(w, "%s\t%d\t\n", op, counts[op])
+	}
+}
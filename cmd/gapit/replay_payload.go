@@ -0,0 +1,139 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/core/text"
+	"github.com/google/gapid/gapir/client"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/replay/executor"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+type replayPayloadVerb struct{ ReplayPayloadFlags }
+
+func init() {
+	verb := &replayPayloadVerb{}
+	verb.Gapir.Device = "host"
+	app.AddVerb(&app.Verb{
+		Name:      "replay-payload",
+		ShortHelp: "Replays a payload saved by replay-dump -save on a replay device",
+		Action:    verb,
+	})
+}
+
+func (verb *replayPayloadVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one saved replay payload file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to read the saved replay payload %v", flags.Arg(0))
+	}
+	saved := &protocol.SavedPayload{}
+	if err := proto.Unmarshal(data, saved); err != nil {
+		return log.Errf(ctx, err, "Failed to decode the saved replay payload %v", flags.Arg(0))
+	}
+	payload, err := protocol.DecodePayload(saved.Payload, protocol.MaxVersion, device.LittleEndian)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to decode the replay payload")
+	}
+	if len(saved.Resources) != len(payload.Resources) {
+		return log.Errf(ctx, nil, "The payload uses %d resources, but %d are saved",
+			len(payload.Resources), len(saved.Resources))
+	}
+
+	// The resources are served from the database, as gapis does. They are
+	// identified by the hash of their data, which is not the identifier of the
+	// resources built lazily by gapis.
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	for i, r := range payload.Resources {
+		if uint32(len(saved.Resources[i])) != r.Size {
+			return log.Errf(ctx, nil, "The saved replay resource %v has %d bytes instead of %d",
+				r.ID, len(saved.Resources[i]), r.Size)
+		}
+		rID, err := database.Store(ctx, saved.Resources[i])
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to store the replay resource %v", r.ID)
+		}
+		payload.Resources[i].ID = rID.String()
+	}
+
+	d, err := verb.device(ctx)
+	if err != nil {
+		return err
+	}
+	var abi *device.ABI
+	for _, a := range d.Instance().GetConfiguration().GetABIs() {
+		if a.Name == saved.Abi {
+			abi = a
+			break
+		}
+	}
+	if abi == nil {
+		return log.Errf(ctx, nil, "The device %v does not support the ABI %v of the payload",
+			d.Instance().GetName(), saved.Abi)
+	}
+
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	bind.GetRegistry(ctx).SetDeviceProperty(ctx, d, client.LaunchArgsKey, text.SplitArgs(verb.Gapir.Args))
+	connection, err := client.New(ctx).Connect(ctx, d, abi)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the replay device")
+	}
+	defer connection.Close()
+
+	postbacks := int64(0)
+	decoder := func(r io.Reader, err error) {
+		if r != nil {
+			postbacks, _ = io.Copy(ioutil.Discard, r)
+		}
+	}
+	if err := executor.Execute(ctx, payload, decoder, connection, connection.Version, abi.MemoryLayout); err != nil {
+		return log.Err(ctx, err, "Replay failed")
+	}
+	fmt.Printf("Replay done, %d bytes posted back\n", postbacks)
+	return nil
+}
+
+// device returns the replay device selected by the Device flag: the host, or
+// the Android device with a matching serial.
+func (verb *replayPayloadVerb) device(ctx context.Context) (bind.Device, error) {
+	pattern := verb.Gapir.Device
+	switch pattern {
+	case "host":
+		return bind.Host(ctx), nil
+	case "android":
+		pattern = ""
+	}
+	d, err := getADBDevice(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
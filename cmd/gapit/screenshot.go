@@ -101,6 +101,11 @@ func getSingleFrame(ctx context.Context, cmd *path.Command, device *path.Device,
 	if err != nil {
 		return nil, log.Errf(ctx, err, "GetFramebufferAttachment failed")
 	}
+	return getFrameImage(ctx, iip, client)
+}
+
+// getFrameImage returns the framebuffer image at iip, converted to RGBA.
+func getFrameImage(ctx context.Context, iip *path.ImageInfo, client service.Service) (*image.NRGBA, error) {
 	iio, err := client.Get(ctx, iip.Path())
 	if err != nil {
 		return nil, log.Errf(ctx, err, "Get frame image.Info failed")
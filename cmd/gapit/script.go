@@ -0,0 +1,116 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type scriptVerb struct{ ScriptFlags }
+
+func init() {
+	verb := &scriptVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "script",
+		ShortHelp: "Evaluates a script over the commands of a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+func (verb *scriptVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	args := 2
+	if verb.File != "" {
+		args = 1
+	}
+	if flags.NArg() != args {
+		app.Usage(ctx, "Expected a gfx trace file and a script, or a gfx trace file and the -file flag")
+		return nil
+	}
+
+	source := flags.Arg(1)
+	if verb.File != "" {
+		data, err := ioutil.ReadFile(verb.File)
+		if err != nil {
+			return log.Errf(ctx, err, "Reading script: %v", verb.File)
+		}
+		source = string(data)
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	result, err := client.Eval(ctx, capture, source)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to evaluate the script")
+	}
+
+	var w io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open script output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if verb.Json {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		if err := e.Encode(result); err != nil {
+			return log.Err(ctx, err, "marshal json")
+		}
+		return nil
+	}
+
+	verb.writeTable(w, result)
+	return nil
+}
+
+func (verb *scriptVerb) writeTable(out io.Writer, result *service.EvalResult) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Command\t%s\n", strings.Join(result.Columns, "\t"))
+	for _, r := range result.Rows {
+		fmt.Fprintf(w, "%d\t%s\n", r.Command, strings.Join(r.Values, "\t"))
+	}
+}
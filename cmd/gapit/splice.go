@@ -0,0 +1,110 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+type spliceVerb struct{ SpliceFlags }
+
+func init() {
+	verb := &spliceVerb{
+		SpliceFlags{
+			Out: "spliced.gfxtrace",
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "splice",
+		ShortHelp: "Splices command ranges of .gfxtrace files into a new .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+// rangeSuffix matches the optional command range of a capture argument:
+// ':first-last', ':first-' or ':index'.
+var rangeSuffix = regexp.MustCompile(`:(\d+)(-(\d*))?$`)
+
+func (verb *spliceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() < 1 {
+		app.Usage(ctx, "At least one gfx trace file expected, with an optional :first-last command range")
+		return nil
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	ranges := []*path.Commands{}
+	loaded := map[string]*path.Capture{}
+	for _, arg := range flags.Args() {
+		file, from, to := arg, uint64(0), uint64(math.MaxUint64)
+		if m := rangeSuffix.FindStringSubmatch(arg); m != nil {
+			file = arg[:len(arg)-len(m[0])]
+			from, _ = strconv.ParseUint(m[1], 10, 64)
+			switch {
+			case m[2] == "":
+				to = from
+			case m[3] != "":
+				to, _ = strconv.ParseUint(m[3], 10, 64)
+			}
+		}
+
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return log.Errf(ctx, err, "Finding file: %v", arg)
+		}
+		capture, ok := loaded[file]
+		if !ok {
+			capture, err = client.LoadCapture(ctx, file)
+			if err != nil {
+				return log.Errf(ctx, err, "LoadCapture(%v)", file)
+			}
+			loaded[file] = capture
+		}
+		ranges = append(ranges, &path.Commands{
+			Capture: capture,
+			From:    []uint64{from},
+			To:      []uint64{to},
+		})
+	}
+
+	spliced, err := client.SpliceCaptures(ctx, filepath.Base(verb.Out), ranges)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to splice the captures")
+	}
+
+	data, err := client.ExportCapture(ctx, spliced, service.CaptureFormat_PackFormat)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to export the spliced capture")
+	}
+	if err := ioutil.WriteFile(verb.Out, data, 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write %v", verb.Out)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type statsVerb struct{ StatsFlags }
+
+func init() {
+	verb := &statsVerb{
+		StatsFlags{
+			Commands: 20,
+		},
+	}
+	app.AddVerb(&app.Verb{
+		Name:      "stats",
+		ShortHelp: "Prints command statistics of a .gfxtrace file",
+		Action:    verb,
+	})
+}
+
+func (verb *statsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	filepath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Finding file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capture, err := client.LoadCapture(ctx, filepath)
+	if err != nil {
+		return log.Errf(ctx, err, "LoadCapture(%v)", filepath)
+	}
+
+	boxedStats, err := client.Get(ctx, capture.Stats().Path())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to get the capture statistics")
+	}
+	stats := boxedStats.(*service.CaptureStats)
+
+	var w io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open statistics output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if verb.Json {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		if err := e.Encode(stats); err != nil {
+			return log.Err(ctx, err, "marshal json")
+		}
+		return nil
+	}
+
+	verb.writeTables(w, stats)
+	return nil
+}
+
+func (verb *statsVerb) writeTables(out io.Writer, stats *service.CaptureStats) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	total := stats.Total
+	fmt.Fprintf(w, "Commands:\t%d\n", stats.NumCommands)
+	fmt.Fprintf(w, "Frames:\t%d\n", len(stats.Frames))
+	fmt.Fprintf(w, "Contexts:\t%d\n", stats.NumContexts)
+	fmt.Fprintf(w, "Threads:\t%d\n", stats.NumThreads)
+	fmt.Fprintf(w, "Draw calls:\t%d\n", total.DrawCalls)
+	fmt.Fprintf(w, "Triangles:\t%d\n", total.Triangles)
+	fmt.Fprintf(w, "Texture uploads:\t%d bytes\n", total.TextureUploadBytes)
+	fmt.Fprintf(w, "Buffer uploads:\t%d bytes\n", total.BufferUploadBytes)
+	fmt.Fprintf(w, "State changes:\t%d\n", total.StateChanges)
+	fmt.Fprintf(w, "Observations:\t%d (%d bytes read, %d bytes written)\n",
+		stats.NumObservations, stats.ObservedReadBytes, stats.ObservedWriteBytes)
+
+	commands := stats.Commands
+	if verb.Commands > 0 && len(commands) > verb.Commands {
+		commands = commands[:verb.Commands]
+	}
+	fmt.Fprintf(w, "\nCount\tAPI\tCommand\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "%d\t%v\t%v\n", c.Count, c.ApiName, c.Name)
+	}
+	if len(commands) < len(stats.Commands) {
+		fmt.Fprintf(w, "...\t\t%d more\n", len(stats.Commands)-len(commands))
+	}
+
+	if verb.Frames {
+		fmt.Fprintf(w, "\nFrame\tCommands\tDraw calls\tTriangles\tTexture bytes\tBuffer bytes\tState changes\n")
+		for i, f := range stats.Frames {
+			fmt.Fprintf(w, "%d\t[%d, %d]\t%d\t%d\t%d\t%d\t%d\n", i, f.FirstCommand, f.LastCommand,
+				f.DrawCalls, f.Triangles, f.TextureUploadBytes, f.BufferUploadBytes, f.StateChanges)
+		}
+	}
+}
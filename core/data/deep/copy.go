@@ -21,11 +21,17 @@ import (
 	"github.com/google/gapid/core/data"
 )
 
+// pointer identifies a source pointer that has already been copied.
+type pointer struct {
+	ty   reflect.Type
+	addr uintptr
+}
+
 // Clone makes a deep copy of v.
 func Clone(v interface{}) (interface{}, error) {
 	s := reflect.ValueOf(v)
 	d := reflect.New(s.Type())
-	if err := reflectCopy(d.Elem(), s, "val", map[reflect.Value]reflect.Value{}); err != nil {
+	if err := reflectCopy(d.Elem(), s, "val", map[pointer]reflect.Value{}); err != nil {
 		return nil, err
 	}
 	return d.Elem().Interface(), nil
@@ -38,10 +44,10 @@ func Copy(dst, src interface{}) error {
 	if d.Kind() != reflect.Ptr {
 		return fmt.Errorf("dst should be a pointer, got %T", dst)
 	}
-	return reflectCopy(d.Elem(), s, "val", map[reflect.Value]reflect.Value{})
+	return reflectCopy(d.Elem(), s, "val", map[pointer]reflect.Value{})
 }
 
-func reflectCopy(d, s reflect.Value, path string, seen map[reflect.Value]reflect.Value) error {
+func reflectCopy(d, s reflect.Value, path string, seen map[pointer]reflect.Value) error {
 	//	fmt.Printf("%v: d:%v (%v), s:%v (%v) %+v\n", path, d.Type(), d.Kind(), s.Type(), s.Kind(), s.Interface())
 	if !d.CanSet() {
 		return fmt.Errorf("Cannot assign to %v", path)
@@ -111,12 +117,16 @@ func reflectCopy(d, s reflect.Value, path string, seen map[reflect.Value]reflect
 			d.Set(reflect.New(d.Type()).Elem()) // Assign nil
 			return nil
 		}
-		d.Set(reflect.New(d.Type().Elem())) // Assign new(T)
-		if s, cyclic := seen[s]; cyclic {
-			d.Elem().Set(s.Elem())
+		key := pointer{s.Type(), s.Pointer()}
+		if c, cyclic := seen[key]; cyclic && c.Type() == d.Type() {
+			// Already copied. Reuse the copy so that the aliasing of the
+			// source pointers is preserved.
+			d.Set(c)
 			return nil
 		}
-		seen[s] = d
+		c := reflect.New(d.Type().Elem()) // new(T)
+		d.Set(c)
+		seen[key] = c
 		return reflectCopy(d.Elem(), s.Elem(), path, seen)
 	default:
 		v := s.Convert(d.Type())
@@ -102,3 +102,24 @@ func TestCopy(t *testing.T) {
 		}
 	}
 }
+
+func TestCloneAliasing(t *testing.T) {
+	ctx := log.Testing(t)
+	type Object struct{ V int }
+	type Holder struct {
+		A, B *Object
+		M    map[int]*Object
+	}
+	shared := &Object{V: 1}
+	src := &Holder{A: shared, B: shared, M: map[int]*Object{1: shared}}
+
+	v, err := deep.Clone(src)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	dst := v.(*Holder)
+	assert.For(ctx, "res").That(dst).DeepEquals(src)
+	assert.For(ctx, "copied").That(dst.A != shared).Equals(true)
+	assert.For(ctx, "B aliases A").That(dst.B == dst.A).Equals(true)
+	assert.For(ctx, "M aliases A").That(dst.M[1] == dst.A).Equals(true)
+}
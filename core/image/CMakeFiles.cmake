@@ -23,6 +23,8 @@ set(files
     convert.go
     convertable.go
     decompress_test.go
+    difference.go
+    difference_test.go
     doc.go
     etc1.go
     etc2.go
@@ -41,6 +43,8 @@ set(files
     s3_dxt1_rgba.go
     s3_dxt3_rgba.go
     s3_dxt5_rgba.go
+    stats.go
+    stats_test.go
     thumbnailer.go
     uncompressed.go
 )
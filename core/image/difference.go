@@ -0,0 +1,107 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
+// DifferenceThreshold is the smallest difference of a channel that makes two
+// pixels different. It is below the precision of 8-bit channels, but ignores
+// the rounding errors of the conversions to floats.
+const DifferenceThreshold = 1.0 / 512
+
+// DifferenceMetrics holds the metrics of the difference between two images.
+type DifferenceMetrics struct {
+	// MeanSquareError is the mean of the squared differences of the channels,
+	// leaving out the infinite differences.
+	MeanSquareError float64
+	// MaxDifference is the largest difference of a channel. It is infinite if
+	// a channel is NaN or infinite in only one of the images, or infinite with
+	// a different sign in each.
+	MaxDifference float64
+	// DifferentPixels is the number of pixels with a channel that differs by
+	// more than DifferenceThreshold.
+	DifferentPixels uint64
+	// Pixels is the total number of pixels.
+	Pixels uint64
+}
+
+// ComputeDifferenceMetrics returns the metrics of the difference between the
+// two images a and b. The images are compared as for Difference, once
+// converted to F32 channels, so normalized channels are in the range [0, 1].
+// Two NaN channels are considered equal.
+// An error is returned if the images do not have the same dimensions, or if
+// their data does not match their dimensions.
+func ComputeDifferenceMetrics(a, b *Data) (*DifferenceMetrics, error) {
+	if a.Depth != b.Depth {
+		return nil, fmt.Errorf("Image dimensions are not identical. %dx%dx%d vs %dx%dx%d",
+			a.Width, a.Height, a.Depth, b.Width, b.Height, b.Depth)
+	}
+	for _, i := range []*Data{a, b} {
+		if err := i.Format.Check(i.Bytes, int(i.Width), int(i.Height), int(i.Depth)); err != nil {
+			return nil, err
+		}
+	}
+	a, b, channels, err := toCommonF32(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	p := endian.Reader(bytes.NewReader(a.Bytes), device.LittleEndian)
+	q := endian.Reader(bytes.NewReader(b.Bytes), device.LittleEndian)
+	out := &DifferenceMetrics{Pixels: uint64(a.Width) * uint64(a.Height) * uint64(a.Depth)}
+	sqrErr, finite := 0.0, 0
+	for i := uint64(0); i < out.Pixels; i++ {
+		different := false
+		for c := 0; c < channels; c++ {
+			d := channelDifference(float64(p.Float32()), float64(q.Float32()))
+			if !math.IsInf(d, 0) {
+				sqrErr += d * d
+				finite++
+			}
+			out.MaxDifference = math.Max(out.MaxDifference, d)
+			if d > DifferenceThreshold {
+				different = true
+			}
+		}
+		if different {
+			out.DifferentPixels++
+		}
+	}
+	if finite > 0 {
+		out.MeanSquareError = sqrErr / float64(finite)
+	}
+	return out, nil
+}
+
+// channelDifference returns the absolute difference between the channels x
+// and y, which is 0 if both are NaN, and infinite if only one of them is NaN
+// or infinite.
+func channelDifference(x, y float64) float64 {
+	switch {
+	case math.IsNaN(x) && math.IsNaN(y), x == y:
+		return 0
+	case math.IsNaN(x), math.IsNaN(y):
+		return math.Inf(1)
+	default:
+		return math.Abs(x - y)
+	}
+}
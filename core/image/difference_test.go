@@ -0,0 +1,136 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/os/device"
+)
+
+// rgbaF32 returns a RGBA_F32 image of the given size holding the pixels.
+func rgbaF32(w, h uint32, pixels ...float32) *image.Data {
+	buf := &bytes.Buffer{}
+	e := endian.Writer(buf, device.LittleEndian)
+	for _, f := range pixels {
+		e.Float32(f)
+	}
+	return &image.Data{Width: w, Height: h, Depth: 1, Bytes: buf.Bytes(), Format: image.RGBA_F32}
+}
+
+func TestComputeDifferenceMetrics(t *testing.T) {
+	assert := assert.To(t)
+
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	for _, test := range []struct {
+		name     string
+		a, b     *image.Data
+		expected image.DifferenceMetrics
+	}{
+		{
+			name:     "identical",
+			a:        rgbaF32(2, 1, 0, 0.5, 1, 1, 0.25, 0.25, 0.25, 1),
+			b:        rgbaF32(2, 1, 0, 0.5, 1, 1, 0.25, 0.25, 0.25, 1),
+			expected: image.DifferenceMetrics{Pixels: 2},
+		}, {
+			name: "one channel",
+			a:    rgbaF32(2, 1, 0, 0, 0, 1, 0, 0, 0, 1),
+			b:    rgbaF32(2, 1, 0, 0, 0.5, 1, 0, 0, 0, 1),
+			expected: image.DifferenceMetrics{
+				MeanSquareError: 0.25 / 8,
+				MaxDifference:   0.5,
+				DifferentPixels: 1,
+				Pixels:          2,
+			},
+		}, {
+			name: "below threshold",
+			a:    rgbaF32(1, 1, 0, 0, 0, 1),
+			b:    rgbaF32(1, 1, 0, 0, 0.0009765625, 1),
+			expected: image.DifferenceMetrics{
+				MeanSquareError: 0.0009765625 * 0.0009765625 / 4,
+				MaxDifference:   0.0009765625,
+				Pixels:          1,
+			},
+		}, {
+			name:     "both NaN",
+			a:        rgbaF32(1, 1, nan, 0, 0, 1),
+			b:        rgbaF32(1, 1, nan, 0, 0, 1),
+			expected: image.DifferenceMetrics{Pixels: 1},
+		}, {
+			name: "one NaN",
+			a:    rgbaF32(2, 1, nan, 0, 0, 1, 0, 0, 0, 1),
+			b:    rgbaF32(2, 1, 0, 0, 0, 1, 0, 0, 0.5, 1),
+			expected: image.DifferenceMetrics{
+				MeanSquareError: 0.25 / 7,
+				MaxDifference:   math.Inf(1),
+				DifferentPixels: 2,
+				Pixels:          2,
+			},
+		}, {
+			name:     "same infinity",
+			a:        rgbaF32(1, 1, inf, 0, 0, 1),
+			b:        rgbaF32(1, 1, inf, 0, 0, 1),
+			expected: image.DifferenceMetrics{Pixels: 1},
+		}, {
+			name: "opposite infinities",
+			a:    rgbaF32(1, 1, inf, 0, 0, 1),
+			b:    rgbaF32(1, 1, -inf, 0, 0, 1),
+			expected: image.DifferenceMetrics{
+				MaxDifference:   math.Inf(1),
+				DifferentPixels: 1,
+				Pixels:          1,
+			},
+		}, {
+			name: "normalized",
+			a:    &image.Data{Width: 1, Height: 1, Depth: 1, Bytes: []byte{0xff, 0, 0, 0xff}, Format: image.RGBA_U8_NORM},
+			b:    &image.Data{Width: 1, Height: 1, Depth: 1, Bytes: []byte{0, 0, 0, 0xff}, Format: image.RGBA_U8_NORM},
+			expected: image.DifferenceMetrics{
+				MeanSquareError: 0.25,
+				MaxDifference:   1,
+				DifferentPixels: 1,
+				Pixels:          1,
+			},
+		},
+	} {
+		got, err := image.ComputeDifferenceMetrics(test.a, test.b)
+		if !assert.For("%v err", test.name).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For("%v", test.name).That(*got).Equals(test.expected)
+	}
+}
+
+func TestComputeDifferenceMetricsSizeMismatch(t *testing.T) {
+	assert := assert.To(t)
+
+	a := rgbaF32(2, 1, 0, 0, 0, 1, 0, 0, 0, 1)
+	for _, test := range []struct {
+		name string
+		b    *image.Data
+	}{
+		{"width", rgbaF32(1, 1, 0, 0, 0, 1)},
+		{"height", rgbaF32(1, 2, 0, 0, 0, 1, 0, 0, 0, 1)},
+		{"depth", &image.Data{Width: 2, Height: 1, Depth: 2, Bytes: make([]byte, 32), Format: image.RGBA_F32}},
+		{"data", &image.Data{Width: 2, Height: 1, Depth: 1, Bytes: make([]byte, 16), Format: image.RGBA_F32}},
+	} {
+		_, err := image.ComputeDifferenceMetrics(a, test.b)
+		assert.For("%v", test.name).ThatError(err).Failed()
+	}
+}
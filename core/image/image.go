@@ -94,8 +94,27 @@ func (b *Data) Convert(to *Format) (*Data, error) {
 // Only channels that are found in both in a and b are compared. However, if
 // there are no common channels then an error is returned.
 func Difference(a, b *Data) (float32, error) {
+	a, b, channels, err := toCommonF32(a, b)
+	if err != nil {
+		return 1, err
+	}
+
+	p := endian.Reader(bytes.NewReader(a.Bytes), device.LittleEndian)
+	q := endian.Reader(bytes.NewReader(b.Bytes), device.LittleEndian)
+	sqrErr := float32(0)
+	c := a.Width * a.Height * uint32(channels)
+	for i := uint32(0); i < c; i++ {
+		err := p.Float32() - q.Float32()
+		sqrErr += err * err
+	}
+	return sqrErr / float32(c), nil
+}
+
+// toCommonF32 returns a and b converted to a format holding the channels
+// found in both a and b as F32, and the number of these channels.
+func toCommonF32(a, b *Data) (*Data, *Data, int, error) {
 	if a.Width != b.Width || a.Height != b.Height {
-		return 1, fmt.Errorf("Image dimensions are not identical. %dx%d vs %dx%d",
+		return nil, nil, 0, fmt.Errorf("Image dimensions are not identical. %dx%d vs %dx%d",
 			a.Width, a.Height, b.Width, b.Height)
 	}
 
@@ -113,7 +132,7 @@ func Difference(a, b *Data) (float32, error) {
 	}
 
 	if len(channels) == 0 {
-		return 1, fmt.Errorf("No common channels between %v and %v",
+		return nil, nil, 0, fmt.Errorf("No common channels between %v and %v",
 			aChannels, bChannels)
 	}
 
@@ -133,20 +152,11 @@ func Difference(a, b *Data) (float32, error) {
 	uncompressed := newUncompressed(streamFmt)
 	a, err := a.Convert(uncompressed)
 	if err != nil {
-		return 1, err
+		return nil, nil, 0, err
 	}
 	b, err = b.Convert(uncompressed)
 	if err != nil {
-		return 1, err
-	}
-
-	p := endian.Reader(bytes.NewReader(a.Bytes), device.LittleEndian)
-	q := endian.Reader(bytes.NewReader(b.Bytes), device.LittleEndian)
-	sqrErr := float32(0)
-	c := a.Width * a.Height * uint32(len(channels))
-	for i := uint32(0); i < c; i++ {
-		err := p.Float32() - q.Float32()
-		sqrErr += err * err
+		return nil, nil, 0, err
 	}
-	return sqrErr / float32(c), nil
+	return a, b, len(channels), nil
 }
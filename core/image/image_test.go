@@ -26,6 +26,7 @@ import (
 var (
 	_ = database.Resolvable((*image.ConvertResolvable)(nil))
 	_ = database.Resolvable((*image.ResizeResolvable)(nil))
+	_ = database.Resolvable((*image.StatsResolvable)(nil))
 )
 
 func TestDifference(t *testing.T) {
@@ -0,0 +1,210 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/stream"
+	"github.com/google/gapid/gapis/database"
+)
+
+const (
+	// DefaultHistogramBins is the number of histogram buckets used when none
+	// are specified.
+	DefaultHistogramBins = 256
+	// DefaultLowPercentile is the default lower percentile of the auto-range.
+	DefaultLowPercentile = 1.0
+	// DefaultHighPercentile is the default upper percentile of the auto-range.
+	DefaultHighPercentile = 99.0
+)
+
+// Stats returns the per-channel statistics of the image.
+// bins is the number of histogram buckets, and low and high are the
+// percentiles in the range [0, 100] used to calculate the auto-range.
+func (i *Info) Stats(ctx context.Context, bins uint32, low, high float64) (*Stats, error) {
+	obj, err := database.Build(ctx, &StatsResolvable{
+		Bytes:          i.Bytes,
+		Format:         i.Format,
+		Width:          i.Width,
+		Height:         i.Height,
+		Depth:          i.Depth,
+		HistogramBins:  bins,
+		LowPercentile:  low,
+		HighPercentile: high,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to calculate the image statistics: %v", err)
+	}
+	return obj.(*Stats), nil
+}
+
+// Resolve returns the Stats for the StatsResolvable request.
+func (r *StatsResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	boxedBytes, err := database.Resolve(ctx, r.Bytes.ID())
+	if err != nil {
+		return nil, err
+	}
+	return ComputeStats(boxedBytes.([]byte),
+		int(r.Width), int(r.Height), int(r.Depth), r.Format,
+		int(r.HistogramBins), r.LowPercentile, r.HighPercentile)
+}
+
+// ComputeStats returns the per-channel statistics of the image formed from
+// data, width, height and depth in the format f.
+// Compressed formats are first decompressed to RGBA_U8_NORM.
+// If bins is 0, then DefaultHistogramBins buckets are used. If both low and
+// high are 0, then DefaultLowPercentile and DefaultHighPercentile are used.
+func ComputeStats(data []byte, width, height, depth int, f *Format, bins int, low, high float64) (*Stats, error) {
+	if bins <= 0 {
+		bins = DefaultHistogramBins
+	}
+	if low == 0 && high == 0 {
+		low, high = DefaultLowPercentile, DefaultHighPercentile
+	}
+	if low < 0 || high > 100 || low > high {
+		return nil, fmt.Errorf("Invalid percentile range [%v, %v]", low, high)
+	}
+
+	src := f
+	if src.GetUncompressed() == nil {
+		// Decompress to something that stream can read.
+		var err error
+		if data, err = Convert(data, width, height, depth, src, RGBA_U8_NORM); err != nil {
+			return nil, err
+		}
+		src = RGBA_U8_NORM
+	}
+	if err := src.Check(data, width, height, depth); err != nil {
+		return nil, err
+	}
+
+	// Read each channel out as a F32, in the order of the source format.
+	srcFmt := src.GetUncompressed().Format
+	dstFmt := &stream.Format{}
+	for _, c := range srcFmt.Components {
+		if c.Channel == stream.Channel_SharedExponent {
+			continue // Shared exponents are applied to the other channels.
+		}
+		dstFmt.Components = append(dstFmt.Components, &stream.Component{
+			DataType: &stream.F32,
+			Sampling: stream.Linear,
+			Channel:  c.Channel,
+		})
+	}
+	if len(dstFmt.Components) == 0 {
+		return nil, fmt.Errorf("Format %v has no channels", f)
+	}
+
+	floats, err := stream.Convert(dstFmt, srcFmt, data)
+	if err != nil {
+		return nil, err
+	}
+
+	numChannels := len(dstFmt.Components)
+	count := width * height * depth
+	values := make([][]float32, numChannels)
+	for i := range values {
+		values[i] = make([]float32, count)
+	}
+	r := endian.Reader(bytes.NewReader(floats), device.LittleEndian)
+	for i := 0; i < count; i++ {
+		for c := range values {
+			values[c][i] = r.Float32()
+		}
+	}
+
+	out := &Stats{Channels: make([]*ChannelStats, numChannels)}
+	for i, c := range dstFmt.Components {
+		out.Channels[i] = channelStats(c.Channel, values[i], bins, low, high)
+	}
+	return out, nil
+}
+
+func channelStats(channel stream.Channel, values []float32, bins int, low, high float64) *ChannelStats {
+	out := &ChannelStats{
+		Channel:   channel,
+		Min:       math.Inf(1),
+		Max:       math.Inf(-1),
+		Histogram: make([]uint64, bins),
+	}
+
+	sum := 0.0
+	for _, f := range values {
+		v := float64(f)
+		switch {
+		case math.IsNaN(v):
+			out.NanCount++
+		case math.IsInf(v, 1):
+			out.PosInfCount++
+		case math.IsInf(v, -1):
+			out.NegInfCount++
+		default:
+			out.Count++
+			sum += v
+			out.Min = math.Min(out.Min, v)
+			out.Max = math.Max(out.Max, v)
+		}
+	}
+
+	if out.Count == 0 {
+		out.Min, out.Max = 0, 0
+		return out
+	}
+	out.Mean = sum / float64(out.Count)
+
+	// Build the histogram over [min, max].
+	span := out.Max - out.Min
+	bucket := func(v float64) int {
+		if span == 0 {
+			return 0
+		}
+		b := int((v - out.Min) / span * float64(bins))
+		if b >= bins {
+			b = bins - 1 // v == max
+		}
+		return b
+	}
+	for _, f := range values {
+		if v := float64(f); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			out.Histogram[bucket(v)]++
+		}
+	}
+
+	// Use the cumulative histogram to find the auto-range.
+	lowCount := uint64(math.Ceil(float64(out.Count) * low / 100))
+	highCount := uint64(math.Ceil(float64(out.Count) * high / 100))
+	bucketMin := func(b int) float64 { return out.Min + span*float64(b)/float64(bins) }
+	out.AutoRangeMin, out.AutoRangeMax = out.Min, out.Max
+	lowFound := false
+	cumulative := uint64(0)
+	for b, n := range out.Histogram {
+		cumulative += n
+		if !lowFound && cumulative > 0 && cumulative >= lowCount {
+			out.AutoRangeMin = bucketMin(b)
+			lowFound = true
+		}
+		if cumulative >= highCount {
+			out.AutoRangeMax = bucketMin(b + 1)
+			break
+		}
+	}
+	return out
+}
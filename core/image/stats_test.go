@@ -0,0 +1,97 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/stream"
+)
+
+func TestComputeStats(t *testing.T) {
+	assert := assert.To(t)
+
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	pixels := []float32{
+		/* R   G    B    A */
+		0.0, 1.0, nan, 1,
+		1.0, 2.0, inf, 1,
+		2.0, 3.0, 0.5, 1,
+		3.0, 4.0, nan, 1,
+	}
+	buf := &bytes.Buffer{}
+	w := endian.Writer(buf, device.LittleEndian)
+	for _, f := range pixels {
+		w.Float32(f)
+	}
+
+	stats, err := image.ComputeStats(buf.Bytes(), 2, 2, 1, image.RGBA_F32, 4, 0, 0)
+	if !assert.For("err").ThatError(err).Succeeded() {
+		return
+	}
+	if !assert.For("channels").ThatInteger(len(stats.Channels)).Equals(4) {
+		return
+	}
+
+	r, g, b, a := stats.Channels[0], stats.Channels[1], stats.Channels[2], stats.Channels[3]
+
+	assert.For("r.Channel").That(r.Channel).Equals(stream.Channel_Red)
+	assert.For("r.Count").That(r.Count).Equals(uint64(4))
+	assert.For("r.Min").ThatFloat(r.Min).Equals(0, 0)
+	assert.For("r.Max").ThatFloat(r.Max).Equals(3, 0)
+	assert.For("r.Mean").ThatFloat(r.Mean).Equals(1.5, 0)
+	assert.For("r.Histogram").ThatSlice(r.Histogram).Equals([]uint64{1, 1, 1, 1})
+
+	assert.For("g.Mean").ThatFloat(g.Mean).Equals(2.5, 0)
+
+	assert.For("b.Count").That(b.Count).Equals(uint64(1))
+	assert.For("b.NanCount").That(b.NanCount).Equals(uint64(2))
+	assert.For("b.PosInfCount").That(b.PosInfCount).Equals(uint64(1))
+	assert.For("b.Min").ThatFloat(b.Min).Equals(0.5, 0)
+	assert.For("b.Max").ThatFloat(b.Max).Equals(0.5, 0)
+	assert.For("b.Histogram").ThatSlice(b.Histogram).Equals([]uint64{1, 0, 0, 0})
+
+	assert.For("a.AutoRangeMin").ThatFloat(a.AutoRangeMin).Equals(1, 0)
+	assert.For("a.AutoRangeMax").ThatFloat(a.AutoRangeMax).Equals(1, 0)
+}
+
+func TestComputeStatsAutoRange(t *testing.T) {
+	assert := assert.To(t)
+
+	// 100 values: 98 in [0, 1), and two outliers.
+	data := make([]byte, 100*2)
+	for i := 0; i < 98; i++ {
+		v := uint16(i * 0xffff / 1000)
+		data[i*2+0], data[i*2+1] = byte(v), byte(v>>8)
+	}
+	data[98*2+0], data[98*2+1] = 0xff, 0xff
+	data[99*2+0], data[99*2+1] = 0xff, 0xff
+
+	stats, err := image.ComputeStats(data, 10, 10, 1, image.R_U16_NORM, 100, 0, 95)
+	if !assert.For("err").ThatError(err).Succeeded() {
+		return
+	}
+	r := stats.Channels[0]
+	assert.For("r.Min").ThatFloat(r.Min).Equals(0, 0)
+	assert.For("r.Max").ThatFloat(r.Max).Equals(1, 0)
+	assert.For("r.AutoRangeMin").ThatFloat(r.AutoRangeMin).Equals(0, 0)
+	assert.For("r.AutoRangeMax").ThatFloat(r.AutoRangeMax).Equals(0.1, 0.001)
+}
@@ -31,6 +31,7 @@ var (
 	R_S16_NORM   = newUncompressed(fmts.R_S16_NORM)
 	RG_S16_NORM  = newUncompressed(fmts.RG_S16_NORM)
 	D_U16_NORM   = newUncompressed(fmts.D_U16_NORM)
+	D_F32        = newUncompressed(fmts.D_F32)
 )
 
 // newUncompressed returns a new uncompressed format containing with the default
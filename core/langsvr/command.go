@@ -28,7 +28,7 @@ type Command struct {
 	Command string
 
 	// Arguments that the command handler should be invoked with.
-	Arguments map[string]interface{}
+	Arguments []interface{}
 }
 
 func (c Command) toProtocol() protocol.Command {
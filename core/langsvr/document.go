@@ -49,6 +49,18 @@ func (s *langsvr) newDocument(uri string, language string, version int, body Bod
 	return d
 }
 
+// NewDocument returns a new document for the file at path that is not
+// managed by a language server connection. Diagnostics set on the document
+// are discarded. NewDocument is intended for testing Server implementations.
+func NewDocument(path string, language string, body Body) *Document {
+	return &Document{
+		uri:      PathToURI(path),
+		path:     path,
+		language: language,
+		body:     body,
+	}
+}
+
 // URI returns the document's URI.
 func (d Document) URI() string { return d.uri }
 
@@ -70,5 +82,8 @@ func (d *Document) SetDiagnostics(diagnostics Diagnostics) {
 	for i, d := range diagnostics {
 		diag[i] = d.toProtocol()
 	}
+	if d.server == nil {
+		return
+	}
 	d.server.conn.PublishDiagnostics(d.uri, diag)
 }
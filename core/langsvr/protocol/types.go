@@ -107,7 +107,7 @@ type Command struct {
 
 	// Arguments that the command handler should be
 	// invoked with.
-	Arguments map[string]interface{} `json:"arguments"`
+	Arguments []interface{} `json:"arguments,omitempty"`
 }
 
 // TextEdit is a textual edit applicable to a text document.
@@ -23,9 +23,11 @@ set(files
 set(dirs
     analysis
     ast
+    docgen
     format
     fuzz
     langsvr
+    lint
     parser
     resolver
     semantic
@@ -0,0 +1,317 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package docgen builds reference documentation for a resolved API.
+//
+// The documentation is gathered from the doc comments attached to the semantic
+// nodes by the resolver, the annotations, and the constant sets found by the
+// static analysis of the command parameters.
+package docgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gapid/gapil/analysis"
+	"github.com/google/gapid/gapil/resolver"
+	"github.com/google/gapid/gapil/semantic"
+	"github.com/google/gapid/gapil/semantic/printer"
+)
+
+const annoDoc = "doc"
+
+// Page identifies one of the pages of the reference.
+type Page string
+
+// The pages of the reference.
+const (
+	Index       = Page("index")
+	Commands    = Page("commands")
+	Classes     = Page("classes")
+	Enums       = Page("enums")
+	Types       = Page("types")
+	Definitions = Page("definitions")
+)
+
+// Reference holds the documentation for an entire API.
+type Reference struct {
+	Name        string    // The name of the API.
+	Commands    []*Entity // The commands, sorted by name.
+	Classes     []*Entity // The classes, sorted by name.
+	Enums       []*Entity // The enums and bitfields, sorted by name.
+	Types       []*Entity // The pseudonyms, sorted by name.
+	Definitions []*Entity // The definitions, sorted by name.
+}
+
+// Entity is a single documented declaration.
+type Entity struct {
+	Name        string    // The declared name.
+	Page        Page      // The page holding the entity.
+	Kind        string    // The kind of declaration, such as "cmd" or "class".
+	Docs        []string  // The documentation lines.
+	Annotations []string  // The annotations, as they appear in the source.
+	Location    string    // The file position of the declaration.
+	SeeAlso     []string  // The URLs of the external documentation.
+	Returns     *Link     // The return type of a command.
+	To          *Link     // The underlying type of a pseudonym.
+	Value       string    // The value of a definition.
+	Members     []*Member // The parameters, fields, entries or labels.
+}
+
+// Anchor returns the identifier of the entity within its page.
+func (e *Entity) Anchor() string { return e.Name }
+
+// MembersTitle returns the heading used for the entity's members.
+func (e *Entity) MembersTitle() string {
+	switch e.Page {
+	case Commands:
+		return "Parameters"
+	case Classes:
+		return "Fields"
+	case Enums:
+		return "Entries"
+	default:
+		return "Labels"
+	}
+}
+
+// Member is a parameter, field, enum entry or label of an Entity.
+type Member struct {
+	Name        string   // The member's name.
+	Type        *Link    // The member's type, if typed.
+	Value       string   // The member's value, if constant.
+	Docs        []string // The documentation lines.
+	Annotations []string // The annotations, as they appear in the source.
+	Values      []string // The constants accepted by a command parameter.
+}
+
+// Link is a reference to a type, linked to the type's entity if it has one.
+type Link struct {
+	Text   string // The type as it appears in the source.
+	Page   Page   // The page holding the type's entity, or empty.
+	Anchor string // The anchor of the type's entity.
+}
+
+// Build returns the reference documentation for the api.
+func Build(api *semantic.API, mappings *resolver.Mappings) *Reference {
+	b := builder{
+		mappings: mappings,
+		analysis: analysis.Analyze(api, mappings),
+		pages:    map[semantic.Type]Page{},
+	}
+	for _, c := range api.Classes {
+		b.pages[c] = Classes
+	}
+	for _, e := range api.Enums {
+		b.pages[e] = Enums
+	}
+	for _, p := range api.Pseudonyms {
+		b.pages[p] = Types
+	}
+
+	out := &Reference{Name: api.Name()}
+	for _, f := range api.Functions {
+		out.Commands = append(out.Commands, b.command(f))
+	}
+	for _, c := range api.Classes {
+		out.Classes = append(out.Classes, b.class(c))
+	}
+	for _, e := range api.Enums {
+		out.Enums = append(out.Enums, b.enum(e))
+	}
+	for _, p := range api.Pseudonyms {
+		out.Types = append(out.Types, b.pseudonym(p))
+	}
+	for _, d := range api.Definitions {
+		out.Definitions = append(out.Definitions, b.definition(d))
+	}
+	for _, l := range [][]*Entity{out.Commands, out.Classes, out.Enums, out.Types, out.Definitions} {
+		sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	}
+	return out
+}
+
+type builder struct {
+	mappings *resolver.Mappings
+	analysis *analysis.Results
+	pages    map[semantic.Type]Page
+}
+
+func (b *builder) entity(n semantic.Node, name string, page Page, kind string, docs semantic.Documentation, annos semantic.Annotations) *Entity {
+	out := &Entity{
+		Name:     name,
+		Page:     page,
+		Kind:     kind,
+		Docs:     docs,
+		Location: b.location(n),
+	}
+	// @doc annotations link to the external documentation. List them
+	// separately to the other annotations.
+	other := semantic.Annotations{}
+	for _, a := range annos {
+		if a.Name() == annoDoc && len(a.Arguments) > 0 {
+			if url, ok := a.Arguments[0].(semantic.StringValue); ok {
+				out.SeeAlso = append(out.SeeAlso, string(url))
+				continue
+			}
+		}
+		other = append(other, a)
+	}
+	out.Annotations = annotations(other)
+	return out
+}
+
+func (b *builder) command(f *semantic.Function) *Entity {
+	out := b.entity(f, f.Name(), Commands, "cmd", f.Docs, f.Annotations)
+	if f.Return != nil && f.Return.Type != semantic.VoidType {
+		out.Returns = b.link(f.Return.Type)
+	}
+	for _, p := range f.CallParameters() {
+		out.Members = append(out.Members, &Member{
+			Name:        p.Name(),
+			Type:        b.link(p.Type),
+			Docs:        p.Docs,
+			Annotations: annotations(p.Annotations),
+			Values:      b.constantSet(p),
+		})
+	}
+	return out
+}
+
+func (b *builder) class(c *semantic.Class) *Entity {
+	out := b.entity(c, c.Name(), Classes, "class", c.Docs, c.Annotations)
+	for _, f := range c.Fields {
+		m := &Member{
+			Name:        f.Name(),
+			Type:        b.link(f.Type),
+			Docs:        f.Docs,
+			Annotations: annotations(f.Annotations),
+		}
+		if f.Default != nil {
+			m.Value = expression(f.Default)
+		}
+		out.Members = append(out.Members, m)
+	}
+	return out
+}
+
+func (b *builder) enum(e *semantic.Enum) *Entity {
+	kind := "enum"
+	if e.IsBitfield {
+		kind = "bitfield"
+	}
+	out := b.entity(e, e.Name(), Enums, kind, e.Docs, e.Annotations)
+	for _, entry := range e.Entries {
+		out.Members = append(out.Members, &Member{
+			Name:  entry.Name(),
+			Value: fmt.Sprintf("0x%X", entry.Value),
+			Docs:  entry.Docs,
+		})
+	}
+	return out
+}
+
+func (b *builder) pseudonym(p *semantic.Pseudonym) *Entity {
+	out := b.entity(p, p.Name(), Types, "type", p.Docs, p.Annotations)
+	out.To = b.link(p.To)
+	for _, l := range p.Labels() {
+		out.Members = append(out.Members, &Member{
+			Name:        l.Name(),
+			Value:       expression(l.Value),
+			Docs:        l.Docs,
+			Annotations: annotations(l.Annotations),
+		})
+	}
+	return out
+}
+
+func (b *builder) definition(d *semantic.Definition) *Entity {
+	out := b.entity(d, d.Name(), Definitions, "define", d.Docs, d.Annotations)
+	out.Value = expression(d.Expression)
+	return out
+}
+
+// link returns the Link for the type ty. Pointers, slices, references and
+// static arrays are linked to their element type.
+func (b *builder) link(ty semantic.Type) *Link {
+	out := &Link{Text: printer.New().WriteType(ty).String()}
+	for target := ty; target != nil; {
+		if page, ok := b.pages[target]; ok {
+			out.Page, out.Anchor = page, target.Name()
+			break
+		}
+		switch t := target.(type) {
+		case *semantic.Pointer:
+			target = t.To
+		case *semantic.Slice:
+			target = t.To
+		case *semantic.Reference:
+			target = t.To
+		case *semantic.StaticArray:
+			target = t.ValueType
+		default:
+			target = nil
+		}
+	}
+	return out
+}
+
+// constantSet returns the names of the constants that the static analysis
+// found are accepted by the command parameter p, sorted by value.
+func (b *builder) constantSet(p *semantic.Parameter) []string {
+	ev, ok := b.analysis.Parameters[p].(*analysis.EnumValue)
+	if !ok || len(ev.Labels) == 0 {
+		return nil
+	}
+	values := make([]uint64, 0, len(ev.Labels))
+	for v := range ev.Labels {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = ev.Labels[v]
+	}
+	return out
+}
+
+func (b *builder) location(n semantic.Node) string {
+	if pn := b.mappings.ParseNode(n); pn != nil {
+		if tok := pn.Token(); tok.Source != nil {
+			return tok.At()
+		}
+	}
+	return ""
+}
+
+func annotations(annos semantic.Annotations) []string {
+	out := make([]string, len(annos))
+	for i, a := range annos {
+		s := "@" + a.Name()
+		if len(a.Arguments) > 0 {
+			args := make([]string, len(a.Arguments))
+			for j, arg := range a.Arguments {
+				args[j] = expression(arg)
+			}
+			s += "(" + strings.Join(args, ", ") + ")"
+		}
+		out[i] = s
+	}
+	return out
+}
+
+func expression(e semantic.Expression) string {
+	return printer.New().WriteExpression(e).String()
+}
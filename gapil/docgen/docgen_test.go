@@ -0,0 +1,103 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docgen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapil"
+	"github.com/google/gapid/gapil/ast"
+	"github.com/google/gapid/gapil/docgen"
+	"github.com/google/gapid/gapil/parser"
+	"github.com/google/gapid/gapil/resolver"
+	"github.com/google/gapid/gapil/semantic"
+)
+
+const maxErrors = 10
+
+func compile(ctx context.Context, source string) (*semantic.API, *resolver.Mappings) {
+	m := resolver.NewMappings()
+	parsed, errs := parser.Parse("docgen_test.api", source, m)
+	assert.For(ctx, "parse errors").That(gapil.CheckErrors(source, errs, maxErrors)).Equals(nil)
+	compiled, errs := resolver.Resolve([]*ast.API{parsed}, m)
+	assert.For(ctx, "resolve errors").That(gapil.CheckErrors(source, errs, maxErrors)).Equals(nil)
+	return compiled, m
+}
+
+const source = `
+enum Mode {
+  MODE_A = 1
+  MODE_B = 2
+}
+
+class Point {
+  s32 X
+  s32 Y = 3
+}
+
+@doc("https://example.com/draw")
+@custom
+cmd void draw(Mode mode, Point* points) {
+  switch mode {
+    case MODE_A, MODE_B: {}
+    default: {}
+  }
+}
+`
+
+func TestBuild(t *testing.T) {
+	ctx := log.Testing(t)
+	api, mappings := compile(ctx, source)
+	ref := docgen.Build(api, mappings)
+
+	assert.For(ctx, "commands").ThatSlice(ref.Commands).IsLength(1)
+	draw := ref.Commands[0]
+	assert.For(ctx, "name").ThatString(draw.Name).Equals("draw")
+	assert.For(ctx, "see also").That(draw.SeeAlso).DeepEquals([]string{"https://example.com/draw"})
+	assert.For(ctx, "annotations").That(draw.Annotations).DeepEquals([]string{"@custom"})
+	assert.For(ctx, "parameters").ThatSlice(draw.Members).IsLength(2)
+	assert.For(ctx, "mode").That(draw.Members[0].Type).DeepEquals(
+		&docgen.Link{Text: "Mode", Page: docgen.Enums, Anchor: "Mode"})
+	assert.For(ctx, "points").That(draw.Members[1].Type).DeepEquals(
+		&docgen.Link{Text: "Point*", Page: docgen.Classes, Anchor: "Point"})
+
+	assert.For(ctx, "classes").ThatSlice(ref.Classes).IsLength(1)
+	assert.For(ctx, "default").ThatString(ref.Classes[0].Members[1].Value).Equals("3")
+	assert.For(ctx, "enums").ThatSlice(ref.Enums).IsLength(1)
+	assert.For(ctx, "entry").ThatString(ref.Enums[0].Members[1].Value).Equals("0x2")
+}
+
+func TestWrite(t *testing.T) {
+	ctx := log.Testing(t)
+	api, mappings := compile(ctx, source)
+	ref := docgen.Build(api, mappings)
+
+	dir, err := ioutil.TempDir("", "docgen")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	for _, f := range []docgen.Format{docgen.Markdown, docgen.HTML} {
+		assert.For(ctx, "write %v", f.Name).ThatError(docgen.Write(dir, ref, f)).Succeeded()
+		data, err := ioutil.ReadFile(filepath.Join(dir, "commands"+f.Ext))
+		assert.For(ctx, "read %v", f.Name).ThatError(err).Succeeded()
+		assert.For(ctx, "%v link", f.Name).ThatString(string(data)).Contains("classes" + f.Ext + "#Point")
+	}
+}
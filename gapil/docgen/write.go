@@ -0,0 +1,235 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docgen
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Format is an output format for the reference pages.
+type Format struct {
+	// Name is the name of the format.
+	Name string
+	// Ext is the file extension of the pages, including the leading dot.
+	Ext string
+
+	execute func(w io.Writer, data *pageData) error
+}
+
+const (
+	markdownExt = ".md"
+	htmlExt     = ".html"
+)
+
+// The supported output formats.
+var (
+	Markdown = Format{Name: "markdown", Ext: markdownExt, execute: executeMarkdown}
+	HTML     = Format{Name: "html", Ext: htmlExt, execute: executeHTML}
+)
+
+// FormatByName returns the format with the given name.
+func FormatByName(name string) (Format, error) {
+	for _, f := range []Format{Markdown, HTML} {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("Unknown documentation format '%v'", name)
+}
+
+// pageData is the data passed to the page templates.
+type pageData struct {
+	Ref      *Reference
+	Page     Page
+	Title    string
+	Ext      string
+	Pages    []pageInfo
+	Entities []*Entity
+}
+
+type pageInfo struct {
+	Page     Page
+	Title    string
+	Entities []*Entity
+}
+
+func (r *Reference) pages() []pageInfo {
+	return []pageInfo{
+		{Commands, "Commands", r.Commands},
+		{Classes, "Classes", r.Classes},
+		{Enums, "Enums", r.Enums},
+		{Types, "Types", r.Types},
+		{Definitions, "Definitions", r.Definitions},
+	}
+}
+
+// Write writes the index page and a page for each kind of declaration of ref
+// into the directory dir, using the format f.
+func Write(dir string, ref *Reference, f Format) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	pages := ref.pages()
+	write := func(data *pageData) error {
+		file, err := os.Create(filepath.Join(dir, string(data.Page)+f.Ext))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := f.execute(file, data); err != nil {
+			return fmt.Errorf("Failed to write %v page: %v", data.Page, err)
+		}
+		return file.Close()
+	}
+	if err := write(&pageData{Ref: ref, Page: Index, Title: "Reference", Ext: f.Ext, Pages: pages}); err != nil {
+		return err
+	}
+	for _, p := range pages {
+		data := &pageData{Ref: ref, Page: p.Page, Title: p.Title, Ext: f.Ext, Pages: pages, Entities: p.Entities}
+		if err := write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// href returns the relative URL to the anchor on page.
+func href(page Page, anchor, ext string) string {
+	return string(page) + ext + "#" + anchor
+}
+
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `|`, `\|`,
+	`[`, `\[`, `]`, `\]`, `<`, `&lt;`, `>`, `&gt;`,
+)
+
+var markdownTemplate = texttemplate.Must(texttemplate.New("markdown").Funcs(texttemplate.FuncMap{
+	"md": mdEscaper.Replace,
+	"href": func(page Page, anchor string) string {
+		return href(page, anchor, markdownExt)
+	},
+	"link": func(l *Link) string {
+		if l.Page == "" {
+			return "`" + l.Text + "`"
+		}
+		return fmt.Sprintf("[`%v`](%v)", l.Text, href(l.Page, l.Anchor, markdownExt))
+	},
+	"cell": func(lines []string) string {
+		return mdEscaper.Replace(strings.Join(lines, " "))
+	},
+	"list": func(l []string) string {
+		return mdEscaper.Replace(strings.Join(l, ", "))
+	},
+	"code": func(l []string) string {
+		if len(l) == 0 {
+			return ""
+		}
+		return "`" + strings.Join(l, "` `") + "`"
+	},
+}).Parse(`{{define "nav"}}[Index](index{{.Ext}}){{range .Pages}} · [{{.Title}}]({{.Page}}{{$.Ext}}){{end}}{{end -}}
+
+# {{md .Ref.Name}} {{.Title}}
+
+{{template "nav" .}}
+{{if eq .Page "index"}}{{range .Pages}}{{$page := .}}
+## [{{.Title}}]({{.Page}}{{$.Ext}})
+
+{{range $i, $e := .Entities}}{{if $i}} · {{end}}[{{md $e.Name}}]({{href $page.Page $e.Anchor}}){{end}}
+{{end}}{{else}}{{range .Entities}}
+<a name="{{.Anchor}}"></a>
+## {{md .Name}}
+
+{{.Kind}} ` + "`" + `{{.Name}}` + "`" + `
+{{if .Docs}}
+{{range .Docs}}{{md .}}
+{{end}}{{end}}{{if .Annotations}}
+**Annotations:** {{code .Annotations}}
+{{end}}{{if .Returns}}
+**Returns:** {{link .Returns}}
+{{end}}{{if .To}}
+**Underlying type:** {{link .To}}
+{{end}}{{if .Value}}
+**Value:** ` + "`" + `{{.Value}}` + "`" + `
+{{end}}{{if .Members}}
+### {{.MembersTitle}}
+
+| Name | Type | Value | Description |
+| ---- | ---- | ----- | ----------- |
+{{range .Members}}| {{md .Name}} | {{if .Type}}{{link .Type}}{{end}} | {{if .Value}}` + "`" + `{{.Value}}` + "`" + `{{end}} | {{cell .Docs}}{{if .Annotations}} {{code .Annotations}}{{end}}{{if .Values}}{{if .Docs}} {{end}}Accepted values: {{list .Values}}{{end}} |
+{{end}}{{end}}{{if .SeeAlso}}
+**See also:**{{range .SeeAlso}} <{{.}}>{{end}}
+{{end}}{{if .Location}}
+_Declared at {{md .Location}}_
+{{end}}{{end}}{{end}}`))
+
+func executeMarkdown(w io.Writer, data *pageData) error {
+	return markdownTemplate.Execute(w, data)
+}
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"href": func(page Page, anchor string) string {
+		return href(page, anchor, htmlExt)
+	},
+	"join": strings.Join,
+}).Parse(`{{define "link"}}{{if .Page}}<a href="{{href .Page .Anchor}}"><code>{{.Text}}</code></a>{{else}}<code>{{.Text}}</code>{{end}}{{end -}}
+{{define "nav"}}<nav><a href="index{{.Ext}}">Index</a>{{range .Pages}} · <a href="{{.Page}}{{$.Ext}}">{{.Title}}</a>{{end}}</nav>{{end -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Ref.Name}} {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.decl { font-family: monospace; font-size: 1.1em; }
+.location { color: #888; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{.Ref.Name}} {{.Title}}</h1>
+{{template "nav" .}}
+{{if eq .Page "index"}}{{range .Pages}}{{$page := .}}
+<h2><a href="{{.Page}}{{$.Ext}}">{{.Title}}</a></h2>
+<p>{{range $i, $e := .Entities}}{{if $i}} · {{end}}<a href="{{href $page.Page $e.Anchor}}">{{$e.Name}}</a>{{end}}</p>
+{{end}}{{else}}{{range .Entities}}
+<h2 id="{{.Anchor}}">{{.Name}}</h2>
+<p class="decl">{{.Kind}} {{.Name}}</p>
+{{range .Docs}}<p>{{.}}</p>
+{{end}}{{if .Annotations}}<p><b>Annotations:</b> <code>{{join .Annotations " "}}</code></p>
+{{end}}{{if .Returns}}<p><b>Returns:</b> {{template "link" .Returns}}</p>
+{{end}}{{if .To}}<p><b>Underlying type:</b> {{template "link" .To}}</p>
+{{end}}{{if .Value}}<p><b>Value:</b> <code>{{.Value}}</code></p>
+{{end}}{{if .Members}}<h3>{{.MembersTitle}}</h3>
+<table>
+<tr><th>Name</th><th>Type</th><th>Value</th><th>Description</th></tr>
+{{range .Members}}<tr><td>{{.Name}}</td><td>{{if .Type}}{{template "link" .Type}}{{end}}</td><td>{{if .Value}}<code>{{.Value}}</code>{{end}}</td><td>{{join .Docs " "}}{{if .Annotations}} <code>{{join .Annotations " "}}</code>{{end}}{{if .Values}}{{if .Docs}}<br>{{end}}Accepted values: {{join .Values ", "}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{if .SeeAlso}}<p><b>See also:</b>{{range .SeeAlso}} <a href="{{.}}">{{.}}</a>{{end}}</p>
+{{end}}{{if .Location}}<p class="location">Declared at {{.Location}}</p>
+{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
+
+func executeHTML(w io.Writer, data *pageData) error {
+	return htmlTemplate.Execute(w, data)
+}
@@ -19,8 +19,12 @@
 
 set(files
     analyze.go
+    code_actions.go
+    code_actions_test.go
     debug_logger.go
     main.go
+    rename.go
+    rename_test.go
 )
 set(dirs
     vscode
@@ -0,0 +1,99 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	ls "github.com/google/gapid/core/langsvr"
+	"github.com/google/gapid/core/langsvr/protocol"
+	"github.com/google/gapid/gapil/semantic"
+	"github.com/google/gapid/gapil/validate"
+)
+
+// applyEditCommand is the identifier of the client command that applies a
+// list of text edits to a document. It is registered by the vscode extension.
+const applyEditCommand = "gfxapi.applyEdit"
+
+// quickFix returns the command that fixes the validation issue, or nil if
+// there is no fix for the issue.
+func quickFix(da *docAnalysis, issue validate.Issue) *ls.Command {
+	switch problem := issue.Problem.(type) {
+	case validate.ErrUnused:
+		n, ok := problem.Node.(semantic.NamedNode)
+		if !ok {
+			return nil
+		}
+		// Annotations come before the declaration, so just prepend one.
+		start := issue.At.Token().Start
+		edits := ls.TextEditList{}
+		edits.Add(da.doc.Body().Range(start, start), "@unused ")
+		return editCommand(fmt.Sprintf("Annotate %v with @unused", n.Name()), da.doc, edits)
+
+	case validate.ErrRedundantAnnotation:
+		tok := da.full.mappings.CST(problem.Annotation.AST).Token()
+		start, end := expandToLine(da.doc.Body().Runes(), tok.Start, tok.End)
+		edits := ls.TextEditList{}
+		edits.Add(da.doc.Body().Range(start, end), "")
+		return editCommand("Remove redundant @unused annotation", da.doc, edits)
+	}
+	return nil
+}
+
+// expandToLine expands the span [start, end) to include trailing whitespace.
+// If the span is the only thing on its line, then the span is expanded to
+// cover the whole line.
+func expandToLine(runes []rune, start, end int) (int, int) {
+	for end < len(runes) && (runes[end] == ' ' || runes[end] == '\t') {
+		end++
+	}
+	lineStart := start
+	for lineStart > 0 && (runes[lineStart-1] == ' ' || runes[lineStart-1] == '\t') {
+		lineStart--
+	}
+	if (lineStart == 0 || runes[lineStart-1] == '\n') && end < len(runes) && runes[end] == '\n' {
+		return lineStart, end + 1
+	}
+	return start, end
+}
+
+// editCommand returns a command that applies the edits to doc when invoked.
+func editCommand(title string, doc *ls.Document, edits ls.TextEditList) *ls.Command {
+	args := make([]protocol.TextEdit, len(edits))
+	for i, e := range edits {
+		args[i] = protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: e.Range.Start.Line - 1, Column: e.Range.Start.Column - 1},
+				End:   protocol.Position{Line: e.Range.End.Line - 1, Column: e.Range.End.Column - 1},
+			},
+			NewText: e.NewText,
+		}
+	}
+	return &ls.Command{
+		Title:     title,
+		Command:   applyEditCommand,
+		Arguments: []interface{}{doc.URI(), args},
+	}
+}
+
+// overlaps returns true if the ranges a and b intersect.
+func overlaps(a, b ls.Range) bool {
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+// before returns true if a comes before b.
+func before(a, b ls.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	ls "github.com/google/gapid/core/langsvr"
+	"github.com/google/gapid/core/langsvr/protocol"
+	"github.com/google/gapid/core/log"
+)
+
+func TestCodeActions(t *testing.T) {
+	ctx := log.Testing(t)
+	const source = `
+class Used {
+  @unused u32 A
+}
+
+@unused
+class Annotated {
+  @unused u32 B
+}
+
+class Unused {
+  @unused u32 C
+}
+
+Used U
+Annotated X
+
+cmd void f() {
+  _ = U
+  _ = X
+}
+`
+	s, dir, cleanup := testWorkspace(ctx, map[string]string{"test.api": source})
+	defer cleanup()
+	doc := s.docs[filepath.Join(dir, "test.api")]
+
+	for _, test := range []struct {
+		name     string
+		at       string
+		title    string
+		expected string
+	}{
+		{"Unused class", "class Unused", "Annotate Unused with @unused", `
+class Used {
+  @unused u32 A
+}
+
+@unused
+class Annotated {
+  @unused u32 B
+}
+
+@unused class Unused {
+  @unused u32 C
+}
+
+Used U
+Annotated X
+
+cmd void f() {
+  _ = U
+  _ = X
+}
+`},
+		{"Redundant annotation", "@unused\nclass Annotated", "Remove redundant @unused annotation", `
+class Used {
+  @unused u32 A
+}
+
+class Annotated {
+  @unused u32 B
+}
+
+class Unused {
+  @unused u32 C
+}
+
+Used U
+Annotated X
+
+cmd void f() {
+  _ = U
+  _ = X
+}
+`},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		pos := position(doc, test.at, 0, 1)
+		cmds, err := s.CodeActions(ctx, doc, ls.Range{Start: pos, End: pos}, nil)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		var found *ls.Command
+		for i := range cmds {
+			if cmds[i].Title == test.title {
+				found = &cmds[i]
+			}
+		}
+		if !assert.For(ctx, "command").That(found).IsNotNil() {
+			continue
+		}
+		assert.For(ctx, "command id").That(found.Command).Equals(applyEditCommand)
+		assert.For(ctx, "uri").That(found.Arguments[0]).Equals(doc.URI())
+
+		// The command's edits use 0-based protocol positions.
+		edits := ls.TextEditList{}
+		for _, e := range found.Arguments[1].([]protocol.TextEdit) {
+			edits.Add(ls.Range{
+				Start: ls.Position{Line: e.Range.Start.Line + 1, Column: e.Range.Start.Column + 1},
+				End:   ls.Position{Line: e.Range.End.Line + 1, Column: e.Range.End.Column + 1},
+			}, e.NewText)
+		}
+		assert.For(ctx, "fixed").ThatString(applyEdits(source, edits)).Equals(test.expected)
+	}
+}
@@ -120,6 +120,16 @@ func (s *server) nodeLocation(fa *fullAnalysis, n ast.Node) ls.Location {
 			Range: fa.nodeRange(doc, n),
 		}
 	}
+	// The node belongs to a file that isn't a workspace document, such as an
+	// import from an ignored path. Use the source that was parsed instead.
+	tok := fa.mappings.CST(n).Token()
+	if src := tok.Source; src != nil && src.Filename != "" {
+		body := ls.NewBodyFromRunes(src.Runes)
+		return ls.Location{
+			URI:   ls.PathToURI(src.Filename),
+			Range: body.Range(tok.Start, tok.End),
+		}
+	}
 	return ls.Location{}
 }
 
@@ -346,16 +356,10 @@ func (s *server) References(ctx context.Context, doc *ls.Document, pos ls.Positi
 		return nil, err
 	}
 	for _, n := range da.walkUp(doc.Body().Offset(pos)) {
-		if _, isIdent := n.ast.(*ast.Identifier); !isIdent {
+		if _, isIdent := n.ast.(*ast.Identifier); !isIdent || n.sem == nil {
 			continue
 		}
-		locations := []ls.Location{}
-		for _, n := range da.full.mappings.SemanticToAST[n.sem] {
-			if _, isIdent := n.(*ast.Identifier); isIdent {
-				locations = append(locations, s.nodeLocation(da.full, n))
-			}
-		}
-		return locations, nil
+		return s.references(da.full, n.sem), nil
 	}
 	return nil, nil
 }
@@ -406,24 +410,38 @@ func (s *server) FormatRange(ctx context.Context, doc *ls.Document, rng ls.Range
 }
 
 // Rename is called to rename the symbol at pos with newName.
+// The symbol is renamed in all the API files of the workspace. Renamed class
+// fields are also renamed in the hand-written Go files alongside the API.
 func (s *server) Rename(ctx context.Context, doc *ls.Document, pos ls.Position, newName string) (ls.WorkspaceEdit, error) {
 	da, err := s.docAnalysis(ctx, doc)
 	if da == nil || err != nil {
 		return ls.WorkspaceEdit{}, err
 	}
+	if !isIdentifier(newName) {
+		return ls.WorkspaceEdit{}, fmt.Errorf("'%v' is not a valid identifier", newName)
+	}
 	offset := doc.Body().Offset(pos)
-	edits := ls.WorkspaceEdit{}
 	for _, n := range da.walkUp(offset) {
-		if _, ok := n.ast.(*ast.Identifier); !ok {
+		if _, ok := n.ast.(*ast.Identifier); !ok || n.sem == nil {
 			continue // We can only sensibly rename identifiers.
 		}
-		for _, n := range da.full.mappings.SemanticToAST[n.sem] {
-			if _, ok := n.(*ast.Identifier); ok {
-				edits.Add(s.nodeLocation(da.full, n), newName)
-			}
+		sem := partial(n.sem)
+		if s.definition(sem) == nil {
+			return ls.WorkspaceEdit{}, fmt.Errorf("'%v' cannot be renamed", goTypename(sem))
+		}
+		edits := ls.WorkspaceEdit{}
+		for _, loc := range s.references(da.full, sem) {
+			edits.Add(loc, newName)
+		}
+		if m, ok := sem.(*semantic.Member); ok {
+			sem = m.Field
+		}
+		if f, ok := sem.(*semantic.Field); ok {
+			s.goFieldEdits(ctx, da.full, f, newName, edits)
 		}
+		return edits, nil
 	}
-	return edits, nil
+	return ls.WorkspaceEdit{}, nil
 }
 
 // Hover returns a list of source code snippets and range for the given
@@ -482,6 +500,9 @@ func (s *server) Hover(ctx context.Context, doc *ls.Document, pos ls.Position) (
 		if _, isIdent := n.ast.(*ast.Identifier); !isIdent || n.sem == nil {
 			continue
 		}
+		if ty := resolvedType(n.sem); ty != "" {
+			code.Add("plain", "Type: "+ty)
+		}
 		if def := s.definition(n.sem); def != nil {
 			if doc := s.nodeDoc(da.full, def); doc != nil {
 				rng := da.full.nodeRange(doc, def)
@@ -558,8 +579,21 @@ func (s *server) WorkspaceSymbols(ctx context.Context) (ls.SymbolList, error) {
 // CodeActions compute commands for a given document and range.
 // The request is triggered when the user moves the cursor into an problem
 // marker in the editor or presses the lightbulb associated with a marker.
-func (s *server) CodeActions(context.Context, *ls.Document, ls.Range, []ls.Diagnostic) ([]ls.Command, error) {
-	return []ls.Command{}, nil
+func (s *server) CodeActions(ctx context.Context, doc *ls.Document, rng ls.Range, diags []ls.Diagnostic) ([]ls.Command, error) {
+	da, err := s.docAnalysis(ctx, doc)
+	if da == nil || err != nil {
+		return []ls.Command{}, err
+	}
+	commands := []ls.Command{}
+	for _, issue := range da.issues {
+		if issue.At == nil || !overlaps(fragRange(doc, issue.At), rng) {
+			continue
+		}
+		if cmd := quickFix(da, issue); cmd != nil {
+			commands = append(commands, *cmd)
+		}
+	}
+	return commands, nil
 }
 
 func findAPIs(root string) []string {
@@ -631,6 +665,25 @@ func typeof(sem semantic.Node) semantic.Type {
 	}
 }
 
+// resolvedType returns the name of the type that the expression sem resolves
+// to, followed by the type it aliases if it is a pseudonym. If sem is not an
+// expression then resolvedType returns an empty string.
+func resolvedType(sem semantic.Node) string {
+	expr, ok := partial(sem).(semantic.Expression)
+	if !ok {
+		return ""
+	}
+	ty := expr.ExpressionType()
+	if ty == nil {
+		return ""
+	}
+	out := typename(ty)
+	if p, ok := ty.(*semantic.Pseudonym); ok {
+		out += " (" + typename(underlying(p).(semantic.Type)) + ")"
+	}
+	return out
+}
+
 // underlying returns the underlying type of ty.
 func underlying(ty semantic.Node) semantic.Node {
 	switch ty := ty.(type) {
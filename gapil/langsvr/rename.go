@@ -0,0 +1,265 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	ls "github.com/google/gapid/core/langsvr"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapil/ast"
+	"github.com/google/gapid/gapil/semantic"
+)
+
+var reIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// generatedMarkers are strings found in the headers of generated Go files.
+// These files are skipped when renaming as they will be regenerated.
+var generatedMarkers = []string{
+	"Automatically generated file",
+	"Code generated",
+	"Do not modify!",
+}
+
+// equivalents returns all the semantic nodes that were resolved from the same
+// declaration as sem.
+// Each API root is resolved separately, so a declaration in a file that is
+// imported by more than one root has a semantic node per root.
+func (s *server) equivalents(fa *fullAnalysis, sem semantic.Node) []semantic.Node {
+	sem = partial(sem)
+	out := []semantic.Node{sem}
+	def := s.definition(sem)
+	if def == nil {
+		return out
+	}
+	ty := reflect.TypeOf(sem)
+	for _, n := range fa.mappings.ASTToSemantic[def] {
+		if n := partial(n); n != sem && reflect.TypeOf(n) == ty {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// references returns the locations of all the identifiers that refer to sem
+// in the workspace, including those in imported files.
+func (s *server) references(fa *fullAnalysis, sem semantic.Node) []ls.Location {
+	seen := map[ls.Location]bool{}
+	out := []ls.Location{}
+	for _, sem := range s.equivalents(fa, sem) {
+		for _, n := range fa.mappings.SemanticToAST[sem] {
+			if _, isIdent := n.(*ast.Identifier); !isIdent {
+				continue
+			}
+			loc := s.nodeLocation(fa, n)
+			if loc.URI == "" || seen[loc] {
+				continue
+			}
+			seen[loc] = true
+			out = append(out, loc)
+		}
+	}
+	return out
+}
+
+// goFieldEdits adds the edits to edits required to rename the Go field
+// generated for the API field f to newName in the hand-written Go files found
+// alongside the API roots that declare f. These are typically the files that
+// implement the @custom commands.
+// To avoid renaming unrelated Go fields of the same name, only the selectors
+// on variables declared with the class type, and the keys of composite
+// literals of the class type, are renamed. See goFieldRefs.
+func (s *server) goFieldEdits(ctx context.Context, fa *fullAnalysis, f *semantic.Field, newName string, edits ls.WorkspaceEdit) {
+	class, ok := f.Owner().(*semantic.Class)
+	if !ok {
+		return
+	}
+	oldGo, newGo := goName(f.Name()), goName(newName)
+
+	dirs := map[string]bool{}
+	for path, root := range fa.roots {
+		if root.sem != nil && declaresClass(root.sem, class.AST) {
+			dirs[filepath.Dir(path)] = true
+		}
+	}
+
+	for dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.W(ctx, "Couldn't read %v: %v", path, err)
+				continue
+			}
+			text := string(data)
+			if isGenerated(text) {
+				continue
+			}
+			refs, err := goFieldRefs(text, goName(class.Name()), oldGo)
+			if err != nil {
+				log.W(ctx, "Couldn't parse %v: %v", path, err)
+				continue
+			}
+			body := ls.NewBody(text)
+			uri := ls.PathToURI(path)
+			for _, offset := range refs {
+				start := utf8.RuneCountInString(text[:offset])
+				end := start + utf8.RuneCountInString(oldGo)
+				edits.Add(ls.Location{URI: uri, Range: body.Range(start, end)}, newGo)
+			}
+		}
+	}
+}
+
+// goFieldRefs returns the byte offsets of the references to the field of the
+// Go type class in the Go source text.
+// The type of a selector's receiver is only known if it is an identifier
+// declared as a parameter, receiver or variable of the class type (or a
+// pointer to it), or assigned a composite literal of the class type. Other
+// selectors are ignored.
+func goFieldRefs(text, class, field string) ([]int, error) {
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "", text, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	isClass := func(e goast.Expr) bool {
+		for {
+			switch t := e.(type) {
+			case *goast.StarExpr:
+				e = t.X
+			case *goast.ParenExpr:
+				e = t.X
+			case *goast.Ident:
+				return t.Name == class
+			default:
+				return false
+			}
+		}
+	}
+	isClassValue := func(e goast.Expr) bool {
+		if u, ok := e.(*goast.UnaryExpr); ok && u.Op == token.AND {
+			e = u.X
+		}
+		switch e := e.(type) {
+		case *goast.CompositeLit:
+			return isClass(e.Type)
+		case *goast.CallExpr:
+			if fun, ok := e.Fun.(*goast.Ident); ok && fun.Name == "new" && len(e.Args) == 1 {
+				return isClass(e.Args[0])
+			}
+		}
+		return false
+	}
+	// declaredAsClass returns true if the identifier id is declared to hold a
+	// value of the class type.
+	declaredAsClass := func(id *goast.Ident) bool {
+		if id.Obj == nil || id.Obj.Kind != goast.Var {
+			return false
+		}
+		switch decl := id.Obj.Decl.(type) {
+		case *goast.Field:
+			return isClass(decl.Type)
+		case *goast.ValueSpec:
+			if decl.Type != nil {
+				return isClass(decl.Type)
+			}
+			for i, n := range decl.Names {
+				if n.Name == id.Name && i < len(decl.Values) {
+					return isClassValue(decl.Values[i])
+				}
+			}
+		case *goast.AssignStmt:
+			if len(decl.Lhs) != len(decl.Rhs) {
+				return false
+			}
+			for i, lhs := range decl.Lhs {
+				if n, ok := lhs.(*goast.Ident); ok && n.Name == id.Name {
+					return isClassValue(decl.Rhs[i])
+				}
+			}
+		}
+		return false
+	}
+
+	out := []int{}
+	goast.Inspect(file, func(n goast.Node) bool {
+		switch n := n.(type) {
+		case *goast.SelectorExpr:
+			if x, ok := n.X.(*goast.Ident); ok && n.Sel.Name == field && declaredAsClass(x) {
+				out = append(out, fset.Position(n.Sel.Pos()).Offset)
+			}
+		case *goast.CompositeLit:
+			if !isClass(n.Type) {
+				break
+			}
+			for _, e := range n.Elts {
+				if kv, ok := e.(*goast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*goast.Ident); ok && key.Name == field {
+						out = append(out, fset.Position(key.Pos()).Offset)
+					}
+				}
+			}
+		}
+		return true
+	})
+	sort.Ints(out)
+	return out, nil
+}
+
+// declaresClass returns true if api holds a class declared by the AST node n.
+func declaresClass(api *semantic.API, n *ast.Class) bool {
+	for _, c := range api.Classes {
+		if c.AST == n {
+			return true
+		}
+	}
+	return false
+}
+
+// goName returns the exported Go identifier generated for the API identifier.
+func goName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToTitle(r)) + name[n:]
+}
+
+func isIdentifier(name string) bool {
+	return reIdentifier.MatchString(name)
+}
+
+func isGenerated(text string) bool {
+	header := text
+	if len(header) > 512 {
+		header = header[:512]
+	}
+	for _, m := range generatedMarkers {
+		if strings.Contains(header, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	ls "github.com/google/gapid/core/langsvr"
+	"github.com/google/gapid/core/log"
+)
+
+const typesAPI = `
+class Rect {
+  u32 Area
+  u32 Other
+}
+`
+
+const mainAPI = `
+import "types.api"
+
+Rect R
+
+cmd void setArea(u32 area) {
+  R.Area = area
+  R.Other = R.Area
+}
+`
+
+const customGo = `package test
+
+type other struct{ Area int }
+
+func (r *Rect) double() { r.Area *= 2 }
+
+func set(x Rect, o other) int {
+	y := &Rect{Area: 1}
+	var z Rect
+	return int(x.Area+y.Area+z.Area) + o.Area
+}
+`
+
+// testWorkspace writes the files to a new temporary directory and returns a
+// server with the API files of the directory as its documents, along with a
+// function that deletes the directory.
+func testWorkspace(ctx context.Context, files map[string]string) (*server, string, func()) {
+	dir, err := ioutil.TempDir("", "langsvr")
+	if err != nil {
+		panic(err)
+	}
+	s := &server{
+		workspaceRoot: dir,
+		docs:          map[string]*ls.Document{},
+		analyzer:      newAnalyzer(),
+		config:        &Config{CheckUnused: true},
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(text), 0666); err != nil {
+			panic(err)
+		}
+		if filepath.Ext(name) == apiExt {
+			s.docs[path] = ls.NewDocument(path, lang, ls.NewBody(text))
+		}
+	}
+	return s, dir, func() { os.RemoveAll(dir) }
+}
+
+// position returns the position of the n'th occurrence of substr in doc,
+// offset by delta runes.
+func position(doc *ls.Document, substr string, n, delta int) ls.Position {
+	text := doc.Body().Text()
+	offset := 0
+	for i := 0; i <= n; i++ {
+		idx := strings.Index(text[offset:], substr)
+		if idx < 0 {
+			panic("substring not found")
+		}
+		offset += idx
+		if i < n {
+			offset += len(substr)
+		}
+	}
+	return doc.Body().Position(len([]rune(text[:offset])) + delta)
+}
+
+// applyEdits returns text with the edits applied.
+func applyEdits(text string, edits ls.TextEditList) string {
+	body := ls.NewBody(text)
+	runes := body.Runes()
+	sort.Slice(edits, func(i, j int) bool {
+		return body.Offset(edits[i].Range.Start) > body.Offset(edits[j].Range.Start)
+	})
+	for _, e := range edits {
+		start, end := body.Offset(e.Range.Start), body.Offset(e.Range.End)
+		runes = append(runes[:start], append([]rune(e.NewText), runes[end:]...)...)
+	}
+	return string(runes)
+}
+
+func TestReferences(t *testing.T) {
+	ctx := log.Testing(t)
+	s, dir, cleanup := testWorkspace(ctx, map[string]string{
+		"types.api": typesAPI,
+		"main.api":  mainAPI,
+	})
+	defer cleanup()
+
+	main := s.docs[filepath.Join(dir, "main.api")]
+	types := s.docs[filepath.Join(dir, "types.api")]
+
+	// The references of a field declared in an imported file include the
+	// declaration, and all the uses in the importing file.
+	locs, err := s.References(ctx, main, position(main, "R.Area", 0, 2))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	byURI := map[string]int{}
+	for _, l := range locs {
+		byURI[l.URI]++
+	}
+	assert.For(ctx, "references").That(byURI).DeepEquals(map[string]int{
+		types.URI(): 1,
+		main.URI():  2,
+	})
+
+	// Searching from the declaration finds the same references.
+	fromDecl, err := s.References(ctx, types, position(types, "Area", 0, 0))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "references from declaration").ThatSlice(fromDecl).Equals(locs)
+}
+
+func TestRename(t *testing.T) {
+	ctx := log.Testing(t)
+	s, dir, cleanup := testWorkspace(ctx, map[string]string{
+		"types.api": typesAPI,
+		"main.api":  mainAPI,
+		"custom.go": customGo,
+	})
+	defer cleanup()
+
+	main := s.docs[filepath.Join(dir, "main.api")]
+	edits, err := s.Rename(ctx, main, position(main, "R.Area", 1, 2), "Size")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	files := map[string]string{
+		"types.api": typesAPI,
+		"main.api":  mainAPI,
+		"custom.go": customGo,
+	}
+	for name, text := range files {
+		files[name] = applyEdits(text, edits[ls.PathToURI(filepath.Join(dir, name))])
+	}
+	assert.For(ctx, "types.api").ThatString(files["types.api"]).Equals(strings.Replace(typesAPI, "Area", "Size", 1))
+	assert.For(ctx, "main.api").ThatString(files["main.api"]).Equals(strings.Replace(mainAPI, ".Area", ".Size", -1))
+	// Only the selectors and keys of values of type Rect are renamed.
+	assert.For(ctx, "custom.go").ThatString(files["custom.go"]).Equals(`package test
+
+type other struct{ Area int }
+
+func (r *Rect) double() { r.Size *= 2 }
+
+func set(x Rect, o other) int {
+	y := &Rect{Size: 1}
+	var z Rect
+	return int(x.Size+y.Size+z.Size) + o.Area
+}
+`)
+
+	_, err = s.Rename(ctx, main, position(main, "R.Area", 1, 2), "not valid")
+	assert.For(ctx, "invalid name").ThatError(err).Failed()
+}
+
+func TestGoFieldRefs(t *testing.T) {
+	ctx := log.Testing(t)
+	refs, err := goFieldRefs(customGo, "Rect", "Area")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	got := []string{}
+	for _, offset := range refs {
+		line := strings.Count(customGo[:offset], "\n") + 1
+		got = append(got, strings.Split(customGo, "\n")[line-1])
+	}
+	assert.For(ctx, "refs").ThatSlice(got).Equals([]string{
+		"func (r *Rect) double() { r.Area *= 2 }",
+		"	y := &Rect{Area: 1}",
+		"	return int(x.Area+y.Area+z.Area) + o.Area",
+		"	return int(x.Area+y.Area+z.Area) + o.Area",
+		"	return int(x.Area+y.Area+z.Area) + o.Area",
+	})
+
+	_, err = goFieldRefs("package", "Rect", "Area")
+	assert.For(ctx, "parse error").ThatError(err).Failed()
+}
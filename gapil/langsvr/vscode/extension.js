@@ -50,6 +50,20 @@ function activate(context) {
 	// Push the disposable to the context's subscriptions so that the
 	// client can be deactivated on extension deactivation
 	context.subscriptions.push(disposable);
+
+	// Register the command used by the server's code actions to apply a list
+	// of text edits to a document.
+	context.subscriptions.push(vscode.commands.registerCommand('gfxapi.applyEdit', function(uri, edits) {
+		let docURI = vscode.Uri.parse(uri);
+		let edit = new vscode.WorkspaceEdit();
+		edits.forEach(function(e) {
+			let range = new vscode.Range(
+				e.range.start.line, e.range.start.character,
+				e.range.end.line, e.range.end.character);
+			edit.replace(docURI, range, e.newText);
+		});
+		return vscode.workspace.applyEdit(edit);
+	}));
 }
 exports.activate = activate;
 
@@ -0,0 +1,213 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Severity is the severity of an issue.
+type Severity int
+
+const (
+	// Off disables the rule.
+	Off = Severity(iota)
+	// Info is for issues that are informational only.
+	Info
+	// Warning is for issues that should be fixed.
+	Warning
+	// Error is for issues that must be fixed.
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Off:     "off",
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (s Severity) String() string {
+	if n, ok := severityNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity returns the severity with the given name.
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return s, nil
+		}
+	}
+	return Off, fmt.Errorf("Unknown severity '%v'", name)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	v, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// Config controls which rules are run, and the severity of their issues.
+//
+// An example configuration file:
+//
+//   {
+//     "rules": { "naming": "error", "missing-docs": "off" },
+//     "files": [
+//       { "match": "gles.api", "rules": { "missing-docs": "warning" } },
+//       { "match": "*/extensions/*.api", "rules": { "naming": "off" } }
+//     ]
+//   }
+type Config struct {
+	// Rules overrides the default severity of the named rules.
+	Rules map[string]Severity `json:"rules,omitempty"`
+	// Files holds the overrides for specific API files. These are applied in
+	// order after Rules.
+	Files []FileConfig `json:"files,omitempty"`
+}
+
+// FileConfig overrides the severity of rules for the issues found in the API
+// files that match a pattern.
+type FileConfig struct {
+	// Match is the filepath.Match pattern for the API file paths. Patterns
+	// without a path separator are matched against the file name only,
+	// otherwise they are matched against the end of the path.
+	Match string `json:"match"`
+	// Rules overrides the severity of the named rules.
+	Rules map[string]Severity `json:"rules"`
+}
+
+// LoadConfig loads the JSON configuration from the file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Failed to parse lint config '%v': %v", path, err)
+	}
+	return config, nil
+}
+
+// Set overrides the severity of the rule for all files.
+func (c *Config) Set(rule string, s Severity) {
+	if c.Rules == nil {
+		c.Rules = map[string]Severity{}
+	}
+	c.Rules[rule] = s
+}
+
+// Validate returns an error if the config references unknown rules or holds
+// invalid file patterns.
+func (c *Config) Validate() error {
+	known := map[string]bool{}
+	for _, r := range Rules() {
+		known[r.Name()] = true
+	}
+	check := func(rules map[string]Severity) error {
+		for name := range rules {
+			if !known[name] {
+				return fmt.Errorf("Unknown lint rule '%v'", name)
+			}
+		}
+		return nil
+	}
+	if err := check(c.Rules); err != nil {
+		return err
+	}
+	for _, f := range c.Files {
+		if _, err := path.Match(f.Match, ""); err != nil {
+			return fmt.Errorf("Invalid file pattern '%v': %v", f.Match, err)
+		}
+		if err := check(f.Rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mayEnable returns true if the rule is enabled for any file.
+func (c *Config) mayEnable(rule Rule) bool {
+	if c.severity(rule, "") != Off {
+		return true
+	}
+	for _, f := range c.Files {
+		if s, ok := f.Rules[rule.Name()]; ok && s != Off {
+			return true
+		}
+	}
+	return false
+}
+
+// severity returns the severity of the rule's issues in the file.
+func (c *Config) severity(rule Rule, file string) Severity {
+	s := rule.Severity()
+	if o, ok := c.Rules[rule.Name()]; ok {
+		s = o
+	}
+	if file == "" {
+		return s
+	}
+	for _, f := range c.Files {
+		if !f.matches(file) {
+			continue
+		}
+		if o, ok := f.Rules[rule.Name()]; ok {
+			s = o
+		}
+	}
+	return s
+}
+
+func (f FileConfig) matches(file string) bool {
+	file = filepath.ToSlash(file)
+	if !strings.Contains(f.Match, "/") {
+		ok, _ := path.Match(f.Match, path.Base(file))
+		return ok
+	}
+	// Match against each suffix of the path that starts at a separator.
+	for s := file; ; {
+		if ok, _ := path.Match(f.Match, s); ok {
+			return true
+		}
+		i := strings.Index(s, "/")
+		if i < 0 {
+			return false
+		}
+		s = s[i+1:]
+	}
+}
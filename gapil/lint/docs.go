@@ -0,0 +1,39 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import "github.com/google/gapid/gapil/semantic"
+
+func init() { Register(missingDocs{}) }
+
+const annoDoc = "doc"
+
+// missingDocs checks that every command has either a @doc annotation or a
+// documentation comment.
+type missingDocs struct{}
+
+func (missingDocs) Name() string { return "missing-docs" }
+func (missingDocs) Description() string {
+	return "Commands should have a @doc annotation or documentation comment"
+}
+func (missingDocs) Severity() Severity { return Info }
+
+func (missingDocs) Check(api *semantic.API, r *Reporter) {
+	for _, f := range api.Functions {
+		if len(f.Docs) == 0 && f.GetAnnotation(annoDoc) == nil {
+			r.ReportNode(f, "Command %v has no @doc annotation or documentation", f.Name())
+		}
+	}
+}
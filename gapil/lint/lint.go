@@ -0,0 +1,193 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint implements a configurable set of style and correctness checks
+// for resolved API files.
+//
+// Each check is a Rule, registered with Register. Rules can be enabled,
+// disabled or have their severity changed for the whole API or for
+// individual API files using a Config.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/gapid/core/text/parse"
+	"github.com/google/gapid/gapil/analysis"
+	"github.com/google/gapid/gapil/resolver"
+	"github.com/google/gapid/gapil/semantic"
+)
+
+// Rule is the interface implemented by a single lint check.
+type Rule interface {
+	// Name returns the unique name of the rule, used in configurations and
+	// reports.
+	Name() string
+	// Description returns a short, human readable description of the rule.
+	Description() string
+	// Severity returns the default severity of the issues raised by the rule.
+	Severity() Severity
+	// Check reports the problems found in api to r.
+	Check(api *semantic.API, r *Reporter)
+}
+
+// Issue is a single problem found by a Rule.
+type Issue struct {
+	Rule     string         // The name of the rule that raised the issue.
+	Severity Severity       // The severity of the issue.
+	At       parse.Fragment // The location of the issue. Can be nil.
+	Message  string         // The description of the problem.
+}
+
+func (i Issue) String() string {
+	if at := i.At; at != nil {
+		return fmt.Sprintf("%v %v: %v [%v]", at.Token().At(), i.Severity, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%v: %v [%v]", i.Severity, i.Message, i.Rule)
+}
+
+// Filename returns the path of the file holding the issue, or an empty string
+// if the issue has no location.
+func (i Issue) Filename() string {
+	if i.At == nil {
+		return ""
+	}
+	if src := i.At.Token().Source; src != nil {
+		return src.Filename
+	}
+	return ""
+}
+
+// Issues is a list of issues.
+type Issues []Issue
+
+func (l Issues) Len() int      { return len(l) }
+func (l Issues) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l Issues) Less(i, j int) bool {
+	a, b := l[i].At, l[j].At
+	switch {
+	case a != nil && b != nil:
+		if a, b := a.Token(), b.Token(); a.Less(b) || b.Less(a) {
+			return a.Less(b)
+		}
+	case a != nil:
+		return true
+	case b != nil:
+		return false
+	}
+	if l[i].Rule != l[j].Rule {
+		return l[i].Rule < l[j].Rule
+	}
+	return l[i].Message < l[j].Message
+}
+
+// Count returns the number of issues with a severity of at least s.
+func (l Issues) Count(s Severity) int {
+	count := 0
+	for _, i := range l {
+		if i.Severity >= s {
+			count++
+		}
+	}
+	return count
+}
+
+// Reporter is passed to Rule.Check to collect the issues found.
+type Reporter struct {
+	// Mappings holds the mappings between the AST and semantic nodes.
+	Mappings *resolver.Mappings
+	// Analysis holds the results of the static analysis of the API.
+	Analysis *analysis.Results
+
+	rule   Rule
+	issues Issues
+}
+
+// Report raises an issue at the parse node at.
+func (r *Reporter) Report(at parse.Fragment, msg string, args ...interface{}) {
+	r.issues = append(r.issues, Issue{
+		Rule:     r.rule.Name(),
+		Severity: r.rule.Severity(),
+		At:       at,
+		Message:  fmt.Sprintf(msg, args...),
+	})
+}
+
+// ReportNode raises an issue at the primary parse node of the semantic node n.
+func (r *Reporter) ReportNode(n semantic.Node, msg string, args ...interface{}) {
+	var at parse.Fragment
+	if pn := r.Mappings.ParseNode(n); pn != nil {
+		at = pn
+	}
+	r.Report(at, msg, args...)
+}
+
+var (
+	rulesMutex sync.Mutex
+	rules      = map[string]Rule{}
+)
+
+// Register adds the rule to the list of rules run by the linter.
+// Register panics if a rule with the same name is already registered.
+func Register(rule Rule) {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	if _, dup := rules[rule.Name()]; dup {
+		panic(fmt.Errorf("Lint rule '%v' already registered", rule.Name()))
+	}
+	rules[rule.Name()] = rule
+}
+
+// Rules returns all the registered rules, sorted by name.
+func Rules() []Rule {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// Run runs the registered rules over api, returning all the issues found
+// sorted by location. If config is nil then every rule is run with its
+// default severity.
+func Run(api *semantic.API, mappings *resolver.Mappings, config *Config) (Issues, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	results := analysis.Analyze(api, mappings)
+	issues := Issues{}
+	for _, rule := range Rules() {
+		if !config.mayEnable(rule) {
+			continue
+		}
+		r := &Reporter{Mappings: mappings, Analysis: results, rule: rule}
+		rule.Check(api, r)
+		for _, issue := range r.issues {
+			issue.Severity = config.severity(rule, issue.Filename())
+			if issue.Severity != Off {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	sort.Sort(issues)
+	return issues, nil
+}
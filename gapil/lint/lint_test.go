@@ -0,0 +1,133 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapil"
+	"github.com/google/gapid/gapil/ast"
+	"github.com/google/gapid/gapil/lint"
+	"github.com/google/gapid/gapil/parser"
+	"github.com/google/gapid/gapil/resolver"
+	"github.com/google/gapid/gapil/semantic"
+)
+
+const (
+	maxErrors = 10
+	filename  = "lint_test.api"
+)
+
+func compile(ctx context.Context, source string) (*semantic.API, *resolver.Mappings) {
+	m := resolver.NewMappings()
+	parsed, errs := parser.Parse(filename, source, m)
+	assert.For(ctx, "parse errors").That(gapil.CheckErrors(source, errs, maxErrors)).Equals(nil)
+	compiled, errs := resolver.Resolve([]*ast.API{parsed}, m)
+	assert.For(ctx, "resolve errors").That(gapil.CheckErrors(source, errs, maxErrors)).Equals(nil)
+	return compiled, m
+}
+
+const source = `
+s32 x = 0
+
+class foo {
+  u32 A
+  u32 b
+}
+
+enum Colors {
+  RED   = 0
+  green = 1
+}
+
+@doc("https://example.com/Documented")
+cmd void documented(s32 count, u32* p) {
+  _ = p[0:count]
+}
+
+cmd void Undocumented(s32 count, u32* p) {
+  if count < 0 { x = 1 }
+  _ = p[0:count]
+  _ = p[2:1]
+}
+`
+
+func rules(issues lint.Issues) map[string]int {
+	out := map[string]int{}
+	for _, i := range issues {
+		out[i.Rule]++
+	}
+	return out
+}
+
+func TestRules(t *testing.T) {
+	ctx := log.Testing(t)
+	api, mappings := compile(ctx, source)
+	issues, err := lint.Run(api, mappings, nil)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "issues").That(rules(issues)).DeepEquals(map[string]int{
+		"naming":             4, // foo, foo.b, Colors.green, Undocumented
+		"missing-docs":       1, // Undocumented
+		"pointer-slice-size": 2, // p[0:count] in documented, p[2:1]
+	})
+}
+
+func TestConfig(t *testing.T) {
+	ctx := log.Testing(t)
+	api, mappings := compile(ctx, source)
+
+	config := &lint.Config{}
+	err := json.Unmarshal([]byte(`{
+		"rules": { "missing-docs": "off", "naming": "error" },
+		"files": [ { "match": "lint_*.api", "rules": { "pointer-slice-size": "off" } } ]
+	}`), config)
+	assert.For(ctx, "unmarshal").ThatError(err).Succeeded()
+
+	issues, err := lint.Run(api, mappings, config)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "issues").That(rules(issues)).DeepEquals(map[string]int{"naming": 4})
+	assert.For(ctx, "errors").That(issues.Count(lint.Error)).Equals(4)
+
+	config.Set("no-such-rule", lint.Error)
+	_, err = lint.Run(api, mappings, config)
+	assert.For(ctx, "unknown rule").ThatError(err).Failed()
+}
+
+func TestSARIF(t *testing.T) {
+	ctx := log.Testing(t)
+	api, mappings := compile(ctx, source)
+	issues, err := lint.Run(api, mappings, nil)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	buf := &bytes.Buffer{}
+	assert.For(ctx, "write").ThatError(lint.WriteSARIF(buf, issues)).Succeeded()
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	assert.For(ctx, "unmarshal").ThatError(json.Unmarshal(buf.Bytes(), &log)).Succeeded()
+	assert.For(ctx, "version").ThatString(log.Version).Equals("2.1.0")
+	assert.For(ctx, "results").ThatSlice(log.Runs[0].Results).IsLength(len(issues))
+}
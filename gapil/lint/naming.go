@@ -0,0 +1,90 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/gapid/gapil/semantic"
+)
+
+func init() { Register(naming{}) }
+
+var reEnumEntry = regexp.MustCompile(`^[A-Z][A-Za-z0-9_]*$`)
+
+// naming checks that the declarations follow the API naming conventions:
+// * Classes, enums and pseudonyms start with an upper-case letter.
+// * Enum entries start with an upper-case letter, and don't contain spaces or
+//   punctuation other than underscores.
+// * Commands start with a lower-case letter.
+// * The fields of a class all start with the same letter case.
+type naming struct{}
+
+func (naming) Name() string { return "naming" }
+func (naming) Description() string {
+	return "Declarations should follow the API naming conventions"
+}
+func (naming) Severity() Severity { return Warning }
+
+func (naming) Check(api *semantic.API, r *Reporter) {
+	for _, c := range api.Classes {
+		if !startsUpper(c.Name()) {
+			r.ReportNode(c, "Class %v should start with an upper-case letter", c.Name())
+		}
+		checkFieldCase(c, r)
+	}
+	for _, e := range api.Enums {
+		if !startsUpper(e.Name()) {
+			r.ReportNode(e, "Enum %v should start with an upper-case letter", e.Name())
+		}
+		for _, entry := range e.Entries {
+			if !reEnumEntry.MatchString(entry.Name()) {
+				r.ReportNode(entry, "Enum entry %v.%v should start with an upper-case letter", e.Name(), entry.Name())
+			}
+		}
+	}
+	for _, p := range api.Pseudonyms {
+		if !startsUpper(p.Name()) {
+			r.ReportNode(p, "Type %v should start with an upper-case letter", p.Name())
+		}
+	}
+	for _, f := range api.Functions {
+		if startsUpper(f.Name()) {
+			r.ReportNode(f, "Command %v should start with a lower-case letter", f.Name())
+		}
+	}
+}
+
+// checkFieldCase reports the fields of c that don't use the same initial
+// letter case as the first field of c.
+func checkFieldCase(c *semantic.Class, r *Reporter) {
+	if len(c.Fields) == 0 {
+		return
+	}
+	upper := startsUpper(c.Fields[0].Name())
+	for _, f := range c.Fields[1:] {
+		if startsUpper(f.Name()) != upper {
+			r.ReportNode(f, "Field %v.%v does not match the letter case of %v.%v",
+				c.Name(), f.Name(), c.Name(), c.Fields[0].Name())
+		}
+	}
+}
+
+func startsUpper(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import "github.com/google/gapid/gapil/semantic"
+
+func init() { Register(pointerSlices{}) }
+
+// pointerSlices checks for pointer slices with suspicious sizes:
+// * Slices with constant bounds that are empty or inverted.
+// * Slices starting at 0 and sized by a signed parameter that is never
+//   compared against anything in the command. A negative size would produce
+//   a huge slice.
+type pointerSlices struct{}
+
+func (pointerSlices) Name() string { return "pointer-slice-size" }
+func (pointerSlices) Description() string {
+	return "Pointer slices should have valid, bounds-checked sizes"
+}
+func (pointerSlices) Severity() Severity { return Warning }
+
+func (pointerSlices) Check(api *semantic.API, r *Reporter) {
+	check := func(f *semantic.Function) {
+		if f.Block == nil {
+			return
+		}
+		guarded := comparedParameters(f.Block)
+		forEachNode(f.Block, func(n semantic.Node) {
+			pr, ok := n.(*semantic.PointerRange)
+			if !ok || pr.Range == nil {
+				return
+			}
+			lo, loOK := constInt(pr.Range.LHS)
+			hi, hiOK := constInt(pr.Range.RHS)
+			switch {
+			case loOK && hiOK && hi < lo:
+				r.ReportNode(pr, "Pointer slice in %v has inverted bounds [%d:%d]", f.Name(), lo, hi)
+			case loOK && hiOK && hi == lo:
+				r.ReportNode(pr, "Pointer slice in %v is always empty", f.Name())
+			case loOK && lo == 0:
+				p, ok := uncast(pr.Range.RHS).(*semantic.Parameter)
+				if ok && isSigned(p.Type) && !guarded[p] {
+					r.ReportNode(pr, "Pointer slice in %v is sized by signed parameter %v, which is never checked",
+						f.Name(), p.Name())
+				}
+			}
+		})
+	}
+	for _, f := range api.Functions {
+		check(f)
+	}
+	for _, f := range api.Subroutines {
+		check(f)
+	}
+	for _, f := range api.Methods {
+		check(f)
+	}
+}
+
+// comparedParameters returns the parameters that are used as an operand of a
+// comparison in the block.
+func comparedParameters(block *semantic.Block) map[*semantic.Parameter]bool {
+	out := map[*semantic.Parameter]bool{}
+	forEachNode(block, func(n semantic.Node) {
+		op, ok := n.(*semantic.BinaryOp)
+		if !ok {
+			return
+		}
+		switch op.Operator {
+		case "<", "<=", ">", ">=", "==", "!=":
+			for _, e := range []semantic.Expression{op.LHS, op.RHS} {
+				if p, ok := uncast(e).(*semantic.Parameter); ok {
+					out[p] = true
+				}
+			}
+		}
+	})
+	return out
+}
+
+// forEachNode calls f for every node in the tree starting at n, without
+// traversing into types or callables.
+func forEachNode(n semantic.Node, f func(semantic.Node)) {
+	var traverse func(n semantic.Node)
+	traverse = func(n semantic.Node) {
+		f(n)
+		switch n.(type) {
+		case semantic.Type, *semantic.Callable:
+			return
+		}
+		semantic.Visit(n, traverse)
+	}
+	traverse(n)
+}
+
+// uncast returns the expression e with any casts removed.
+func uncast(e semantic.Expression) semantic.Expression {
+	for {
+		c, ok := e.(*semantic.Cast)
+		if !ok {
+			return e
+		}
+		e = c.Object
+	}
+}
+
+// constInt returns the value of e if it is an integer literal.
+func constInt(e semantic.Expression) (int64, bool) {
+	switch v := uncast(e).(type) {
+	case semantic.Int8Value:
+		return int64(v), true
+	case semantic.Uint8Value:
+		return int64(v), true
+	case semantic.Int16Value:
+		return int64(v), true
+	case semantic.Uint16Value:
+		return int64(v), true
+	case semantic.Int32Value:
+		return int64(v), true
+	case semantic.Uint32Value:
+		return int64(v), true
+	case semantic.Int64Value:
+		return int64(v), true
+	case semantic.Uint64Value:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func isSigned(ty semantic.Type) bool {
+	ty = semantic.Underlying(ty)
+	return semantic.IsInteger(ty) && !semantic.IsUnsigned(ty)
+}
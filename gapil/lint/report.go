@@ -0,0 +1,161 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// location is the file position of an issue.
+type location struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (i Issue) location() *location {
+	if i.At == nil {
+		return nil
+	}
+	tok := i.At.Token()
+	if tok.Source == nil {
+		return nil
+	}
+	line, column := tok.Cursor()
+	return &location{File: tok.Source.RelativeFilename(), Line: line, Column: column}
+}
+
+// WriteText writes the issues to w, one per line.
+func WriteText(w io.Writer, issues Issues) error {
+	for _, i := range issues {
+		if _, err := fmt.Fprintln(w, i.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the issues to w as a JSON array.
+func WriteJSON(w io.Writer, issues Issues) error {
+	type jsonIssue struct {
+		Rule     string    `json:"rule"`
+		Severity Severity  `json:"severity"`
+		Message  string    `json:"message"`
+		Location *location `json:"location,omitempty"`
+	}
+	out := make([]jsonIssue, len(issues))
+	for i, issue := range issues {
+		out[i] = jsonIssue{issue.Rule, issue.Severity, issue.Message, issue.location()}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(out)
+}
+
+// The subset of the SARIF 2.1.0 format used by WriteSARIF.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex int             `json:"ruleIndex"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+	}
+)
+
+// sarifLevels maps the issue severities to SARIF result levels.
+var sarifLevels = map[Severity]string{
+	Info:    "note",
+	Warning: "warning",
+	Error:   "error",
+}
+
+// WriteSARIF writes the issues to w in the SARIF format, as consumed by many
+// continuous integration systems.
+func WriteSARIF(w io.Writer, issues Issues) error {
+	rules := Rules()
+	driver := sarifDriver{Name: "apic lint", Rules: make([]sarifRule, len(rules))}
+	ruleIndices := map[string]int{}
+	for i, r := range rules {
+		driver.Rules[i] = sarifRule{ID: r.Name(), ShortDescription: sarifMessage{r.Description()}}
+		ruleIndices[r.Name()] = i
+	}
+	results := make([]sarifResult, len(issues))
+	for i, issue := range issues {
+		res := sarifResult{
+			RuleID:    issue.Rule,
+			RuleIndex: ruleIndices[issue.Rule],
+			Level:     sarifLevels[issue.Severity],
+			Message:   sarifMessage{issue.Message},
+		}
+		if l := issue.location(); l != nil {
+			res.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(l.File)},
+					Region:           sarifRegion{StartLine: l.Line, StartColumn: l.Column},
+				},
+			}}
+		}
+		results[i] = res
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"github.com/google/gapid/gapil/semantic"
+	"github.com/google/gapid/gapil/validate"
+)
+
+func init() { Register(unreachable{}) }
+
+// unreachable reports the blocks, statements and expressions that the static
+// analysis found can never be reached.
+type unreachable struct{}
+
+func (unreachable) Name() string        { return "unreachable" }
+func (unreachable) Description() string { return "Code that can never be executed" }
+func (unreachable) Severity() Severity  { return Warning }
+
+func (unreachable) Check(api *semantic.API, r *Reporter) {
+	for _, u := range r.Analysis.Unreachables {
+		r.Report(u.At, "%v", validate.ErrUnreachable{Unreachable: u}.Error())
+	}
+}
@@ -197,6 +197,8 @@ func (p *Printer) WriteExpression(n semantic.Expression) *Printer {
 		p.WriteString(fmt.Sprintf("%v", int64(n)))
 	case semantic.Int8Value:
 		p.WriteString(fmt.Sprintf("%v", int8(n)))
+	case *semantic.Label:
+		p.WriteString(n.Name())
 	case *semantic.Length:
 		p.WriteString("len(")
 		p.WriteExpression(n.Object)
@@ -15,6 +15,8 @@
 package validate
 
 import (
+	"fmt"
+
 	"github.com/google/gapid/gapil/resolver"
 	"github.com/google/gapid/gapil/semantic"
 	"github.com/google/gapid/core/text/parse"
@@ -24,6 +26,23 @@ type fieldUsage struct{ read, written bool }
 
 const annoUnused = "unused"
 
+// ErrUnused is the problem raised for a type or field that is declared but not
+// used. It can be silenced by annotating the declaration with @unused.
+type ErrUnused struct {
+	Node    semantic.Node // The unused *semantic.Field or semantic.Type.
+	Message string
+}
+
+func (e ErrUnused) Error() string { return e.Message }
+
+// ErrRedundantAnnotation is the problem raised for an @unused annotation on a
+// type or field that is used.
+type ErrRedundantAnnotation struct {
+	Annotation *semantic.Annotation
+}
+
+func (e ErrRedundantAnnotation) Error() string { return "Redundant annotation" }
+
 // noUnused verifies that all declared types and fields are used.
 func noUnused(api *semantic.API, mappings *resolver.Mappings) Issues {
 	types := map[semantic.Type]bool{}
@@ -188,13 +207,14 @@ func noUnused(api *semantic.API, mappings *resolver.Mappings) Issues {
 		if a, ok := t.(semantic.Annotated); ok {
 			if anno := a.GetAnnotation(annoUnused); anno != nil {
 				if used {
-					issues.addf(mappings.CST(anno.AST), "Redundant annotation")
+					issues.add(mappings.CST(anno.AST), ErrRedundantAnnotation{anno})
 				}
 				continue
 			}
 		}
 		if !used {
-			issues.addf(mappings.ParseNode(t), "Type %s declared but never used", t.Name())
+			msg := fmt.Sprintf("Type %s declared but never used", t.Name())
+			issues.add(mappings.ParseNode(t), ErrUnused{t, msg})
 		}
 	}
 	for f, usage := range fields {
@@ -211,10 +231,11 @@ func noUnused(api *semantic.API, mappings *resolver.Mappings) Issues {
 		unused := len(msg) > 0
 		fiu, ciu := f.GetAnnotation(annoUnused), class.GetAnnotation(annoUnused)
 		if unused && fiu == nil && ciu == nil {
-			issues.addf(mappings.CST(f.AST), msg, f.Owner().Name(), f.Name())
+			msg = fmt.Sprintf(msg, f.Owner().Name(), f.Name())
+			issues.add(mappings.CST(f.AST), ErrUnused{f, msg})
 		}
 		if !unused && fiu != nil && ciu == nil {
-			issues.addf(mappings.CST(fiu.AST), "Redundant annotation")
+			issues.add(mappings.CST(fiu.AST), ErrRedundantAnnotation{fiu})
 		}
 	}
 	return issues
@@ -35,6 +35,10 @@ glob(test_sources
     INCLUDE "_test.cpp$"
 )
 
+list(APPEND sources
+    "${PROTO_CC_OUT}/gapis/replay/protocol/replay_protocol.pb.cc"
+)
+
 foreach(abi ${ANDROID_ACTIVE_ABI_LIST})
     set(dst "${CMAKE_RUNTIME_OUTPUT_DIRECTORY}/${ANDROID_BUILD_PATH_${abi}}")
     add_cmake_target(${abi} gapir ${dst} "libgapir.so"
@@ -46,7 +50,10 @@ endforeach()
 if(NOT DISABLED_CXX)
     add_library(gapir_static STATIC  ${sources})
     set_target_properties(gapir_static PROPERTIES OUTPUT_NAME gapir)
-    target_link_libraries(gapir_static cc-core)
+    target_link_libraries(gapir_static cc-core protobuf)
+
+    target_include_directories(gapir_static PUBLIC "${PROTO_CC_OUT}")
+    target_include_directories(gapir_static PUBLIC "${CMAKE_SOURCE_DIR}/external/protobuf/src")
 
     if(APPLE)
         find_package(Cocoa REQUIRED)
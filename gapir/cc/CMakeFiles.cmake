@@ -28,6 +28,9 @@ set(files
     gles_gfx_api.cpp
     gles_gfx_api.h
     gles_renderer.h
+    inflate.cpp
+    inflate.h
+    inflate_test.cpp
     interpreter.cpp
     interpreter.h
     interpreter_test.cpp
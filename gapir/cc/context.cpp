@@ -31,9 +31,12 @@
 #include "core/cc/log.h"
 #include "core/cc/target.h"
 
+#include <algorithm>
 #include <cstdlib>
 #include <sstream>
 #include <string>
+#include <unordered_set>
+#include <vector>
 
 namespace gapir {
 
@@ -88,9 +91,29 @@ void Context::prefetch(ResourceInMemoryCache* cache) const {
     auto cacheSize = static_cast<uint32_t>(
             static_cast<uint8_t*>(mMemoryManager->getVolatileAddress()) -
             static_cast<uint8_t*>(mMemoryManager->getBaseAddress()));
+    if (mServer.version() >= ServerConnection::VERSION_3) {
+        // The server may limit the size of the cache, or disable it.
+        cacheSize = static_cast<uint32_t>(
+                std::min<uint64_t>(cacheSize, mServer.resourceCacheSize()));
+    }
     cache->resize(cacheSize);
 
     auto resources = mReplayRequest->getResources();
+
+    std::vector<ResourceId> cached;
+    std::unordered_set<ResourceId> seen;
+    uint64_t cachedSize = 0;
+    for (const auto& resource : resources) {
+        if (cache->contains(resource.id) && seen.insert(resource.id).second) {
+            cached.push_back(resource.id);
+            cachedSize += resource.size;
+        }
+    }
+    if (cached.size() > 0) {
+        GAPID_INFO("%d resources are cached", cached.size());
+        mServer.cached(cached.data(), cached.size(), cachedSize);
+    }
+
     if (resources.size() > 0) {
         GAPID_INFO("Prefetching %d resources...", resources.size());
         mResourceProvider->prefetch(resources.data(), resources.size(), mServer,
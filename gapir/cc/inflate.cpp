@@ -0,0 +1,352 @@
+/*
+ * Copyright (C) 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#include "inflate.h"
+
+#include <string.h>
+
+namespace {
+
+const int kMaxBits = 15;       // The maximum number of bits in a code.
+const int kMaxLCodes = 286;    // The maximum number of literal/length codes.
+const int kMaxDCodes = 30;     // The maximum number of distance codes.
+const int kFixLCodes = 288;    // The number of fixed literal/length codes.
+const int kMaxCodes = kMaxLCodes + kMaxDCodes;
+
+// The base lengths and extra bits of the length symbols 257 to 285.
+const uint16_t kLengthBase[29] = {
+    3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+    35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258};
+const uint16_t kLengthExtra[29] = {
+    0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+    3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0};
+
+// The base distances and extra bits of the distance symbols 0 to 29.
+const uint16_t kDistBase[30] = {
+    1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+    257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577};
+const uint16_t kDistExtra[30] = {
+    0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+    7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13};
+
+// The order of the code length code lengths of a dynamic block.
+const uint8_t kCodeLengthOrder[19] = {
+    16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15};
+
+// Huffman is a canonical Huffman code, decoded from the number of codes of each length and the
+// symbols ordered by code.
+struct Huffman {
+    uint16_t count[kMaxBits + 1];
+    uint16_t symbol[kFixLCodes];
+};
+
+// Builds the Huffman code h for the n symbols with the given code lengths. Returns 0 if the code
+// is complete, a negative value if it is over-subscribed, and a positive value if it is
+// incomplete.
+int construct(Huffman* h, const uint16_t* lengths, int n) {
+    for (int len = 0; len <= kMaxBits; len++) {
+        h->count[len] = 0;
+    }
+    for (int symbol = 0; symbol < n; symbol++) {
+        h->count[lengths[symbol]]++;
+    }
+    if (h->count[0] == n) {
+        return 0;  // No codes.
+    }
+
+    int left = 1;
+    for (int len = 1; len <= kMaxBits; len++) {
+        left <<= 1;
+        left -= h->count[len];
+        if (left < 0) {
+            return left;
+        }
+    }
+
+    uint16_t offsets[kMaxBits + 1];
+    offsets[1] = 0;
+    for (int len = 1; len < kMaxBits; len++) {
+        offsets[len + 1] = offsets[len] + h->count[len];
+    }
+    for (int symbol = 0; symbol < n; symbol++) {
+        if (lengths[symbol] != 0) {
+            h->symbol[offsets[lengths[symbol]]++] = symbol;
+        }
+    }
+    return left;
+}
+
+// Inflater holds the state of the decompression of a DEFLATE stream.
+class Inflater {
+public:
+    Inflater(const uint8_t* in, size_t inSize, uint8_t* out, size_t outSize) :
+            mIn(in), mInSize(inSize), mInPos(0), mBitBuf(0), mBitCount(0),
+            mOut(out), mOutSize(outSize), mOutPos(0) {}
+
+    // Decompresses all the blocks of the stream, returning the decompressed size in written.
+    bool run(size_t* written);
+
+private:
+    // Reads need bits from the input to value, least significant bit first.
+    bool bits(int need, uint32_t* value);
+    // Decodes a symbol of the Huffman code h from the input.
+    bool decode(const Huffman& h, int* symbol);
+    // Decompresses a stored, fixed or dynamic block.
+    bool stored();
+    bool fixed();
+    bool dynamic();
+    // Decodes the literals and length/distance pairs of a block until the end of block symbol.
+    bool codes(const Huffman& lencode, const Huffman& distcode);
+
+    const uint8_t* mIn;
+    size_t mInSize;
+    size_t mInPos;
+    uint32_t mBitBuf;
+    int mBitCount;
+    uint8_t* mOut;
+    size_t mOutSize;
+    size_t mOutPos;
+};
+
+bool Inflater::run(size_t* written) {
+    uint32_t last, type;
+    do {
+        if (!bits(1, &last) || !bits(2, &type)) {
+            return false;
+        }
+        bool ok = false;
+        switch (type) {
+            case 0: ok = stored(); break;
+            case 1: ok = fixed(); break;
+            case 2: ok = dynamic(); break;
+        }
+        if (!ok) {
+            return false;
+        }
+    } while (!last);
+    *written = mOutPos;
+    return true;
+}
+
+bool Inflater::bits(int need, uint32_t* value) {
+    uint32_t val = mBitBuf;
+    while (mBitCount < need) {
+        if (mInPos == mInSize) {
+            return false;
+        }
+        val |= uint32_t(mIn[mInPos++]) << mBitCount;
+        mBitCount += 8;
+    }
+    mBitBuf = val >> need;
+    mBitCount -= need;
+    *value = val & ((1u << need) - 1);
+    return true;
+}
+
+bool Inflater::decode(const Huffman& h, int* symbol) {
+    int code = 0;   // The bits read so far.
+    int first = 0;  // The first code of the current length.
+    int index = 0;  // The index of the first code of the current length in h.symbol.
+    for (int len = 1; len <= kMaxBits; len++) {
+        uint32_t bit;
+        if (!bits(1, &bit)) {
+            return false;
+        }
+        code |= bit;
+        int count = h.count[len];
+        if (code - count < first) {
+            *symbol = h.symbol[index + (code - first)];
+            return true;
+        }
+        index += count;
+        first += count;
+        first <<= 1;
+        code <<= 1;
+    }
+    return false;
+}
+
+bool Inflater::stored() {
+    // Stored blocks start on a byte boundary.
+    mBitBuf = 0;
+    mBitCount = 0;
+    if (mInSize - mInPos < 4) {
+        return false;
+    }
+    size_t len = mIn[mInPos] | (mIn[mInPos + 1] << 8);
+    size_t nlen = mIn[mInPos + 2] | (mIn[mInPos + 3] << 8);
+    mInPos += 4;
+    if (len != (~nlen & 0xffff) || mInSize - mInPos < len || mOutSize - mOutPos < len) {
+        return false;
+    }
+    memcpy(mOut + mOutPos, mIn + mInPos, len);
+    mInPos += len;
+    mOutPos += len;
+    return true;
+}
+
+bool Inflater::fixed() {
+    uint16_t lengths[kFixLCodes];
+    Huffman lencode, distcode;
+    int symbol = 0;
+    for (; symbol < 144; symbol++) {
+        lengths[symbol] = 8;
+    }
+    for (; symbol < 256; symbol++) {
+        lengths[symbol] = 9;
+    }
+    for (; symbol < 280; symbol++) {
+        lengths[symbol] = 7;
+    }
+    for (; symbol < kFixLCodes; symbol++) {
+        lengths[symbol] = 8;
+    }
+    construct(&lencode, lengths, kFixLCodes);
+    for (symbol = 0; symbol < kMaxDCodes; symbol++) {
+        lengths[symbol] = 5;
+    }
+    construct(&distcode, lengths, kMaxDCodes);
+    return codes(lencode, distcode);
+}
+
+bool Inflater::dynamic() {
+    uint32_t nlen, ndist, ncode;
+    if (!bits(5, &nlen) || !bits(5, &ndist) || !bits(4, &ncode)) {
+        return false;
+    }
+    nlen += 257;
+    ndist += 1;
+    ncode += 4;
+    if (nlen > kMaxLCodes || ndist > kMaxDCodes) {
+        return false;
+    }
+
+    // Read the code lengths of the code used to encode the code lengths.
+    uint16_t lengths[kMaxCodes];
+    uint32_t index = 0;
+    for (; index < ncode; index++) {
+        uint32_t len;
+        if (!bits(3, &len)) {
+            return false;
+        }
+        lengths[kCodeLengthOrder[index]] = len;
+    }
+    for (; index < 19; index++) {
+        lengths[kCodeLengthOrder[index]] = 0;
+    }
+    Huffman lencode, distcode;
+    if (construct(&lencode, lengths, 19) != 0) {
+        return false;  // The code lengths code must be complete.
+    }
+
+    // Read the code lengths of the literal/length and distance codes.
+    for (index = 0; index < nlen + ndist;) {
+        int symbol;
+        if (!decode(lencode, &symbol)) {
+            return false;
+        }
+        if (symbol < 16) {
+            lengths[index++] = symbol;
+            continue;
+        }
+        uint16_t len = 0;  // The length to repeat.
+        uint32_t repeat;
+        if (symbol == 16) {
+            if (index == 0 || !bits(2, &repeat)) {
+                return false;
+            }
+            len = lengths[index - 1];
+            repeat += 3;
+        } else if (symbol == 17) {
+            if (!bits(3, &repeat)) {
+                return false;
+            }
+            repeat += 3;
+        } else {
+            if (!bits(7, &repeat)) {
+                return false;
+            }
+            repeat += 11;
+        }
+        if (index + repeat > nlen + ndist) {
+            return false;
+        }
+        for (; repeat > 0; repeat--) {
+            lengths[index++] = len;
+        }
+    }
+    if (lengths[256] == 0) {
+        return false;  // No end of block code.
+    }
+
+    // Incomplete codes are only allowed with a single code.
+    int left = construct(&lencode, lengths, nlen);
+    if (left < 0 || (left > 0 && nlen - lencode.count[0] != 1)) {
+        return false;
+    }
+    left = construct(&distcode, lengths + nlen, ndist);
+    if (left < 0 || (left > 0 && ndist - distcode.count[0] != 1)) {
+        return false;
+    }
+    return codes(lencode, distcode);
+}
+
+bool Inflater::codes(const Huffman& lencode, const Huffman& distcode) {
+    while (true) {
+        int symbol;
+        if (!decode(lencode, &symbol)) {
+            return false;
+        }
+        if (symbol < 256) {
+            if (mOutPos == mOutSize) {
+                return false;
+            }
+            mOut[mOutPos++] = symbol;
+            continue;
+        }
+        if (symbol == 256) {
+            return true;
+        }
+
+        symbol -= 257;
+        uint32_t extra;
+        if (symbol >= 29 || !bits(kLengthExtra[symbol], &extra)) {
+            return false;
+        }
+        size_t len = kLengthBase[symbol] + extra;
+        if (!decode(distcode, &symbol) || symbol >= 30 || !bits(kDistExtra[symbol], &extra)) {
+            return false;
+        }
+        size_t dist = kDistBase[symbol] + extra;
+        if (dist > mOutPos || mOutSize - mOutPos < len) {
+            return false;
+        }
+        for (; len > 0; len--, mOutPos++) {
+            mOut[mOutPos] = mOut[mOutPos - dist];
+        }
+    }
+}
+
+}  // anonymous namespace
+
+namespace gapir {
+
+bool inflate(const void* in, size_t inSize, void* out, size_t outSize, size_t* written) {
+    Inflater inflater(static_cast<const uint8_t*>(in), inSize, static_cast<uint8_t*>(out), outSize);
+    return inflater.run(written);
+}
+
+}  // namespace gapir
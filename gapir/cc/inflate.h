@@ -0,0 +1,33 @@
+/*
+ * Copyright (C) 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#ifndef GAPIR_INFLATE_H
+#define GAPIR_INFLATE_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+namespace gapir {
+
+// Decompresses the inSize bytes of DEFLATE (RFC 1951) compressed data at in to the outSize bytes
+// of memory at out. On success, written is set to the number of decompressed bytes and true is
+// returned. False is returned if the data is invalid, truncated, or decompresses to more than
+// outSize bytes.
+bool inflate(const void* in, size_t inSize, void* out, size_t outSize, size_t* written);
+
+}  // namespace gapir
+
+#endif  // GAPIR_INFLATE_H
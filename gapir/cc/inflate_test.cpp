@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+#include "inflate.h"
+
+#include <gtest/gtest.h>
+
+#include <string>
+#include <vector>
+
+namespace gapir {
+namespace test {
+namespace {
+
+// "abc" in a stored block.
+const std::vector<uint8_t> STORED = {0x01, 0x03, 0x00, 0xfc, 0xff, 0x61, 0x62, 0x63};
+
+// "hello hello hello" in a block using the fixed Huffman codes.
+const std::vector<uint8_t> FIXED = {0xcb, 0x48, 0xcd, 0xc9, 0xc9, 0x57, 0xc8, 0x40, 0x90, 0x00};
+
+// DYNAMIC_DATA in a block using dynamic Huffman codes.
+const std::string DYNAMIC_DATA =
+        "cbaaabacbabcaaabcaabaabbcbbaaabbacabcaaabaaaabcbbbabaabaacabcbaa";
+const std::vector<uint8_t> DYNAMIC = {
+        0x2d, 0x89, 0xc1, 0x11, 0x00, 0x30, 0x0c, 0x82, 0x66, 0x05, 0xf7, 0xdf,
+        0xa1, 0x9a, 0xeb, 0x4b, 0x81, 0x08, 0x48, 0xc4, 0xec, 0x65, 0x84, 0xc6,
+        0x0b, 0x2d, 0x3f, 0x70, 0xd5, 0x1a, 0x8f, 0xe6, 0x3b, 0x0f};
+
+std::string inflateString(const std::vector<uint8_t>& in, size_t inSize, size_t outSize, bool* ok) {
+    std::vector<char> out(outSize);
+    size_t written = 0;
+    *ok = inflate(in.data(), inSize, out.data(), out.size(), &written);
+    return std::string(out.data(), *ok ? written : 0);
+}
+
+}  // anonymous namespace
+
+TEST(InflateTest, Stored) {
+    bool ok;
+    EXPECT_EQ("abc", inflateString(STORED, STORED.size(), 16, &ok));
+    EXPECT_TRUE(ok);
+}
+
+TEST(InflateTest, Fixed) {
+    bool ok;
+    EXPECT_EQ("hello hello hello", inflateString(FIXED, FIXED.size(), 32, &ok));
+    EXPECT_TRUE(ok);
+}
+
+TEST(InflateTest, Dynamic) {
+    bool ok;
+    EXPECT_EQ(DYNAMIC_DATA, inflateString(DYNAMIC, DYNAMIC.size(), DYNAMIC_DATA.size(), &ok));
+    EXPECT_TRUE(ok);
+}
+
+TEST(InflateTest, ErrorOutputTooSmall) {
+    bool ok;
+    inflateString(STORED, STORED.size(), 2, &ok);
+    EXPECT_FALSE(ok);
+    inflateString(FIXED, FIXED.size(), 16, &ok);
+    EXPECT_FALSE(ok);
+    inflateString(DYNAMIC, DYNAMIC.size(), DYNAMIC_DATA.size() - 1, &ok);
+    EXPECT_FALSE(ok);
+}
+
+TEST(InflateTest, ErrorTruncated) {
+    bool ok;
+    inflateString(STORED, STORED.size() - 1, 16, &ok);
+    EXPECT_FALSE(ok);
+    inflateString(FIXED, FIXED.size() - 1, 32, &ok);
+    EXPECT_FALSE(ok);
+    inflateString(DYNAMIC, DYNAMIC.size() / 2, DYNAMIC_DATA.size(), &ok);
+    EXPECT_FALSE(ok);
+}
+
+TEST(InflateTest, ErrorInvalidBlockType) {
+    // A final block of the reserved type 3.
+    const std::vector<uint8_t> invalid = {0x07, 0x00};
+    bool ok;
+    inflateString(invalid, invalid.size(), 16, &ok);
+    EXPECT_FALSE(ok);
+}
+
+}  // namespace test
+}  // namespace gapir
@@ -21,6 +21,8 @@
 
 #include "core/cc/log.h"
 
+#include "gapis/replay/protocol/replay_protocol.pb.h"
+
 #include <string.h>
 
 #include <string>
@@ -43,7 +45,9 @@ std::unique_ptr<ReplayRequest> ReplayRequest::create(const ServerConnection& ser
     }
 
     std::unique_ptr<ReplayRequest> req(new ReplayRequest());
-    if (req->load(address, resource.size)) {
+    bool loaded = server.version() >= ServerConnection::VERSION_2 ?
+            req->loadVersioned(address, resource.size) : req->load(address, resource.size);
+    if (loaded) {
         return req;
     } else {
         return nullptr;
@@ -84,6 +88,52 @@ bool ReplayRequest::load(void* data, uint32_t size) {
     return ptr - size == data;
 }
 
+bool ReplayRequest::loadVersioned(void* data, uint32_t size) {
+    protocol::PayloadData payload;
+    if (!payload.ParseFromArray(data, size)) {
+        GAPID_WARNING("Failed to parse the replay payload");
+        return false;
+    }
+    if (payload.version() < ServerConnection::VERSION_2) {
+        GAPID_WARNING("Unsupported replay payload version %d", payload.version());
+        return false;
+    }
+
+    mStackSize = payload.stack_size();
+    mVolatileMemorySize = payload.volatile_memory_size();
+    GAPID_DEBUG("Stack size: %d", mStackSize);
+    GAPID_DEBUG("Volatile memory size: %d", mVolatileMemorySize);
+
+    mResources.reserve(payload.resources_size());
+    for (const auto& resource : payload.resources()) {
+        mResources.emplace_back(resource.id(), resource.size());
+    }
+    GAPID_DEBUG("Resources: %d", payload.resources_size());
+
+    // The parsed message holds copies of the constant memory and of the instruction list, so they
+    // can be moved to the start of the replay data, which is larger than both. The instruction
+    // list goes first to keep it aligned.
+    const std::string& opcodes = payload.opcodes();
+    const std::string& constants = payload.constants();
+    if (opcodes.size() % sizeof(uint32_t) != 0 || opcodes.size() + constants.size() > size) {
+        GAPID_WARNING("Invalid replay payload");
+        return false;
+    }
+    uint8_t* ptr = static_cast<uint8_t*>(data);
+    memcpy(ptr, opcodes.data(), opcodes.size());
+    mInstructionList = {reinterpret_cast<const uint32_t*>(ptr),
+                        static_cast<uint32_t>(opcodes.size() / sizeof(uint32_t))};
+    ptr += opcodes.size();
+    memcpy(ptr, constants.data(), constants.size());
+    mConstantMemory = {ptr, static_cast<uint32_t>(constants.size())};
+    GAPID_DEBUG("Constant memory size: %d", mConstantMemory.second);
+    GAPID_DEBUG("Instruction count: %d", mInstructionList.second);
+
+    GAPID_INFO("Replay request loaded");
+
+    return true;
+}
+
 const uint8_t* ReplayRequest::loadVolatileMemorySize(const uint8_t* ptr) {
     mVolatileMemorySize = *reinterpret_cast<const uint32_t*>(ptr);
     ptr += sizeof(uint32_t);
@@ -64,6 +64,11 @@ private:
     // amount of bytes were used false otherwise
     bool load(void* data, uint32_t size);
 
+    // Parse the replay request from the PayloadData protobuf message of the given size encoded at
+    // the given memory address. The constant memory and the instruction list are moved within
+    // the same memory. Returns true if the message was parsed successfully false otherwise
+    bool loadVersioned(void* data, uint32_t size);
+
     // Helper functions for loading the replay request from a raw byte buffer
     const uint8_t* loadStackSize(const uint8_t* ptr);
     const uint8_t* loadVolatileMemorySize(const uint8_t* ptr);
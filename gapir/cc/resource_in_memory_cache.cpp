@@ -187,6 +187,10 @@ void ResourceInMemoryCache::putCache(const Resource& resource, const void* data)
     mHead = mHead->next;
 }
 
+bool ResourceInMemoryCache::contains(const ResourceId& id) const {
+    return mCache.count(id) > 0;
+}
+
 bool ResourceInMemoryCache::getCache(const Resource& resource, void* data) {
     auto iter = mCache.find(resource.id);
     if (iter == mCache.end()) {
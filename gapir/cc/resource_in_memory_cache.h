@@ -50,6 +50,9 @@ public:
     // resets the size of the buffer used for caching.
     void resize(size_t newSize);
 
+    // returns true if the resource with the given id is in the cache.
+    bool contains(const ResourceId& id) const;
+
     // debug print the internal state.
     void dump(FILE*);
 
@@ -14,15 +14,27 @@
  * limitations under the License.
  */
 
+#include "inflate.h"
 #include "server_connection.h"
 
 #include "core/cc/connection.h"
 #include "core/cc/log.h"
 
+#include "gapis/replay/protocol/replay_protocol.pb.h"
+
+#include <string.h>
+
 #include <memory>
 #include <string>
 #include <vector>
 
+namespace {
+
+// The largest size of a message accepted by recvMessage.
+const uint32_t kMaxMessageSize = 1 << 30;
+
+}  // anonymous namespace
+
 namespace gapir {
 
 std::unique_ptr<ServerConnection> ServerConnection::create(
@@ -40,14 +52,43 @@ std::unique_ptr<ServerConnection> ServerConnection::create(
     }
 
     return std::unique_ptr<ServerConnection>(
-            new ServerConnection(std::move(conn), replayId, replayLen));
+            new ServerConnection(std::move(conn), replayId, replayLen, VERSION_1));
+}
+
+std::unique_ptr<ServerConnection> ServerConnection::createVersioned(
+        std::unique_ptr<core::Connection> conn, uint32_t minVersion, uint32_t maxVersion) {
+    uint32_t version;
+    if (conn->recv(&version, sizeof(version)) != sizeof(version)) {
+        GAPID_WARNING("Failed to read replay protocol version. Error: %s", conn->error());
+        return nullptr;
+    }
+    if (version < minVersion || version > maxVersion) {
+        GAPID_WARNING("Unsupported replay protocol version %d", version);
+        return nullptr;
+    }
+
+    std::unique_ptr<ServerConnection> server(
+            new ServerConnection(std::move(conn), "", 0, version));
+    protocol::ReplayRequest req;
+    if (!server->recvMessage(&req)) {
+        GAPID_WARNING("Failed to read replay request. Error: %s", server->mConn->error());
+        return nullptr;
+    }
+    server->mReplayId = req.payload_id();
+    server->mReplayLen = req.payload_size();
+    if (version >= VERSION_3) {
+        server->mResourceCacheSize = req.resource_cache_size();
+    }
+    return server;
 }
 
 ServerConnection::ServerConnection(std::unique_ptr<core::Connection> conn,
-        const std::string& replayId, uint32_t replayLen) :
+        const std::string& replayId, uint32_t replayLen, uint32_t version) :
         mConn(std::move(conn)),
         mReplayLen(replayLen),
-        mReplayId(replayId) {
+        mReplayId(replayId),
+        mVersion(version),
+        mResourceCacheSize(0) {
 }
 
 ServerConnection::~ServerConnection() {
@@ -61,8 +102,20 @@ uint32_t ServerConnection::replayLength() const {
     return mReplayLen;
 }
 
+uint32_t ServerConnection::version() const {
+    return mVersion;
+}
+
+uint64_t ServerConnection::resourceCacheSize() const {
+    return mResourceCacheSize;
+}
+
 bool ServerConnection::getResources(const ResourceId* resourceIds, size_t count, void* target,
                           size_t size) const {
+    if (mVersion >= VERSION_2) {
+        return getResourcesVersioned(resourceIds, count, target, size);
+    }
+
     uint32_t c = static_cast<uint32_t>(count);
 
     GAPID_DEBUG("GET resources (count: %lu, size: %d, target: %p)", c, size, target);
@@ -105,6 +158,10 @@ bool ServerConnection::getResources(const ResourceId* resourceIds, size_t count,
 }
 
 bool ServerConnection::post(const void* postData, uint32_t postSize) const {
+    if (mVersion >= VERSION_2) {
+        return postVersioned(postData, postSize);
+    }
+
     GAPID_DEBUG("POST: %p (%d)", postData, postSize);
 
     MessageType type = MESSAGE_TYPE_POST;
@@ -126,4 +183,129 @@ bool ServerConnection::post(const void* postData, uint32_t postSize) const {
     return true;
 }
 
+bool ServerConnection::getResourcesVersioned(const ResourceId* resourceIds, size_t count,
+                                             void* target, size_t size) const {
+    GAPID_DEBUG("GET resources (count: %lu, size: %d, target: %p)", count, size, target);
+
+    protocol::GetRequest req;
+    for (size_t i = 0; i < count; i++) {
+        req.add_ids(resourceIds[i]);
+    }
+    req.set_total_size(size);
+    if (mVersion >= VERSION_3) {
+        req.set_compression(protocol::Deflate);
+    }
+
+    MessageType type = MESSAGE_TYPE_GET;
+    if (mConn->send(&type, sizeof(type)) != sizeof(type) || !sendMessage(req)) {
+        GAPID_WARNING("Failed to send GET request to the server. Error: %s", mConn->error());
+        return false;
+    }
+
+    protocol::GetResponse res;
+    if (!recvMessage(&res)) {
+        GAPID_WARNING("Failed to read GET response from the server. Error: %s", mConn->error());
+        return false;
+    }
+    if (static_cast<size_t>(res.data_size()) != count ||
+            (res.compression() != protocol::None && res.compression() != req.compression())) {
+        GAPID_WARNING("GET %lu resources returned an unexpected response", count);
+        return false;
+    }
+
+    uint8_t* ptr = static_cast<uint8_t*>(target);
+    size_t received = 0;
+    for (const auto& data : res.data()) {
+        if (res.compression() == protocol::Deflate) {
+            size_t n = 0;
+            if (!inflate(data.data(), data.size(), ptr + received, size - received, &n)) {
+                GAPID_WARNING("GET %lu resources returned invalid compressed data", count);
+                return false;
+            }
+            received += n;
+            continue;
+        }
+        if (received + data.size() > size) {
+            break;
+        }
+        memcpy(ptr + received, data.data(), data.size());
+        received += data.size();
+    }
+    if (received != size) {
+        GAPID_WARNING("GET %lu resources returned unexpected size. Expected: 0x%x, Got: 0x%x\n",
+            count, int(size), int(received));
+        return false;
+    }
+
+    return true;
+}
+
+bool ServerConnection::postVersioned(const void* postData, uint32_t postSize) const {
+    GAPID_DEBUG("POST: %p (%d)", postData, postSize);
+
+    protocol::PostRequest req;
+    req.set_data(postData, postSize);
+
+    MessageType type = MESSAGE_TYPE_POST;
+    if (mConn->send(&type, sizeof(type)) != sizeof(type) || !sendMessage(req)) {
+        GAPID_WARNING("Failed to send POST to the server. Error: %s", mConn->error());
+        return false;
+    }
+
+    return true;
+}
+
+bool ServerConnection::cached(const ResourceId* ids, size_t count, uint64_t size) const {
+    if (mVersion < VERSION_3) {
+        return true;
+    }
+
+    GAPID_DEBUG("CACHED resources (count: %lu, size: %lu)", count, size);
+
+    protocol::CachedResources req;
+    for (size_t i = 0; i < count; i++) {
+        req.add_ids(ids[i]);
+    }
+    req.set_total_size(size);
+
+    MessageType type = MESSAGE_TYPE_CACHED;
+    if (mConn->send(&type, sizeof(type)) != sizeof(type) || !sendMessage(req)) {
+        GAPID_WARNING("Failed to send CACHED to the server. Error: %s", mConn->error());
+        return false;
+    }
+
+    return true;
+}
+
+bool ServerConnection::sendMessage(const google::protobuf::MessageLite& msg) const {
+    std::string data;
+    if (!msg.SerializeToString(&data)) {
+        return false;
+    }
+    uint32_t n = static_cast<uint32_t>(data.size());
+    uint8_t size[4] = {
+        uint8_t(n), uint8_t(n >> 8), uint8_t(n >> 16), uint8_t(n >> 24),
+    };
+    return mConn->send(size, sizeof(size)) == sizeof(size) &&
+        mConn->send(data.data(), data.size()) == data.size();
+}
+
+bool ServerConnection::recvMessage(google::protobuf::MessageLite* msg) const {
+    uint8_t size[4];
+    if (mConn->recv(size, sizeof(size)) != sizeof(size)) {
+        return false;
+    }
+    uint32_t n = uint32_t(size[0]) | uint32_t(size[1]) << 8 |
+        uint32_t(size[2]) << 16 | uint32_t(size[3]) << 24;
+    if (n > kMaxMessageSize) {
+        GAPID_WARNING("Message of %d bytes exceeds the maximum size", n);
+        return false;
+    }
+    std::string data(n, '\0');
+    if (n > 0 && mConn->recv(&data[0], n) != n) {
+        return false;
+    }
+    return msg->ParseFromString(data);
+}
+
 }  // namespace gapir
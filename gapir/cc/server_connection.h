@@ -29,15 +29,30 @@ class Connection;
 
 }  // namespace core
 
+namespace google {
+namespace protobuf {
+
+class MessageLite;
+
+}  // namespace protobuf
+}  // namespace google
+
 
 namespace gapir {
 
 // Class for managing the communication between the replay daemon and the server (gazer)
 class ServerConnection {
 public:
-    // Creates a gazer connection using the given connection
+    // Creates a gazer connection using the given connection, for a Replay connection using the
+    // first version of the replay protocol.
     static std::unique_ptr<ServerConnection> create(std::unique_ptr<core::Connection> conn);
 
+    // Creates a gazer connection using the given connection, for a VersionedReplay connection.
+    // The version of the replay protocol and the ReplayRequest message are read from the
+    // connection. Returns nullptr if the version is not between minVersion and maxVersion.
+    static std::unique_ptr<ServerConnection> createVersioned(
+            std::unique_ptr<core::Connection> conn, uint32_t minVersion, uint32_t maxVersion);
+
     ~ServerConnection();
 
     // Returns the resource id of the replay data
@@ -46,6 +61,13 @@ public:
     // Returns the length of the replay data
     uint32_t replayLength() const;
 
+    // Returns the version of the replay protocol used by the connection
+    uint32_t version() const;
+
+    // Returns the maximum size in bytes of the resources that may be kept in the resource cache
+    // for later replays. The cache is disabled if 0.
+    uint64_t resourceCacheSize() const;
+
     // Fetch the specified resources to the specified target address from the server. The resources
     // are loaded into the memory address continuously in the order they are specified in the id
     // list. Size have to specify the sum size of the requested resources. The function returns true
@@ -56,17 +78,44 @@ public:
     // the posting was successful false otherwise.
     bool post(const void* postData, uint32_t postSize) const;
 
+    // Tells the server that the specified resources, of the given total size, are held in the
+    // resource cache. This is informational, the resources may still be fetched if they are
+    // evicted from the cache. Does nothing before VERSION_3. Returns true if the message was sent
+    // successfully false otherwise.
+    bool cached(const ResourceId* ids, size_t count, uint64_t size) const;
+
     // Type of the message sent to the server. It have to be consistent with the values expected by
     // the server
     enum MessageType : uint8_t {
         MESSAGE_TYPE_GET  = 0,
         MESSAGE_TYPE_POST = 1,
+        MESSAGE_TYPE_CACHED = 2,
+    };
+
+    // The versions of the replay protocol. They have to be consistent with the versions in
+    // gapis/replay/protocol/version.go
+    enum Version : uint32_t {
+        // The payload and the messages are encoded by hand.
+        VERSION_1 = 1,
+        // The payload and the messages are encoded as size framed protobuf messages.
+        VERSION_2 = 2,
+        // The resources may be compressed, and the resource cache is reported to the server.
+        VERSION_3 = 3,
     };
 
 private:
     // Initialize the member variables of the ServerConnection object
     ServerConnection(std::unique_ptr<core::Connection> conn, const std::string& replayId,
-                    uint32_t replayLen);
+                    uint32_t replayLen, uint32_t version);
+
+    // Implementations of getResources and post for VERSION_2 and above.
+    bool getResourcesVersioned(const ResourceId* ids, size_t count, void* target,
+                               size_t size) const;
+    bool postVersioned(const void* postData, uint32_t postSize) const;
+
+    // Send and receive a protobuf message framed by its size, as a little-endian uint32.
+    bool sendMessage(const google::protobuf::MessageLite& msg) const;
+    bool recvMessage(google::protobuf::MessageLite* msg) const;
 
     // The connection used for sending and receiving data to and from the server.
     std::unique_ptr<core::Connection> mConn;
@@ -76,6 +125,12 @@ private:
 
     // The resource id of the replay this request belongs to.
     std::string mReplayId;
+
+    // The version of the replay protocol used by the connection.
+    uint32_t mVersion;
+
+    // The maximum size of the resource cache requested by the server.
+    uint64_t mResourceCacheSize;
 };
 
 }  // namespace gapir
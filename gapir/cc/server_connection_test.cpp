@@ -19,6 +19,8 @@
 
 #include "core/cc/mock_connection.h"
 
+#include "gapis/replay/protocol/replay_protocol.pb.h"
+
 #include <gmock/gmock.h>
 #include <gtest/gtest.h>
 
@@ -49,6 +51,29 @@ protected:
     std::unique_ptr<ServerConnection> mServerConnection;
     std::vector<uint8_t> mBuffer;
 };
+// pushMessage appends the protobuf message msg framed by its size to buf.
+void pushMessage(std::vector<uint8_t>* buf, const google::protobuf::MessageLite& msg) {
+    std::string data = msg.SerializeAsString();
+    pushUint32(buf, data.size());
+    buf->insert(buf->end(), data.begin(), data.end());
+}
+
+const uint64_t resourceCacheSize = 1024;
+
+// createVersionedServerConnection returns a ServerConnection using the given version of the replay
+// protocol on connection.
+std::unique_ptr<ServerConnection> createVersionedServerConnection(
+        core::test::MockConnection* connection, uint32_t version) {
+    protocol::ReplayRequest req;
+    req.set_payload_id(replayId);
+    req.set_resource_cache_size(resourceCacheSize);
+    pushUint32(&connection->in, version);
+    pushMessage(&connection->in, req);
+    return ServerConnection::createVersioned(
+            std::unique_ptr<core::Connection>(connection),
+            ServerConnection::VERSION_1, ServerConnection::VERSION_3);
+}
+
 }  // anonymous namespace
 
 TEST(ServerConnectionTestStatic, Create) {
@@ -144,5 +169,161 @@ TEST_F(ServerConnectionTest, PostErrorData) {
     EXPECT_FALSE(mServerConnection->post(&postData.front(), postData.size()));
 }
 
+TEST(ServerConnectionTestStatic, CreateVersioned) {
+    auto connection = new core::test::MockConnection();
+    protocol::ReplayRequest req;
+    req.set_payload_id(replayId);
+    req.set_payload_size(0x56003412);
+    pushUint32(&connection->in, ServerConnection::VERSION_2);
+    pushMessage(&connection->in, req);
+
+    auto svrConnection = ServerConnection::createVersioned(
+            std::unique_ptr<core::Connection>(connection),
+            ServerConnection::VERSION_1, ServerConnection::VERSION_2);
+
+    EXPECT_THAT(svrConnection, NotNull());
+    EXPECT_EQ(replayId, svrConnection->replayId());
+    EXPECT_EQ(0x56003412, svrConnection->replayLength());
+    EXPECT_EQ(ServerConnection::VERSION_2, svrConnection->version());
+    EXPECT_EQ(0, svrConnection->resourceCacheSize());
+}
+
+TEST(ServerConnectionTestStatic, CreateVersionedResourceCacheSize) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_3);
+
+    EXPECT_THAT(svrConnection, NotNull());
+    EXPECT_EQ(ServerConnection::VERSION_3, svrConnection->version());
+    EXPECT_EQ(resourceCacheSize, svrConnection->resourceCacheSize());
+}
+
+TEST(ServerConnectionTestStatic, CreateVersionedErrorVersion) {
+    auto connection = new core::test::MockConnection();
+    pushUint32(&connection->in, ServerConnection::VERSION_2 + 1);
+    pushMessage(&connection->in, protocol::ReplayRequest());
+
+    auto svrConnection = ServerConnection::createVersioned(
+            std::unique_ptr<core::Connection>(connection),
+            ServerConnection::VERSION_1, ServerConnection::VERSION_2);
+
+    EXPECT_THAT(svrConnection, IsNull());
+}
+
+TEST(ServerConnectionTestStatic, GetVersioned) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_2);
+    std::vector<uint8_t> buffer(3);
+
+    protocol::GetRequest req;
+    req.add_ids("A");
+    req.add_ids("B");
+    req.set_total_size(3);
+    std::vector<uint8_t> expected;
+    pushUint8(&expected, ServerConnection::MESSAGE_TYPE_GET);
+    pushMessage(&expected, req);
+
+    protocol::GetResponse res;
+    res.add_data(std::string{1, 2});
+    res.add_data(std::string{3});
+    pushMessage(&connection->in, res);
+
+    EXPECT_TRUE(svrConnection->getResources(AB, 2, buffer.data(), buffer.size()));
+    EXPECT_THAT(buffer, ElementsAre(1, 2, 3));
+    EXPECT_EQ(connection->out, expected);
+}
+
+TEST(ServerConnectionTestStatic, GetVersionedErrorSize) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_2);
+    std::vector<uint8_t> buffer(3);
+
+    protocol::GetResponse res;
+    res.add_data(std::string{1, 2});
+    res.add_data(std::string{3, 4});
+    pushMessage(&connection->in, res);
+
+    EXPECT_FALSE(svrConnection->getResources(AB, 2, buffer.data(), buffer.size()));
+}
+
+TEST(ServerConnectionTestStatic, GetVersionedDeflate) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_3);
+    std::vector<uint8_t> buffer(20);
+
+    protocol::GetRequest req;
+    req.add_ids("A");
+    req.add_ids("B");
+    req.set_total_size(20);
+    req.set_compression(protocol::Deflate);
+    std::vector<uint8_t> expected;
+    pushUint8(&expected, ServerConnection::MESSAGE_TYPE_GET);
+    pushMessage(&expected, req);
+
+    // "abc" in a stored block, and "hello hello hello" in a fixed Huffman block.
+    protocol::GetResponse res;
+    res.add_data(std::string{0x01, 0x03, 0x00, '\xfc', '\xff', 'a', 'b', 'c'});
+    res.add_data(std::string{'\xcb', 0x48, '\xcd', '\xc9', '\xc9', 0x57, '\xc8', 0x40, '\x90', 0x00});
+    res.set_compression(protocol::Deflate);
+    pushMessage(&connection->in, res);
+
+    EXPECT_TRUE(svrConnection->getResources(AB, 2, buffer.data(), buffer.size()));
+    EXPECT_EQ("abchello hello hello", std::string(buffer.begin(), buffer.end()));
+    EXPECT_EQ(connection->out, expected);
+}
+
+TEST(ServerConnectionTestStatic, GetVersionedDeflateErrorData) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_3);
+    std::vector<uint8_t> buffer(3);
+
+    // A truncated stored block.
+    protocol::GetResponse res;
+    res.add_data(std::string{0x01, 0x03, 0x00, '\xfc', '\xff', 'a', 'b'});
+    res.add_data(std::string{});
+    res.set_compression(protocol::Deflate);
+    pushMessage(&connection->in, res);
+
+    EXPECT_FALSE(svrConnection->getResources(AB, 2, buffer.data(), buffer.size()));
+}
+
+TEST(ServerConnectionTestStatic, CachedVersioned) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_3);
+
+    protocol::CachedResources req;
+    req.add_ids("A");
+    req.add_ids("B");
+    req.set_total_size(3);
+    std::vector<uint8_t> expected;
+    pushUint8(&expected, ServerConnection::MESSAGE_TYPE_CACHED);
+    pushMessage(&expected, req);
+
+    EXPECT_TRUE(svrConnection->cached(AB, 2, 3));
+    EXPECT_EQ(connection->out, expected);
+}
+
+TEST(ServerConnectionTestStatic, CachedVersion2) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_2);
+
+    EXPECT_TRUE(svrConnection->cached(AB, 2, 3));
+    EXPECT_TRUE(connection->out.empty());
+}
+
+TEST(ServerConnectionTestStatic, PostVersioned) {
+    auto connection = new core::test::MockConnection();
+    auto svrConnection = createVersionedServerConnection(connection, ServerConnection::VERSION_2);
+    std::vector<uint8_t> postData{1, 2, 3};
+
+    protocol::PostRequest req;
+    req.set_data(postData.data(), postData.size());
+    std::vector<uint8_t> expected;
+    pushUint8(&expected, ServerConnection::MESSAGE_TYPE_POST);
+    pushMessage(&expected, req);
+
+    EXPECT_TRUE(svrConnection->post(&postData.front(), postData.size()));
+    EXPECT_EQ(connection->out, expected);
+}
+
 }  // namespace gapir
 }  // namespace test
@@ -26,13 +26,16 @@
 
 #include <string.h>
 
+#include <algorithm>
 #include <memory>
 #include <sstream>
 #include <string>
 
 namespace {
 
-const uint32_t kProtocolVersion = 1;
+// The range of versions of the replay protocol supported.
+const uint32_t kMinProtocolVersion = gapir::ServerConnection::VERSION_1;
+const uint32_t kMaxProtocolVersion = gapir::ServerConnection::VERSION_3;
 const char kAuthTokenHeader[] = { 'A', 'U', 'T', 'H' };
 
 }  // anonymous namespace
@@ -87,6 +90,17 @@ std::unique_ptr<ServerConnection> ServerListener::acceptConnection(int idleTimeo
                 }
                 break;
             }
+            case VERSIONED_REPLAY: {
+                GAPID_DEBUG("Versioned replay requested");
+                std::unique_ptr<ServerConnection> conn = ServerConnection::createVersioned(
+                        std::move(client), kMinProtocolVersion, kMaxProtocolVersion);
+                if (conn != nullptr) {
+                    return conn;
+                } else {
+                    GAPID_WARNING("Loading ServerConnection failed!");
+                }
+                break;
+            }
             case SHUTDOWN_REQUEST: {
                 GAPID_INFO("Shutdown request received!");
                 return nullptr;
@@ -95,6 +109,24 @@ std::unique_ptr<ServerConnection> ServerListener::acceptConnection(int idleTimeo
                 client->sendString("PONG");
                 break;
             }
+            case HANDSHAKE: {
+                // The server sends the range of protocol versions it supports,
+                // and expects the version to use, or 0 if there is none.
+                uint32_t versions[2];
+                if (client->recv(versions, sizeof(versions)) != sizeof(versions)) {
+                    GAPID_WARNING("Failed to read handshake");
+                    break;
+                }
+                uint32_t min = std::max(versions[0], kMinProtocolVersion);
+                uint32_t max = std::min(versions[1], kMaxProtocolVersion);
+                uint32_t version = min <= max ? max : 0;
+                GAPID_DEBUG("Handshake for protocol versions %d to %d: using %d",
+                        versions[0], versions[1], version);
+                if (client->send(&version, sizeof(version)) != sizeof(version)) {
+                    GAPID_WARNING("Failed to send handshake response");
+                }
+                break;
+            }
             default: {
                 GAPID_WARNING("Unknown connection type %d ignored", connectionType);
             }
@@ -48,6 +48,8 @@ public:
         REPLAY_REQUEST   = 0,
         SHUTDOWN_REQUEST = 1,
         PING             = 2,
+        HANDSHAKE        = 3,
+        VERSIONED_REPLAY = 4,
     };
 
 private:
@@ -44,13 +44,21 @@ func New(ctx context.Context) *Client {
 	return c
 }
 
+// Connection is a connection to a GAPIR instance.
+type Connection struct {
+	io.ReadWriteCloser
+	// Version is the version of the replay protocol negotiated with the
+	// GAPIR instance.
+	Version uint32
+}
+
 type deviceArch struct {
 	d bind.Device
 	a device.Architecture
 }
 
 // Connect opens a connection to the replay device.
-func (c *Client) Connect(ctx context.Context, d bind.Device, abi *device.ABI) (io.ReadWriteCloser, error) {
+func (c *Client) Connect(ctx context.Context, d bind.Device, abi *device.ABI) (*Connection, error) {
 	s, isNew, err := c.getOrCreateSession(ctx, d, abi)
 	if err != nil {
 		return nil, err
@@ -61,9 +69,18 @@ func (c *Client) Connect(ctx context.Context, d bind.Device, abi *device.ABI) (i
 		if err := s.init(ctx, d, abi, launchArgs); err != nil {
 			return nil, err
 		}
+	} else if !s.alive(ctx) {
+		// The GAPIR instance has most likely crashed during a replay.
+		log.W(ctx, "GAPIR is not responding. Starting a new instance")
+		s.close()
+		return c.Connect(ctx, d, abi)
 	}
 
-	return s.connect(ctx)
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Connection{conn, s.version}, nil
 }
 
 func (c *Client) getOrCreateSession(ctx context.Context, d bind.Device, abi *device.ABI) (*session, bool, error) {
@@ -85,7 +102,9 @@ func (c *Client) getOrCreateSession(ctx context.Context, d bind.Device, abi *dev
 	s.onClose(func() {
 		c.mutex.Lock()
 		defer c.mutex.Unlock()
-		delete(c.sessions, key)
+		if c.sessions[key] == s {
+			delete(c.sessions, key)
+		}
 	})
 
 	return s, true, nil
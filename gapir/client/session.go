@@ -46,6 +46,7 @@ type session struct {
 	auth     auth.Token
 	closeCBs []func()
 	inited   chan struct{}
+	version  uint32 // The negotiated replay protocol version.
 }
 
 func newSession(d bind.Device) *session {
@@ -68,6 +69,12 @@ func (s *session) init(ctx context.Context, d bind.Device, abi *device.ABI, laun
 		return err
 	}
 
+	if s.version, err = s.handshake(ctx); err != nil {
+		s.close()
+		return err
+	}
+	log.I(ctx, "Using replay protocol version %d", s.version)
+
 	go s.heartbeat(ctx, sessionTimeout/2)
 	return nil
 }
@@ -190,6 +197,13 @@ func (s *session) connect(ctx context.Context) (io.ReadWriteCloser, error) {
 	return process.Connect(s.port, s.auth)
 }
 
+// alive returns true if the GAPIR instance of the session responds to pings.
+func (s *session) alive(ctx context.Context) bool {
+	<-s.inited
+	_, err := s.ping(ctx)
+	return err == nil
+}
+
 func (s *session) onClose(f func()) {
 	s.closeCBs = append(s.closeCBs, f)
 }
@@ -219,6 +233,35 @@ func (s *session) ping(ctx context.Context) (time.Duration, error) {
 	return time.Since(start), nil
 }
 
+// handshake negotiates the version of the replay protocol with GAPIR.
+func (s *session) handshake(ctx context.Context) (uint32, error) {
+	connection, err := process.Connect(s.port, s.auth)
+	if err != nil {
+		return 0, err
+	}
+	defer connection.Close()
+	w := endian.Writer(connection, device.LittleEndian)
+	r := endian.Reader(connection, device.LittleEndian)
+	w.Uint8(uint8(protocol.ConnectionType_Handshake))
+	w.Uint32(protocol.MinVersion)
+	w.Uint32(protocol.MaxVersion)
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	version := r.Uint32()
+	switch err := r.Error(); {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		// GAPIR predates the handshake and closed the connection.
+		return protocol.Version1, nil
+	case err != nil:
+		return 0, err
+	case version < protocol.MinVersion || version > protocol.MaxVersion:
+		return 0, log.Errf(ctx, nil, "GAPIR doesn't support replay protocol versions %d to %d",
+			protocol.MinVersion, protocol.MaxVersion)
+	}
+	return version, nil
+}
+
 func (s *session) heartbeat(ctx context.Context, pingInterval time.Duration) {
 	defer s.close()
 	for {
@@ -18,6 +18,7 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    analysis.go
     api.go
     api.pb.go
     api.proto
@@ -34,18 +35,24 @@ set(files
     cmd_service_test.go
     cmd_service.go
     cmd.go
+    compat.go
     context.go
     doc.go
+    footprint.go
+    handles.go
+    handles_test.go
     labeled.go
     mesh.go
     resource.go
     state.go
+    stats.go
     texture.go
 )
 set(dirs
     .vscode
     all
     core
+    cpp
     gles
     sync
     templates
@@ -0,0 +1,51 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+// Issue is a problem found by an Analyzer with a command.
+type Issue struct {
+	// Severity is the severity of the issue.
+	Severity log.Severity
+	// Message describes the issue.
+	Message *stringtable.Msg
+	// Subcommand is the index of the subcommand the issue was found with,
+	// or nil if the issue was found with the command itself.
+	Subcommand []uint64
+}
+
+// Analyzer statically analyzes the commands of a capture, without replaying
+// them. The commands of all the APIs of the capture are passed to the
+// analyzer, in order.
+type Analyzer interface {
+	// PreMutate is called before cmd is mutated on the state s.
+	PreMutate(ctx context.Context, cmd Cmd, s *State)
+	// PostMutate is called after cmd has been successfully mutated on the
+	// state s. It returns the issues found with cmd.
+	PostMutate(ctx context.Context, cmd Cmd, s *State) []Issue
+}
+
+// AnalysisProvider is the interface implemented by APIs that can statically
+// analyze their commands.
+type AnalysisProvider interface {
+	// NewAnalyzer returns a new Analyzer for the commands of a capture.
+	NewAnalyzer(ctx context.Context) Analyzer
+}
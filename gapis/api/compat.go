@@ -0,0 +1,55 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/core/os/device"
+)
+
+// CompatReport lists the parts of a capture that the compatibility layer of
+// an API does not handle for replay on a given device.
+type CompatReport struct {
+	// Commands is the sorted list of extension commands used by the capture
+	// that the compatibility layer does not handle and the device may not
+	// support.
+	Commands []string
+	// Extensions is the sorted list of extensions used by the capture that
+	// are neither supported by the device nor handled by the compatibility
+	// layer.
+	Extensions []string
+}
+
+// Empty returns true if the report lists no unhandled commands or extensions.
+func (r *CompatReport) Empty() bool {
+	return len(r.Commands) == 0 && len(r.Extensions) == 0
+}
+
+func (r *CompatReport) String() string {
+	return fmt.Sprintf("unhandled commands: [%v], unhandled extensions: [%v]",
+		strings.Join(r.Commands, ", "), strings.Join(r.Extensions, ", "))
+}
+
+// CompatCoverageProvider is the interface implemented by APIs that can report
+// the coverage of their compatibility layer.
+type CompatCoverageProvider interface {
+	// CompatCoverage returns the commands and extensions of the capture
+	// commands cmds that the compatibility layer does not handle for replay
+	// on device. Commands of other APIs are ignored.
+	CompatCoverage(ctx context.Context, cmds []Cmd, device *device.Instance) (*CompatReport, error)
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// ErrNotObserved is the error returned by Command.Read and Command.Written
+// when the memory was not observed by the command.
+const ErrNotObserved = fault.Const("Memory not observed")
+
+// Provider is the interface implemented by APIs that can be exported to C++.
+type Provider interface {
+	// CppTarget returns a new Target for exporting the commands of the API.
+	CppTarget() *Target
+}
+
+// Target holds the API specific parts of an exported program.
+type Target struct {
+	// Defines are the preprocessor macros defined before including Headers.
+	Defines []string
+	// Headers are the system headers declaring the API functions.
+	Headers []string
+	// Libraries are the libraries the program links against.
+	Libraries []string
+	// Declarations is the C++ source declaring the API specific helpers
+	// used by the statements returned by Statement.
+	Declarations string
+	// Runtime is the C++ source of the API specific part of the runtime.
+	// It defines the functions lookup and initialize, and the helpers of
+	// Declarations.
+	Runtime string
+	// Remap returns the key identifying the object of the handle v, used by
+	// the command cmd on the state s, and true if the handle can have a
+	// different value on replay.
+	Remap func(v interface{}, cmd api.Cmd, s *api.State) (key interface{}, remap bool)
+	// Arg returns the C++ expression of the argument v of the named
+	// parameter, or an empty string to generate it from v. Arg can be nil.
+	Arg func(name string, v interface{}) string
+	// Statement returns the C++ statements replaying the command, or an
+	// empty string to use the call generated from its parameters. Statement
+	// can be nil.
+	Statement func(ctx context.Context, c *Command) (string, error)
+}
+
+// File is a file of an exported program.
+type File struct {
+	// Name is the path of the file, relative to the root of the program.
+	Name string
+	// Data is the content of the file, or nil for resource files.
+	Data []byte
+	// Resource is the identifier of the content of resource files.
+	Resource id.ID
+}
+
+// Command is a command being exported.
+type Command struct {
+	// Cmd is the exported command.
+	Cmd api.Cmd
+	// Call is the C++ statement calling the API function with the command's
+	// parameters, and remapping the handles it returns.
+	Call string
+
+	exporter     *exporter
+	observations *api.CmdObservations
+}
+
+// State returns the state after the command.
+func (c *Command) State() *api.State {
+	return c.exporter.state
+}
+
+// Arg returns the C++ expression of the argument v, converted to the type of
+// the parameter it is passed to.
+func (c *Command) Arg(v interface{}) string {
+	return c.exporter.arg(c.Cmd, v)
+}
+
+// Bind returns the C++ expression of the call, remapping the handle v to the
+// value it returns. If v is not remapped, Bind returns call.
+func (c *Command) Bind(v interface{}, call string) string {
+	return c.exporter.bind(c.Cmd, v, call)
+}
+
+// Read returns the memory range rng as observed before the command.
+func (c *Command) Read(ctx context.Context, rng memory.Range) ([]byte, error) {
+	if c.observations == nil {
+		return nil, ErrNotObserved
+	}
+	return observed(ctx, c.observations.Reads, rng)
+}
+
+// Written returns the memory range rng as observed after the command.
+func (c *Command) Written(ctx context.Context, rng memory.Range) ([]byte, error) {
+	if c.observations == nil {
+		return nil, ErrNotObserved
+	}
+	return observed(ctx, c.observations.Writes, rng)
+}
+
+// observed returns the data of the memory range rng from the observations.
+func observed(ctx context.Context, observations []api.CmdObservation, rng memory.Range) ([]byte, error) {
+	out := make([]byte, rng.Size)
+	covered := uint64(0)
+	for _, o := range observations {
+		if !o.Range.Overlaps(rng) {
+			continue
+		}
+		obj, err := database.Resolve(ctx, o.ID)
+		if err != nil {
+			return nil, err
+		}
+		data, ok := obj.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("Observation %v is not a byte slice: %T", o.ID, obj)
+		}
+		i := o.Range.Intersect(rng)
+		copy(out[i.Base-rng.Base:i.End()-rng.Base], data[i.Base-o.Range.Base:])
+		covered += i.Size
+	}
+	if covered < rng.Size {
+		return nil, ErrNotObserved
+	}
+	return out, nil
+}
+
+// Uint returns the unsigned integer of size bytes at the start of data, in
+// the byte order of the capture.
+func (c *Command) Uint(data []byte, size uint64) uint64 {
+	v := uint64(0)
+	for i := uint64(0); i < size && i < uint64(len(data)); i++ {
+		if c.exporter.state.MemoryLayout.GetEndian() == device.BigEndian {
+			v = v<<8 | uint64(data[i])
+		} else {
+			v |= uint64(data[i]) << (8 * i)
+		}
+	}
+	return v
+}
@@ -0,0 +1,23 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cpp exports the commands of a capture as the source of a standalone
+// C++ program that replays them.
+//
+// The program calls the API functions directly, with the parameters of the
+// captured commands. The memory observed by the commands is loaded from
+// resource files, at the captured addresses when these are available in the
+// replaying process. Object handles that can differ between the capture and
+// the replay are remapped by the program.
+package cpp
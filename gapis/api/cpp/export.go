@@ -0,0 +1,436 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/math/interval"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+const (
+	// commandsPerFile is the maximum number of commands in a source file.
+	commandsPerFile = 1000
+	// pageSize is the alignment of the memory regions of the program.
+	pageSize = 4096
+)
+
+// Export returns the files of a C++ program that replays the commands cmds of
+// a capture, using the API specific parts of t. The commands are mutated on
+// the state s, which must be the initial state of the capture.
+func Export(ctx context.Context, cmds []api.Cmd, t *Target, s *api.State) ([]File, error) {
+	e := &exporter{
+		target:    t,
+		state:     s,
+		slots:     map[interface{}]int{},
+		resources: map[id.ID]bool{},
+	}
+
+	files := []File{}
+	sources := []string{}
+	for first := 0; first < len(cmds); first += commandsPerFile {
+		name := fmt.Sprintf("commands_%d", len(sources))
+		buf := &bytes.Buffer{}
+		fmt.Fprintf(buf, "%s\n#include \"replay.h\"\n\nvoid %s(Replay& r) {\n", generated, name)
+		for i := first; i < len(cmds) && i < first+commandsPerFile; i++ {
+			if err := e.command(ctx, buf, i, cmds[i]); err != nil {
+				return nil, log.Errf(ctx, err, "Exporting command %d: %v", i, cmds[i])
+			}
+		}
+		buf.WriteString("}\n")
+		sources = append(sources, name)
+		files = append(files, File{Name: name + ".cpp", Data: buf.Bytes()})
+	}
+
+	for _, id := range e.resourceList {
+		files = append(files, File{Name: resourcePath(id), Resource: id})
+	}
+
+	program := map[string]string{
+		"CMakeLists.txt": e.cmakeLists(sources),
+		"README.md":      readme,
+		"replay.h":       e.replayHeader(),
+		"replay.cpp":     generated + runtime,
+		"api.cpp":        generated + t.Runtime,
+		"regions.cpp":    e.regionsSource(),
+		"main.cpp":       e.mainSource(sources),
+	}
+	for _, name := range []string{
+		"CMakeLists.txt", "README.md", "replay.h", "replay.cpp", "api.cpp",
+		"regions.cpp", "main.cpp",
+	} {
+		files = append(files, File{Name: name, Data: []byte(program[name])})
+	}
+	return files, nil
+}
+
+// exporter holds the state of an export.
+type exporter struct {
+	target       *Target
+	state        *api.State
+	slots        map[interface{}]int  // Remapping key to handle slot.
+	regions      interval.U64SpanList // Memory used by the commands.
+	resources    map[id.ID]bool
+	resourceList []id.ID // Resources, in order of first use.
+}
+
+func resourcePath(id id.ID) string {
+	return fmt.Sprintf("resources/%v.bin", id)
+}
+
+// command writes the C++ statements replaying cmd to w, and mutates the state
+// with cmd.
+func (e *exporter) command(ctx context.Context, w *bytes.Buffer, idx int, cmd api.Cmd) error {
+	c := &Command{Cmd: cmd, exporter: e}
+	if extras := cmd.Extras(); extras != nil {
+		c.observations = extras.Observations()
+	}
+
+	fmt.Fprintf(w, "  // %d\n", idx)
+	if c.observations != nil {
+		for _, o := range c.observations.Reads {
+			e.use(o.Range)
+			if !e.resources[o.ID] {
+				e.resources[o.ID] = true
+				e.resourceList = append(e.resourceList, o.ID)
+			}
+			fmt.Fprintf(w, "  r.load(0x%x, %d, \"%s\");\n", o.Range.Base, o.Range.Size, resourcePath(o.ID))
+		}
+		for _, o := range c.observations.Writes {
+			e.use(o.Range)
+		}
+		e.patches(ctx, w, c)
+	}
+
+	// The handles passed to the command are identified before the command,
+	// the handles it returns after it.
+	call := e.call(c)
+	if err := cmd.Mutate(ctx, e.state, nil); err != nil {
+		fmt.Fprintf(w, "  // %v\n", strings.Replace(err.Error(), "\n", " ", -1))
+	}
+	call, err := e.results(ctx, c, call)
+	if err != nil {
+		return err
+	}
+	c.Call = call
+
+	statement := c.Call
+	if e.target.Statement != nil {
+		s, err := e.target.Statement(ctx, c)
+		if err != nil {
+			return err
+		}
+		if s != "" {
+			statement = s
+		}
+	}
+	for _, line := range strings.Split(statement, "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+	return nil
+}
+
+// patches writes the statements replacing the handles held in the memory
+// read by the command with their replay values.
+func (e *exporter) patches(ctx context.Context, w *bytes.Buffer, c *Command) {
+	if e.target.Remap == nil {
+		return
+	}
+	read := func(rng memory.Range) []byte {
+		data, err := c.Read(ctx, rng)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+	for _, h := range api.ReadHandles(c.Cmd, e.state, e.target.Remap, read) {
+		// Handles without a slot were not bound, and keep their values.
+		if slot, ok := e.slots[h.Key]; ok {
+			fmt.Fprintf(w, "  r.patch(0x%x, %d, %d, 0x%x);\n", h.Range.Base, h.Range.Size, slot, handleValue(h.Value))
+		}
+	}
+}
+
+// use adds the memory range to the regions of the program.
+func (e *exporter) use(rng memory.Range) {
+	if rng.Size == 0 {
+		return
+	}
+	span := interval.U64Span{
+		Start: rng.Base &^ (pageSize - 1),
+		End:   (rng.End() + pageSize - 1) &^ (pageSize - 1),
+	}
+	interval.Merge(&e.regions, span, true)
+}
+
+// fields calls f with the parameters of the command, and with its result
+// value if it has one.
+func fields(cmd api.Cmd, f func(name string, v interface{}, result bool)) {
+	v := reflect.ValueOf(cmd)
+	for v.Kind() != reflect.Struct {
+		v = v.Elem()
+	}
+	t := v.Type()
+	for i, count := 0, t.NumField(); i < count; i++ {
+		field, t := v.Field(i), t.Field(i)
+		if _, ok := t.Tag.Lookup("result"); ok {
+			f("", field.Interface(), true)
+		} else if name, ok := t.Tag.Lookup("param"); ok {
+			f(name, field.Interface(), false)
+		}
+	}
+}
+
+// call returns the C++ expression calling the API function of the command
+// with its parameters.
+func (e *exporter) call(c *Command) string {
+	args := []string{}
+	fields(c.Cmd, func(name string, v interface{}, result bool) {
+		if result {
+			return
+		}
+		arg := ""
+		if e.target.Arg != nil {
+			arg = e.target.Arg(name, v)
+		}
+		if arg == "" {
+			arg = e.arg(c.Cmd, v)
+		}
+		args = append(args, arg)
+	})
+	return fmt.Sprintf("P(%s)(%s)", c.Cmd.CmdName(), strings.Join(args, ", "))
+}
+
+// results returns the statement of the call, remapping the handles returned
+// by the command.
+func (e *exporter) results(ctx context.Context, c *Command, call string) (string, error) {
+	outputs := []string{}
+	var err error
+	fields(c.Cmd, func(name string, v interface{}, result bool) {
+		if result {
+			call = e.bind(c.Cmd, v, call)
+			return
+		}
+		if p, ok := v.(memory.Pointer); ok && !p.IsNullptr() && err == nil {
+			var out string
+			if out, err = e.output(ctx, c, p); out != "" {
+				outputs = append(outputs, out)
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{call + ";"}, outputs...), "\n"), nil
+}
+
+// output returns the statement remapping the handles written by the command
+// to the pointer p, or an empty string if p does not point to handles.
+func (e *exporter) output(ctx context.Context, c *Command, p memory.Pointer) (string, error) {
+	el := p.ElementType()
+	if el == nil || c.observations == nil {
+		return "", nil
+	}
+	switch el.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return "", nil // Handles are 32 or 64 bit integers.
+	}
+	if _, remap := e.remap(c.Cmd, reflect.Zero(el).Interface()); !remap {
+		// Zero handles are usually not remapped, try with a non-zero one.
+		v := reflect.New(el).Elem()
+		setInt(v, 1)
+		if _, remap := e.remap(c.Cmd, v.Interface()); !remap {
+			return "", nil
+		}
+	}
+	size := p.ElementSize(e.state.MemoryLayout)
+	for _, o := range c.observations.Writes {
+		if !o.Range.Contains(p.Address()) {
+			continue
+		}
+		rng := memory.Range{Base: p.Address(), Size: (o.Range.End() - p.Address()) / size * size}
+		data, err := c.Written(ctx, rng)
+		if err != nil {
+			return "", err
+		}
+		handles := []string{}
+		for i := uint64(0); i < rng.Size; i += size {
+			captured := c.Uint(data[i:], size)
+			v := reflect.New(el).Elem()
+			setInt(v, captured)
+			if key, remap := e.remap(c.Cmd, v.Interface()); remap {
+				handles = append(handles, fmt.Sprintf("{%d, 0x%x}", e.slot(key), captured))
+			}
+		}
+		if len(handles) == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("r.bind_out(0x%x, %d, {%s});", p.Address(), size, strings.Join(handles, ", ")), nil
+	}
+	return "", nil
+}
+
+// setInt sets the integer value v to the bits of i.
+func setInt(v reflect.Value, i uint64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(i))
+	default:
+		v.SetUint(i)
+	}
+}
+
+// remap returns the remapping key of the handle v, used by the command cmd.
+func (e *exporter) remap(cmd api.Cmd, v interface{}) (key interface{}, remap bool) {
+	if e.target.Remap == nil {
+		return nil, false
+	}
+	return e.target.Remap(v, cmd, e.state)
+}
+
+// slot returns the index of the slot holding the replay value of the handle
+// with the remapping key.
+func (e *exporter) slot(key interface{}) int {
+	slot, ok := e.slots[key]
+	if !ok {
+		slot = len(e.slots)
+		e.slots[key] = slot
+	}
+	return slot
+}
+
+// bind returns the C++ expression of the call, remapping the handle v to the
+// value it returns. If v is not remapped, bind returns call.
+func (e *exporter) bind(cmd api.Cmd, v interface{}, call string) string {
+	key, remap := e.remap(cmd, v)
+	if !remap {
+		return call
+	}
+	return fmt.Sprintf("r.bind(%d, 0x%x, %s)", e.slot(key), handleValue(v), call)
+}
+
+// handleValue returns the captured value of the handle v.
+func handleValue(v interface{}) uint64 {
+	if p, ok := v.(memory.Pointer); ok {
+		return p.Address()
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(r.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return r.Uint()
+	}
+	return 0
+}
+
+// arg returns the C++ expression of the argument v of the command cmd.
+func (e *exporter) arg(cmd api.Cmd, v interface{}) string {
+	if key, remap := e.remap(cmd, v); remap {
+		return fmt.Sprintf("H(%d, 0x%x)", e.slot(key), handleValue(v))
+	}
+	if p, ok := v.(memory.Pointer); ok {
+		return fmt.Sprintf("M(0x%x)", p.Address())
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Bool:
+		if r.Bool() {
+			return "U(1)"
+		}
+		return "U(0)"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := r.Int(); n != math.MinInt64 {
+			return fmt.Sprintf("I(%d)%s", n, comment(v))
+		}
+		return "I(INT64_MIN)"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := r.Uint(); n >= 0x1000 {
+			return fmt.Sprintf("U(0x%x)%s", n, comment(v))
+		}
+		return fmt.Sprintf("U(%d)%s", r.Uint(), comment(v))
+	case reflect.Float32:
+		return float(r.Float(), 32)
+	case reflect.Float64:
+		return float(r.Float(), 64)
+	case reflect.String:
+		return fmt.Sprintf("S(%s)", quote(r.String()))
+	default:
+		return fmt.Sprintf("U(0) /* unsupported %v */", r.Type())
+	}
+}
+
+// comment returns a C++ comment with the name of the value v, or an empty
+// string if it has none.
+func comment(v interface{}) string {
+	s, ok := v.(fmt.Stringer)
+	if !ok {
+		return ""
+	}
+	n := s.String()
+	if n == "" || '0' <= n[0] && n[0] <= '9' {
+		return ""
+	}
+	for _, r := range n {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return ""
+		}
+	}
+	return fmt.Sprintf(" /* %s */", n)
+}
+
+func float(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "F(NAN)"
+	case math.IsInf(f, 1):
+		return "F(INFINITY)"
+	case math.IsInf(f, -1):
+		return "F(-INFINITY)"
+	}
+	return fmt.Sprintf("F(%s)", strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// quote returns s as a C++ string literal.
+func quote(s string) string {
+	b := &bytes.Buffer{}
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '?':
+			b.WriteString(`\?`) // Avoid trigraphs.
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(b, `\%03o`, c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpp_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/cpp"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/builder"
+)
+
+type handle uint32
+
+type enum uint32
+
+func (e enum) String() string {
+	if e == 0xde1 {
+		return "GL_TEXTURE_2D"
+	}
+	return fmt.Sprintf("enum(%d)", uint32(e))
+}
+
+type cmd struct {
+	Target  enum           `param:"target"`
+	Texture handle         `param:"texture"`
+	Level   int32          `param:"level"`
+	Scale   float32        `param:"scale"`
+	Name    string         `param:"name"`
+	Data    memory.Pointer `param:"data"`
+	Result  handle         `result:"true"`
+}
+
+func (c *cmd) Thread() uint64         { return 1 }
+func (c *cmd) SetThread(uint64)       {}
+func (c *cmd) CmdName() string        { return "glTest" }
+func (c *cmd) API() api.API           { return nil }
+func (c *cmd) CmdFlags() api.CmdFlags { return 0 }
+func (c *cmd) Extras() *api.CmdExtras { return nil }
+func (c *cmd) Mutate(context.Context, *api.State, *builder.Builder) error {
+	return nil
+}
+
+// object is a structure holding a handle.
+type object struct {
+	Kind    uint32
+	Texture handle
+}
+
+// useCmd is a command reading objects.
+type useCmd struct {
+	Count   uint32         `param:"count"`
+	Objects memory.Pointer `param:"objects"`
+	extras  api.CmdExtras
+}
+
+func (c *useCmd) Thread() uint64         { return 1 }
+func (c *useCmd) SetThread(uint64)       {}
+func (c *useCmd) CmdName() string        { return "glUse" }
+func (c *useCmd) API() api.API           { return nil }
+func (c *useCmd) CmdFlags() api.CmdFlags { return 0 }
+func (c *useCmd) Extras() *api.CmdExtras { return &c.extras }
+func (c *useCmd) Mutate(context.Context, *api.State, *builder.Builder) error {
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	target := &cpp.Target{
+		Remap: func(v interface{}, cmd api.Cmd, s *api.State) (interface{}, bool) {
+			h, ok := v.(handle)
+			return h, ok
+		},
+	}
+	cmds := []api.Cmd{
+		&cmd{
+			Target:  0xde1,
+			Texture: 5,
+			Level:   -1,
+			Scale:   0.5,
+			Name:    "a\"b?",
+			Data:    memory.BytePtr(0x1000, memory.ApplicationPool),
+			Result:  7,
+		},
+	}
+	// Two objects, holding the texture returned by the first command and a
+	// texture that was not returned.
+	objects, err := database.Store(ctx, []byte{1, 0, 0, 0, 7, 0, 0, 0, 1, 0, 0, 0, 9, 0, 0, 0})
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	use := &useCmd{Count: 2, Objects: memory.NewPtr(0x2000, memory.ApplicationPool, reflect.TypeOf(object{}))}
+	use.extras.GetOrAppendObservations().AddRead(memory.Range{Base: 0x2000, Size: 16}, objects)
+	cmds = append(cmds, use)
+	s := api.NewStateWithEmptyAllocator(device.Little64)
+	files, err := cpp.Export(ctx, cmds, target, s)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+
+	byName := map[string]string{}
+	for _, f := range files {
+		byName[f.Name] = string(f.Data)
+	}
+	for _, test := range []struct {
+		file     string
+		expected string
+	}{
+		{"commands_0.cpp", `r.bind(1, 0x7, P(glTest)(U(3553) /* GL_TEXTURE_2D */, H(0, 0x5), I(-1), F(0.5), S("a\"b\?"), M(0x1000)));`},
+		{"commands_0.cpp", fmt.Sprintf("r.load(0x2000, 16, \"resources/%v.bin\");\n  r.patch(0x2004, 4, 1, 0x7);\n  P(glUse)", objects)},
+		{"main.cpp", "  commands_0(r);\n"},
+		{"CMakeLists.txt", "    commands_0.cpp\n"},
+	} {
+		assert.For(ctx, "%v contains %v", test.file, test.expected).
+			That(strings.Contains(byName[test.file], test.expected)).Equals(true)
+	}
+}
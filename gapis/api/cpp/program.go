@@ -0,0 +1,470 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// generated is the comment at the top of the generated sources.
+const generated = "// Generated by gapit export-cpp.\n"
+
+func (e *exporter) cmakeLists(sources []string) string {
+	b := &bytes.Buffer{}
+	b.WriteString("# Generated by gapit export-cpp.\n\n")
+	b.WriteString("cmake_minimum_required(VERSION 3.7)\n")
+	b.WriteString("project(replay CXX)\n\n")
+	b.WriteString("set(CMAKE_CXX_STANDARD 17)\n")
+	b.WriteString("set(CMAKE_CXX_STANDARD_REQUIRED ON)\n\n")
+	b.WriteString("add_executable(replay\n    main.cpp\n    replay.cpp\n    api.cpp\n    regions.cpp\n")
+	for _, s := range sources {
+		fmt.Fprintf(b, "    %s.cpp\n", s)
+	}
+	b.WriteString(")\n")
+	if len(e.target.Libraries) > 0 {
+		fmt.Fprintf(b, "target_link_libraries(replay %s)\n", strings.Join(e.target.Libraries, " "))
+	}
+	return b.String()
+}
+
+var replayHeader = template.Must(template.New("replay.h").Parse(generated + `
+#ifndef REPLAY_H
+#define REPLAY_H
+{{range .Defines}}
+#define {{.}}{{end}}
+{{range .Headers}}
+#include <{{.}}>{{end}}
+
+#include <cmath>
+#include <cstddef>
+#include <cstdint>
+#include <cstring>
+#include <initializer_list>
+#include <map>
+#include <string>
+#include <type_traits>
+#include <utility>
+#include <vector>
+
+// Region is a range of the memory of the captured application.
+struct Region {
+  uint64_t base;
+  uint64_t size;
+};
+
+extern const Region kRegions[];
+extern const size_t kRegionCount;
+
+template <typename T>
+uint64_t to_bits(T v) {
+  if constexpr (std::is_pointer<T>::value) {
+    return static_cast<uint64_t>(reinterpret_cast<uintptr_t>(v));
+  } else {
+    return static_cast<uint64_t>(v);
+  }
+}
+
+template <typename T>
+T from_bits(uint64_t v) {
+  if constexpr (std::is_pointer<T>::value) {
+    return reinterpret_cast<T>(static_cast<uintptr_t>(v));
+  } else {
+    return static_cast<T>(v);
+  }
+}
+
+// Replay holds the memory and the handles of the replay.
+class Replay {
+ public:
+  Replay(const char* root, const Region* regions, size_t count);
+
+  // ptr returns the replay address of the captured address addr.
+  void* ptr(uint64_t addr);
+
+  // load copies the resource of size bytes to the captured address addr.
+  void load(uint64_t addr, uint64_t size, const char* resource);
+
+  // map makes the captured addresses [addr, addr + size) refer to the memory
+  // at host, until unmap is called with addr.
+  void map(uint64_t addr, uint64_t size, void* host);
+  void unmap(uint64_t addr);
+
+  // out returns the value of type T at the captured address addr.
+  template <typename T>
+  T out(uint64_t addr) {
+    T v;
+    memcpy(&v, ptr(addr), sizeof(T));
+    return v;
+  }
+
+  // proc returns the address of the API function name.
+  void* proc(const char* name);
+
+  // handle returns the replay value of the handle in the slot, or captured if
+  // the slot is empty.
+  uint64_t handle(int slot, uint64_t captured) const;
+
+  // bind sets the replay value of the handle in the slot, and returns it.
+  template <typename T>
+  T bind(int slot, uint64_t captured, T value) {
+    set_handle(slot, to_bits(value));
+    return value;
+  }
+
+  // bind_out sets the replay values of the handles in the slots from the
+  // values of size bytes written at the captured address addr.
+  void bind_out(uint64_t addr, size_t size,
+                std::initializer_list<std::pair<int, uint64_t>> handles);
+
+  // patch writes the replay value of the handle in the slot, of size bytes,
+  // to the captured address addr.
+  void patch(uint64_t addr, size_t size, int slot, uint64_t captured);
+
+ private:
+  struct Mapping {
+    uint64_t size;
+    uint8_t* host;
+  };
+
+  static uint8_t* find(std::map<uint64_t, Mapping>& mappings, uint64_t addr);
+  void set_handle(int slot, uint64_t value);
+
+  std::string root_;
+  std::map<uint64_t, Mapping> regions_;
+  std::map<uint64_t, Mapping> mappings_;
+  std::map<int, uint64_t> handles_;
+  std::map<std::string, void*> procs_;
+  std::vector<uint8_t> scratch_;
+  bool warned_ = false;
+};
+
+// replay returns the running Replay.
+Replay& replay();
+
+// lookup returns the address of the API function name, or nullptr.
+void* lookup(const char* name);
+
+// initialize prepares the replay of the API.
+void initialize(Replay& r);
+
+// P returns the API function f.
+#define P(f) reinterpret_cast<decltype(&f)>(replay().proc(#f))
+
+// The arguments of the replayed calls, converted to the types of the
+// parameters they are passed to: U and I are integers, F is a floating-point
+// number, S is a string, M is a captured address and H is a captured handle.
+struct U {
+  explicit U(uint64_t v) : v(v) {}
+  template <typename T>
+  operator T() const {
+    return from_bits<T>(v);
+  }
+  uint64_t v;
+};
+
+struct I {
+  explicit I(int64_t v) : v(v) {}
+  template <typename T>
+  operator T() const {
+    if constexpr (std::is_pointer<T>::value) {
+      return from_bits<T>(static_cast<uint64_t>(v));
+    } else {
+      return static_cast<T>(v);
+    }
+  }
+  int64_t v;
+};
+
+struct F {
+  explicit F(double v) : v(v) {}
+  template <typename T>
+  operator T() const {
+    return static_cast<T>(v);
+  }
+  double v;
+};
+
+struct S {
+  explicit S(const char* v) : v(v) {}
+  template <typename T>
+  operator T*() const {
+    return reinterpret_cast<T*>(const_cast<char*>(v));
+  }
+  const char* v;
+};
+
+struct M {
+  explicit M(uint64_t addr) : addr(addr) {}
+  template <typename T>
+  operator T*() const {
+    if constexpr (std::is_function<T>::value) {
+      return nullptr;  // The callbacks of the application are not replayed.
+    } else {
+      return static_cast<T*>(replay().ptr(addr));
+    }
+  }
+  uint64_t addr;
+};
+
+struct H {
+  H(int slot, uint64_t v) : slot(slot), v(v) {}
+  template <typename T>
+  operator T() const {
+    return from_bits<T>(replay().handle(slot, v));
+  }
+  int slot;
+  uint64_t v;
+};
+{{.Declarations}}
+#endif  // REPLAY_H
+`))
+
+func (e *exporter) replayHeader() string {
+	b := &bytes.Buffer{}
+	if err := replayHeader.Execute(b, e.target); err != nil {
+		panic(err) // The template is static.
+	}
+	return b.String()
+}
+
+func (e *exporter) regionsSource() string {
+	b := &bytes.Buffer{}
+	b.WriteString(generated)
+	b.WriteString("\n#include \"replay.h\"\n\nconst Region kRegions[] = {\n")
+	for _, r := range e.regions {
+		fmt.Fprintf(b, "    {0x%x, 0x%x},\n", r.Start, r.End-r.Start)
+	}
+	if len(e.regions) == 0 {
+		b.WriteString("    {0, 0},\n")
+	}
+	fmt.Fprintf(b, "};\n\nconst size_t kRegionCount = %d;\n", len(e.regions))
+	return b.String()
+}
+
+func (e *exporter) mainSource(sources []string) string {
+	b := &bytes.Buffer{}
+	b.WriteString(generated)
+	b.WriteString("\n#include \"replay.h\"\n\n")
+	for _, s := range sources {
+		fmt.Fprintf(b, "void %s(Replay& r);\n", s)
+	}
+	b.WriteString("\n// Usage: replay [directory of the resources]\n")
+	b.WriteString("int main(int argc, char** argv) {\n")
+	b.WriteString("  Replay r(argc > 1 ? argv[1] : \".\", kRegions, kRegionCount);\n")
+	b.WriteString("  initialize(r);\n")
+	for _, s := range sources {
+		fmt.Fprintf(b, "  %s(r);\n", s)
+	}
+	b.WriteString("  return 0;\n}\n")
+	return b.String()
+}
+
+// runtime is the C++ source of the API independent part of the runtime.
+const runtime = `
+#include "replay.h"
+
+#include <cstdio>
+#include <cstdlib>
+
+#ifdef _WIN32
+#include <windows.h>
+#else
+#include <sys/mman.h>
+#endif
+
+namespace {
+
+Replay* current = nullptr;
+
+const size_t kScratchSize = 16 << 20;
+
+// allocate returns size bytes of zeroed memory, at the address base if it is
+// available.
+uint8_t* allocate(uint64_t base, uint64_t size) {
+  void* hint = nullptr;
+  if (base <= UINTPTR_MAX) {
+    hint = reinterpret_cast<void*>(static_cast<uintptr_t>(base));
+  }
+#ifdef _WIN32
+  void* p = VirtualAlloc(hint, size, MEM_RESERVE | MEM_COMMIT, PAGE_READWRITE);
+  if (p == nullptr) {
+    p = VirtualAlloc(nullptr, size, MEM_RESERVE | MEM_COMMIT, PAGE_READWRITE);
+  }
+#else
+  void* p = mmap(hint, size, PROT_READ | PROT_WRITE,
+                 MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+  if (p == MAP_FAILED) {
+    p = nullptr;
+  }
+#endif
+  if (p == nullptr) {
+    fprintf(stderr, "Failed to allocate %llu bytes\n",
+            static_cast<unsigned long long>(size));
+    abort();
+  }
+  return static_cast<uint8_t*>(p);
+}
+
+}  // namespace
+
+Replay& replay() { return *current; }
+
+Replay::Replay(const char* root, const Region* regions, size_t count)
+    : root_(root), scratch_(kScratchSize) {
+  current = this;
+  size_t moved = 0;
+  for (size_t i = 0; i < count; i++) {
+    uint8_t* host = allocate(regions[i].base, regions[i].size);
+    if (reinterpret_cast<uintptr_t>(host) != regions[i].base) {
+      moved++;
+    }
+    regions_[regions[i].base] = Mapping{regions[i].size, host};
+  }
+  if (moved > 0) {
+    fprintf(stderr,
+            "Warning: %zu of %zu memory regions are not at their captured "
+            "address. The pointers stored in memory to these regions are not "
+            "valid.\n",
+            moved, count);
+  }
+}
+
+uint8_t* Replay::find(std::map<uint64_t, Mapping>& mappings, uint64_t addr) {
+  auto it = mappings.upper_bound(addr);
+  if (it == mappings.begin()) {
+    return nullptr;
+  }
+  --it;
+  if (addr - it->first >= it->second.size) {
+    return nullptr;
+  }
+  return it->second.host + (addr - it->first);
+}
+
+void* Replay::ptr(uint64_t addr) {
+  if (addr == 0) {
+    return nullptr;
+  }
+  if (uint8_t* p = find(mappings_, addr)) {
+    return p;
+  }
+  if (uint8_t* p = find(regions_, addr)) {
+    return p;
+  }
+  if (!warned_) {
+    fprintf(stderr,
+            "Warning: address 0x%llx was not observed, using scratch "
+            "memory.\n",
+            static_cast<unsigned long long>(addr));
+    warned_ = true;
+  }
+  return scratch_.data();
+}
+
+void Replay::load(uint64_t addr, uint64_t size, const char* resource) {
+  std::string path = root_ + "/" + resource;
+  FILE* f = fopen(path.c_str(), "rb");
+  if (f == nullptr) {
+    fprintf(stderr, "Failed to open %s\n", path.c_str());
+    abort();
+  }
+  uint8_t* dst = static_cast<uint8_t*>(ptr(addr));
+  size_t n = fread(dst, 1, size, f);
+  fclose(f);
+  if (n != size) {
+    fprintf(stderr, "Failed to read %s\n", path.c_str());
+    abort();
+  }
+}
+
+void Replay::patch(uint64_t addr, size_t size, int slot, uint64_t captured) {
+  uint64_t v = handle(slot, captured);
+  memcpy(ptr(addr), &v, size < sizeof(v) ? size : sizeof(v));
+}
+
+void Replay::map(uint64_t addr, uint64_t size, void* host) {
+  mappings_[addr] = Mapping{size, static_cast<uint8_t*>(host)};
+}
+
+void Replay::unmap(uint64_t addr) { mappings_.erase(addr); }
+
+void* Replay::proc(const char* name) {
+  auto it = procs_.find(name);
+  if (it != procs_.end()) {
+    return it->second;
+  }
+  void* p = lookup(name);
+  if (p == nullptr) {
+    fprintf(stderr, "Function %s not found\n", name);
+    abort();
+  }
+  procs_[name] = p;
+  return p;
+}
+
+uint64_t Replay::handle(int slot, uint64_t captured) const {
+  auto it = handles_.find(slot);
+  return it != handles_.end() ? it->second : captured;
+}
+
+void Replay::set_handle(int slot, uint64_t value) { handles_[slot] = value; }
+
+void Replay::bind_out(uint64_t addr, size_t size,
+                      std::initializer_list<std::pair<int, uint64_t>> handles) {
+  const uint8_t* p = static_cast<const uint8_t*>(ptr(addr));
+  for (const auto& h : handles) {
+    uint64_t v = 0;
+    memcpy(&v, p, size < sizeof(v) ? size : sizeof(v));
+    set_handle(h.first, v);
+    p += size;
+  }
+}
+`
+
+// readme is the documentation of the exported program.
+const readme = `# Replay
+
+This program was generated by ` + "`gapit export-cpp`" + ` from a capture. It
+replays the commands of the capture by calling the API functions with the
+captured parameters.
+
+## Building
+
+    mkdir build && cd build
+    cmake ..
+    make
+
+## Running
+
+    ./build/replay [directory of the resources]
+
+The resources are loaded from the ` + "`resources`" + ` directory, relative to
+the current directory if none is given.
+
+## Limitations
+
+* The memory observed by the capture is allocated at the captured addresses
+  when they are available. Otherwise a warning is printed, and the pointers
+  stored in memory to the moved regions are not valid.
+* Object handles returned by the API are remapped when they are passed as
+  parameters, or stored in the arrays and structures passed to the API. The
+  structures chained by untyped pointers keep their captured handles.
+* Window system surfaces are not created. Rendering is done off-screen when
+  the API allows it.
+* Callbacks of the captured application are not called.
+`
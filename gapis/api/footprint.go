@@ -0,0 +1,48 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import "context"
+
+// FootprintObject is a single object of a state that holds memory.
+type FootprintObject struct {
+	// Key identifies the object across the mutations of a state. It is
+	// typically the pointer to the object in the state.
+	Key interface{}
+	// Kind is the kind of memory held by the object.
+	Kind MemoryKind
+	// Handle is the UI identity of the object.
+	Handle string
+	// Label is the optional debug label of the object.
+	Label string
+	// Size is the number of bytes held by the object.
+	Size uint64
+	// Aliased is true if the memory of the object is also reported by another
+	// object, for example a Vulkan image bound to device memory.
+	Aliased bool
+	// Resource is the resource of the object, or nil if the object is not a
+	// resource.
+	Resource Resource
+}
+
+// FootprintProvider is the interface implemented by APIs that can report the
+// memory held by the objects of their state.
+type FootprintProvider interface {
+	// AffectsFootprint returns true if the command cmd, which belongs to the
+	// API, may create, delete or resize the objects returned by Footprint.
+	AffectsFootprint(cmd Cmd) bool
+	// Footprint returns the objects of the API's state in s that hold memory.
+	Footprint(ctx context.Context, s *State) []FootprintObject
+}
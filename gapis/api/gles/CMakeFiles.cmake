@@ -20,11 +20,16 @@
 set(files
     api.go
     compat.go
+    compat_coverage.go
+    compat_rules.go
+    compat_rules_test.go
     compat_test.go
     constant_sets.go
     context.go
     convert.go
+    cpp_export.go
     custom_replay.go
+    custom_replay_test.go
     dead_code_elimination_test.go
     dependency_graph_behaviour_provider.go
     doc.go
@@ -34,10 +39,15 @@ set(files
     externs.go
     extras.go
     find_issues.go
+    footprint.go
+    footprint_test.go
+    fragment_tests.go
+    fragment_tests_test.go
     gles.go
     glsl_compat.go
     glsl_compat_test.go
     guess_semantics.go
+    handles.go
     helpers.go
     image.go
     issue_whitelist.go
@@ -45,6 +55,8 @@ set(files
     markers.go
     markers_test.go
     mutate.go
+    perf_analysis.go
+    perf_analysis_test.go
     read_framebuffer.go
     replay.go
     resolvables.pb.go
@@ -52,6 +64,8 @@ set(files
     resources.go
     resources_test.go
     state.go
+    stats.go
+    stats_test.go
     string.go
     stub_program.go
     stub_program_test.go
@@ -0,0 +1,123 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+)
+
+var _ api.CompatCoverageProvider = API{}
+
+// extensionVendors are the vendor suffixes of GLES extension command names.
+var extensionVendors = []string{
+	"ANDROID", "ANGLE", "APPLE", "ARM", "EXT", "IMG", "INTEL",
+	"KHR", "NV", "OES", "OVR", "QCOM",
+}
+
+// CompatCoverage implements api.CompatCoverageProvider.
+// The extensions are those exposed by the capture's contexts. Extension
+// commands are matched against the device's extensions by vendor namespace
+// only, so the command list is an approximation.
+func (API) CompatCoverage(ctx context.Context, cmds []api.Cmd, device *device.Instance) (*api.CompatReport, error) {
+	glDev := device.GetConfiguration().GetDrivers().GetOpenGL()
+	if glDev == nil {
+		return nil, fmt.Errorf("Device '%v' has no OpenGL driver", device.Name)
+	}
+	target := listToExtensions(glDev.Extensions)
+	handled := compatExtensions()
+
+	commands, exts := map[string]struct{}{}, map[string]struct{}{}
+	for _, cmd := range cmds {
+		if _, ok := cmd.API().(API); !ok {
+			continue
+		}
+		if cmd, ok := cmd.(*EglMakeCurrent); ok {
+			if scs := FindStaticContextState(cmd.Extras()); scs != nil {
+				for _, ext := range scs.Constants.Extensions {
+					if _, ok := handled[ext]; ok || target.get(ext) == supported {
+						continue
+					}
+					// Unsupported compressed texture formats are decompressed.
+					if len(getExtensionTextureFormats(ext)) == 0 {
+						exts[ext] = struct{}{}
+					}
+				}
+			}
+			continue
+		}
+		name := cmd.CmdName()
+		if _, ok := compatRules[name]; ok || !strings.HasPrefix(name, "gl") {
+			// EGL commands are not replayed directly, so only GL commands
+			// need to be supported by the device.
+			continue
+		}
+		if vendor := extensionVendor(name); vendor != "" && !target.hasVendor(vendor) {
+			commands[name] = struct{}{}
+		}
+	}
+
+	return &api.CompatReport{
+		Commands:   sortedKeys(commands),
+		Extensions: sortedKeys(exts),
+	}, nil
+}
+
+// compatExtensions returns the set of extensions that the compatibility
+// layer can replay on targets that do not support them.
+func compatExtensions() extensions {
+	out := extensions{}
+	for _, rule := range compatRules {
+		for _, ext := range rule.extensions {
+			out[ext] = struct{}{}
+		}
+	}
+	return out
+}
+
+// extensionVendor returns the vendor suffix of the extension command name, or
+// an empty string if name is not an extension command.
+func extensionVendor(name string) string {
+	for _, v := range extensionVendors {
+		if strings.HasSuffix(name, v) {
+			return v
+		}
+	}
+	return ""
+}
+
+// hasVendor returns true if e holds an extension of the vendor namespace.
+func (e extensions) hasVendor(vendor string) bool {
+	prefix := "GL_" + vendor + "_"
+	for ext := range e {
+		if strings.HasPrefix(ext, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
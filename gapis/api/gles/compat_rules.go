@@ -0,0 +1,970 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/math/u64"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/gles/glsl/ast"
+	"github.com/google/gapid/gapis/api/gles/glsl/preprocessor"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// compatRewrite rewrites the command cmd for the replay target described by
+// cs. c is the context bound on the command's thread.
+// If the rewrite writes its replacement commands to out, it returns true,
+// otherwise the unmodified cmd is written to out by the caller.
+type compatRewrite func(cs *compatState, ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool
+
+// compatRule is the compatibility rule for a single command.
+type compatRule struct {
+	rewrite compatRewrite
+	// extensions is the list of extensions used by the command that the
+	// rule makes replayable on targets that do not support them.
+	extensions []string
+}
+
+// compatRules is the table of compatibility rules, keyed by command name.
+// Commands without a rule are written unmodified, unless they are draw calls
+// or clears which go through MultiviewDraw.
+var compatRules = map[string]compatRule{
+	"glBindBuffer":                        {rewrite: (*compatState).bindBuffer},
+	"glBindTexture":                       {rewrite: (*compatState).bindTexture, extensions: []string{"GL_OES_EGL_image_external"}},
+	"glBindVertexArray":                   {rewrite: (*compatState).bindVertexArray},
+	"glBindVertexArrayOES":                {rewrite: (*compatState).bindVertexArray, extensions: []string{"GL_OES_vertex_array_object"}},
+	"glGenVertexArraysOES":                {rewrite: (*compatState).stripVertexArraySuffix, extensions: []string{"GL_OES_vertex_array_object"}},
+	"glDeleteVertexArraysOES":             {rewrite: (*compatState).stripVertexArraySuffix, extensions: []string{"GL_OES_vertex_array_object"}},
+	"glIsVertexArrayOES":                  {rewrite: (*compatState).stripVertexArraySuffix, extensions: []string{"GL_OES_vertex_array_object"}},
+	"glBindBufferRange":                   {rewrite: (*compatState).bindBufferRange},
+	"glDisableVertexAttribArray":          {rewrite: (*compatState).disableVertexAttribArray},
+	"glVertexAttrib4fv":                   {rewrite: (*compatState).vertexAttrib4fv},
+	"glShaderSource":                      {rewrite: (*compatState).shaderSource},
+	"glVertexAttribPointer":               {rewrite: (*compatState).vertexAttribPointer, extensions: []string{"GL_OES_vertex_half_float"}},
+	"glDrawArrays":                        {rewrite: (*compatState).drawArrays},
+	"glDrawElements":                      {rewrite: (*compatState).drawElements},
+	"glCompressedTexImage2D":              {rewrite: (*compatState).compressedTexImage},
+	"glCompressedTexSubImage2D":           {rewrite: (*compatState).compressedTexImage},
+	"glTexBufferEXT":                      {rewrite: (*compatState).texBuffer, extensions: []string{"GL_EXT_texture_buffer"}},
+	"glTexStorage1DEXT":                   {rewrite: (*compatState).texStorage, extensions: []string{"GL_EXT_texture_storage"}},
+	"glTexStorage2D":                      {rewrite: (*compatState).texStorage},
+	"glTexStorage2DEXT":                   {rewrite: (*compatState).texStorage, extensions: []string{"GL_EXT_texture_storage"}},
+	"glTexStorage2DMultisample":           {rewrite: (*compatState).texStorage},
+	"glTexStorage3D":                      {rewrite: (*compatState).texStorage},
+	"glTexStorage3DEXT":                   {rewrite: (*compatState).texStorage, extensions: []string{"GL_EXT_texture_storage"}},
+	"glTexStorage3DMultisample":           {rewrite: (*compatState).texStorage},
+	"glTexStorage3DMultisampleOES":        {rewrite: (*compatState).texStorage, extensions: []string{"GL_OES_texture_storage_multisample_2d_array"}},
+	"glTexImage2D":                        {rewrite: (*compatState).texImage},
+	"glTexImage3D":                        {rewrite: (*compatState).texImage},
+	"glTexImage3DOES":                     {rewrite: (*compatState).texImage, extensions: []string{"GL_OES_texture_3D"}},
+	"glTexSubImage2D":                     {rewrite: (*compatState).texImage},
+	"glTexSubImage3D":                     {rewrite: (*compatState).texImage},
+	"glTexSubImage3DOES":                  {rewrite: (*compatState).texImage, extensions: []string{"GL_OES_texture_3D"}},
+	"glCopyTexImage2D":                    {rewrite: (*compatState).texImage},
+	"glTexParameterIivOES":                {rewrite: (*compatState).texParameter, extensions: []string{"GL_OES_texture_border_clamp"}},
+	"glTexParameterIuivOES":               {rewrite: (*compatState).texParameter, extensions: []string{"GL_OES_texture_border_clamp"}},
+	"glTexParameterIiv":                   {rewrite: (*compatState).texParameter},
+	"glTexParameterIuiv":                  {rewrite: (*compatState).texParameter},
+	"glTexParameterf":                     {rewrite: (*compatState).texParameter},
+	"glTexParameterfv":                    {rewrite: (*compatState).texParameter},
+	"glTexParameteri":                     {rewrite: (*compatState).texParameter},
+	"glTexParameteriv":                    {rewrite: (*compatState).texParameter},
+	"glTexParameterIivEXT":                {rewrite: (*compatState).texParameter, extensions: []string{"GL_EXT_texture_border_clamp"}},
+	"glTexParameterIuivEXT":               {rewrite: (*compatState).texParameter, extensions: []string{"GL_EXT_texture_border_clamp"}},
+	"glProgramBinary":                     {rewrite: (*compatState).programBinary},
+	"glProgramBinaryOES":                  {rewrite: (*compatState).programBinary, extensions: []string{"GL_OES_get_program_binary"}},
+	"glHint":                              {rewrite: (*compatState).hint},
+	"glEnable":                            {rewrite: (*compatState).enable, extensions: []string{"GL_EXT_sRGB_write_control"}},
+	"glDisable":                           {rewrite: (*compatState).disable, extensions: []string{"GL_QCOM_alpha_test"}},
+	"glBindFramebuffer":                   {rewrite: (*compatState).bindFramebuffer, extensions: []string{"GL_EXT_sRGB_write_control"}},
+	"glMapBufferOES":                      {rewrite: (*compatState).stripBufferSuffix, extensions: []string{"GL_OES_mapbuffer"}},
+	"glUnmapBufferOES":                    {rewrite: (*compatState).stripBufferSuffix, extensions: []string{"GL_OES_mapbuffer"}},
+	"glMapBufferRangeEXT":                 {rewrite: (*compatState).stripBufferSuffix, extensions: []string{"GL_EXT_map_buffer_range"}},
+	"glFlushMappedBufferRangeEXT":         {rewrite: (*compatState).stripBufferSuffix, extensions: []string{"GL_EXT_map_buffer_range"}},
+	"eglCreateImageKHR":                   {rewrite: (*compatState).createImage, extensions: []string{"EGL_KHR_image_base", "EGL_ANDROID_image_native_buffer"}},
+	"glEGLImageTargetTexture2DOES":        {rewrite: (*compatState).eglImageTargetTexture, extensions: []string{"GL_OES_EGL_image", "GL_OES_EGL_image_external"}},
+	"glRenderbufferStorageMultisampleEXT": {rewrite: (*compatState).multisampledRenderToTexture, extensions: []string{"GL_EXT_multisampled_render_to_texture"}},
+	"glFramebufferTexture2DMultisampleEXT": {
+		rewrite:    (*compatState).multisampledRenderToTexture,
+		extensions: []string{"GL_EXT_multisampled_render_to_texture"},
+	},
+	"glFramebufferTextureMultiviewOVR": {rewrite: (*compatState).framebufferTextureMultiview, extensions: []string{"GL_OVR_multiview", "GL_OVR_multiview2"}},
+	"glLinkProgram":                    {rewrite: (*compatState).linkProgram},
+
+	// Some applications iterate over all arrays and query their state.
+	// This may fail if the target supports fewer arrays than the capture.
+	// As these should have no side-effects, just drop them.
+	"glGetVertexAttribIiv":      {rewrite: (*compatState).drop},
+	"glGetVertexAttribIuiv":     {rewrite: (*compatState).drop},
+	"glGetVertexAttribPointerv": {rewrite: (*compatState).drop},
+	"glGetVertexAttribfv":       {rewrite: (*compatState).drop},
+	"glGetVertexAttribiv":       {rewrite: (*compatState).drop},
+
+	// Ignore - the callback function address is invalid in replay.
+	"glDebugMessageCallback":    {rewrite: (*compatState).drop},
+	"glDebugMessageControl":     {rewrite: (*compatState).drop},
+	"glDebugMessageCallbackKHR": {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+	"glDebugMessageControlKHR":  {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+
+	// The acceptable values of these get functions vary between GL versions.
+	// As these should have no side-effects, just drop them.
+	"glGetBooleani_v":       {rewrite: (*compatState).drop},
+	"glGetBooleanv":         {rewrite: (*compatState).drop},
+	"glGetFloatv":           {rewrite: (*compatState).drop},
+	"glGetInteger64i_v":     {rewrite: (*compatState).drop},
+	"glGetInteger64v":       {rewrite: (*compatState).drop},
+	"glGetIntegeri_v":       {rewrite: (*compatState).drop},
+	"glGetIntegerv":         {rewrite: (*compatState).drop},
+	"glGetInternalformativ": {rewrite: (*compatState).drop},
+	"glGetString":           {rewrite: (*compatState).drop},
+	"glGetStringi":          {rewrite: (*compatState).drop},
+
+	// The number of active attributes and uniforms can vary between compilers
+	// depending on their ability to eliminate dead code. In particular,
+	// dead code in pixel shader can allow code removal in the vertex shader.
+	// As these should have no side-effects, just drop them.
+	"glGetActiveAttrib":  {rewrite: (*compatState).drop},
+	"glGetActiveUniform": {rewrite: (*compatState).drop},
+
+	// Introduced as core in 4.3, but macOS caps out at 4.1.
+	// As this should have no side-effects, just drop them.
+	"glGetProgramInterfaceiv": {rewrite: (*compatState).drop},
+
+	// These methods require non-trivial remapping for replay.
+	// As they do not affect rendering output, just drop them.
+	"glLabelObjectEXT":    {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_debug_label"}},
+	"glGetObjectLabelEXT": {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_debug_label"}},
+	"glObjectLabel":       {rewrite: (*compatState).drop},
+	"glObjectLabelKHR":    {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+	"glGetObjectLabel":    {rewrite: (*compatState).drop},
+	"glObjectPtrLabel":    {rewrite: (*compatState).drop},
+	"glGetObjectPtrLabel": {rewrite: (*compatState).drop},
+	"glGetObjectLabelKHR": {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+
+	// Debug markers may not be supported on the replay device.
+	// As they do not affect rendering output, just drop them.
+	"glInsertEventMarkerEXT":  {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_debug_marker"}},
+	"glPushGroupMarkerEXT":    {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_debug_marker"}},
+	"glPopGroupMarkerEXT":     {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_debug_marker"}},
+	"glPushDebugGroup":        {rewrite: (*compatState).drop},
+	"glPopDebugGroup":         {rewrite: (*compatState).drop},
+	"glPushDebugGroupKHR":     {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+	"glPopDebugGroupKHR":      {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+	"glDebugMessageInsertKHR": {rewrite: (*compatState).drop, extensions: []string{"GL_KHR_debug"}},
+
+	// Program binaries are very driver specific. This command may fail on replay
+	// because one of the arguments must be GL_PROGRAM_BINARY_LENGTH.
+	// It has no side effects, so just drop it.
+	"glGetProgramBinary":    {rewrite: (*compatState).drop},
+	"glGetProgramBinaryOES": {rewrite: (*compatState).drop, extensions: []string{"GL_OES_get_program_binary"}},
+
+	// From extension GL_EXT_robustness
+	// It may not be implemented by the replay driver.
+	// It has no effect on rendering so just drop it.
+	"glGetGraphicsResetStatusEXT": {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_robustness"}},
+
+	// It may not be implemented by the replay driver.
+	// It is only a hint so we can just drop it.
+	// TODO: It has performance impact so we should not ignore it when profiling.
+	"glInvalidateFramebuffer": {rewrite: (*compatState).drop},
+	"glDiscardFramebufferEXT": {rewrite: (*compatState).drop, extensions: []string{"GL_EXT_discard_framebuffer"}},
+
+	// Removing the context would interfere with the EGLImage compat below,
+	// since TextureID remapping relies on being able to find the Context by ID.
+	"eglDestroyContext": {rewrite: (*compatState).drop},
+
+	// These extensions are not applicable on desktop.
+	"glStartTilingQCOM":                  {rewrite: (*compatState).dropOnDesktop, extensions: []string{"GL_QCOM_tiled_rendering"}},
+	"glEndTilingQCOM":                    {rewrite: (*compatState).dropOnDesktop, extensions: []string{"GL_QCOM_tiled_rendering"}},
+	"eglCreateNativeClientBufferANDROID": {rewrite: (*compatState).dropOnDesktop, extensions: []string{"EGL_ANDROID_create_native_client_buffer"}},
+}
+
+// compatRuleNames returns the sorted names of the commands that have a
+// compatibility rule.
+func compatRuleNames() []string {
+	out := make([]string, 0, len(compatRules))
+	for name := range compatRules {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (cs *compatState) drop(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	return true
+}
+
+func (cs *compatState) dropOnDesktop(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	return !cs.version.IsES
+}
+
+func (cs *compatState) bindBuffer(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	bind := cmd.(*GlBindBuffer)
+	if bind.Buffer != 0 && !c.Objects.Shared.GeneratedNames.Buffers[bind.Buffer] {
+		// glGenBuffers() was not used to generate the buffer. Legal in GLES 2.
+		cb := CommandBuilder{Thread: cmd.Thread()}
+		tmp := out.State().AllocDataOrPanic(ctx, bind.Buffer)
+		out.MutateAndWrite(ctx, id.Derived(), cb.GlGenBuffers(1, tmp.Ptr()).AddRead(tmp.Data()))
+	}
+	return false
+}
+
+func (cs *compatState) bindTexture(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	bind := *cmd.(*GlBindTexture)
+	if bind.Texture != 0 && !c.Objects.Shared.GeneratedNames.Textures[bind.Texture] {
+		// glGenTextures() was not used to generate the texture. Legal in GLES 2.
+		cb := CommandBuilder{Thread: cmd.Thread()}
+		tmp := out.State().AllocDataOrPanic(ctx, VertexArrayId(bind.Texture))
+		out.MutateAndWrite(ctx, id.Derived(), cb.GlGenTextures(1, tmp.Ptr()).AddRead(tmp.Data()))
+	}
+
+	cs.convertTexTarget(&bind.Target)
+
+	out.MutateAndWrite(ctx, id, &bind)
+	return true
+}
+
+func (cs *compatState) bindVertexArray(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	var array VertexArrayId
+	switch cmd := cmd.(type) {
+	case *GlBindVertexArray:
+		array = cmd.Array
+	case *GlBindVertexArrayOES:
+		array = cmd.Array
+	}
+	if array == VertexArrayId(0) {
+		if cs.target.vertexArrayObjects == required &&
+			cs.contexts[c].vertexArrayObjects != required {
+			// NB: This leaks state change upstream.
+			// In particular, when the tweaker saves and then restores vertex array binding,
+			// it will restore it to DefaultVertexArrayId instead of 0.  It is harmless.
+			cb := CommandBuilder{Thread: cmd.Thread()}
+			out.MutateAndWrite(ctx, id, cb.GlBindVertexArray(DefaultVertexArrayId))
+			return true
+		}
+	}
+	if _, ok := cmd.(*GlBindVertexArrayOES); ok && !cs.version.IsES { // Strip suffix on desktop.
+		cb := CommandBuilder{Thread: cmd.Thread()}
+		out.MutateAndWrite(ctx, id, cb.GlBindVertexArray(array))
+		return true
+	}
+	return false
+}
+
+// stripVertexArraySuffix replaces the vertex array object extension commands
+// with their core equivalents on desktop.
+func (cs *compatState) stripVertexArraySuffix(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	if cs.version.IsES {
+		return false
+	}
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	switch cmd := cmd.(type) {
+	case *GlGenVertexArraysOES:
+		core := cb.GlGenVertexArrays(cmd.Count, memory.Pointer(cmd.Arrays))
+		core.extras = cmd.extras
+		out.MutateAndWrite(ctx, id, core)
+	case *GlDeleteVertexArraysOES:
+		core := cb.GlDeleteVertexArrays(cmd.Count, memory.Pointer(cmd.Arrays))
+		core.extras = cmd.extras
+		out.MutateAndWrite(ctx, id, core)
+	case *GlIsVertexArrayOES:
+		out.MutateAndWrite(ctx, id, cb.GlIsVertexArray(cmd.Array, cmd.Result))
+	default:
+		return false
+	}
+	return true
+}
+
+func (cs *compatState) bindBufferRange(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	bind := cmd.(*GlBindBufferRange)
+	misalignment := bind.Offset % GLintptr(cs.glDev.UniformBufferAlignment)
+	if bind.Target != GLenum_GL_UNIFORM_BUFFER || misalignment == 0 {
+		return false
+	}
+
+	// We have a glBindBufferRange() taking a uniform buffer with an
+	// illegal offset alignment.
+	// TODO: We don't handle the case where the buffer is kept bound
+	// while the buffer is updated. It's an unlikely issue, but
+	// something that may break us.
+	if _, ok := c.Objects.Shared.Buffers[bind.Buffer]; !ok {
+		return true // Don't know what buffer this is referring to.
+	}
+
+	dID := id.Derived()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+
+	// We need a scratch buffer to copy the buffer data to a correct
+	// alignment.
+	key := struct {
+		c      *Context
+		Target GLenum
+		Index  GLuint
+	}{c, bind.Target, bind.Index}
+
+	// Look for pre-existing buffer we can reuse.
+	buffer, ok := cs.scratchBuffers[key]
+	if !ok {
+		buffer.id = cs.newBuffer(ctx, dID, cb, out)
+		cs.scratchBuffers[key] = buffer
+	}
+
+	// Bind the scratch buffer to GL_COPY_WRITE_BUFFER
+	origCopyWriteBuffer := c.Bound.CopyWriteBuffer
+	out.MutateAndWrite(ctx, dID, cb.GlBindBuffer(GLenum_GL_COPY_WRITE_BUFFER, buffer.id))
+
+	if buffer.size < bind.Size {
+		// Resize the scratch buffer
+		out.MutateAndWrite(ctx, dID, cb.GlBufferData(GLenum_GL_COPY_WRITE_BUFFER, bind.Size, memory.Nullptr, GLenum_GL_DYNAMIC_COPY))
+		buffer.size = bind.Size
+		cs.scratchBuffers[key] = buffer
+	}
+
+	// Copy out the misaligned data to the scratch buffer in the
+	// GL_COPY_WRITE_BUFFER binding.
+	out.MutateAndWrite(ctx, dID, cb.GlBindBuffer(bind.Target, bind.Buffer))
+	out.MutateAndWrite(ctx, dID, cb.GlCopyBufferSubData(bind.Target, GLenum_GL_COPY_WRITE_BUFFER, bind.Offset, 0, bind.Size))
+
+	// We can now bind the range with correct alignment.
+	out.MutateAndWrite(ctx, id, cb.GlBindBufferRange(bind.Target, bind.Index, buffer.id, 0, bind.Size))
+
+	// Restore old GL_COPY_WRITE_BUFFER binding.
+	out.MutateAndWrite(ctx, dID, cb.GlBindBuffer(GLenum_GL_COPY_WRITE_BUFFER, origCopyWriteBuffer.GetID()))
+
+	return true
+}
+
+func (cs *compatState) disableVertexAttribArray(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	// Ignore the call if it is redundant (i.e. it is already disabled).
+	// Some applications iterate over all arrays and explicitly disable them.
+	// This is a problem if the target supports fewer arrays than the capture.
+	location := cmd.(*GlDisableVertexAttribArray).Location
+	return c.Bound.VertexArray.VertexAttributeArrays[location].Enabled == GLboolean_GL_FALSE
+}
+
+func (cs *compatState) vertexAttrib4fv(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	attrib := cmd.(*GlVertexAttrib4fv)
+	s := out.State()
+	if oldAttrib, ok := c.Vertex.Attributes[attrib.Location]; ok {
+		oldValue := oldAttrib.Value.Read(ctx, attrib, s, nil /* builder */)
+		attrib.Mutate(ctx, s, nil /* no builder, just mutate */)
+		newAttrib := c.Vertex.Attributes[attrib.Location]
+		newValue := newAttrib.Value.Read(ctx, attrib, s, nil /* builder */)
+		if reflect.DeepEqual(oldValue, newValue) {
+			// Ignore the call if it is redundant.
+			// Some applications iterate over all arrays and explicitly initialize them.
+			// This is a problem if the target supports fewer arrays than the capture.
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *compatState) shaderSource(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	source := cmd.(*GlShaderSource)
+	s := out.State()
+
+	// Apply the state mutation of the unmodified glShaderSource atom.
+	// This is so we can grab the source string from the Shader object.
+	if err := source.Mutate(ctx, s, nil /* no builder, just mutate */); err != nil {
+		return true
+	}
+	shader := c.Objects.Shared.Shaders.Get(source.Shader)
+	src := ""
+
+	if config.UseGlslang {
+		opts := shadertools.Option{
+			IsFragmentShader: shader.Type == GLenum_GL_FRAGMENT_SHADER,
+			IsVertexShader:   shader.Type == GLenum_GL_VERTEX_SHADER,
+		}
+
+		res, err := shadertools.ConvertGlsl(shader.Source, &opts)
+		if err != nil {
+			log.E(ctx, "glShaderSource() compat: %v", err)
+			return true
+		}
+
+		src = res.SourceCode
+	} else {
+		lang := ast.LangVertexShader
+		switch shader.Type {
+		case GLenum_GL_VERTEX_SHADER:
+		case GLenum_GL_FRAGMENT_SHADER:
+			lang = ast.LangFragmentShader
+		default:
+			log.W(ctx, "Unknown shader type: %v", shader.Type)
+		}
+
+		exts := []preprocessor.Extension{}
+		if cs.target.textureMultisample == supported {
+			// TODO: Check that this extension is actually used by the shader.
+			exts = append(exts, preprocessor.Extension{
+				Name: "GL_ARB_texture_multisample", Behaviour: "enable",
+			})
+		}
+
+		var err error
+		src, err = glslCompat(ctx, shader.Source, lang, exts, cs.device)
+		if err != nil {
+			log.E(ctx, "Error reformatting GLSL source for command %d: %v", id, err)
+		}
+	}
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	tmpSrc := s.AllocDataOrPanic(ctx, src)
+	tmpPtrToSrc := s.AllocDataOrPanic(ctx, tmpSrc.Ptr())
+	cmd = cb.GlShaderSource(source.Shader, 1, tmpPtrToSrc.Ptr(), memory.Nullptr).
+		AddRead(tmpSrc.Data()).
+		AddRead(tmpPtrToSrc.Data())
+	out.MutateAndWrite(ctx, id, cmd)
+	tmpPtrToSrc.Free()
+	tmpSrc.Free()
+	return true
+}
+
+// TODO: glVertexAttribIPointer
+func (cs *compatState) vertexAttribPointer(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	ptr := cmd.(*GlVertexAttribPointer)
+	if ptr.Type == GLenum_GL_HALF_FLOAT_OES && cs.target.vertexHalfFloatOES == unsupported {
+		// Convert GL_HALF_FLOAT_OES to GL_HALF_FLOAT_ARB.
+		cb := CommandBuilder{Thread: cmd.Thread()}
+		ptr = cb.GlVertexAttribPointer(ptr.Location, ptr.Size, GLenum_GL_HALF_FLOAT_ARB, ptr.Normalized, ptr.Stride, memory.Pointer(ptr.Data))
+	}
+	vaa := c.Bound.VertexArray.VertexAttributeArrays[ptr.Location]
+	if cs.target.vertexArrayObjects == required && c.Bound.ArrayBuffer == nil {
+		// Client-pointers are not supported, we need to copy this data to a buffer.
+		// However, we can't do this now as the observation only happens at the draw call.
+		cs.clientVAs[vaa] = ptr
+	} else {
+		delete(cs.clientVAs, vaa)
+		out.MutateAndWrite(ctx, id, ptr)
+	}
+	return true
+}
+
+func (cs *compatState) drawArrays(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	draw := cmd.(*GlDrawArrays)
+	if cs.target.vertexArrayObjects == required {
+		if clientVAsBound(c, cs.clientVAs) {
+			first := uint32(draw.FirstIndex)
+			count := uint32(draw.IndicesCount)
+			t := newTweaker(out, id.Derived(), CommandBuilder{Thread: cmd.Thread()})
+			defer t.revert(ctx)
+			moveClientVBsToVAs(ctx, t, cs.clientVAs, first, count, id, cmd, out.State(), c, out)
+		}
+	}
+	MultiviewDraw(ctx, id, cmd, out)
+	return true
+}
+
+func (cs *compatState) drawElements(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	draw := cmd.(*GlDrawElements)
+	if cs.target.vertexArrayObjects != required {
+		MultiviewDraw(ctx, id, cmd, out)
+		return true
+	}
+
+	dID := id.Derived()
+	s := out.State()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	e := externs{ctx: ctx, cmd: cmd, s: s}
+	t := newTweaker(out, dID, cb)
+	defer t.revert(ctx)
+
+	ib := c.Bound.VertexArray.ElementArrayBuffer
+	clientIB := ib == nil
+	clientVB := clientVAsBound(c, cs.clientVAs)
+	if clientIB {
+		// The indices for the glDrawElements call is in client memory.
+		// We need to move this into a temporary buffer.
+
+		// Generate a new element array buffer and bind it.
+		bufID := t.glGenBuffer(ctx)
+		t.GlBindBuffer_ElementArrayBuffer(ctx, bufID)
+
+		// By moving the draw call's observations earlier, populate the element array buffer.
+		size, base := DataTypeSize(draw.IndicesType)*int(draw.IndicesCount), memory.Pointer(draw.Indices)
+		glBufferData := cb.GlBufferData(GLenum_GL_ELEMENT_ARRAY_BUFFER, GLsizeiptr(size), memory.Pointer(base), GLenum_GL_STATIC_DRAW)
+		glBufferData.extras = draw.extras
+		out.MutateAndWrite(ctx, dID, glBufferData)
+
+		if clientVB {
+			// Some of the vertex arrays for the glDrawElements call is in
+			// client memory and we need to move this into temporary buffer(s).
+			// The indices are also in client memory, so we need to apply the
+			// atom's reads now so that the indices can be read from the
+			// application pool.
+			draw.Extras().Observations().ApplyReads(s.Memory[memory.ApplicationPool])
+			indexSize := DataTypeSize(draw.IndicesType)
+			data := U8ᵖ(draw.Indices).Slice(0, uint64(indexSize*int(draw.IndicesCount)), s.MemoryLayout)
+			limits := e.calcIndexLimits(data, indexSize)
+			moveClientVBsToVAs(ctx, t, cs.clientVAs, limits.First, limits.Count, id, cmd, s, c, out)
+		}
+
+		draw := *draw
+		draw.Indices.addr = 0
+		MultiviewDraw(ctx, id, &draw, out)
+		return true
+
+	} else if clientVB { // GL_ELEMENT_ARRAY_BUFFER is bound
+		// Some of the vertex arrays for the glDrawElements call is in
+		// client memory and we need to move this into temporary buffer(s).
+		// The indices are server-side, so can just be read from the internal
+		// pooled buffer.
+		data := ib.Data
+		indexSize := DataTypeSize(draw.IndicesType)
+		start := u64.Min(draw.Indices.addr, data.count)                               // Clamp
+		end := u64.Min(start+uint64(indexSize)*uint64(draw.IndicesCount), data.count) // Clamp
+		limits := e.calcIndexLimits(data.Slice(start, end, s.MemoryLayout), indexSize)
+		moveClientVBsToVAs(ctx, t, cs.clientVAs, limits.First, limits.Count, id, cmd, s, c, out)
+	}
+	MultiviewDraw(ctx, id, cmd, out)
+	return true
+}
+
+func (cs *compatState) compressedTexImage(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	s := out.State()
+	switch cmd := cmd.(type) {
+	case *GlCompressedTexImage2D:
+		if _, supported := cs.target.compressedTextureFormats[cmd.Internalformat]; !supported {
+			err := decompressTexImage2D(ctx, id, cmd, s, out)
+			if err == nil {
+				return true
+			}
+			log.E(ctx, "Error decompressing texture: %v", err)
+		}
+	case *GlCompressedTexSubImage2D:
+		if _, supported := cs.target.compressedTextureFormats[cmd.Internalformat]; !supported {
+			err := decompressTexSubImage2D(ctx, id, cmd, s, out)
+			if err == nil {
+				return true
+			}
+			log.E(ctx, "Error decompressing texture: %v", err)
+		}
+	}
+	return false
+}
+
+func (cs *compatState) texBuffer(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	tb := cmd.(*GlTexBufferEXT)
+	if cs.version.AtLeastGL(3, 1) { // Strip suffix on desktop.
+		cb := CommandBuilder{Thread: cmd.Thread()}
+		out.MutateAndWrite(ctx, id, cb.GlTexBuffer(tb.Target, tb.Internalformat, tb.Buffer))
+		return true
+	}
+	return false
+}
+
+// TODO: glTexStorage functions are not guaranteed to be supported. Consider replacing with glTexImage calls.
+// TODO: Handle glTextureStorage family of functions - those use direct state access, not the bound texture.
+func (cs *compatState) texStorage(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	tc := cs.textureCompat
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	switch cmd := cmd.(type) {
+	case *GlTexStorage1DEXT:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				out.MutateAndWrite(ctx, id, cb.GlTexStorage1D(cmd.Target, cmd.Levels, cmd.Internalformat, cmd.Width))
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage2D:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage2DEXT:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				out.MutateAndWrite(ctx, id, cb.GlTexStorage2D(cmd.Target, cmd.Levels, cmd.Internalformat, cmd.Width, cmd.Height))
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage2DMultisample:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage3D:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage3DEXT:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				out.MutateAndWrite(ctx, id, cb.GlTexStorage3D(cmd.Target, cmd.Levels, cmd.Internalformat, cmd.Width, cmd.Height, cmd.Depth))
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage3DMultisample:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexStorage3DMultisampleOES:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				out.MutateAndWrite(ctx, id, cb.GlTexStorage3DMultisample(cmd.Target, cmd.Samples, cmd.Internalformat, cmd.Width, cmd.Height, cmd.Depth, cmd.Fixedsamplelocations))
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (cs *compatState) texImage(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	tc := cs.textureCompat
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	switch cmd := cmd.(type) {
+	case *GlTexImage2D:
+		{
+			cmd := *cmd
+			internalformat := GLenum(cmd.Internalformat)
+			tc.convertFormat(ctx, cmd.Target, &internalformat, &cmd.Format, &cmd.Type, out, id, &cmd)
+			cmd.Internalformat = GLint(internalformat)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexImage3D:
+		{
+			cmd := *cmd
+			internalformat := GLenum(cmd.Internalformat)
+			tc.convertFormat(ctx, cmd.Target, &internalformat, &cmd.Format, &cmd.Type, out, id, &cmd)
+			cmd.Internalformat = GLint(internalformat)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexImage3DOES:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, &cmd.Format, &cmd.Type, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				extras := cmd.extras
+				cmd := cb.GlTexImage3D(cmd.Target, cmd.Level, GLint(cmd.Internalformat), cmd.Width, cmd.Height, cmd.Depth, cmd.Border, cmd.Format, cmd.Type, memory.Pointer(cmd.Pixels))
+				cmd.extras = extras
+				out.MutateAndWrite(ctx, id, cmd)
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexSubImage2D:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, nil, &cmd.Format, &cmd.Type, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexSubImage3D:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, nil, &cmd.Format, &cmd.Type, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlTexSubImage3DOES:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, nil, &cmd.Format, &cmd.Type, out, id, &cmd)
+			if !cs.version.IsES { // Strip suffix on desktop.
+				extras := cmd.extras
+				cmd := cb.GlTexSubImage3D(cmd.Target, cmd.Level, cmd.Xoffset, cmd.Yoffset, cmd.Zoffset, cmd.Width, cmd.Height, cmd.Depth, cmd.Format, cmd.Type, memory.Pointer(cmd.Pixels))
+				cmd.extras = extras
+				out.MutateAndWrite(ctx, id, cmd)
+				return true
+			}
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	case *GlCopyTexImage2D:
+		{
+			cmd := *cmd
+			tc.convertFormat(ctx, cmd.Target, &cmd.Internalformat, nil, nil, out, id, &cmd)
+			out.MutateAndWrite(ctx, id, &cmd)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (cs *compatState) texParameter(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	var p api.Cmd
+	var target, pname GLenum
+	switch cmd := cmd.(type) {
+	case *GlTexParameterIivOES:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterIuivOES:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterIiv:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterIuiv:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterf:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Parameter
+	case *GlTexParameterfv:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameteri:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Parameter
+	case *GlTexParameteriv:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterIivEXT:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	case *GlTexParameterIuivEXT:
+		tp := *cmd
+		cs.convertTexTarget(&tp.Target)
+		p, target, pname = &tp, tp.Target, tp.Pname
+	default:
+		return false
+	}
+	out.MutateAndWrite(ctx, id, p)
+	cs.textureCompat.postTexParameter(ctx, target, pname, out, id, p)
+	return true
+}
+
+func (cs *compatState) programBinary(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	if canUsePrecompiledShader(c, cs.glDev) {
+		return false
+	}
+	var program ProgramId
+	switch cmd := cmd.(type) {
+	case *GlProgramBinary:
+		program = cmd.Program
+	case *GlProgramBinaryOES:
+		program = cmd.Program
+	}
+	for _, cmd := range buildStubProgram(ctx, cmd.Thread(), cmd.Extras(), out.State(), program) {
+		cs.t.Transform(ctx, id, cmd, out)
+	}
+	return true
+}
+
+func (cs *compatState) hint(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	if cmd.(*GlHint).Target == GLenum_GL_GENERATE_MIPMAP_HINT && !cs.target.supportGenerateMipmapHint {
+		return true // Not supported in the core profile of OpenGL.
+	}
+	return false
+}
+
+func (cs *compatState) enable(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	if cmd.(*GlEnable).Capability == GLenum_GL_FRAMEBUFFER_SRGB &&
+		cs.target.framebufferSrgb == required && cs.contexts[c].framebufferSrgb != required &&
+		c.Bound.DrawFramebuffer.GetID() == 0 {
+		// Ignore enabling of FRAMEBUFFER_SRGB if the capture device did not
+		// support an SRGB default framebuffer, but the replay device does. This
+		// is only done if the current bound draw framebuffer is the default
+		// framebuffer. The state is mutated so that when a non-default
+		// framebuffer is bound later on, FRAMEBUFFER_SRGB will be enabled.
+		// (see bindFramebuffer below)
+		cmd.Mutate(ctx, out.State(), nil /* no builder, just mutate */)
+		return true
+	}
+	return false
+}
+
+func (cs *compatState) disable(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	// GL_QCOM_alpha_test adds back GL_ALPHA_TEST from GLES 1.0 as extension.
+	// It seems that applications only disable it to make sure it is off, so
+	// we can safely ignore it. We should not ignore glEnable for it though.
+	return cmd.(*GlDisable).Capability == GLenum_GL_ALPHA_TEST_QCOM
+}
+
+// stripBufferSuffix replaces the buffer mapping extension commands with their
+// core equivalents on desktop.
+func (cs *compatState) stripBufferSuffix(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	if cs.version.IsES {
+		return false
+	}
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	switch cmd := cmd.(type) {
+	case *GlMapBufferOES:
+		out.MutateAndWrite(ctx, id, cb.GlMapBuffer(cmd.Target, cmd.Access, memory.Pointer(cmd.Result)))
+	case *GlMapBufferRangeEXT:
+		out.MutateAndWrite(ctx, id, cb.GlMapBufferRange(cmd.Target, cmd.Offset, cmd.Length, cmd.Access, memory.Pointer(cmd.Result)))
+	case *GlFlushMappedBufferRangeEXT:
+		core := cb.GlFlushMappedBufferRange(cmd.Target, cmd.Offset, cmd.Length)
+		core.extras = cmd.extras
+		out.MutateAndWrite(ctx, id, core)
+	case *GlUnmapBufferOES:
+		core := cb.GlUnmapBuffer(cmd.Target, cmd.Result)
+		core.extras = cmd.extras
+		out.MutateAndWrite(ctx, id, core)
+	default:
+		return false
+	}
+	return true
+}
+
+func (cs *compatState) bindFramebuffer(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	bind := cmd.(*GlBindFramebuffer)
+	if cs.target.framebufferSrgb == required && cs.contexts[c].framebufferSrgb != required &&
+		c.Pixel.FramebufferSrgb != 0 {
+		// Replay device defaults FRAMEBUFFER_SRGB to disabled and allows
+		// enabling it (desktop), while the capture device defaulted to enabled
+		// and may or may not have allowed it to be changed (GLES). While at the
+		// same time, we currently assume that the default frame buffer is not
+		// SRGB capable. Thus, when SRGB is enabled in the state, and we're
+		// binding the default framebuffer, SRGB needs to be disabled, and
+		// specifically enabled when binding the non-default framebuffer.
+		// (If it was explicetly disabled in the capture, no change is needed.)
+		// TODO: Handle the use of the EGL KHR_gl_colorspace extension.
+		if bind.Target == GLenum_GL_FRAMEBUFFER || bind.Target == GLenum_GL_DRAW_FRAMEBUFFER {
+			dID := id.Derived()
+			cb := CommandBuilder{Thread: cmd.Thread()}
+			origSrgb := c.Pixel.FramebufferSrgb
+			if bind.Framebuffer == 0 {
+				out.MutateAndWrite(ctx, dID, cb.GlDisable(GLenum_GL_FRAMEBUFFER_SRGB))
+			} else {
+				out.MutateAndWrite(ctx, dID, cb.GlEnable(GLenum_GL_FRAMEBUFFER_SRGB))
+			}
+			// Change the replay driver state, but keep our mutated state,
+			// so we know what to do the next time we see glBindFramebuffer.
+			// TODO: Handle SRGB better.
+			c.Pixel.FramebufferSrgb = origSrgb
+		}
+	}
+	return false
+}
+
+func (cs *compatState) createImage(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	create := cmd.(*EglCreateImageKHR)
+	dID := id.Derived()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	out.MutateAndWrite(ctx, dID, cb.Custom(func(ctx context.Context, s *api.State, b *builder.Builder) error {
+		return create.Mutate(ctx, s, nil) // do not call, just mutate
+	}))
+
+	// Create GL texture as compat replacement of the EGL image
+	switch create.Target {
+	case EGLenum_EGL_GL_TEXTURE_2D:
+		{
+			// The mutate sets the target fileds
+		}
+	case EGLenum_EGL_NATIVE_BUFFER_ANDROID:
+		{
+			texId := cs.newTexture(ctx, id, cb, out)
+			t := newTweaker(out, dID, cb)
+			defer t.revert(ctx)
+			t.glBindTexture_2D(ctx, texId)
+			img := GetState(out.State()).EGLImages[create.Result].Image
+			sizedFormat := img.SizedFormat // Might be RGB565 which is not supported on desktop
+			cs.textureCompat.convertFormat(ctx, GLenum_GL_TEXTURE_2D, &sizedFormat, nil, nil, out, id, cmd)
+			out.MutateAndWrite(ctx, dID, cb.GlTexImage2D(GLenum_GL_TEXTURE_2D, 0, GLint(sizedFormat), img.Width, img.Height, 0, img.DataFormat, img.DataType, memory.Nullptr))
+
+			out.MutateAndWrite(ctx, dID, cb.Custom(func(ctx context.Context, s *api.State, b *builder.Builder) error {
+				GetState(s).EGLImages[create.Result].TargetContext = c.Identifier
+				GetState(s).EGLImages[create.Result].TargetTexture = texId
+				return nil
+			}))
+		}
+	}
+	return true
+}
+
+func (cs *compatState) eglImageTargetTexture(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	target := *cmd.(*GlEGLImageTargetTexture2DOES)
+	cs.convertTexTarget(&target.Target)
+	dID := id.Derived()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	out.MutateAndWrite(ctx, dID, cb.Custom(func(ctx context.Context, s *api.State, b *builder.Builder) error {
+		return target.Mutate(ctx, s, nil) // do not call, just mutate
+	}))
+
+	// Rebind the currently bound 2D texture.  This might seem like a no-op, however,
+	// the remapping layer will use the ID of the EGL image replacement texture now.
+	out.MutateAndWrite(ctx, dID, cb.GlBindTexture(GLenum_GL_TEXTURE_2D, c.Bound.TextureUnit.Binding2d.ID))
+	return true
+}
+
+// EXT_multisampled_render_to_texture
+func (cs *compatState) multisampledRenderToTexture(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	// TODO: Support multi-sample rendering.
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	switch cmd := cmd.(type) {
+	case *GlRenderbufferStorageMultisampleEXT:
+		out.MutateAndWrite(ctx, id, cb.GlRenderbufferStorage(cmd.Target, cmd.Internalformat, cmd.Width, cmd.Height))
+	case *GlFramebufferTexture2DMultisampleEXT:
+		out.MutateAndWrite(ctx, id, cb.GlFramebufferTexture2D(cmd.Target, cmd.Attachment, cmd.Textarget, cmd.Texture, cmd.Level))
+	default:
+		return false
+	}
+	return true
+}
+
+func (cs *compatState) framebufferTextureMultiview(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	// The views are rendered one at a time by MultiviewDraw.
+	cmd.Mutate(ctx, out.State(), nil /* no builder, just mutate */)
+	return true
+}
+
+func (cs *compatState) linkProgram(ctx context.Context, id api.CmdID, cmd api.Cmd, c *Context, out transform.Writer) bool {
+	link := cmd.(*GlLinkProgram)
+	out.MutateAndWrite(ctx, id, cmd)
+	// Forcefully get all uniform locations, so that we can remap for applications that
+	// just assume locations (in particular, apps tend to assume arrays are consecutive)
+	// TODO: We should warn the developers that the consecutive layout is not guaranteed.
+	dID := id.Derived()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	prog := c.Objects.Shared.Programs[link.Program]
+	for _, uniformIndex := range prog.ActiveUniforms.KeysSorted() {
+		uniform := prog.ActiveUniforms[uniformIndex]
+		for i := 0; i < int(uniform.ArraySize); i++ {
+			name := fmt.Sprintf("%v[%v]", strings.TrimSuffix(uniform.Name, "[0]"), i)
+			loc := uniform.Location + UniformLocation(i) // TODO: Does not have to be consecutive
+			out.MutateAndWrite(ctx, dID, cb.GlGetUniformLocation(link.Program, name, loc))
+		}
+	}
+	return true
+}
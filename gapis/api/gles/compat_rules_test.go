@@ -0,0 +1,629 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/gles"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/atom"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+)
+
+const (
+	OpenGL_3_3    = "3.3"
+	OpenGL_ES_3_0 = "OpenGL ES 3.0"
+
+	captureVendor = "GAPID test"
+)
+
+var compatRuleNames = gles.VisibleForTestingCompatRuleNames
+
+// compatRuleTest is a test of the compatibility rule for a single command.
+type compatRuleTest struct {
+	name       string
+	target     string   // GL_VERSION of the replay device.
+	extensions []string // Extensions of the replay device.
+	setup      []api.Cmd
+	cmd        api.Cmd
+	expected   []string // Names of the commands written for cmd.
+	check      func(*testing.T, []api.Cmd)
+}
+
+func newCompatTestContext(t *testing.T) context.Context {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	h := &capture.Header{Abi: device.AndroidARMv7a}
+	capturePath, err := capture.New(ctx, "test", h, []api.Cmd{})
+	if err != nil {
+		panic(err)
+	}
+	ctx = capture.Put(ctx, capturePath)
+	return gles.PutUnusedIDMap(ctx)
+}
+
+func newCompatTestDevice(target string, extensions []string) *device.Instance {
+	return &device.Instance{Configuration: &device.Configuration{
+		Drivers: &device.Drivers{
+			OpenGL: &device.OpenGLDriver{
+				Version:                target,
+				Vendor:                 captureVendor,
+				Extensions:             extensions,
+				UniformBufferAlignment: 256,
+			},
+		},
+	}}
+}
+
+// makeCurrent returns the commands creating and binding a GLES 3.0 context on
+// thread 0, exposing the given extensions.
+func makeCurrent(extensions ...string) []api.Cmd {
+	cb := gles.CommandBuilder{Thread: 0}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	scs := gles.NewStaticContextState()
+	scs.Constants.Version = OpenGL_ES_3_0
+	scs.Constants.Vendor = captureVendor
+	scs.Constants.MajorVersion = 3
+	scs.Constants.Extensions = map[uint32]string{}
+	for i, e := range extensions {
+		scs.Constants.Extensions[uint32(i)] = e
+	}
+	eglMakeCurrent := cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0)
+	eglMakeCurrent.Extras().Add(scs, gles.NewDynamicContextState(64, 64, true))
+	return []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		eglMakeCurrent,
+	}
+}
+
+func (test compatRuleTest) run(ctx context.Context, t *testing.T) {
+	ctx = log.Enter(ctx, test.name)
+
+	transform, err := compat(ctx, newCompatTestDevice(test.target, test.extensions))
+	if !assert.For(ctx, "compat").ThatError(err).Succeeded() {
+		return
+	}
+
+	mw := &testcmd.Writer{S: newState(ctx)}
+	for _, cmd := range append(makeCurrent(), test.setup...) {
+		transform.Transform(ctx, api.CmdNoID, cmd, mw)
+	}
+	start := len(mw.Cmds)
+	transform.Transform(ctx, api.CmdNoID, test.cmd, mw)
+	got := mw.Cmds[start:]
+
+	names := make([]string, len(got))
+	for i, cmd := range got {
+		names[i] = cmd.CmdName()
+	}
+	if test.expected != nil && !reflect.DeepEqual(names, test.expected) {
+		t.Errorf("%v: %v produced unexpected commands.\nGot:      %v\nExpected: %v",
+			test.name, test.cmd.CmdName(), names, test.expected)
+		return
+	}
+	if test.check != nil {
+		test.check(t, got)
+	}
+}
+
+// indexOf returns the index of the first command named name in cmds, or -1.
+func indexOf(cmds []api.Cmd, name string) int {
+	for i, cmd := range cmds {
+		if cmd.CmdName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestCompatRules(t *testing.T) {
+	ctx := newCompatTestContext(t)
+	a := device.AndroidARMv7a.MemoryLayout
+	cb := gles.CommandBuilder{Thread: 0}
+
+	positions := []float32{-1., -1., 1., -1., -1., 1., 1., 1.}
+	attrib := []float32{1., 2., 3., 4.}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	img := memory.BytePtr(0x1000, memory.ApplicationPool)
+
+	tests := []compatRuleTest{
+		{
+			name:     "GenerateUnnamedBuffer",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindBuffer(gles.GLenum_GL_ARRAY_BUFFER, 10),
+			expected: []string{"glGenBuffers", "glBindBuffer"},
+		}, {
+			name:     "GenerateUnnamedTexture",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindTexture(gles.GLenum_GL_TEXTURE_2D, 10),
+			expected: []string{"glGenTextures", "glBindTexture"},
+		}, {
+			name:     "ExternalTextureTarget",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindTexture(gles.GLenum_GL_TEXTURE_EXTERNAL_OES, 0),
+			expected: []string{"glBindTexture"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlBindTexture).Target; got != gles.GLenum_GL_TEXTURE_2D {
+					t.Errorf("External texture target was not remapped: %v", got)
+				}
+			},
+		}, {
+			name:     "DefaultVertexArray",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindVertexArray(0),
+			expected: []string{"glBindVertexArray"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlBindVertexArray).Array; got != gles.DefaultVertexArrayId {
+					t.Errorf("Default vertex array was not remapped: %v", got)
+				}
+			},
+		}, {
+			name:     "DefaultVertexArrayES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlBindVertexArray(0),
+			expected: []string{"glBindVertexArray"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlBindVertexArray).Array; got != 0 {
+					t.Errorf("Default vertex array was unexpectedly remapped: %v", got)
+				}
+			},
+		}, {
+			name:     "VertexArrayOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindVertexArrayOES(5),
+			expected: []string{"glBindVertexArray"},
+		}, {
+			name:     "VertexArrayOESOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlBindVertexArrayOES(5),
+			expected: []string{"glBindVertexArrayOES"},
+		}, {
+			name:     "GenVertexArraysOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlGenVertexArraysOES(1, p(0x100000)),
+			expected: []string{"glGenVertexArrays"},
+		}, {
+			name:     "DeleteVertexArraysOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlDeleteVertexArraysOES(1, p(0x100000)),
+			expected: []string{"glDeleteVertexArrays"},
+		}, {
+			name:     "IsVertexArrayOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlIsVertexArrayOES(5, 0),
+			expected: []string{"glIsVertexArray"},
+		}, {
+			name:     "UnknownMisalignedUniformBuffer",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindBufferRange(gles.GLenum_GL_UNIFORM_BUFFER, 0, 10, 4, 16),
+			expected: []string{},
+		}, {
+			name:     "MisalignedUniformBuffer",
+			target:   OpenGL_3_3,
+			setup:    []api.Cmd{cb.GlBindBuffer(gles.GLenum_GL_UNIFORM_BUFFER, 10)},
+			cmd:      cb.GlBindBufferRange(gles.GLenum_GL_UNIFORM_BUFFER, 0, 10, 4, 16),
+			expected: []string{"glGenBuffers", "glBindBuffer", "glBufferData", "glBindBuffer", "glCopyBufferSubData", "glBindBufferRange", "glBindBuffer"},
+		}, {
+			name:     "AlignedUniformBuffer",
+			target:   OpenGL_3_3,
+			setup:    []api.Cmd{cb.GlBindBuffer(gles.GLenum_GL_UNIFORM_BUFFER, 10)},
+			cmd:      cb.GlBindBufferRange(gles.GLenum_GL_UNIFORM_BUFFER, 0, 10, 256, 16),
+			expected: []string{"glBindBufferRange"},
+		}, {
+			name:     "RedundantDisableVertexAttribArray",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlDisableVertexAttribArray(0),
+			expected: []string{},
+		}, {
+			name:     "DisableVertexAttribArray",
+			target:   OpenGL_ES_3_0,
+			setup:    []api.Cmd{cb.GlEnableVertexAttribArray(0)},
+			cmd:      cb.GlDisableVertexAttribArray(0),
+			expected: []string{"glDisableVertexAttribArray"},
+		}, {
+			name:   "RedundantVertexAttrib4fv",
+			target: OpenGL_3_3,
+			setup: []api.Cmd{
+				cb.GlVertexAttrib4fv(0, p(0x100000)).
+					AddRead(atom.Data(ctx, a, p(0x100000), attrib)),
+			},
+			cmd: cb.GlVertexAttrib4fv(0, p(0x100000)).
+				AddRead(atom.Data(ctx, a, p(0x100000), attrib)),
+			expected: []string{},
+		}, {
+			name:   "HalfFloatVertexAttribPointer",
+			target: OpenGL_ES_3_0,
+			cmd: cb.GlVertexAttribPointer(0, 2, gles.GLenum_GL_HALF_FLOAT_OES, gles.GLboolean(0), 4, p(0x100000)).
+				AddRead(atom.Data(ctx, a, p(0x100000), positions)),
+			expected: []string{"glVertexAttribPointer"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlVertexAttribPointer).Type; got != gles.GLenum_GL_HALF_FLOAT_ARB {
+					t.Errorf("GL_HALF_FLOAT_OES was not converted: %v", got)
+				}
+			},
+		}, {
+			name:   "ClientVertexAttribPointer",
+			target: OpenGL_3_3,
+			cmd: cb.GlVertexAttribPointer(0, 2, gles.GLenum_GL_FLOAT, gles.GLboolean(0), 8, p(0x100000)).
+				AddRead(atom.Data(ctx, a, p(0x100000), positions)),
+			expected: []string{}, // Postponed until the draw call.
+		}, {
+			name:   "ClientVertexArrayDraw",
+			target: OpenGL_3_3,
+			setup: []api.Cmd{
+				cb.GlEnableVertexAttribArray(0),
+				cb.GlVertexAttribPointer(0, 2, gles.GLenum_GL_FLOAT, gles.GLboolean(0), 8, p(0x100000)),
+			},
+			cmd: cb.GlDrawArrays(gles.GLenum_GL_TRIANGLE_STRIP, 0, 4).
+				AddRead(atom.Data(ctx, a, p(0x100000), positions)),
+			check: func(t *testing.T, cmds []api.Cmd) {
+				data, draw := indexOf(cmds, "glBufferData"), indexOf(cmds, "glDrawArrays")
+				if data < 0 || draw < data {
+					t.Errorf("Client vertex data was not moved to a buffer before the draw call: %v", cmds)
+				}
+			},
+		}, {
+			name:     "DrawArrays",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlDrawArrays(gles.GLenum_GL_TRIANGLES, 0, 3),
+			expected: []string{"glDrawArrays"},
+		}, {
+			name:     "DrawElements",
+			target:   OpenGL_ES_3_0,
+			setup:    []api.Cmd{cb.GlBindBuffer(gles.GLenum_GL_ELEMENT_ARRAY_BUFFER, 10)},
+			cmd:      cb.GlDrawElements(gles.GLenum_GL_TRIANGLES, 3, gles.GLenum_GL_UNSIGNED_SHORT, memory.Nullptr),
+			expected: []string{"glDrawElements"},
+		}, {
+			name:       "SupportedCompressedTexture",
+			target:     OpenGL_3_3,
+			extensions: []string{"GL_EXT_texture_compression_s3tc"},
+			cmd:        cb.GlCompressedTexImage2D(gles.GLenum_GL_TEXTURE_2D, 0, gles.GLenum_GL_COMPRESSED_RGB_S3TC_DXT1_EXT, 4, 4, 0, 8, p(0x100000)),
+			expected:   []string{"glCompressedTexImage2D"},
+		}, {
+			name:       "SupportedCompressedSubTexture",
+			target:     OpenGL_3_3,
+			extensions: []string{"GL_EXT_texture_compression_s3tc"},
+			cmd:        cb.GlCompressedTexSubImage2D(gles.GLenum_GL_TEXTURE_2D, 0, 0, 0, 4, 4, gles.GLenum_GL_COMPRESSED_RGB_S3TC_DXT1_EXT, 8, p(0x100000)),
+			expected:   []string{"glCompressedTexSubImage2D"},
+		}, {
+			name:     "TexBufferEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexBufferEXT(gles.GLenum_GL_TEXTURE_BUFFER, gles.GLenum_GL_RGBA8, 10),
+			expected: []string{"glTexBuffer"},
+		}, {
+			name:     "TexBufferEXTOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlTexBufferEXT(gles.GLenum_GL_TEXTURE_BUFFER, gles.GLenum_GL_RGBA8, 10),
+			expected: []string{"glTexBufferEXT"},
+		}, {
+			name:     "TexStorage1DEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage1DEXT(gles.GLenum_GL_TEXTURE_1D, 1, gles.GLenum_GL_RGBA8, 4),
+			expected: []string{"glTexStorage1D"},
+		}, {
+			name:     "TexStorage2D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage2D(gles.GLenum_GL_TEXTURE_2D, 1, gles.GLenum_GL_BGRA8_EXT, 4, 4),
+			expected: []string{"glTexStorage2D"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlTexStorage2D).Internalformat; got != gles.GLenum_GL_RGBA8 {
+					t.Errorf("GL_BGRA8_EXT was not converted: %v", got)
+				}
+			},
+		}, {
+			name:     "TexStorage2DEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage2DEXT(gles.GLenum_GL_TEXTURE_2D, 1, gles.GLenum_GL_RGBA8, 4, 4),
+			expected: []string{"glTexStorage2D"},
+		}, {
+			name:     "TexStorage2DEXTOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlTexStorage2DEXT(gles.GLenum_GL_TEXTURE_2D, 1, gles.GLenum_GL_RGBA8, 4, 4),
+			expected: []string{"glTexStorage2DEXT"},
+		}, {
+			name:     "TexStorage2DMultisample",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage2DMultisample(gles.GLenum_GL_TEXTURE_2D_MULTISAMPLE, 4, gles.GLenum_GL_RGBA8, 4, 4, gles.GLboolean(1)),
+			expected: []string{"glTexStorage2DMultisample"},
+		}, {
+			name:     "TexStorage3D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage3D(gles.GLenum_GL_TEXTURE_2D_ARRAY, 1, gles.GLenum_GL_RGBA8, 4, 4, 4),
+			expected: []string{"glTexStorage3D"},
+		}, {
+			name:     "TexStorage3DEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage3DEXT(gles.GLenum_GL_TEXTURE_2D_ARRAY, 1, gles.GLenum_GL_RGBA8, 4, 4, 4),
+			expected: []string{"glTexStorage3D"},
+		}, {
+			name:     "TexStorage3DMultisample",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage3DMultisample(gles.GLenum_GL_TEXTURE_2D_MULTISAMPLE_ARRAY, 4, gles.GLenum_GL_RGBA8, 4, 4, 4, gles.GLboolean(1)),
+			expected: []string{"glTexStorage3DMultisample"},
+		}, {
+			name:     "TexStorage3DMultisampleOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexStorage3DMultisampleOES(gles.GLenum_GL_TEXTURE_2D_MULTISAMPLE_ARRAY, 4, gles.GLenum_GL_RGBA8, 4, 4, 4, gles.GLboolean(1)),
+			expected: []string{"glTexStorage3DMultisample"},
+		}, {
+			name:     "TexImage2D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexImage2D(gles.GLenum_GL_TEXTURE_2D, 0, gles.GLint(gles.GLenum_GL_RGBA), 4, 4, 0, gles.GLenum_GL_RGBA, gles.GLenum_GL_HALF_FLOAT_OES, memory.Nullptr),
+			expected: []string{"glTexImage2D"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				cmd := cmds[0].(*gles.GlTexImage2D)
+				if cmd.Type != gles.GLenum_GL_HALF_FLOAT {
+					t.Errorf("GL_HALF_FLOAT_OES was not converted: %v", cmd.Type)
+				}
+				if gles.GLenum(cmd.Internalformat) == gles.GLenum_GL_RGBA {
+					t.Errorf("Unsized internal format was not converted: %v", cmd.Internalformat)
+				}
+			},
+		}, {
+			name:     "TexImage3D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexImage3D(gles.GLenum_GL_TEXTURE_3D, 0, gles.GLint(gles.GLenum_GL_RGBA8), 4, 4, 4, 0, gles.GLenum_GL_RGBA, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+			expected: []string{"glTexImage3D"},
+		}, {
+			name:     "TexImage3DOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexImage3DOES(gles.GLenum_GL_TEXTURE_3D, 0, gles.GLenum_GL_RGBA8, 4, 4, 4, 0, gles.GLenum_GL_RGBA, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+			expected: []string{"glTexImage3D"},
+		}, {
+			name:     "TexSubImage2D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexSubImage2D(gles.GLenum_GL_TEXTURE_2D, 0, 0, 0, 4, 4, gles.GLenum_GL_LUMINANCE, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+			expected: []string{"glTexSubImage2D"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlTexSubImage2D).Format; got != gles.GLenum_GL_RED {
+					t.Errorf("GL_LUMINANCE was not converted: %v", got)
+				}
+			},
+		}, {
+			name:     "TexSubImage3D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexSubImage3D(gles.GLenum_GL_TEXTURE_3D, 0, 0, 0, 0, 4, 4, 4, gles.GLenum_GL_RGBA, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+			expected: []string{"glTexSubImage3D"},
+		}, {
+			name:     "TexSubImage3DOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexSubImage3DOES(gles.GLenum_GL_TEXTURE_3D, 0, 0, 0, 0, 4, 4, 4, gles.GLenum_GL_RGBA, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+			expected: []string{"glTexSubImage3D"},
+		}, {
+			name:     "CopyTexImage2D",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlCopyTexImage2D(gles.GLenum_GL_TEXTURE_2D, 0, gles.GLenum_GL_RGBA8, 0, 0, 4, 4, 0),
+			expected: []string{"glCopyTexImage2D"},
+		}, {
+			name:     "ExternalTexParameter",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlTexParameteri(gles.GLenum_GL_TEXTURE_EXTERNAL_OES, gles.GLenum_GL_TEXTURE_MIN_FILTER, gles.GLint(gles.GLenum_GL_LINEAR)),
+			expected: []string{"glTexParameteri"},
+			check: func(t *testing.T, cmds []api.Cmd) {
+				if got := cmds[0].(*gles.GlTexParameteri).Target; got != gles.GLenum_GL_TEXTURE_2D {
+					t.Errorf("External texture target was not remapped: %v", got)
+				}
+			},
+		}, {
+			name:     "PrecompiledProgram",
+			target:   OpenGL_ES_3_0,
+			setup:    []api.Cmd{cb.GlCreateProgram(10)},
+			cmd:      cb.GlProgramBinary(10, 0, p(0x100000), 0),
+			expected: []string{"glProgramBinary"},
+		}, {
+			name:     "PrecompiledProgramOES",
+			target:   OpenGL_ES_3_0,
+			setup:    []api.Cmd{cb.GlCreateProgram(10)},
+			cmd:      cb.GlProgramBinaryOES(10, 0, p(0x100000), 0),
+			expected: []string{"glProgramBinaryOES"},
+		}, {
+			name:     "GenerateMipmapHint",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlHint(gles.GLenum_GL_GENERATE_MIPMAP_HINT, gles.GLenum_GL_FASTEST),
+			expected: []string{},
+		}, {
+			name:     "GenerateMipmapHintOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlHint(gles.GLenum_GL_GENERATE_MIPMAP_HINT, gles.GLenum_GL_FASTEST),
+			expected: []string{"glHint"},
+		}, {
+			name:     "EnableFramebufferSrgb",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlEnable(gles.GLenum_GL_FRAMEBUFFER_SRGB),
+			expected: []string{},
+		}, {
+			name:     "DisableAlphaTestQCOM",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlDisable(gles.GLenum_GL_ALPHA_TEST_QCOM),
+			expected: []string{},
+		}, {
+			name:     "BindDefaultFramebuffer",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlBindFramebuffer(gles.GLenum_GL_FRAMEBUFFER, 0),
+			expected: []string{"glDisable", "glBindFramebuffer"},
+		}, {
+			name:     "MapBufferOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlMapBufferOES(gles.GLenum_GL_ARRAY_BUFFER, gles.GLenum_GL_WRITE_ONLY_OES, memory.Nullptr),
+			expected: []string{"glMapBuffer"},
+		}, {
+			name:     "MapBufferOESOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlMapBufferOES(gles.GLenum_GL_ARRAY_BUFFER, gles.GLenum_GL_WRITE_ONLY_OES, memory.Nullptr),
+			expected: []string{"glMapBufferOES"},
+		}, {
+			name:     "MapBufferRangeEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlMapBufferRangeEXT(gles.GLenum_GL_ARRAY_BUFFER, 0, 16, gles.GLbitfield(2), memory.Nullptr),
+			expected: []string{"glMapBufferRange"},
+		}, {
+			name:     "FlushMappedBufferRangeEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlFlushMappedBufferRangeEXT(gles.GLenum_GL_ARRAY_BUFFER, 0, 16),
+			expected: []string{"glFlushMappedBufferRange"},
+		}, {
+			name:     "UnmapBufferOES",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlUnmapBufferOES(gles.GLenum_GL_ARRAY_BUFFER, gles.GLboolean(1)),
+			expected: []string{"glUnmapBuffer"},
+		}, {
+			name:     "CreateImageFromTexture",
+			target:   OpenGL_3_3,
+			cmd:      cb.EglCreateImageKHR(memory.Nullptr, ctxHandle, gles.EGLenum_EGL_GL_TEXTURE_2D, memory.Nullptr, memory.Nullptr, img),
+			expected: []string{"<Custom>"},
+		}, {
+			name:     "EGLImageTargetTexture",
+			target:   OpenGL_3_3,
+			setup:    []api.Cmd{cb.GlBindTexture(gles.GLenum_GL_TEXTURE_EXTERNAL_OES, 10)},
+			cmd:      cb.GlEGLImageTargetTexture2DOES(gles.GLenum_GL_TEXTURE_EXTERNAL_OES, img),
+			expected: []string{"<Custom>", "glBindTexture"},
+		}, {
+			name:     "RenderbufferStorageMultisampleEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlRenderbufferStorageMultisampleEXT(gles.GLenum_GL_RENDERBUFFER, 4, gles.GLenum_GL_RGBA8, 4, 4),
+			expected: []string{"glRenderbufferStorage"},
+		}, {
+			name:     "FramebufferTexture2DMultisampleEXT",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlFramebufferTexture2DMultisampleEXT(gles.GLenum_GL_FRAMEBUFFER, gles.GLenum_GL_COLOR_ATTACHMENT0, gles.GLenum_GL_TEXTURE_2D, 10, 0, 4),
+			expected: []string{"glFramebufferTexture2D"},
+		}, {
+			name:     "FramebufferTextureMultiviewOVR",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlFramebufferTextureMultiviewOVR(gles.GLenum_GL_FRAMEBUFFER, gles.GLenum_GL_COLOR_ATTACHMENT0, 10, 0, 0, 2),
+			expected: []string{},
+		}, {
+			name:     "LinkProgram",
+			target:   OpenGL_3_3,
+			setup:    []api.Cmd{cb.GlCreateProgram(10)},
+			cmd:      cb.GlLinkProgram(10),
+			expected: []string{"glLinkProgram"},
+		}, {
+			name:     "DestroyContext",
+			target:   OpenGL_3_3,
+			cmd:      cb.EglDestroyContext(memory.Nullptr, ctxHandle, 1),
+			expected: []string{},
+		}, {
+			name:     "TilingQCOM",
+			target:   OpenGL_3_3,
+			cmd:      cb.GlStartTilingQCOM(0, 0, 4, 4, 0),
+			expected: []string{},
+		}, {
+			name:     "TilingQCOMOnES",
+			target:   OpenGL_ES_3_0,
+			cmd:      cb.GlEndTilingQCOM(0),
+			expected: []string{"glEndTilingQCOM"},
+		},
+	}
+
+	// Commands that are always dropped by the compatibility layer.
+	for _, name := range []string{
+		"glGetVertexAttribIiv", "glGetVertexAttribIuiv", "glGetVertexAttribPointerv",
+		"glGetVertexAttribfv", "glGetVertexAttribiv",
+		"glDebugMessageCallback", "glDebugMessageControl",
+		"glDebugMessageCallbackKHR", "glDebugMessageControlKHR",
+		"glGetBooleani_v", "glGetBooleanv", "glGetFloatv", "glGetInteger64i_v",
+		"glGetInteger64v", "glGetIntegeri_v", "glGetIntegerv", "glGetInternalformativ",
+		"glGetString", "glGetStringi",
+		"glGetActiveAttrib", "glGetActiveUniform", "glGetProgramInterfaceiv",
+		"glLabelObjectEXT", "glGetObjectLabelEXT", "glObjectLabel", "glObjectLabelKHR",
+		"glGetObjectLabel", "glObjectPtrLabel", "glGetObjectPtrLabel", "glGetObjectLabelKHR",
+		"glInsertEventMarkerEXT", "glPushGroupMarkerEXT", "glPopGroupMarkerEXT",
+		"glPushDebugGroup", "glPopDebugGroup", "glPushDebugGroupKHR", "glPopDebugGroupKHR",
+		"glDebugMessageInsertKHR",
+		"glGetProgramBinary", "glGetProgramBinaryOES",
+		"glGetGraphicsResetStatusEXT",
+		"glInvalidateFramebuffer", "glDiscardFramebufferEXT",
+		"eglCreateNativeClientBufferANDROID",
+	} {
+		tests = append(tests, compatRuleTest{
+			name:     "Drop_" + name,
+			target:   OpenGL_3_3,
+			cmd:      gles.API{}.CreateCmd(name),
+			expected: []string{},
+		})
+	}
+
+	for _, test := range tests {
+		test.run(ctx, t)
+	}
+
+	// Check that every rule is exercised above, or by the other tests of the
+	// compatibility layer.
+	tested := map[string]bool{
+		"glShaderSource":        true, // TestShaderCompat
+		"glTexParameterIivOES":  true, // Same rule as glTexParameteri
+		"glTexParameterIuivOES": true,
+		"glTexParameterIiv":     true,
+		"glTexParameterIuiv":    true,
+		"glTexParameterf":       true,
+		"glTexParameterfv":      true,
+		"glTexParameteriv":      true,
+		"glTexParameterIivEXT":  true,
+		"glTexParameterIuivEXT": true,
+	}
+	for _, test := range tests {
+		tested[test.cmd.CmdName()] = true
+	}
+	untested := []string{}
+	for _, name := range compatRuleNames() {
+		if !tested[name] {
+			untested = append(untested, name)
+		}
+	}
+	assert.For(ctx, "untested rules").ThatSlice(untested).IsEmpty()
+}
+
+func TestCompatCoverage(t *testing.T) {
+	ctx := newCompatTestContext(t)
+	cb := gles.CommandBuilder{Thread: 0}
+
+	cmds := append(makeCurrent(
+		"GL_OES_vertex_array_object",      // Handled by the compatibility layer.
+		"GL_EXT_texture_compression_s3tc", // Decompressed on replay.
+		"GL_ARB_debug_output",             // Supported by the device.
+		"GL_OES_element_index_uint",       // Not handled.
+	),
+		cb.GlBindVertexArrayOES(5),
+		cb.GlTexImage3DOES(gles.GLenum_GL_TEXTURE_3D, 0, gles.GLenum_GL_RGBA8, 4, 4, 4, 0, gles.GLenum_GL_RGBA, gles.GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+		cb.GlBlendEquationiOES(0, gles.GLenum_GL_FUNC_ADD),
+		cb.GlDrawArrays(gles.GLenum_GL_TRIANGLES, 0, 3),
+	)
+
+	dev := newCompatTestDevice(OpenGL_3_3, []string{"GL_ARB_debug_output"})
+	report, err := gles.API{}.CompatCoverage(ctx, cmds, dev)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "commands").ThatSlice(report.Commands).Equals([]string{"glBlendEquationiOES"})
+	assert.For(ctx, "extensions").ThatSlice(report.Extensions).Equals([]string{"GL_OES_element_index_uint"})
+
+	// The device exposes OES extensions, so OES commands are assumed to be
+	// supported.
+	dev = newCompatTestDevice(OpenGL_ES_3_0, []string{"GL_ARB_debug_output", "GL_OES_element_index_uint"})
+	report, err = gles.API{}.CompatCoverage(ctx, cmds, dev)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "empty").That(report.Empty()).Equals(true)
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/cpp"
+)
+
+var _ cpp.Provider = API{}
+
+// CppTarget implements cpp.Provider.
+// The exported program renders off-screen, to an EGL pbuffer surface of the
+// size of the captured backbuffer.
+func (API) CppTarget() *cpp.Target {
+	return &cpp.Target{
+		Defines:      []string{"GL_GLEXT_PROTOTYPES", "EGL_EGLEXT_PROTOTYPES"},
+		Headers:      []string{"EGL/egl.h", "EGL/eglext.h", "GLES3/gl32.h", "GLES2/gl2ext.h"},
+		Libraries:    []string{"EGL", "GLESv2", "dl"},
+		Declarations: cppDeclarations,
+		Runtime:      cppRuntime,
+		Remap:        API{}.RemapHandle,
+		Statement:    cppStatement,
+	}
+}
+
+func cppStatement(ctx context.Context, c *cpp.Command) (string, error) {
+	switch cmd := c.Cmd.(type) {
+	case *EglMakeCurrent:
+		return cppMakeCurrent(cmd, cmd.Context.addr), nil
+	case *WglMakeCurrent:
+		return cppMakeCurrent(cmd, cmd.Hglrc.addr), nil
+	case *CGLSetCurrentContext:
+		return cppMakeCurrent(cmd, cmd.Ctx.addr), nil
+	case *GlXMakeContextCurrent:
+		return cppMakeCurrent(cmd, cmd.Ctx.addr), nil
+	case *GlXMakeCurrent:
+		return cppMakeCurrent(cmd, cmd.Ctx.addr), nil
+	case *GlLinkProgram:
+		return cppLinkProgram(c, cmd.Program), nil
+	}
+	name := c.Cmd.CmdName()
+	switch {
+	case strings.HasPrefix(name, "gl") && !strings.HasPrefix(name, "glX"):
+		return "", nil
+	case c.Cmd.CmdFlags().IsStartOfFrame():
+		return "swap_buffers();", nil
+	default:
+		return fmt.Sprintf("// %s is not replayed.", name), nil
+	}
+}
+
+// cppMakeCurrent returns the statement making the context current, with a
+// surface of the size of the captured backbuffer.
+func cppMakeCurrent(cmd api.Cmd, handle uint64) string {
+	width, height := GLsizei(0), GLsizei(0)
+	if cs := FindDynamicContextState(cmd.Extras()); cs != nil {
+		width, height = cs.BackbufferWidth, cs.BackbufferHeight
+	}
+	return fmt.Sprintf("make_current(0x%x, %d, %d);", handle, width, height)
+}
+
+// cppLinkProgram returns the statements linking the program with the captured
+// attribute locations, and remapping its uniform block indices.
+// See bindAttribLocations and bindUniformBlocks.
+func cppLinkProgram(c *cpp.Command, program ProgramId) string {
+	pi := FindProgramInfo(c.Cmd.Extras())
+	if pi == nil {
+		return ""
+	}
+	lines := []string{}
+	for _, i := range pi.ActiveAttributes.KeysSorted() {
+		attr := pi.ActiveAttributes[i]
+		if int32(attr.Location) != -1 && !strings.HasPrefix(attr.Name, "gl_") {
+			lines = append(lines, fmt.Sprintf("P(glBindAttribLocation)(%s, %s, %s);",
+				c.Arg(program), c.Arg(attr.Location), c.Arg(attr.Name)))
+		}
+	}
+	lines = append(lines, c.Call)
+	cb := CommandBuilder{Thread: c.Cmd.Thread()}
+	for _, i := range pi.ActiveUniformBlocks.KeysSorted() {
+		// Remap the index as the one returned by glGetUniformBlockIndex.
+		name := pi.ActiveUniformBlocks[i].Name
+		get := *c
+		get.Cmd = cb.GlGetUniformBlockIndex(program, name, i)
+		call := fmt.Sprintf("P(glGetUniformBlockIndex)(%s, %s)", c.Arg(program), c.Arg(name))
+		lines = append(lines, get.Bind(i, call)+";")
+	}
+	return strings.Join(lines, "\n")
+}
+
+const cppDeclarations = `
+// make_current makes the captured context current, with a surface of
+// width x height pixels. The size of the surface is unchanged if width or
+// height is 0.
+void make_current(uint64_t context, int width, int height);
+
+// swap_buffers presents the surface of the current context.
+void swap_buffers();
+`
+
+const cppRuntime = `
+#include "replay.h"
+
+#include <dlfcn.h>
+#include <cstdio>
+#include <cstdlib>
+
+namespace {
+
+EGLDisplay display = EGL_NO_DISPLAY;
+EGLConfig config = nullptr;
+EGLSurface surface = EGL_NO_SURFACE;
+int surface_width = 0;
+int surface_height = 0;
+std::map<uint64_t, EGLContext> contexts;
+
+void check(bool ok, const char* what) {
+  if (!ok) {
+    fprintf(stderr, "%s failed: 0x%x\n", what, eglGetError());
+    abort();
+  }
+}
+
+}  // namespace
+
+void* lookup(const char* name) {
+  void* p = dlsym(RTLD_DEFAULT, name);
+  if (p == nullptr) {
+    p = reinterpret_cast<void*>(eglGetProcAddress(name));
+  }
+  return p;
+}
+
+void initialize(Replay&) {
+  display = eglGetDisplay(EGL_DEFAULT_DISPLAY);
+  check(eglInitialize(display, nullptr, nullptr), "eglInitialize");
+  check(eglBindAPI(EGL_OPENGL_ES_API), "eglBindAPI");
+  const EGLint attribs[] = {
+      EGL_SURFACE_TYPE, EGL_PBUFFER_BIT,
+      EGL_RENDERABLE_TYPE, EGL_OPENGL_ES3_BIT_KHR,
+      EGL_RED_SIZE, 8,
+      EGL_GREEN_SIZE, 8,
+      EGL_BLUE_SIZE, 8,
+      EGL_ALPHA_SIZE, 8,
+      EGL_DEPTH_SIZE, 24,
+      EGL_STENCIL_SIZE, 8,
+      EGL_NONE,
+  };
+  EGLint count = 0;
+  check(eglChooseConfig(display, attribs, &config, 1, &count) && count > 0,
+        "eglChooseConfig");
+}
+
+void make_current(uint64_t context, int width, int height) {
+  if (context == 0) {
+    eglMakeCurrent(display, EGL_NO_SURFACE, EGL_NO_SURFACE, EGL_NO_CONTEXT);
+    return;
+  }
+  if (width == 0 || height == 0) {
+    width = surface_width > 0 ? surface_width : 1;
+    height = surface_height > 0 ? surface_height : 1;
+  }
+  if (surface == EGL_NO_SURFACE || width != surface_width ||
+      height != surface_height) {
+    if (surface != EGL_NO_SURFACE) {
+      eglMakeCurrent(display, EGL_NO_SURFACE, EGL_NO_SURFACE, EGL_NO_CONTEXT);
+      eglDestroySurface(display, surface);
+    }
+    const EGLint attribs[] = {EGL_WIDTH, width, EGL_HEIGHT, height, EGL_NONE};
+    surface = eglCreatePbufferSurface(display, config, attribs);
+    check(surface != EGL_NO_SURFACE, "eglCreatePbufferSurface");
+    surface_width = width;
+    surface_height = height;
+  }
+  auto it = contexts.find(context);
+  if (it == contexts.end()) {
+    // All the contexts share their objects, as the captured ones may have.
+    EGLContext share =
+        contexts.empty() ? EGL_NO_CONTEXT : contexts.begin()->second;
+    const EGLint attribs[] = {EGL_CONTEXT_CLIENT_VERSION, 3, EGL_NONE};
+    EGLContext c = eglCreateContext(display, config, share, attribs);
+    check(c != EGL_NO_CONTEXT, "eglCreateContext");
+    it = contexts.emplace(context, c).first;
+  }
+  check(eglMakeCurrent(display, surface, surface, it->second),
+        "eglMakeCurrent");
+}
+
+void swap_buffers() {
+  if (surface != EGL_NO_SURFACE) {
+    eglSwapBuffers(display, surface);
+  }
+}
+`
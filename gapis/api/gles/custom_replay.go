@@ -25,20 +25,36 @@ import (
 	"github.com/google/gapid/gapis/replay/value"
 )
 
-// objectKey is a map and object identifier pair used for a remapping key.
+// objectKey is a namespace and object identifier pair used for a remapping
+// key. The namespace is the identifier of the context for the objects of a
+// context, and of the share group for the shared objects. The identifier type
+// tells the maps apart.
 // Ideally we'd just use the object or object pointer as the key, but we have
 // atoms that want to remap the identifier before the state object is created.
+// Keys hold no pointers into the state, so that they are the same in clones
+// of the state, as used by the replay builders resumed from snapshots.
 // TODO: It maybe possible to rework the state-mutator and/or APIs to achieve
 // this.
 type objectKey struct {
-	mapPtr interface{}
-	mapKey interface{}
+	namespace ContextID
+	mapKey    interface{}
+}
+
+// contextKey returns the remapping key of the object i of the context ctx.
+func contextKey(ctx *Context, i interface{}) objectKey {
+	return objectKey{ctx.Identifier, i}
+}
+
+// sharedKey returns the remapping key of the object i shared by the context
+// ctx.
+func sharedKey(ctx *Context, i interface{}) objectKey {
+	return objectKey{ctx.Objects.Shared.ShareGroup, i}
 }
 
 func (i BufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Shared.Buffers, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -46,7 +62,7 @@ func (i BufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool)
 func (i FramebufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Framebuffers, i}, true
+		key, remap = contextKey(ctx, i), true
 	}
 	return
 }
@@ -54,7 +70,7 @@ func (i FramebufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap
 func (i RenderbufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Shared.Renderbuffers, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -62,7 +78,7 @@ func (i RenderbufferId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap
 func (i ProgramId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Shared.Programs, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -70,7 +86,7 @@ func (i ProgramId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool
 func (i ShaderId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Shared.Shaders, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -89,13 +105,13 @@ func (i TextureId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool
 						if !ctx.Objects.Shared.Textures.Contains(i) {
 							panic(fmt.Errorf("Can not find EGL replacement texture %v", i))
 						}
-						return objectKey{&ctx.Objects.Shared.Textures, i}, true
+						return sharedKey(ctx, i), true
 					}
 				}
 				panic(fmt.Errorf("Can not find EGL replacement context %v", ctxId))
 			}
 		}
-		key, remap = objectKey{&ctx.Objects.Shared.Textures, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -114,15 +130,15 @@ func (i UniformBlockIndex) remap(cmd api.Cmd, s *api.State) (key interface{}, re
 		program = cmd.Program
 	}
 	return struct {
-		p *Program
+		p objectKey
 		i UniformBlockIndex
-	}{ctx.Objects.Shared.Programs[program], i}, true
+	}{sharedKey(ctx, program), i}, true
 }
 
 func (i VertexArrayId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.VertexArrays, i}, true
+		key, remap = contextKey(ctx, i), true
 	}
 	return
 }
@@ -130,7 +146,7 @@ func (i VertexArrayId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap
 func (i QueryId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Queries, i}, true
+		key, remap = contextKey(ctx, i), true
 	}
 	return
 }
@@ -138,7 +154,7 @@ func (i QueryId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool)
 func (i GLsync) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && !i.IsNullptr() {
-		key, remap = objectKey{&ctx.Objects.Shared.SyncObjects, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -150,7 +166,7 @@ func (i GLsync) value(b *builder.Builder, cmd api.Cmd, s *api.State) value.Value
 func (i SamplerId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Shared.Samplers, i}, true
+		key, remap = sharedKey(ctx, i), true
 	}
 	return
 }
@@ -158,7 +174,7 @@ func (i SamplerId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool
 func (i PipelineId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.Pipelines, i}, true
+		key, remap = contextKey(ctx, i), true
 	}
 	return
 }
@@ -166,7 +182,7 @@ func (i PipelineId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap boo
 func (i TransformFeedbackId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
 	ctx := GetContext(s, cmd.Thread())
 	if ctx != nil && i != 0 {
-		key, remap = objectKey{&ctx.Objects.TransformFeedbacks, i}, true
+		key, remap = contextKey(ctx, i), true
 	}
 	return
 }
@@ -181,9 +197,9 @@ func (i UniformLocation) remap(cmd api.Cmd, s *api.State) (key interface{}, rema
 		program = cmd.Program
 	}
 	return struct {
-		p *Program
+		p objectKey
 		l UniformLocation
-	}{ctx.Objects.Shared.Programs[program], i}, true
+	}{sharedKey(ctx, program), i}, true
 }
 
 func (i SrcImageId) remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+)
+
+func TestRemapKeysMatchClones(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.AndroidARMv7a.MemoryLayout)
+
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := CommandBuilder{Thread: 0}
+	for _, cmd := range []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0),
+			NewStaticContextState(), NewDynamicContextState(64, 64, false)),
+		cb.GlCreateProgram(1),
+	} {
+		if err := cmd.Mutate(ctx, s, nil); !assert.For(ctx, "err").ThatError(err).Succeeded() {
+			return
+		}
+	}
+
+	// The keys are the same in a clone of the state, so that the builders
+	// resumed from a snapshot find the handles they remapped.
+	clone, err := s.Clone()
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	use := cb.GlUseProgram(1)
+	for _, r := range []remapper{BufferId(1), FramebufferId(1), ProgramId(1), UniformLocation(2)} {
+		key, _ := r.remap(use, s)
+		cloned, _ := r.remap(use, clone)
+		assert.For(ctx, "%T key", r).That(cloned).Equals(key)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+)
+
+var _ api.FootprintProvider = API{}
+
+// Prefixes of the commands that may create, delete or resize the objects
+// returned by Footprint.
+var footprintChanges = []string{
+	"glDelete", "glTexImage", "glTexStorage", "glCompressedTexImage",
+	"glCopyTexImage", "glGenerateMipmap", "glEGLImageTarget", "glBufferData",
+	"glBufferStorage", "glRenderbufferStorage", "eglCreateContext",
+	"eglDestroyContext", "eglMakeCurrent",
+}
+
+// AffectsFootprint implements api.FootprintProvider.
+func (API) AffectsFootprint(cmd api.Cmd) bool {
+	return hasPrefix(cmd.CmdName(), footprintChanges)
+}
+
+// Footprint implements api.FootprintProvider.
+// It returns the textures, buffers and renderbuffers of the shared objects of
+// all the contexts.
+func (API) Footprint(ctx context.Context, s *api.State) []api.FootprintObject {
+	state := GetState(s)
+	if state == nil {
+		return nil
+	}
+	out := []api.FootprintObject{}
+	seen := map[*SharedObjects]bool{}
+	add := func(c *Context) {
+		if c == nil {
+			return
+		}
+		shared := c.Objects.Shared
+		if shared == nil || seen[shared] {
+			return
+		}
+		seen[shared] = true
+		for _, t := range shared.Textures {
+			if t == nil {
+				continue
+			}
+			out = append(out, api.FootprintObject{
+				Key:      t,
+				Kind:     api.MemoryKind_TextureMemory,
+				Handle:   t.ResourceHandle(),
+				Label:    t.ResourceLabel(),
+				Size:     t.size(),
+				Resource: t,
+			})
+		}
+		for _, b := range shared.Buffers {
+			if b == nil {
+				continue
+			}
+			out = append(out, api.FootprintObject{
+				Key:    b,
+				Kind:   api.MemoryKind_BufferMemory,
+				Handle: fmt.Sprintf("Buffer<%d>", b.ID),
+				Label:  b.Label,
+				Size:   uint64(b.Size),
+			})
+		}
+		for _, r := range shared.Renderbuffers {
+			if r == nil {
+				continue
+			}
+			out = append(out, api.FootprintObject{
+				Key:    r,
+				Kind:   api.MemoryKind_RenderbufferMemory,
+				Handle: fmt.Sprintf("Renderbuffer<%d>", r.ID),
+				Label:  r.Label,
+				Size:   r.size(),
+			})
+		}
+	}
+	for _, c := range state.EGLContexts {
+		add(c)
+	}
+	for _, c := range state.Contexts {
+		add(c)
+	}
+	return out
+}
+
+// size returns the number of bytes held by all the images of the texture.
+func (t *Texture) size() uint64 {
+	size := uint64(0)
+	for _, level := range t.Levels {
+		for _, img := range level.Layers {
+			if img != nil {
+				size += img.size()
+			}
+		}
+	}
+	return size
+}
+
+// size returns the number of bytes held by the image, computed from its
+// format. The size of the image data is used if the format is not supported.
+func (i *Image) size() uint64 {
+	if f, err := getImageFormat(i.DataFormat, i.DataType); err == nil {
+		if size := f.Size(int(i.Width), int(i.Height), 1); size > 0 {
+			return uint64(size)
+		}
+	}
+	return i.Data.Count()
+}
+
+// size returns the number of bytes held by the renderbuffer, computed from
+// its internal format.
+func (r *Renderbuffer) size() uint64 {
+	format, ty := getUnsizedFormatAndType(r.InternalFormat)
+	f, err := getImageFormat(format, ty)
+	if err != nil {
+		return 0
+	}
+	return uint64(f.Size(int(r.Width), int(r.Height), 1))
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestFootprint(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	// name returns the observation of a single object name at 0x1000.
+	name := func(n byte) api.CmdObservation {
+		id, err := database.Store(ctx, []byte{n, 0, 0, 0})
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		return api.CmdObservation{Range: memory.Range{Base: 0x1000, Size: 4}, ID: id}
+	}
+	names := memory.BytePtr(0x1000, memory.ApplicationPool)
+	buffer, texture := name(5), name(7)
+
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := CommandBuilder{Thread: 0}
+	cmds := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0),
+			NewStaticContextState(), NewDynamicContextState(64, 64, false)),
+		cb.GlGenBuffers(1, names).AddWrite(buffer.Range, buffer.ID),
+		cb.GlBindBuffer(GLenum_GL_ARRAY_BUFFER, 5),
+		cb.GlBufferData(GLenum_GL_ARRAY_BUFFER, 64, memory.Nullptr, GLenum_GL_STATIC_DRAW),
+		cb.EglSwapBuffers(memory.Nullptr, memory.Nullptr, 1),
+		cb.GlGenTextures(1, names).AddWrite(texture.Range, texture.ID),
+		cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 7),
+		cb.GlTexImage2D(GLenum_GL_TEXTURE_2D, 0, GLint(GLenum_GL_RGBA), 4, 4, 0,
+			GLenum_GL_RGBA, GLenum_GL_UNSIGNED_BYTE, memory.Nullptr),
+		cb.GlBufferData(GLenum_GL_ARRAY_BUFFER, 256, memory.Nullptr, GLenum_GL_STATIC_DRAW),
+		cb.GlDeleteBuffers(1, names).AddRead(buffer.Range, buffer.ID),
+	}
+	h := &capture.Header{Abi: device.AndroidARMv7a}
+	c, err := capture.New(ctx, "test", h, cmds)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	// eglMakeCurrent creates the RGB565 color, 16 bit depth and 8 bit stencil
+	// renderbuffers of the 64x64 backbuffer.
+	const backbuffer = 64*64*2 + 64*64*2 + 64*64*1
+	rb := &service.FootprintTotal{Kind: api.MemoryKind_RenderbufferMemory, Bytes: backbuffer, Count: 3}
+
+	// eglSwapBuffers starts a new frame, and so a new range.
+	footprint, err := resolve.Footprint(ctx, c.Footprint(0))
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "PeakBytes").That(footprint.PeakBytes).Equals(uint64(backbuffer + 256 + 64))
+	assert.For(ctx, "PeakCommand").That(footprint.PeakCommand).Equals(uint64(9))
+	assert.For(ctx, "Ranges").ThatSlice(footprint.Ranges).DeepEquals([]*service.FootprintRange{
+		{
+			FirstCommand: 0, LastCommand: 4, LiveBytes: backbuffer + 64, PeakBytes: backbuffer + 64, Created: 4,
+			Live: []*service.FootprintTotal{{Kind: api.MemoryKind_BufferMemory, Bytes: 64, Count: 1}, rb},
+			Peak: []*service.FootprintTotal{{Kind: api.MemoryKind_BufferMemory, Bytes: 64, Count: 1}, rb},
+		},
+		{
+			FirstCommand: 5, LastCommand: 10, LiveBytes: backbuffer + 64, PeakBytes: backbuffer + 256 + 64,
+			Created: 1, Deleted: 1,
+			Live: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_TextureMemory, Bytes: 64, Count: 1},
+				{Kind: api.MemoryKind_BufferMemory},
+				rb,
+			},
+			Peak: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_TextureMemory, Bytes: 64, Count: 1},
+				{Kind: api.MemoryKind_BufferMemory, Bytes: 256, Count: 1},
+				rb,
+			},
+		},
+	})
+
+	if !assert.For(ctx, "Objects").ThatSlice(footprint.Objects).IsLength(5) {
+		return
+	}
+	for _, o := range footprint.Objects[:3] {
+		assert.For(ctx, "Backbuffer kind").That(o.Kind).Equals(api.MemoryKind_RenderbufferMemory)
+		assert.For(ctx, "Backbuffer created").That(o.Created).DeepEquals(c.Command(1))
+	}
+	buf, tex := footprint.Objects[3], footprint.Objects[4]
+	assert.For(ctx, "Buffer").That(buf.Handle).Equals("Buffer<5>")
+	assert.For(ctx, "Buffer size").That(buf.Size).Equals(uint64(256))
+	assert.For(ctx, "Buffer peak").That(buf.PeakSize).Equals(uint64(256))
+	assert.For(ctx, "Buffer created").That(buf.Created).DeepEquals(c.Command(4))
+	assert.For(ctx, "Buffer deleted").That(buf.Deleted).DeepEquals(c.Command(10))
+	assert.For(ctx, "Texture kind").That(tex.Kind).Equals(api.MemoryKind_TextureMemory)
+	assert.For(ctx, "Texture size").That(tex.Size).Equals(uint64(64))
+	assert.For(ctx, "Texture created").That(tex.Created).DeepEquals(c.Command(8))
+	assert.For(ctx, "Texture deleted").That(tex.Deleted).IsNil()
+
+	// A range size splits the commands regardless of the frames.
+	footprint, err = resolve.Footprint(ctx, c.Footprint(4))
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	ranges := [][2]uint64{}
+	for _, r := range footprint.Ranges {
+		ranges = append(ranges, [2]uint64{r.FirstCommand, r.LastCommand})
+	}
+	assert.For(ctx, "Ranges").That(ranges).DeepEquals([][2]uint64{{0, 3}, {4, 7}, {8, 10}})
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+// fragmentTests is a transform that redraws each of the requested draw calls
+// with a scissor rectangle isolating a single pixel, and with all framebuffer
+// writes masked. Occlusion queries around each redraw report whether the draw
+// call generated a fragment for the pixel, and whether it passed the stencil
+// and depth tests. The original draw call is then issued unmodified.
+type fragmentTests struct {
+	x, y    uint32
+	draws   map[api.CmdID]struct{}
+	res     replay.Result
+	results []replay.FragmentTests
+	posted  int  // Number of draws that post query results.
+	done    int  // Number of query results received.
+	failed  bool // True if res has been called with an error.
+}
+
+func newFragmentTests(ctx context.Context, req fragmentTestsRequest, res replay.Result) *fragmentTests {
+	draws := make(map[api.CmdID]struct{}, len(req.draws))
+	for _, id := range req.draws {
+		draws[id] = struct{}{}
+	}
+	return &fragmentTests{
+		x:     req.x,
+		y:     req.y,
+		draws: draws,
+		res:   res,
+	}
+}
+
+func (t *fragmentTests) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	if _, ok := t.draws[id]; ok && cmd.CmdFlags().IsDrawCall() {
+		t.test(ctx, id, cmd, out)
+	}
+	out.MutateAndWrite(ctx, id, cmd)
+}
+
+func (t *fragmentTests) Flush(ctx context.Context, out transform.Writer) {
+	if t.posted == 0 {
+		// No query results will be posted, so return what we have now.
+		t.res(t.results, nil)
+	}
+}
+
+// test emits the redraws of the draw call cmd and the query readback.
+func (t *fragmentTests) test(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	idx := len(t.results)
+	t.results = append(t.results, replay.FragmentTests{Command: id})
+
+	s := out.State()
+	c := GetContext(s, cmd.Thread())
+	if c == nil {
+		return
+	}
+
+	// If the draw call already uses a scissor rectangle that excludes the pixel
+	// then no fragment can be generated, and there's no need to redraw.
+	if scissor := c.Pixel.Scissor; scissor.Test == GLboolean_GL_TRUE {
+		x, y, box := GLint(t.x), GLint(t.y), scissor.Box
+		if x < box.X || y < box.Y || x >= box.X+GLint(box.Width) || y >= box.Y+GLint(box.Height) {
+			return
+		}
+	}
+
+	dID := id.Derived()
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	tw := newTweaker(out, id, cb)
+
+	tw.glEnable(ctx, GLenum_GL_SCISSOR_TEST)
+	tw.glScissor(ctx, GLint(t.x), GLint(t.y), 1, 1)
+	tw.glColorMask(ctx, GLboolean_GL_FALSE, GLboolean_GL_FALSE, GLboolean_GL_FALSE, GLboolean_GL_FALSE)
+	tw.glDepthMask(ctx, GLboolean_GL_FALSE)
+	tw.glStencilMask(ctx, 0)
+
+	redraw := func() QueryId {
+		query := tw.glGenQuery(ctx)
+		mutateAndWriteEach(ctx, out, dID,
+			cb.GlBeginQuery(GLenum_GL_ANY_SAMPLES_PASSED, query),
+			cmd,
+			cb.GlEndQuery(GLenum_GL_ANY_SAMPLES_PASSED),
+		)
+		return query
+	}
+
+	// The stencil and depth tests as performed by the draw call.
+	depth := redraw()
+	// Just the stencil test.
+	tw.glDisable(ctx, GLenum_GL_DEPTH_TEST)
+	stencil := redraw()
+	// No tests at all.
+	tw.glDisable(ctx, GLenum_GL_STENCIL_TEST)
+	rasterized := redraw()
+
+	queries := []QueryId{rasterized, stencil, depth}
+	size := uint64(len(queries) * 4)
+	tmp := s.AllocOrPanic(ctx, size)
+	out.MutateAndWrite(ctx, dID, cb.Custom(func(ctx context.Context, s *api.State, b *builder.Builder) error {
+		b.ReserveMemory(tmp.Range())
+		for i, q := range queries {
+			cb.GlGetQueryObjectuiv(q, GLenum_GL_QUERY_RESULT, tmp.Offset(uint64(i*4))).Call(ctx, s, b)
+		}
+		b.Post(value.ObservedPointer(tmp.Address()), size, func(r binary.Reader, err error) error {
+			if err == nil {
+				res := &t.results[idx]
+				res.Rasterized = r.Uint32() != 0
+				res.StencilPassed = r.Uint32() != 0
+				res.DepthPassed = r.Uint32() != 0
+				err = r.Error()
+			}
+			if err != nil {
+				err = fmt.Errorf("Could not read fragment test results for command %v: %v", id, err)
+				if !t.failed {
+					t.failed = true
+					t.res(nil, err)
+				}
+				return err
+			}
+			t.done++
+			if t.done == t.posted && !t.failed {
+				t.res(t.results, nil)
+			}
+			return nil
+		})
+		return nil
+	}))
+	tmp.Free()
+	t.posted++
+
+	out.MutateAndWrite(ctx, dID, cb.GlGetError(0)) // Check for errors.
+
+	tw.revert(ctx)
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+func TestFragmentTests(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	ctx = PutUnusedIDMap(ctx)
+	h := &capture.Header{Abi: device.AndroidARMv7a}
+	capturePath, err := capture.New(ctx, "test", h, []api.Cmd{})
+	if err != nil {
+		panic(err)
+	}
+	ctx = capture.Put(ctx, capturePath)
+
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := CommandBuilder{Thread: 0}
+	prologue := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0),
+			NewStaticContextState(), NewDynamicContextState(64, 64, false)),
+		cb.GlEnable(GLenum_GL_DEPTH_TEST),
+		cb.GlEnable(GLenum_GL_STENCIL_TEST),
+	}
+
+	for _, test := range []struct {
+		name    string
+		cmds    []api.Cmd
+		redraws int
+	}{
+		{"Requested draw is redrawn", []api.Cmd{
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 3),
+		}, 3},
+		{"Draw scissored away from the pixel is not redrawn", []api.Cmd{
+			cb.GlEnable(GLenum_GL_SCISSOR_TEST),
+			cb.GlScissor(0, 0, 8, 8),
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 3),
+		}, 0},
+		{"Draw scissored around the pixel is redrawn", []api.Cmd{
+			cb.GlEnable(GLenum_GL_SCISSOR_TEST),
+			cb.GlScissor(8, 16, 8, 8),
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 3),
+		}, 3},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		s, err := capture.NewState(ctx)
+		if !assert.For(ctx, "NewState").ThatError(err).Succeeded() {
+			continue
+		}
+		cmds := append(append([]api.Cmd{}, prologue...), test.cmds...)
+		draw := api.CmdID(len(cmds) - 1)
+
+		var results []replay.FragmentTests
+		req := fragmentTestsRequest{draws: []api.CmdID{draw}, x: 10, y: 20}
+		transform := newFragmentTests(ctx, req, func(val interface{}, err error) {
+			results, _ = val.([]replay.FragmentTests)
+		})
+		w := &testcmd.Writer{S: s}
+		for i, cmd := range cmds {
+			transform.Transform(ctx, api.CmdID(i), cmd, w)
+		}
+		transform.Flush(ctx, w)
+
+		begins, scissors := 0, []*GlScissor{}
+		for _, c := range w.CmdsAndIDs {
+			switch cmd := c.Cmd.(type) {
+			case *GlBeginQuery:
+				assert.For(ctx, "query target").That(cmd.Target).Equals(GLenum_GL_ANY_SAMPLES_PASSED)
+				begins++
+			case *GlScissor:
+				if c.Id == draw.Derived() {
+					scissors = append(scissors, cmd)
+				}
+			}
+		}
+		assert.For(ctx, "redraws").That(begins).Equals(test.redraws)
+
+		// The original draw is issued last, with its own ID.
+		last := w.CmdsAndIDs[len(w.CmdsAndIDs)-1]
+		assert.For(ctx, "last command").That(last.Cmd).Equals(cmds[draw])
+		assert.For(ctx, "last id").That(last.Id).Equals(draw)
+
+		if test.redraws > 0 {
+			// The pixel is isolated, then the scissor rectangle is restored.
+			if assert.For(ctx, "scissors").That(len(scissors)).Equals(2) {
+				got := Rect{X: scissors[0].X, Y: scissors[0].Y, Width: scissors[0].Width, Height: scissors[0].Height}
+				assert.For(ctx, "pixel scissor").That(got).Equals(Rect{X: 10, Y: 20, Width: 1, Height: 1})
+			}
+			// No results are posted without a replay builder.
+			assert.For(ctx, "results").That(results).IsNil()
+		} else {
+			assert.For(ctx, "results").That(results).DeepEquals([]replay.FragmentTests{{Command: draw}})
+		}
+
+		// All the state changed for the redraws is reverted.
+		c := GetContext(s, 0)
+		assert.For(ctx, "color mask").That(c.Pixel.ColorWritemask[0]).Equals(
+			Vec4b{GLboolean_GL_TRUE, GLboolean_GL_TRUE, GLboolean_GL_TRUE, GLboolean_GL_TRUE})
+		assert.For(ctx, "depth mask").That(c.Pixel.DepthWritemask).Equals(GLboolean_GL_TRUE)
+		assert.For(ctx, "stencil mask").That(c.Pixel.StencilWritemask).Equals(GLuint(0xffffffff))
+		assert.For(ctx, "stencil back mask").That(c.Pixel.StencilBackWritemask).Equals(GLuint(0xffffffff))
+		assert.For(ctx, "depth test").That(c.Pixel.Depth.Test).Equals(GLboolean_GL_TRUE)
+		assert.For(ctx, "stencil test").That(c.Pixel.Stencil.Test).Equals(GLboolean_GL_TRUE)
+		assert.For(ctx, "queries").That(len(c.Objects.Queries)).Equals(0)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/gapid/core/data/deep"
 	"github.com/google/gapid/core/image"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/resolve/dependencygraph"
@@ -26,6 +27,11 @@ import (
 
 type CustomState struct{}
 
+// CloneState implements api.StateCloner.
+func (s *State) CloneState() (interface{}, error) {
+	return deep.Clone(s)
+}
+
 func GetContext(s *api.State, thread uint64) *Context {
 	return GetState(s).GetContext(thread)
 }
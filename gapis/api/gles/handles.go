@@ -0,0 +1,47 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// remapper is the interface implemented by the types remapped on replay.
+type remapper interface {
+	remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool)
+}
+
+var _ api.HandleRemapper = API{}
+
+// RemapHandle implements api.HandleRemapper.
+// The object names are namespaced by the objects of the bound context, so
+// only the names of objects shared by captures need new values. The uniform
+// locations and block indices are chosen by the driver, and are keyed by their
+// program, so they only change on replay.
+func (API) RemapHandle(v interface{}, cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
+	switch v.(type) {
+	case EGLContext, EGLSurface, GLXContext, HGLRC, CGLContextObj:
+		if !v.(memory.Pointer).IsNullptr() {
+			return v, true
+		}
+		return nil, false
+	}
+	r, ok := v.(remapper)
+	if !ok || GetContext(s, cmd.Thread()) == nil {
+		return nil, false
+	}
+	return r.remap(cmd, s)
+}
@@ -0,0 +1,327 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+var _ api.AnalysisProvider = API{}
+
+const (
+	// bufferRecreationFrames is the number of consecutive frames a buffer is
+	// re-created in before it is reported.
+	bufferRecreationFrames = 3
+	// getErrorsPerFrame is the number of glGetError calls in a frame from
+	// which they are reported.
+	getErrorsPerFrame = 16
+)
+
+// NewAnalyzer implements api.AnalysisProvider.
+// The returned analyzer reports redundant state changes and the commands that
+// are likely to hurt performance.
+func (API) NewAnalyzer(ctx context.Context) api.Analyzer {
+	return &perfAnalyzer{buffers: map[*Buffer]*bufferRecreation{}}
+}
+
+// perfAnalyzer is an api.Analyzer that finds performance issues in the GLES
+// commands of a capture.
+type perfAnalyzer struct {
+	// The index of the current frame, and whether it has any command.
+	frame   uint64
+	inFrame bool
+	// The number of draw calls in the current frame.
+	draws uint32
+	// The number of glGetError calls in the current frame.
+	getErrors uint32
+	// The re-creations of each buffer.
+	buffers map[*Buffer]*bufferRecreation
+	// The program and value of the uniform set by the current command,
+	// before the command.
+	uniformProgram *Program
+	uniformValue   []byte
+	// The issues found with the current command.
+	issues []api.Issue
+}
+
+// bufferRecreation tracks the frames in which a buffer is re-created.
+type bufferRecreation struct {
+	// The last frame the buffer was re-created in.
+	lastFrame uint64
+	// The number of consecutive frames the buffer was re-created in.
+	frames uint32
+}
+
+// nextFrame ends the current frame.
+func (a *perfAnalyzer) nextFrame() {
+	a.frame, a.draws, a.getErrors, a.inFrame = a.frame+1, 0, 0, false
+}
+
+func (a *perfAnalyzer) report(s log.Severity, m *stringtable.Msg) {
+	a.issues = append(a.issues, api.Issue{Severity: s, Message: m})
+}
+
+// PreMutate implements api.Analyzer.
+func (a *perfAnalyzer) PreMutate(ctx context.Context, cmd api.Cmd, s *api.State) {
+	a.issues, a.uniformProgram, a.uniformValue = nil, nil, nil
+
+	flags := cmd.CmdFlags()
+	if flags.IsStartOfFrame() && a.inFrame {
+		a.nextFrame()
+	}
+	a.inFrame = true
+	defer func() {
+		if flags.IsEndOfFrame() {
+			a.nextFrame()
+		}
+	}()
+
+	if cmd.API() == nil || cmd.API().ID() != apiID {
+		return
+	}
+	c := GetContext(s, cmd.Thread())
+	if c == nil {
+		return
+	}
+
+	if flags.IsDrawCall() {
+		a.draws++
+		if mode, vertices, instances, ok := drawCallVertices(cmd); ok && vertices*instances < primitiveVertices(mode) {
+			a.report(log.Warning, messages.WarnDegenerateDrawCall(vertices*instances))
+		}
+	}
+	if a.draws > 0 && hasPrefix(cmd.CmdName(), textureUploads) {
+		a.report(log.Warning, messages.WarnMidFrameTextureUpload(a.draws))
+	}
+
+	switch cmd := cmd.(type) {
+	case *GlBindTexture:
+		if t := boundTexture(c.Bound.TextureUnit, cmd.Target); t != nil && t.ID == cmd.Texture {
+			a.report(log.Info, messages.WarnRedundantBindTexture(uint32(cmd.Texture), cmd.Target.String()))
+		}
+	case *GlUseProgram:
+		if c.Bound.Program.GetID() == cmd.Program {
+			a.report(log.Info, messages.WarnRedundantUseProgram(uint32(cmd.Program)))
+		}
+	case *GlGetError:
+		a.getErrors++
+		if a.getErrors == getErrorsPerFrame {
+			a.report(log.Warning, messages.WarnGetErrorInLoop(a.getErrors))
+		}
+	}
+
+	if location, ok := uniformLocation(cmd); ok {
+		if p := c.Bound.Program; p != nil {
+			if u, ok := p.Uniforms[location]; ok {
+				a.uniformProgram = p
+				a.uniformValue = u.Value.Read(ctx, cmd, s, nil /* builder */)
+			}
+		}
+	}
+}
+
+// PostMutate implements api.Analyzer.
+func (a *perfAnalyzer) PostMutate(ctx context.Context, cmd api.Cmd, s *api.State) []api.Issue {
+	c := GetContext(s, cmd.Thread())
+	if c == nil {
+		return a.issues
+	}
+
+	if p := a.uniformProgram; p != nil {
+		location, _ := uniformLocation(cmd)
+		if u, ok := p.Uniforms[location]; ok {
+			if bytes.Equal(a.uniformValue, u.Value.Read(ctx, cmd, s, nil /* builder */)) {
+				a.report(log.Info, messages.WarnRedundantUniform(int64(location), uint32(p.ID)))
+			}
+		}
+	}
+
+	if cmd, ok := cmd.(*GlBufferData); ok {
+		if b := boundBuffer(c, cmd.Target); b != nil {
+			r, ok := a.buffers[b]
+			switch {
+			case !ok:
+				r = &bufferRecreation{frames: 1}
+				a.buffers[b] = r
+			case r.lastFrame+1 == a.frame:
+				r.frames++
+				if r.frames == bufferRecreationFrames {
+					a.report(log.Warning, messages.WarnBufferRecreatedEveryFrame(uint32(b.ID), r.frames))
+				}
+			case r.lastFrame != a.frame:
+				r.frames = 1
+			}
+			r.lastFrame = a.frame
+		}
+	}
+
+	return a.issues
+}
+
+// boundTexture returns the texture bound to target on the texture unit tu.
+func boundTexture(tu *TextureUnit, target GLenum) *Texture {
+	if tu == nil {
+		return nil
+	}
+	switch target {
+	case GLenum_GL_TEXTURE_2D:
+		return tu.Binding2d
+	case GLenum_GL_TEXTURE_3D:
+		return tu.Binding3d
+	case GLenum_GL_TEXTURE_2D_ARRAY:
+		return tu.Binding2dArray
+	case GLenum_GL_TEXTURE_BUFFER:
+		return tu.BindingBuffer
+	case GLenum_GL_TEXTURE_CUBE_MAP:
+		return tu.BindingCubeMap
+	case GLenum_GL_TEXTURE_CUBE_MAP_ARRAY:
+		return tu.BindingCubeMapArray
+	case GLenum_GL_TEXTURE_2D_MULTISAMPLE:
+		return tu.Binding2dMultisample
+	case GLenum_GL_TEXTURE_2D_MULTISAMPLE_ARRAY:
+		return tu.Binding2dMultisampleArray
+	case GLenum_GL_TEXTURE_EXTERNAL_OES:
+		return tu.BindingExternalOes
+	}
+	return nil
+}
+
+// boundBuffer returns the buffer bound to target in the context c.
+func boundBuffer(c *Context, target GLenum) *Buffer {
+	switch target {
+	case GLenum_GL_ARRAY_BUFFER:
+		return c.Bound.ArrayBuffer
+	case GLenum_GL_ELEMENT_ARRAY_BUFFER:
+		if c.Bound.VertexArray != nil {
+			return c.Bound.VertexArray.ElementArrayBuffer
+		}
+	case GLenum_GL_COPY_READ_BUFFER:
+		return c.Bound.CopyReadBuffer
+	case GLenum_GL_COPY_WRITE_BUFFER:
+		return c.Bound.CopyWriteBuffer
+	case GLenum_GL_PIXEL_PACK_BUFFER:
+		return c.Bound.PixelPackBuffer
+	case GLenum_GL_PIXEL_UNPACK_BUFFER:
+		return c.Bound.PixelUnpackBuffer
+	case GLenum_GL_TRANSFORM_FEEDBACK_BUFFER:
+		return c.Bound.TransformFeedbackBuffer
+	case GLenum_GL_UNIFORM_BUFFER:
+		return c.Bound.UniformBuffer
+	case GLenum_GL_ATOMIC_COUNTER_BUFFER:
+		return c.Bound.AtomicCounterBuffer
+	case GLenum_GL_DISPATCH_INDIRECT_BUFFER:
+		return c.Bound.DispatchIndirectBuffer
+	case GLenum_GL_DRAW_INDIRECT_BUFFER:
+		return c.Bound.DrawIndirectBuffer
+	case GLenum_GL_SHADER_STORAGE_BUFFER:
+		return c.Bound.ShaderStorageBuffer
+	case GLenum_GL_TEXTURE_BUFFER:
+		return c.Bound.TextureBuffer
+	}
+	return nil
+}
+
+// uniformLocation returns the location of the uniform set by cmd, if cmd
+// sets a uniform of the bound program.
+func uniformLocation(cmd api.Cmd) (UniformLocation, bool) {
+	switch cmd := cmd.(type) {
+	case *GlUniform1f:
+		return cmd.Location, true
+	case *GlUniform1fv:
+		return cmd.Location, true
+	case *GlUniform1i:
+		return cmd.Location, true
+	case *GlUniform1iv:
+		return cmd.Location, true
+	case *GlUniform1ui:
+		return cmd.Location, true
+	case *GlUniform1uiv:
+		return cmd.Location, true
+	case *GlUniform2f:
+		return cmd.Location, true
+	case *GlUniform2fv:
+		return cmd.Location, true
+	case *GlUniform2i:
+		return cmd.Location, true
+	case *GlUniform2iv:
+		return cmd.Location, true
+	case *GlUniform2ui:
+		return cmd.Location, true
+	case *GlUniform2uiv:
+		return cmd.Location, true
+	case *GlUniform3f:
+		return cmd.Location, true
+	case *GlUniform3fv:
+		return cmd.Location, true
+	case *GlUniform3i:
+		return cmd.Location, true
+	case *GlUniform3iv:
+		return cmd.Location, true
+	case *GlUniform3ui:
+		return cmd.Location, true
+	case *GlUniform3uiv:
+		return cmd.Location, true
+	case *GlUniform4f:
+		return cmd.Location, true
+	case *GlUniform4fv:
+		return cmd.Location, true
+	case *GlUniform4i:
+		return cmd.Location, true
+	case *GlUniform4iv:
+		return cmd.Location, true
+	case *GlUniform4ui:
+		return cmd.Location, true
+	case *GlUniform4uiv:
+		return cmd.Location, true
+	case *GlUniformMatrix2fv:
+		return cmd.Location, true
+	case *GlUniformMatrix2x3fv:
+		return cmd.Location, true
+	case *GlUniformMatrix2x4fv:
+		return cmd.Location, true
+	case *GlUniformMatrix3fv:
+		return cmd.Location, true
+	case *GlUniformMatrix3x2fv:
+		return cmd.Location, true
+	case *GlUniformMatrix3x4fv:
+		return cmd.Location, true
+	case *GlUniformMatrix4fv:
+		return cmd.Location, true
+	case *GlUniformMatrix4x2fv:
+		return cmd.Location, true
+	case *GlUniformMatrix4x3fv:
+		return cmd.Location, true
+	}
+	return 0, false
+}
+
+// primitiveVertices returns the number of vertices of the smallest primitive
+// drawn with mode. Draw calls with fewer vertices draw nothing.
+func primitiveVertices(mode GLenum) uint64 {
+	switch mode {
+	case GLenum_GL_POINTS, GLenum_GL_PATCHES:
+		return 1
+	case GLenum_GL_LINES, GLenum_GL_LINE_STRIP, GLenum_GL_LINE_LOOP:
+		return 2
+	default:
+		return 3
+	}
+}
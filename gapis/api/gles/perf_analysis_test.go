@@ -0,0 +1,150 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+)
+
+func TestPerfAnalysis(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	programInfo := &ProgramInfo{
+		LinkStatus: GLboolean_GL_TRUE,
+		ActiveUniforms: UniformIndexːActiveUniformᵐ{
+			0: {Name: "u", Type: GLenum_GL_FLOAT, Location: 0, ArraySize: 1},
+		},
+	}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := CommandBuilder{Thread: 0}
+	prologue := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0),
+			NewStaticContextState(), NewDynamicContextState(64, 64, false)),
+		cb.GlCreateProgram(1),
+		api.WithExtras(cb.GlLinkProgram(1), programInfo),
+	}
+
+	swap := func() api.Cmd { return cb.EglSwapBuffers(memory.Nullptr, memory.Nullptr, 1) }
+	texImage := func() api.Cmd {
+		return cb.GlTexImage2D(GLenum_GL_TEXTURE_2D, 0, GLint(GLenum_GL_RGBA), 4, 4, 0,
+			GLenum_GL_RGBA, GLenum_GL_UNSIGNED_BYTE, memory.Nullptr)
+	}
+	bufferData := func() api.Cmd {
+		return cb.GlBufferData(GLenum_GL_ARRAY_BUFFER, 64, memory.Nullptr, GLenum_GL_DYNAMIC_DRAW)
+	}
+	getErrors := func(n int) []api.Cmd {
+		out := make([]api.Cmd, n)
+		for i := range out {
+			out[i] = cb.GlGetError(GLenum_GL_NO_ERROR)
+		}
+		return out
+	}
+	concat := func(cmds ...[]api.Cmd) []api.Cmd {
+		out := []api.Cmd{}
+		for _, c := range cmds {
+			out = append(out, c...)
+		}
+		return out
+	}
+
+	for _, test := range []struct {
+		name     string
+		cmds     []api.Cmd
+		expected []string
+	}{
+		{"Redundant texture bind", []api.Cmd{
+			cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 7),
+			cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 7),
+			cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 8),
+			cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 7),
+		}, []string{"1 WARN_REDUNDANT_BIND_TEXTURE"}},
+		{"Redundant program use", []api.Cmd{
+			cb.GlUseProgram(1),
+			cb.GlUseProgram(1),
+			cb.GlUseProgram(0),
+		}, []string{"1 WARN_REDUNDANT_USE_PROGRAM"}},
+		{"Redundant uniform", []api.Cmd{
+			cb.GlUseProgram(1),
+			cb.GlUniform1f(0, 1),
+			cb.GlUniform1f(0, 1),
+			cb.GlUniform1f(0, 2),
+		}, []string{"2 WARN_REDUNDANT_UNIFORM"}},
+		{"Buffer re-created every frame", []api.Cmd{
+			cb.GlBindBuffer(GLenum_GL_ARRAY_BUFFER, 5),
+			bufferData(),
+			swap(),
+			bufferData(),
+			swap(),
+			bufferData(),
+		}, []string{"5 WARN_BUFFER_RECREATED_EVERY_FRAME"}},
+		{"Buffer re-created in a single frame", []api.Cmd{
+			cb.GlBindBuffer(GLenum_GL_ARRAY_BUFFER, 5),
+			bufferData(),
+			bufferData(),
+			bufferData(),
+		}, nil},
+		{"glGetError in a loop", concat(
+			getErrors(getErrorsPerFrame),
+			[]api.Cmd{swap()},
+			getErrors(getErrorsPerFrame-1),
+		), []string{fmt.Sprintf("%d WARN_GET_ERROR_IN_LOOP", getErrorsPerFrame-1)}},
+		{"Degenerate draw call", []api.Cmd{
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 2),
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 3),
+			cb.GlDrawArraysInstanced(GLenum_GL_TRIANGLES, 0, 3, 2),
+			cb.GlDrawArrays(GLenum_GL_LINES, 0, 2),
+			cb.GlDrawArrays(GLenum_GL_POINTS, 0, 1),
+			cb.GlDrawArrays(GLenum_GL_LINES, 0, 1),
+			cb.GlDrawArraysInstanced(GLenum_GL_TRIANGLES, 0, 6, 0),
+		}, []string{"0 WARN_DEGENERATE_DRAW_CALL", "5 WARN_DEGENERATE_DRAW_CALL", "6 WARN_DEGENERATE_DRAW_CALL"}},
+		{"Mid-frame texture upload", []api.Cmd{
+			cb.GlBindTexture(GLenum_GL_TEXTURE_2D, 7),
+			texImage(),
+			cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 6),
+			texImage(),
+			swap(),
+			texImage(),
+		}, []string{"3 WARN_MID_FRAME_TEXTURE_UPLOAD"}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		h := &capture.Header{Abi: device.AndroidARMv7a}
+		c, err := capture.New(ctx, test.name, h, append(append([]api.Cmd{}, prologue...), test.cmds...))
+		if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+			continue
+		}
+		report, err := resolve.Report(ctx, c.Report(nil, nil))
+		if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+			continue
+		}
+		got := []string{}
+		for _, item := range report.Items {
+			idx := item.Command.Indices[0] - uint64(len(prologue))
+			got = append(got, fmt.Sprintf("%d %v", idx, report.Strings[item.Message.Identifier]))
+		}
+		assert.For(ctx, "issues").ThatSlice(got).Equals(test.expected)
+	}
+}
@@ -35,6 +35,7 @@ var (
 	// Interface compliance tests
 	_ = replay.QueryIssues(API{})
 	_ = replay.QueryFramebufferAttachment(API{})
+	_ = replay.QueryFragmentTests(API{})
 	_ = replay.Support(API{})
 )
 
@@ -48,6 +49,9 @@ type drawConfig struct {
 	wireframeOverlayID api.CmdID // used when wireframeMode == WireframeMode_Overlay
 }
 
+// fragmentTestsConfig is a replay.Config used by fragmentTestsRequests.
+type fragmentTestsConfig struct{}
+
 // uniqueConfig returns a replay.Config that is guaranteed to be unique.
 // Any requests made with a Config returned from uniqueConfig will not be
 // batched with any other request.
@@ -66,6 +70,13 @@ type framebufferRequest struct {
 	wireframeOverlay bool
 }
 
+// fragmentTestsRequest requests the fragment test results of the given draw
+// calls for the pixel at (x, y).
+type fragmentTestsRequest struct {
+	draws []api.CmdID
+	x, y  uint32
+}
+
 // GetReplayPriority returns a uint32 representing the preference for
 // replaying this trace on the given device.
 // A lower number represents a higher priority, and Zero represents
@@ -147,6 +158,12 @@ func (a API) Replay(
 			case replay.WireframeMode_Overlay:
 				transforms.Add(wireframeOverlay(ctx, req.after))
 			}
+
+		case fragmentTestsRequest:
+			for _, id := range req.draws {
+				deadCodeElimination.Request(id)
+			}
+			transforms.Add(newFragmentTests(ctx, req, rr.Result))
 		}
 	}
 
@@ -187,6 +204,9 @@ func (a API) Replay(
 		for i, t := range transforms {
 			log.I(ctx, "(%d) %#v", i, t)
 		}
+		if r, err := a.CompatCoverage(ctx, capture.Commands, device); err == nil && !r.Empty() {
+			log.I(ctx, "Compatibility layer coverage for device '%v': %v", device.Name, r)
+		}
 	}
 
 	if config.LogTransformsToFile {
@@ -250,6 +270,22 @@ func (a API) QueryFramebufferAttachment(
 	return res.(*image.Data), nil
 }
 
+func (a API) QueryFragmentTests(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr *replay.Manager,
+	draws []api.CmdID,
+	x, y uint32,
+	hints *service.UsageHints) ([]replay.FragmentTests, error) {
+
+	c, r := fragmentTestsConfig{}, fragmentTestsRequest{draws: draws, x: x, y: y}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	return res.([]replay.FragmentTests), nil
+}
+
 // destroyResourcesAtEOS is a transform that destroys all textures,
 // framebuffers, buffers, shaders, programs and vertex-arrays that were not
 // destroyed by EOS.
@@ -0,0 +1,106 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gles
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+)
+
+var _ api.StatsProvider = API{}
+
+var (
+	// Prefixes of the commands that upload data to textures.
+	textureUploads = []string{
+		"glTexImage", "glTexSubImage", "glCompressedTexImage", "glCompressedTexSubImage",
+	}
+	// Prefixes of the commands that upload data to buffers.
+	bufferUploads = []string{"glBufferData", "glBufferSubData"}
+	// Prefixes of the commands that only change the pipeline state.
+	stateChanges = []string{
+		"glActiveTexture", "glBind", "glBlend", "glClearColor", "glClearDepth",
+		"glClearStencil", "glColorMask", "glCullFace", "glDepth", "glDisable",
+		"glEnable", "glFrontFace", "glLineWidth", "glPixelStore",
+		"glPolygonOffset", "glSampleCoverage", "glSamplerParameter", "glScissor",
+		"glStencil", "glTexParameter", "glUniform", "glUseProgram",
+		"glVertexAttrib", "glViewport",
+	}
+)
+
+// CmdStats implements api.StatsProvider.
+func (API) CmdStats(ctx context.Context, cmd api.Cmd) api.CmdStats {
+	out := api.CmdStats{}
+	name := cmd.CmdName()
+	switch {
+	case hasPrefix(name, textureUploads):
+		out.TextureUploadBytes = api.ReadBytes(cmd)
+	case hasPrefix(name, bufferUploads):
+		out.BufferUploadBytes = api.ReadBytes(cmd)
+	case hasPrefix(name, stateChanges):
+		out.StateChange = true
+	}
+	if mode, vertices, instances, ok := drawCallVertices(cmd); ok {
+		if p, err := translateDrawPrimitive(mode); err == nil {
+			out.Triangles = p.TriangleCount(vertices) * instances
+		}
+	}
+	return out
+}
+
+// drawCallVertices returns the draw mode, the number of vertices and the
+// number of instances drawn by the draw call cmd. Indirect draw calls are not
+// supported, as the counts are held in buffers. Negative counts, which
+// generate GL_INVALID_VALUE, are reported as 0.
+func drawCallVertices(cmd api.Cmd) (mode GLenum, vertices, instances uint64, ok bool) {
+	switch cmd := cmd.(type) {
+	case *GlDrawArrays:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), 1, true
+	case *GlDrawArraysInstanced:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), drawCount(cmd.InstanceCount), true
+	case *GlDrawElements:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), 1, true
+	case *GlDrawElementsBaseVertex:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), 1, true
+	case *GlDrawElementsInstanced:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), drawCount(cmd.InstanceCount), true
+	case *GlDrawElementsInstancedBaseVertex:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), drawCount(cmd.InstanceCount), true
+	case *GlDrawRangeElements:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), 1, true
+	case *GlDrawRangeElementsBaseVertex:
+		return cmd.DrawMode, drawCount(cmd.IndicesCount), 1, true
+	}
+	return 0, 0, 0, false
+}
+
+// drawCount returns the count n as an unsigned integer, clamping negative values
+// to 0.
+func drawCount(n GLsizei) uint64 {
+	if n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
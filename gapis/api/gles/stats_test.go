@@ -0,0 +1,118 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gles
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCmdStats(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	cb := CommandBuilder{Thread: 0}
+	data, err := database.Store(ctx, make([]byte, 64))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		name     string
+		cmd      api.Cmd
+		expected api.CmdStats
+	}{
+		{"Triangles", cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 6), api.CmdStats{Triangles: 2}},
+		{"Triangle strip", cb.GlDrawArrays(GLenum_GL_TRIANGLE_STRIP, 0, 6), api.CmdStats{Triangles: 4}},
+		{"Lines", cb.GlDrawArrays(GLenum_GL_LINES, 0, 6), api.CmdStats{}},
+		{"Instanced", cb.GlDrawArraysInstanced(GLenum_GL_TRIANGLES, 0, 3, 5), api.CmdStats{Triangles: 5}},
+		{"Elements", cb.GlDrawElements(GLenum_GL_TRIANGLES, 9, GLenum_GL_UNSIGNED_SHORT, memory.Nullptr), api.CmdStats{Triangles: 3}},
+		{"Negative count", cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, -3), api.CmdStats{}},
+		{"Negative instance count", cb.GlDrawArraysInstanced(GLenum_GL_TRIANGLES, 0, 3, -1), api.CmdStats{}},
+		{"Texture upload", cb.GlTexImage2D(GLenum_GL_TEXTURE_2D, 0, GLint(GLenum_GL_RGBA), 4, 4, 0,
+			GLenum_GL_RGBA, GLenum_GL_UNSIGNED_BYTE, memory.BytePtr(0x1000, memory.ApplicationPool)).
+			AddRead(memory.Range{Base: 0x1000, Size: 64}, data), api.CmdStats{TextureUploadBytes: 64}},
+		{"Buffer upload", cb.GlBufferData(GLenum_GL_ARRAY_BUFFER, 32, memory.BytePtr(0x1000, memory.ApplicationPool), GLenum_GL_STATIC_DRAW).
+			AddRead(memory.Range{Base: 0x1000, Size: 32}, data), api.CmdStats{BufferUploadBytes: 32}},
+		{"State change", cb.GlEnable(GLenum_GL_BLEND), api.CmdStats{StateChange: true}},
+		{"Other", cb.GlFlush(), api.CmdStats{}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		assert.For(ctx, "stats").That(API{}.CmdStats(ctx, test.cmd)).Equals(test.expected)
+	}
+}
+
+func TestStats(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	data, err := database.Store(ctx, make([]byte, 64))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := CommandBuilder{Thread: 0}
+	cmds := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 0),
+			NewStaticContextState(), NewDynamicContextState(64, 64, false)),
+		cb.GlEnable(GLenum_GL_DEPTH_TEST),
+		cb.GlBufferData(GLenum_GL_ARRAY_BUFFER, 64, memory.BytePtr(0x1000, memory.ApplicationPool), GLenum_GL_STATIC_DRAW).
+			AddRead(memory.Range{Base: 0x1000, Size: 64}, data),
+		cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, 6),
+		cb.GlDrawArrays(GLenum_GL_TRIANGLES, 0, -3),
+		cb.EglSwapBuffers(memory.Nullptr, memory.Nullptr, 1),
+		cb.GlDrawArraysInstanced(GLenum_GL_TRIANGLES, 0, 3, 4),
+	}
+	h := &capture.Header{Abi: device.AndroidARMv7a}
+	c, err := capture.New(ctx, "test", h, cmds)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	// eglSwapBuffers starts a new frame.
+	stats, err := resolve.Stats(ctx, c.Stats())
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "NumCommands").That(stats.NumCommands).Equals(uint64(len(cmds)))
+	assert.For(ctx, "NumThreads").That(stats.NumThreads).Equals(uint32(1))
+	assert.For(ctx, "NumObservations").That(stats.NumObservations).Equals(uint64(1))
+	assert.For(ctx, "ObservedReadBytes").That(stats.ObservedReadBytes).Equals(uint64(64))
+	assert.For(ctx, "Frames").ThatSlice(stats.Frames).DeepEquals([]*service.FrameStats{
+		{FirstCommand: 0, LastCommand: 5, DrawCalls: 2, Triangles: 2, BufferUploadBytes: 64, StateChanges: 1},
+		{FirstCommand: 6, LastCommand: 7, DrawCalls: 1, Triangles: 4},
+	})
+	assert.For(ctx, "Total").That(stats.Total).DeepEquals(&service.FrameStats{
+		LastCommand: 7, DrawCalls: 3, Triangles: 6, BufferUploadBytes: 64, StateChanges: 1,
+	})
+	counts := map[string]uint64{}
+	for _, c := range stats.Commands {
+		counts[c.Name] += c.Count
+		assert.For(ctx, "ApiName").That(c.ApiName).Equals("gles")
+	}
+	assert.For(ctx, "Commands").That(counts).DeepEquals(map[string]uint64{
+		"eglCreateContext":      1,
+		"eglMakeCurrent":        1,
+		"glEnable":              1,
+		"glBufferData":          1,
+		"glDrawArrays":          2,
+		"eglSwapBuffers":        1,
+		"glDrawArraysInstanced": 1,
+	})
+	assert.For(ctx, "First command").That(stats.Commands[0].Name).Equals("glDrawArrays")
+}
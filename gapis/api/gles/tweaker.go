@@ -98,6 +98,29 @@ func (t *tweaker) glDepthMask(ctx context.Context, v GLboolean) {
 	}
 }
 
+func (t *tweaker) glColorMask(ctx context.Context, r, g, b, a GLboolean) {
+	// TODO: This does not correctly handle indexed state.
+	n := Vec4b{r, g, b, a}
+	if o := t.c.Pixel.ColorWritemask[0]; o != n {
+		t.doAndUndo(ctx,
+			t.cb.GlColorMask(r, g, b, a),
+			t.cb.GlColorMask(o[0], o[1], o[2], o[3]))
+	}
+}
+
+func (t *tweaker) glStencilMask(ctx context.Context, v GLuint) {
+	if o := t.c.Pixel.StencilWritemask; o != v {
+		t.doAndUndo(ctx,
+			t.cb.GlStencilMaskSeparate(GLenum_GL_FRONT, v),
+			t.cb.GlStencilMaskSeparate(GLenum_GL_FRONT, o))
+	}
+	if o := t.c.Pixel.StencilBackWritemask; o != v {
+		t.doAndUndo(ctx,
+			t.cb.GlStencilMaskSeparate(GLenum_GL_BACK, v),
+			t.cb.GlStencilMaskSeparate(GLenum_GL_BACK, o))
+	}
+}
+
 func (t *tweaker) glDepthFunc(ctx context.Context, v GLenum) {
 	if o := t.c.Pixel.Depth.Func; o != v {
 		t.doAndUndo(ctx,
@@ -232,6 +255,15 @@ func (t *tweaker) glGenVertexArray(ctx context.Context) VertexArrayId {
 	return id
 }
 
+func (t *tweaker) glGenQuery(ctx context.Context) QueryId {
+	id := QueryId(newUnusedID(ctx, 'Q', func(x uint32) bool { return t.c.Objects.Queries[QueryId(x)] != nil }))
+	tmp := t.AllocData(ctx, id)
+	t.doAndUndo(ctx,
+		t.cb.GlGenQueries(1, tmp.Ptr()).AddWrite(tmp.Data()),
+		t.cb.GlDeleteQueries(1, tmp.Ptr()).AddRead(tmp.Data()))
+	return id
+}
+
 func (t *tweaker) glCreateProgram(ctx context.Context) ProgramId {
 	id := ProgramId(newUnusedID(ctx, 'P', func(x uint32) bool {
 		return t.c.Objects.Shared.Programs[ProgramId(x)] != nil || t.c.Objects.Shared.Shaders[ShaderId(x)] != nil
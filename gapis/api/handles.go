@@ -0,0 +1,272 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/google/gapid/core/data"
+	"github.com/google/gapid/core/math/u64"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// HandleRemapper is the interface implemented by APIs whose commands refer to
+// objects by handles that are only unique within a capture.
+type HandleRemapper interface {
+	// RemapHandle returns the key identifying the object referred to by the
+	// handle v, as used by the command cmd on the state s. The handle v is
+	// either a parameter or result of cmd, or an element of an array read or
+	// written by cmd. remap is false if v is not a handle.
+	RemapHandle(v interface{}, cmd Cmd, s *State) (key interface{}, remap bool)
+}
+
+// MemoryHandle is a handle held in the memory read by a command.
+type MemoryHandle struct {
+	// Range is the memory holding the handle.
+	Range memory.Range
+	// Value is the handle, of the type of the parameter, field or array
+	// element holding it.
+	Value interface{}
+	// Key is the remapping key of the handle.
+	Key interface{}
+}
+
+// maxHandleDepth is the maximum number of pointers followed from the
+// parameters of a command to find handles.
+const maxHandleDepth = 4
+
+var tyPointer = reflect.TypeOf((*memory.Pointer)(nil)).Elem()
+
+// ReadHandles returns the handles held in the memory read by the command cmd
+// on the state s. The handles are the values accepted by remap, which has
+// the signature of HandleRemapper.RemapHandle. They are searched in the
+// arrays pointed to by the parameters of cmd, in the fields of the
+// structures of these arrays, and in the arrays pointed to by these fields.
+// The length of an array is the value of the closest preceding integer
+// parameter or field named n or with a name ending in count, or 1 if there is
+// none. Untyped pointers are not followed.
+//
+// read returns the memory of the range as observed before cmd, or nil if it
+// was not observed. Arrays are only searched up to their first element that
+// was not observed.
+func ReadHandles(cmd Cmd, s *State, remap func(v interface{}, cmd Cmd, s *State) (interface{}, bool),
+	read func(rng memory.Range) []byte) []MemoryHandle {
+
+	f := &handleFinder{cmd: cmd, state: s, remap: remap, read: read}
+	v := reflect.ValueOf(cmd)
+	for v.Kind() != reflect.Struct {
+		v = v.Elem()
+	}
+	counts := ArrayCounts(cmd)
+	for i, c := 0, v.NumField(); i < c; i++ {
+		if count, ok := counts[i]; ok {
+			f.array(v.Field(i).Interface().(memory.Pointer), count, 0)
+		}
+	}
+	return f.found
+}
+
+// ArrayCounts returns the number of elements of the arrays pointed to by the
+// pointer parameters of cmd, by index of the parameter in the command
+// structure. The number of elements of an array is the value of the last
+// count parameter before its pointer, or 1 if there is none.
+func ArrayCounts(cmd Cmd) map[int]uint64 {
+	v := reflect.ValueOf(cmd)
+	for v.Kind() != reflect.Struct {
+		v = v.Elem()
+	}
+	t := v.Type()
+	out := map[int]uint64{}
+	count := uint64(1)
+	for i, c := 0, t.NumField(); i < c; i++ {
+		name, ok := t.Field(i).Tag.Lookup("param")
+		if !ok {
+			continue
+		}
+		switch field := v.Field(i); {
+		case field.Type().Implements(tyPointer):
+			out[i] = count
+		case isCount(name):
+			if n, ok := intValue(field); ok {
+				count = n
+			}
+		}
+	}
+	return out
+}
+
+// handleFinder holds the state of ReadHandles.
+type handleFinder struct {
+	cmd   Cmd
+	state *State
+	remap func(v interface{}, cmd Cmd, s *State) (interface{}, bool)
+	read  func(rng memory.Range) []byte
+	found []MemoryHandle
+}
+
+// array searches the count elements of the array at p.
+func (f *handleFinder) array(p memory.Pointer, count uint64, depth int) {
+	if p == nil || p.IsNullptr() || depth > maxHandleDepth {
+		return
+	}
+	el := p.ElementType()
+	if el == nil || !searchable(el) {
+		return
+	}
+	size := memory.SizeOf(el, f.state.MemoryLayout)
+	for i := uint64(0); i < count; i++ {
+		addr := p.Address() + i*size
+		buf := f.read(memory.Range{Base: addr, Size: size})
+		if buf == nil {
+			return
+		}
+		f.value(el, addr, buf, depth)
+	}
+}
+
+// value searches the value of type t held by buf, at the address addr.
+func (f *handleFinder) value(t reflect.Type, addr uint64, buf []byte, depth int) {
+	m := f.state.MemoryLayout
+	switch {
+	case t.Implements(tyPointer):
+		if p := f.pointer(t, buf); p != nil {
+			f.handle(p, addr, memory.SizeOf(t, m))
+		}
+		return
+	case isHandleKind(t.Kind()):
+		v := reflect.New(t).Elem()
+		size := memory.SizeOf(t, m)
+		setBits(v, f.uint(buf, size))
+		f.handle(v.Interface(), addr, size)
+		return
+	}
+	switch t.Kind() {
+	case reflect.Array:
+		size := memory.SizeOf(t.Elem(), m)
+		for i := uint64(0); i < uint64(t.Len()); i++ {
+			f.value(t.Elem(), addr+i*size, buf[i*size:], depth)
+		}
+	case reflect.Struct:
+		offset, count := uint64(0), uint64(1)
+		for i, c := 0, t.NumField(); i < c; i++ {
+			field := t.Field(i)
+			offset = u64.AlignUp(offset, memory.AlignOf(field.Type, m))
+			size := memory.SizeOf(field.Type, m)
+			switch {
+			case field.Type.Implements(tyPointer):
+				if p := f.pointer(field.Type, buf[offset:]); p != nil && !f.handle(p, addr+offset, size) {
+					f.array(p.(memory.Pointer), count, depth+1)
+				}
+			case isHandleKind(field.Type.Kind()) && isCount(field.Name):
+				count = f.uint(buf[offset:], size)
+				fallthrough
+			default:
+				f.value(field.Type, addr+offset, buf[offset:], depth)
+			}
+			offset += size
+		}
+	}
+}
+
+// pointer returns the pointer of type t held by buf, or nil if t cannot be
+// assigned.
+func (f *handleFinder) pointer(t reflect.Type, buf []byte) interface{} {
+	v := reflect.New(t)
+	a, ok := v.Interface().(data.Assignable)
+	if !ok {
+		return nil
+	}
+	addr := f.uint(buf, uint64(f.state.MemoryLayout.GetPointer().GetSize()))
+	if !a.Assign(memory.BytePtr(addr, memory.ApplicationPool)) {
+		return nil
+	}
+	return v.Elem().Interface()
+}
+
+// handle adds v to the found handles if it is remapped, and returns whether
+// it is.
+func (f *handleFinder) handle(v interface{}, addr, size uint64) bool {
+	key, remap := f.remap(v, f.cmd, f.state)
+	if remap {
+		f.found = append(f.found, MemoryHandle{
+			Range: memory.Range{Base: addr, Size: size},
+			Value: v,
+			Key:   key,
+		})
+	}
+	return remap
+}
+
+// uint returns the unsigned integer of size bytes at the start of buf, in
+// the byte order of the state.
+func (f *handleFinder) uint(buf []byte, size uint64) uint64 {
+	v := uint64(0)
+	for i := uint64(0); i < size && i < uint64(len(buf)); i++ {
+		if f.state.MemoryLayout.GetEndian() == device.BigEndian {
+			v = v<<8 | uint64(buf[i])
+		} else {
+			v |= uint64(buf[i]) << (8 * i)
+		}
+	}
+	return v
+}
+
+// searchable returns true if the values of type t can hold handles.
+func searchable(t reflect.Type) bool {
+	return t.Implements(tyPointer) || isHandleKind(t.Kind()) ||
+		t.Kind() == reflect.Struct || t.Kind() == reflect.Array && searchable(t.Elem())
+}
+
+// isHandleKind returns true if the values of kind k can be integer handles.
+func isHandleKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// isCount returns true if the parameter or field name is the length of the
+// following arrays.
+func isCount(name string) bool {
+	return name == "n" || strings.HasSuffix(strings.ToLower(name), "count")
+}
+
+// intValue returns the value of the integer v, with negative values clamped
+// to 0.
+func intValue(v reflect.Value) (uint64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := v.Int(); n > 0 {
+			return uint64(n), true
+		}
+		return 0, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true
+	}
+	return 0, false
+}
+
+// setBits sets the integer value v to the bits of i.
+func setBits(v reflect.Value, i uint64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(i))
+	default:
+		v.SetUint(i)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/builder"
+)
+
+type handle uint32
+
+// handlePtr is a typed pointer to handles, as the generated pointer types.
+type handlePtr struct{ memory.Pointer }
+
+func (p *handlePtr) Assign(o interface{}) bool {
+	a, ok := o.(memory.Pointer)
+	if ok {
+		p.Pointer = memory.NewPtr(a.Address(), a.Pool(), reflect.TypeOf(handle(0)))
+	}
+	return ok
+}
+
+// info is a structure holding handles, and a pointer to an array of handles.
+type info struct {
+	Kind    uint32
+	Handle  handle
+	Count   uint32
+	Handles handlePtr
+	Size    uint64
+}
+
+type infosCmd struct {
+	Count uint32         `param:"infoCount"`
+	Infos memory.Pointer `param:"pInfos"`
+}
+
+func (c *infosCmd) Thread() uint64         { return 1 }
+func (c *infosCmd) SetThread(uint64)       {}
+func (c *infosCmd) CmdName() string        { return "infos" }
+func (c *infosCmd) API() api.API           { return nil }
+func (c *infosCmd) CmdFlags() api.CmdFlags { return 0 }
+func (c *infosCmd) Extras() *api.CmdExtras { return nil }
+func (c *infosCmd) Mutate(context.Context, *api.State, *builder.Builder) error {
+	return nil
+}
+
+func TestReadHandles(t *testing.T) {
+	ctx := log.Testing(t)
+	s := api.NewStateWithEmptyAllocator(device.Little64)
+	le := binary.LittleEndian
+
+	// Two infos at 0x1000, the first pointing to two handles at 0x2000, the
+	// second to a handle at 0x3000 that was not observed.
+	infos := make([]byte, 64)
+	le.PutUint32(infos[0:], 1)
+	le.PutUint32(infos[4:], 5)
+	le.PutUint32(infos[8:], 2)
+	le.PutUint64(infos[16:], 0x2000)
+	le.PutUint64(infos[24:], 10)
+	le.PutUint32(infos[32:], 1)
+	le.PutUint32(infos[36:], 6)
+	le.PutUint32(infos[40:], 1)
+	le.PutUint64(infos[48:], 0x3000)
+	handles := make([]byte, 12)
+	le.PutUint32(handles[0:], 7)
+	le.PutUint32(handles[4:], 8)
+	le.PutUint32(handles[8:], 9)
+	observed := map[uint64][]byte{0x1000: infos, 0x2000: handles}
+	read := func(rng memory.Range) []byte {
+		for base, data := range observed {
+			if base <= rng.Base && rng.End() <= base+uint64(len(data)) {
+				return data[rng.Base-base : rng.End()-base]
+			}
+		}
+		return nil
+	}
+	remap := func(v interface{}, cmd api.Cmd, s *api.State) (interface{}, bool) {
+		h, ok := v.(handle)
+		return h, ok && h != 0
+	}
+
+	cmd := &infosCmd{Count: 2, Infos: memory.NewPtr(0x1000, memory.ApplicationPool, reflect.TypeOf(info{}))}
+	got := api.ReadHandles(cmd, s, remap, read)
+	assert.For(ctx, "handles").ThatSlice(got).DeepEquals([]api.MemoryHandle{
+		{Range: memory.Range{Base: 0x1004, Size: 4}, Value: handle(5), Key: handle(5)},
+		{Range: memory.Range{Base: 0x2000, Size: 4}, Value: handle(7), Key: handle(7)},
+		{Range: memory.Range{Base: 0x2004, Size: 4}, Value: handle(8), Key: handle(8)},
+		{Range: memory.Range{Base: 0x1024, Size: 4}, Value: handle(6), Key: handle(6)},
+	})
+
+	// The array pointed to by the parameter is only searched up to its count.
+	cmd.Count = 1
+	got = api.ReadHandles(cmd, s, remap, read)
+	assert.For(ctx, "handles").ThatSlice(got).IsLength(3)
+}
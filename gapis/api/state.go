@@ -86,6 +86,49 @@ func NewStateWithAllocator(allocator memory.Allocator, memoryLayout *device.Memo
 	}
 }
 
+// StateCloner is the interface implemented by per-API states that can be
+// copied by State.Clone.
+type StateCloner interface {
+	// CloneState returns a deep copy of the API state.
+	CloneState() (interface{}, error)
+}
+
+// ErrStateNotCloneable is the error returned by State.Clone when a per-API
+// state does not implement StateCloner.
+type ErrStateNotCloneable struct {
+	API API
+}
+
+func (e ErrStateNotCloneable) Error() string {
+	return fmt.Sprintf("%v state cannot be cloned", e.API.Name())
+}
+
+// Clone returns a deep copy of the State, which can be mutated without
+// affecting s. The callbacks are not copied.
+// Clone returns ErrStateNotCloneable if any of the per-API states does not
+// implement StateCloner.
+func (s *State) Clone() (*State, error) {
+	out := &State{
+		MemoryLayout: s.MemoryLayout,
+		Memory:       s.Memory.Clone(),
+		NextPoolID:   s.NextPoolID,
+		APIs:         make(map[API]interface{}, len(s.APIs)),
+		Allocator:    s.Allocator.Clone(),
+	}
+	for a, state := range s.APIs {
+		c, ok := state.(StateCloner)
+		if !ok {
+			return nil, ErrStateNotCloneable{a}
+		}
+		clone, err := c.CloneState()
+		if err != nil {
+			return nil, err
+		}
+		out.APIs[a] = clone
+	}
+	return out, nil
+}
+
 func (s State) String() string {
 	mem := make([]string, 0, len(s.Memory))
 	for i, p := range s.Memory {
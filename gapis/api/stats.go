@@ -0,0 +1,64 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import "context"
+
+// CmdStats holds API specific statistics about a single command.
+type CmdStats struct {
+	// Triangles is the number of triangles drawn by the command.
+	Triangles uint64
+	// TextureUploadBytes is the number of bytes uploaded to textures.
+	TextureUploadBytes uint64
+	// BufferUploadBytes is the number of bytes uploaded to buffers.
+	BufferUploadBytes uint64
+	// StateChange is true if the command only changes the pipeline state.
+	StateChange bool
+}
+
+// StatsProvider is the interface implemented by APIs that can report
+// statistics about their commands.
+type StatsProvider interface {
+	// CmdStats returns the statistics of the command cmd, which belongs to the
+	// API.
+	CmdStats(ctx context.Context, cmd Cmd) CmdStats
+}
+
+// TriangleCount returns the number of triangles drawn with the primitive p
+// for the given number of vertices.
+func (p DrawPrimitive) TriangleCount(vertices uint64) uint64 {
+	switch p {
+	case DrawPrimitive_Triangles:
+		return vertices / 3
+	case DrawPrimitive_TriangleStrip, DrawPrimitive_TriangleFan:
+		if vertices < 3 {
+			return 0
+		}
+		return vertices - 2
+	default:
+		return 0
+	}
+}
+
+// ReadBytes returns the total size of the read observations of cmd.
+func ReadBytes(cmd Cmd) uint64 {
+	size := uint64(0)
+	if o := cmd.Extras().Observations(); o != nil {
+		for _, r := range o.Reads {
+			size += r.Range.Size
+		}
+	}
+	return size
+}
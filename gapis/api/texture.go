@@ -176,3 +176,52 @@ func NewTexture(t interface{}) *Texture {
 		panic(fmt.Errorf("%T is not a Texture type", t))
 	}
 }
+
+// Image returns the image at the given mip-level and layer of the texture.
+// For cubemaps, layer selects the face in the order -X, +X, -Y, +Y, -Z, +Z.
+// For cubemap arrays, layer is the array index multiplied by 6 plus the face.
+// If the texture does not hold an image at level and layer then nil is
+// returned.
+func (t *Texture) Image(level, layer uint32) *image.Info {
+	pick := func(levels []*image.Info) *image.Info {
+		if level < uint32(len(levels)) {
+			return levels[level]
+		}
+		return nil
+	}
+	face := func(c *Cubemap, f uint32) *image.Info {
+		if c == nil || level >= uint32(len(c.Levels)) || c.Levels[level] == nil || f >= 6 {
+			return nil
+		}
+		return c.Levels[level].faces()[f]
+	}
+	switch t := protoutil.OneOf(t.Type).(type) {
+	case *Texture1D:
+		if layer == 0 {
+			return pick(t.Levels)
+		}
+	case *Texture1DArray:
+		if layer < uint32(len(t.Layers)) {
+			return pick(t.Layers[layer].Levels)
+		}
+	case *Texture2D:
+		if layer == 0 {
+			return pick(t.Levels)
+		}
+	case *Texture2DArray:
+		if layer < uint32(len(t.Layers)) {
+			return pick(t.Layers[layer].Levels)
+		}
+	case *Texture3D:
+		if layer == 0 {
+			return pick(t.Levels)
+		}
+	case *Cubemap:
+		return face(t, layer)
+	case *CubemapArray:
+		if i := layer / 6; i < uint32(len(t.Layers)) {
+			return face(t.Layers[i], layer%6)
+		}
+	}
+	return nil
+}
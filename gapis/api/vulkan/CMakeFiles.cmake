@@ -18,10 +18,13 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    analysis.go
+    analysis_test.go
     api.go
     buffer_command.go
     command_buffer_rebuilder.go
     convert.go
+    cpp_export.go
     custom_replay.go
     dependency_graph_behaviour_provider.go
     doc.go
@@ -30,6 +33,10 @@ set(files
     enum.go
     externs.go
     find_issues.go
+    footprint.go
+    footprint_test.go
+    fragment_tests.go
+    handles.go
     mutate.go
     read_framebuffer.go
     replay.go
@@ -0,0 +1,315 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/stringtable"
+)
+
+var _ api.AnalysisProvider = API{}
+
+// NewAnalyzer implements api.AnalysisProvider.
+// The returned analyzer reports misuses of the API in the spirit of the
+// validation layers, from the state alone.
+func (API) NewAnalyzer(ctx context.Context) api.Analyzer {
+	return &analyzer{
+		fences:   map[VkFence]bool{},
+		written:  map[VkImage]string{},
+		reported: map[interface{}]bool{},
+	}
+}
+
+// analyzer is an api.Analyzer that validates the Vulkan commands of a
+// capture. The commands recorded in command buffers are validated as they are
+// executed by the queue submissions.
+type analyzer struct {
+	// The state the subcommand handler is installed on, and the handler it
+	// replaced.
+	installed   *State
+	prevHandler func(interface{})
+	// Whether each fence is signaled, or will be signaled by a pending
+	// command.
+	fences map[VkFence]bool
+	// The images written by the current queue submission since the last
+	// pipeline barrier that covers them, with the name of the writing command.
+	written map[VkImage]string
+	// The issues already reported for the current queue submission.
+	reported map[interface{}]bool
+	// The issues found with the current command.
+	issues []api.Issue
+}
+
+func (a *analyzer) report(s log.Severity, m *stringtable.Msg, subcommand []uint64) {
+	a.issues = append(a.issues, api.Issue{Severity: s, Message: m, Subcommand: subcommand})
+}
+
+// reportOnce reports the issue identified by key, unless it has already been
+// reported for the current queue submission.
+func (a *analyzer) reportOnce(key interface{}, s log.Severity, m *stringtable.Msg, subcommand []uint64) {
+	if !a.reported[key] {
+		a.reported[key] = true
+		a.report(s, m, subcommand)
+	}
+}
+
+// PreMutate implements api.Analyzer.
+func (a *analyzer) PreMutate(ctx context.Context, cmd api.Cmd, s *api.State) {
+	a.issues = nil
+	st := GetState(s)
+	if st == nil {
+		return
+	}
+	a.install(st)
+	if _, ok := cmd.(*VkQueueSubmit); ok {
+		a.written = map[VkImage]string{}
+		a.reported = map[interface{}]bool{}
+	}
+}
+
+// PostMutate implements api.Analyzer.
+func (a *analyzer) PostMutate(ctx context.Context, cmd api.Cmd, s *api.State) []api.Issue {
+	a.uninstall()
+	st := GetState(s)
+	if st == nil {
+		return a.issues
+	}
+	l := s.MemoryLayout
+	switch cmd := cmd.(type) {
+	case *VkQueueSubmit:
+		a.signal(cmd.Fence)
+	case *VkQueueBindSparse:
+		a.signal(cmd.Fence)
+	case *VkAcquireNextImageKHR:
+		a.signal(cmd.Fence)
+	case *VkResetFences:
+		for _, f := range cmd.PFences.Slice(uint64(0), uint64(cmd.FenceCount), l).Read(ctx, cmd, s, nil) {
+			a.fences[f] = false
+		}
+	case *VkWaitForFences:
+		fences := cmd.PFences.Slice(uint64(0), uint64(cmd.FenceCount), l).Read(ctx, cmd, s, nil)
+		unsignaled := []VkFence{}
+		for _, f := range fences {
+			if !a.signaled(st, f) {
+				unsignaled = append(unsignaled, f)
+			}
+		}
+		// Waiting for any fence only blocks forever if none can be signaled.
+		if cmd.WaitAll != 0 || len(unsignaled) == len(fences) {
+			for _, f := range unsignaled {
+				a.report(log.Error, messages.ErrWaitForUnsignaledFence(uint64(f)), nil)
+			}
+		}
+	}
+	return a.issues
+}
+
+// install wraps the subcommand handler of st so that the analyzer validates
+// the command buffer commands executed by the command being mutated.
+func (a *analyzer) install(st *State) {
+	// PostMutate is not called for the commands that failed to mutate.
+	a.uninstall()
+	prev := st.HandleSubcommand
+	a.installed, a.prevHandler = st, prev
+	st.HandleSubcommand = func(c interface{}) {
+		if prev != nil {
+			prev(c)
+		}
+		if c, ok := c.(CommandBufferCommand); ok {
+			a.subcommand(st, c)
+		}
+	}
+}
+
+// uninstall restores the subcommand handler replaced by install.
+func (a *analyzer) uninstall() {
+	if a.installed != nil {
+		a.installed.HandleSubcommand = a.prevHandler
+		a.installed, a.prevHandler = nil, nil
+	}
+}
+
+// signal marks the fence f as signaled by a pending command.
+func (a *analyzer) signal(f VkFence) {
+	if f != 0 {
+		a.fences[f] = true
+	}
+}
+
+// signaled returns true if the fence f is signaled, or will be signaled by a
+// pending command. Unknown fences are assumed to be signaled.
+func (a *analyzer) signaled(st *State, f VkFence) bool {
+	if signaled, ok := a.fences[f]; ok {
+		return signaled
+	}
+	if o := st.Fences[f]; o != nil {
+		return o.Signaled
+	}
+	return true
+}
+
+// subcommand validates the command buffer command c, which has just been
+// executed.
+func (a *analyzer) subcommand(st *State, c CommandBufferCommand) {
+	idx := append([]uint64(nil), st.SubcommandIndex...)
+	switch d := c.recreateData.(type) {
+	case *RecreateCmdCopyImageData:
+		a.checkLayout(st, idx, "vkCmdCopyImage", d.SrcImage, d.SrcImageLayout)
+		a.checkLayout(st, idx, "vkCmdCopyImage", d.DstImage, d.DstImageLayout)
+		a.written[d.DstImage] = "vkCmdCopyImage"
+	case *RecreateCmdBlitImageData:
+		a.checkLayout(st, idx, "vkCmdBlitImage", d.SrcImage, d.SrcImageLayout)
+		a.checkLayout(st, idx, "vkCmdBlitImage", d.DstImage, d.DstImageLayout)
+		a.written[d.DstImage] = "vkCmdBlitImage"
+	case *RecreateCmdResolveImageData:
+		a.checkLayout(st, idx, "vkCmdResolveImage", d.SrcImage, d.SrcImageLayout)
+		a.checkLayout(st, idx, "vkCmdResolveImage", d.DstImage, d.DstImageLayout)
+		a.written[d.DstImage] = "vkCmdResolveImage"
+	case *RecreateCopyBufferToImageData:
+		a.checkLayout(st, idx, "vkCmdCopyBufferToImage", d.DstImage, d.Layout)
+		a.written[d.DstImage] = "vkCmdCopyBufferToImage"
+	case *RecreateCopyImageToBufferData:
+		a.checkLayout(st, idx, "vkCmdCopyImageToBuffer", d.SrcImage, d.SrcImageLayout)
+	case *RecreateCmdClearColorImageData:
+		a.checkLayout(st, idx, "vkCmdClearColorImage", d.Image, d.ImageLayout)
+		a.written[d.Image] = "vkCmdClearColorImage"
+	case *RecreateCmdClearDepthStencilImageData:
+		a.checkLayout(st, idx, "vkCmdClearDepthStencilImage", d.Image, d.ImageLayout)
+		a.written[d.Image] = "vkCmdClearDepthStencilImage"
+	case *RecreateCmdPipelineBarrierData:
+		if len(d.MemoryBarriers) > 0 {
+			a.written = map[VkImage]string{}
+		}
+		for _, b := range d.ImageMemoryBarriers {
+			delete(a.written, b.Image)
+		}
+	case *RecreateCmdWaitEventsData:
+		if len(d.MemoryBarriers) > 0 {
+			a.written = map[VkImage]string{}
+		}
+		for _, b := range d.ImageMemoryBarriers {
+			delete(a.written, b.Image)
+		}
+	case *RecreateCmdDrawData:
+		a.checkDraw(st, idx, "vkCmdDraw")
+	case *RecreateCmdDrawIndexedData:
+		a.checkDraw(st, idx, "vkCmdDrawIndexed")
+	case *RecreateCmdDrawIndirectData:
+		a.checkDraw(st, idx, "vkCmdDrawIndirect")
+	case *RecreateCmdDrawIndexedIndirectData:
+		a.checkDraw(st, idx, "vkCmdDrawIndexedIndirect")
+	}
+}
+
+// checkLayout reports if the image is not in the layout expected by the
+// command.
+func (a *analyzer) checkLayout(st *State, idx []uint64, command string, image VkImage, expected VkImageLayout) {
+	img := st.Images[image]
+	if img == nil || img.Info.Layout == expected {
+		return
+	}
+	type key struct {
+		image    VkImage
+		expected VkImageLayout
+	}
+	a.reportOnce(key{image, expected}, log.Warning, messages.WarnImageLayoutMismatch(
+		uint64(image), command, expected.String(), img.Info.Layout.String()), idx)
+}
+
+// checkDraw validates the descriptor sets bound for the draw call command.
+func (a *analyzer) checkDraw(st *State, idx []uint64, command string) {
+	if st.LastBoundQueue == nil {
+		return
+	}
+	info := st.LastDrawInfos[st.LastBoundQueue.VulkanHandle]
+	if info == nil {
+		return
+	}
+	type key struct {
+		set     VkDescriptorSet
+		binding uint32
+		handle  uint64
+	}
+	destroyed := func(set *DescriptorSetObject, binding uint32, object string, handle uint64) {
+		a.reportOnce(key{set.VulkanHandle, binding, handle}, log.Error,
+			messages.ErrDescriptorReferencesDestroyedObject(uint64(set.VulkanHandle), command, object, handle, binding), idx)
+	}
+	for _, set := range info.DescriptorSets {
+		if set == nil {
+			continue
+		}
+		for b, binding := range set.Bindings {
+			switch ty := binding.BindingType; ty {
+			case VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLED_IMAGE,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_IMAGE,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_INPUT_ATTACHMENT:
+				hasSampler := ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER ||
+					ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER
+				for _, i := range binding.ImageBinding {
+					if i == nil {
+						continue
+					}
+					if hasSampler && i.Sampler != 0 && st.Samplers[i.Sampler] == nil {
+						destroyed(set, b, "sampler", uint64(i.Sampler))
+					}
+					if ty == VkDescriptorType_VK_DESCRIPTOR_TYPE_SAMPLER || i.ImageView == 0 {
+						continue
+					}
+					view := st.ImageViews[i.ImageView]
+					if view == nil {
+						destroyed(set, b, "image view", uint64(i.ImageView))
+						continue
+					}
+					img := view.Image
+					if img == nil {
+						continue
+					}
+					if st.Images[img.VulkanHandle] != img {
+						destroyed(set, b, "image", uint64(img.VulkanHandle))
+						continue
+					}
+					a.checkLayout(st, idx, command, img.VulkanHandle, i.ImageLayout)
+					if writer, ok := a.written[img.VulkanHandle]; ok {
+						delete(a.written, img.VulkanHandle)
+						a.report(log.Warning, messages.WarnMissingPipelineBarrier(
+							uint64(img.VulkanHandle), command, writer), idx)
+					}
+				}
+			case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER_DYNAMIC,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_BUFFER_DYNAMIC:
+				for _, i := range binding.BufferBinding {
+					if i != nil && i.Buffer != 0 && st.Buffers[i.Buffer] == nil {
+						destroyed(set, b, "buffer", uint64(i.Buffer))
+					}
+				}
+			case VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_TEXEL_BUFFER,
+				VkDescriptorType_VK_DESCRIPTOR_TYPE_STORAGE_TEXEL_BUFFER:
+				for _, v := range binding.BufferViewBindings {
+					if v != 0 && st.BufferViews[v] == nil {
+						destroyed(set, b, "buffer view", uint64(v))
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// issues returns the identifiers and subcommands of the issues.
+func issues(in []api.Issue) []string {
+	out := []string{}
+	for _, i := range in {
+		out = append(out, fmt.Sprintf("%v %v", i.Message.Identifier, i.Subcommand))
+	}
+	return out
+}
+
+// analyze passes cmd to the analyzer a around its mutation on s, as the
+// report does, and returns the issues found with cmd.
+func analyze(ctx context.Context, a api.Analyzer, s *api.State, cmd api.Cmd) []string {
+	a.PreMutate(ctx, cmd, s)
+	if err := cmd.Mutate(ctx, s, nil); err != nil {
+		log.E(ctx, "Mutate %v failed: %v", cmd.CmdName(), err)
+		return nil
+	}
+	return issues(a.PostMutate(ctx, cmd, s))
+}
+
+func TestAnalyzerFences(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.AndroidARMv7a.MemoryLayout)
+	a := API{}.NewAnalyzer(ctx)
+
+	cb := CommandBuilder{Thread: 0}
+	dev, queue := VkDevice(1), VkQueue(2)
+	unsignaled, signaled, unknown := VkFence(0x10), VkFence(0x20), VkFence(0x30)
+	create := func(f VkFence, flags VkFenceCreateFlags) api.Cmd {
+		info := s.AllocDataOrPanic(ctx, VkFenceCreateInfo{
+			SType: VkStructureType_VK_STRUCTURE_TYPE_FENCE_CREATE_INFO,
+			Flags: flags,
+		})
+		handle := s.AllocDataOrPanic(ctx, f)
+		return cb.VkCreateFence(dev, info.Ptr(), memory.Nullptr, handle.Ptr(), VkResult_VK_SUCCESS).
+			AddRead(info.Data()).AddWrite(handle.Data())
+	}
+	wait := func(all bool, fences ...VkFence) api.Cmd {
+		data := s.AllocDataOrPanic(ctx, fences)
+		waitAll := VkBool32(0)
+		if all {
+			waitAll = 1
+		}
+		return cb.VkWaitForFences(dev, uint32(len(fences)), data.Ptr(), waitAll, 0, VkResult_VK_SUCCESS).
+			AddRead(data.Data())
+	}
+	reset := func(fences ...VkFence) api.Cmd {
+		data := s.AllocDataOrPanic(ctx, fences)
+		return cb.VkResetFences(dev, uint32(len(fences)), data.Ptr(), VkResult_VK_SUCCESS).
+			AddRead(data.Data())
+	}
+	const waitErr = "ERR_WAIT_FOR_UNSIGNALED_FENCE []"
+
+	for _, test := range []struct {
+		name     string
+		cmd      api.Cmd
+		expected []string
+	}{
+		{"Create unsignaled", create(unsignaled, 0), []string{}},
+		{"Create signaled", create(signaled, VkFenceCreateFlags(VkFenceCreateFlagBits_VK_FENCE_CREATE_SIGNALED_BIT)), []string{}},
+		{"Wait for unsignaled", wait(true, unsignaled), []string{waitErr}},
+		{"Wait for signaled", wait(true, signaled), []string{}},
+		{"Wait for any", wait(false, unsignaled, signaled), []string{}},
+		{"Wait for all", wait(true, unsignaled, signaled), []string{waitErr}},
+		{"Submit", cb.VkQueueSubmit(queue, 0, memory.Nullptr, unsignaled, VkResult_VK_SUCCESS), []string{}},
+		{"Wait for submitted", wait(true, unsignaled), []string{}},
+		{"Reset", reset(unsignaled, signaled), []string{}},
+		{"Wait for any reset", wait(false, unsignaled, signaled), []string{waitErr, waitErr}},
+		{"Wait for unknown", wait(true, unknown), []string{}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		assert.For(ctx, "issues").ThatSlice(analyze(ctx, a, s, test.cmd)).Equals(test.expected)
+	}
+}
+
+func TestAnalyzerSubcommands(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.AndroidARMv7a.MemoryLayout)
+	st := GetState(s)
+	a := API{}.NewAnalyzer(ctx)
+
+	prevCalls := 0
+	st.HandleSubcommand = func(interface{}) { prevCalls++ }
+
+	const (
+		general = VkImageLayout_VK_IMAGE_LAYOUT_GENERAL
+		dst     = VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_DST_OPTIMAL
+		src     = VkImageLayout_VK_IMAGE_LAYOUT_TRANSFER_SRC_OPTIMAL
+	)
+	queue, set := VkQueue(1), VkDescriptorSet(2)
+	copied, sampled := VkImage(0x10), VkImage(0x20)
+	view, sampler, buffer := VkImageView(0x30), VkSampler(0x40), VkBuffer(0x50)
+	st.Images[copied] = &ImageObject{VulkanHandle: copied, Info: ImageInfo{Layout: dst}}
+	st.Images[sampled] = &ImageObject{VulkanHandle: sampled, Info: ImageInfo{Layout: general}}
+	st.ImageViews[view] = &ImageViewObject{VulkanHandle: view, Image: st.Images[sampled]}
+	st.Samplers[sampler] = &SamplerObject{VulkanHandle: sampler}
+	st.Buffers[buffer] = &BufferObject{VulkanHandle: buffer}
+	st.LastBoundQueue = &QueueObject{VulkanHandle: queue}
+	st.LastDrawInfos[queue] = &DrawInfo{DescriptorSets: U32ːDescriptorSetObjectʳᵐ{
+		0: {VulkanHandle: set, Bindings: U32ːDescriptorBindingᵐ{
+			0: {
+				BindingType: VkDescriptorType_VK_DESCRIPTOR_TYPE_COMBINED_IMAGE_SAMPLER,
+				ImageBinding: U32ːVkDescriptorImageInfoʳᵐ{
+					0: {Sampler: sampler, ImageView: view, ImageLayout: general},
+				},
+			},
+			1: {
+				BindingType: VkDescriptorType_VK_DESCRIPTOR_TYPE_UNIFORM_BUFFER,
+				BufferBinding: U32ːVkDescriptorBufferInfoʳᵐ{
+					0: {Buffer: buffer},
+				},
+			},
+		}},
+	}}
+
+	copyImage := func(srcLayout, dstLayout VkImageLayout) interface{} {
+		return &RecreateCmdCopyImageData{SrcImage: copied, SrcImageLayout: srcLayout, DstImage: sampled, DstImageLayout: dstLayout}
+	}
+	barrier := &RecreateCmdPipelineBarrierData{ImageMemoryBarriers: U32ːVkImageMemoryBarrierᵐ{0: {Image: sampled}}}
+	draw := &RecreateCmdDrawData{}
+
+	// submit passes a submission executing the commands to the analyzer, and
+	// returns the issues found with it.
+	cb := CommandBuilder{Thread: 0}
+	submit := func(cmds ...interface{}) []string {
+		cmd := cb.VkQueueSubmit(queue, 0, memory.Nullptr, 0, VkResult_VK_SUCCESS)
+		a.PreMutate(ctx, cmd, s)
+		for i, c := range cmds {
+			st.SubcommandIndex = []uint64{0, uint64(i)}
+			st.HandleSubcommand(CommandBufferCommand{recreateData: c})
+		}
+		return issues(a.PostMutate(ctx, cmd, s))
+	}
+
+	assert.For(ctx, "layout mismatch").ThatSlice(submit(copyImage(general, general), copyImage(general, general))).Equals([]string{
+		"WARN_IMAGE_LAYOUT_MISMATCH [0 0]",
+	})
+	assert.For(ctx, "missing barrier").ThatSlice(submit(copyImage(dst, general), draw, draw)).Equals([]string{
+		"WARN_MISSING_PIPELINE_BARRIER [0 1]",
+	})
+	assert.For(ctx, "barrier").ThatSlice(submit(copyImage(dst, general), barrier, draw)).Equals([]string{})
+
+	// The handler replaced by the analyzer is called for each subcommand, and
+	// restored after the command.
+	restored := func(calls int) {
+		st.HandleSubcommand(CommandBufferCommand{recreateData: copyImage(src, src)})
+		assert.For(ctx, "previous handler calls").That(prevCalls).Equals(calls)
+		assert.For(ctx, "issues").ThatSlice(a.(*analyzer).issues).IsEmpty()
+	}
+	assert.For(ctx, "previous handler calls").That(prevCalls).Equals(8)
+	restored(9)
+
+	// The handler is also restored if PostMutate is not called, as for the
+	// commands that fail to mutate.
+	a.PreMutate(ctx, cb.VkQueueSubmit(queue, 0, memory.Nullptr, 0, VkResult_VK_SUCCESS), s)
+	assert.For(ctx, "nothing drawn").ThatSlice(submit(draw)).Equals([]string{})
+	restored(11)
+
+	delete(st.Samplers, sampler)
+	delete(st.ImageViews, view)
+	delete(st.Buffers, buffer)
+	assert.For(ctx, "destroyed objects").ThatSlice(submit(draw, draw)).Equals([]string{
+		"ERR_DESCRIPTOR_REFERENCES_DESTROYED_OBJECT [0 0]",
+		"ERR_DESCRIPTOR_REFERENCES_DESTROYED_OBJECT [0 0]",
+		"ERR_DESCRIPTOR_REFERENCES_DESTROYED_OBJECT [0 0]",
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/api/cpp"
+)
+
+var _ cpp.Provider = API{}
+
+// CppTarget implements cpp.Provider.
+// The exported program does not create the window system surfaces, which are
+// left for the user to add.
+func (API) CppTarget() *cpp.Target {
+	mapped := map[VkDeviceMemory]uint64{}
+	return &cpp.Target{
+		Headers:      []string{"vulkan/vulkan.h"},
+		Libraries:    []string{"vulkan"},
+		Declarations: cppDeclarations,
+		Runtime:      cppRuntime,
+		Remap:        API{}.RemapHandle,
+		Arg: func(name string, v interface{}) string {
+			if name == "pAllocator" {
+				return "nullptr" // The allocation callbacks are not replayed.
+			}
+			return ""
+		},
+		Statement: func(ctx context.Context, c *cpp.Command) (string, error) {
+			switch cmd := c.Cmd.(type) {
+			case *VkCreateInstance:
+				return fmt.Sprintf("%s\nvk_instance = r.out<VkInstance>(0x%x);", c.Call, cmd.PInstance.Address()), nil
+			case *VkCreateDevice:
+				return fmt.Sprintf("%s\nvk_device = r.out<VkDevice>(0x%x);", c.Call, cmd.PDevice.Address()), nil
+			case *VkMapMemory:
+				// Redirect the captured mapped memory to the replay mapping.
+				m := GetState(c.State()).DeviceMemories[cmd.Memory]
+				if m == nil {
+					return "", nil
+				}
+				mapped[cmd.Memory] = m.MappedLocation.Address()
+				return fmt.Sprintf("%s\nr.map(0x%x, 0x%x, r.out<void*>(0x%x));",
+					c.Call, m.MappedLocation.Address(), uint64(m.MappedSize), cmd.PpData.Address()), nil
+			case *VkUnmapMemory:
+				addr, ok := mapped[cmd.Memory]
+				if !ok {
+					return "", nil
+				}
+				delete(mapped, cmd.Memory)
+				return fmt.Sprintf("r.unmap(0x%x);\n%s", addr, c.Call), nil
+			}
+			name := c.Cmd.CmdName()
+			switch {
+			case strings.HasPrefix(name, "vkCreate") && strings.HasSuffix(name, "SurfaceKHR"):
+				return fmt.Sprintf("// %s: create the surface here.\n// %s", name, c.Call), nil
+			case !strings.HasPrefix(name, "vk"):
+				return fmt.Sprintf("// %s is not replayed.", name), nil
+			}
+			return "", nil
+		},
+	}
+}
+
+const cppDeclarations = `
+// The last created instance and device, used to look up the functions.
+extern VkInstance vk_instance;
+extern VkDevice vk_device;
+`
+
+const cppRuntime = `
+#include "replay.h"
+
+VkInstance vk_instance = VK_NULL_HANDLE;
+VkDevice vk_device = VK_NULL_HANDLE;
+
+void* lookup(const char* name) {
+  void* p = nullptr;
+  if (vk_device != VK_NULL_HANDLE) {
+    p = reinterpret_cast<void*>(vkGetDeviceProcAddr(vk_device, name));
+  }
+  if (p == nullptr) {
+    p = reinterpret_cast<void*>(vkGetInstanceProcAddr(vk_instance, name));
+  }
+  return p;
+}
+
+void initialize(Replay&) {}
+`
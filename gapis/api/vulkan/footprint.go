@@ -0,0 +1,123 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+)
+
+var _ api.FootprintProvider = API{}
+
+// AffectsFootprint implements api.FootprintProvider.
+func (API) AffectsFootprint(cmd api.Cmd) bool {
+	name := cmd.CmdName()
+	return strings.HasPrefix(name, "vkCreate") ||
+		strings.HasPrefix(name, "vkDestroy") ||
+		name == "vkAllocateMemory" ||
+		name == "vkFreeMemory"
+}
+
+// Footprint implements api.FootprintProvider.
+// Images and buffers are aliased, as their memory is held by the device
+// memory they are bound to.
+func (API) Footprint(ctx context.Context, s *api.State) []api.FootprintObject {
+	c := GetState(s)
+	if c == nil {
+		return nil
+	}
+	out := []api.FootprintObject{}
+	for _, m := range c.DeviceMemories {
+		if m == nil {
+			continue
+		}
+		out = append(out, api.FootprintObject{
+			Key:    m,
+			Kind:   api.MemoryKind_DeviceMemory,
+			Handle: fmt.Sprintf("DeviceMemory<%d>", m.VulkanHandle),
+			Size:   uint64(m.AllocationSize),
+		})
+	}
+	for _, b := range c.Buffers {
+		if b == nil {
+			continue
+		}
+		out = append(out, api.FootprintObject{
+			Key:     b,
+			Kind:    api.MemoryKind_BufferMemory,
+			Handle:  fmt.Sprintf("Buffer<%d>", b.VulkanHandle),
+			Size:    uint64(b.Info.Size),
+			Aliased: true,
+		})
+	}
+	for _, i := range c.Images {
+		if i == nil {
+			continue
+		}
+		out = append(out, api.FootprintObject{
+			Key:      i,
+			Kind:     api.MemoryKind_TextureMemory,
+			Handle:   i.ResourceHandle(),
+			Label:    i.ResourceLabel(),
+			Size:     i.size(),
+			Aliased:  true,
+			Resource: i,
+		})
+	}
+	return out
+}
+
+// size returns the number of bytes of all the mip levels and array layers of
+// the image, computed from its format. The size of the image data is used if
+// the format is not supported.
+func (t *ImageObject) size() uint64 {
+	info := t.Info
+	f, err := getImageFormatFromVulkanFormat(info.Format)
+	if err != nil {
+		size := uint64(0)
+		for _, layer := range t.Layers {
+			if layer == nil {
+				continue
+			}
+			for _, level := range layer.Levels {
+				if level != nil {
+					size += level.Data.Count()
+				}
+			}
+		}
+		return size
+	}
+	size := uint64(0)
+	for l := uint32(0); l < info.MipLevels; l++ {
+		w, h, d := levelSize(info.Extent.Width, l), levelSize(info.Extent.Height, l), levelSize(info.Extent.Depth, l)
+		size += uint64(f.Size(int(w), int(h), int(d)))
+	}
+	samples := uint64(info.Samples)
+	if samples == 0 {
+		samples = 1
+	}
+	return size * uint64(info.ArrayLayers) * samples
+}
+
+// levelSize returns the size of the mip level of a dimension of size base.
+func levelSize(base, level uint32) uint32 {
+	if size := base >> level; size > 0 {
+		return size
+	}
+	return 1
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestImageSize(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		name     string
+		info     ImageInfo
+		expected uint64
+	}{
+		{"Single level", ImageInfo{
+			Format: VkFormat_VK_FORMAT_R8G8B8A8_UNORM, Extent: VkExtent3D{Width: 4, Height: 4, Depth: 1},
+			MipLevels: 1, ArrayLayers: 1, Samples: VkSampleCountFlagBits_VK_SAMPLE_COUNT_1_BIT,
+		}, 64},
+		{"Mip levels and layers", ImageInfo{
+			Format: VkFormat_VK_FORMAT_R8G8B8A8_UNORM, Extent: VkExtent3D{Width: 4, Height: 2, Depth: 1},
+			MipLevels: 3, ArrayLayers: 2, Samples: VkSampleCountFlagBits_VK_SAMPLE_COUNT_1_BIT,
+		}, (32 + 8 + 4) * 2},
+		{"Multisampled", ImageInfo{
+			Format: VkFormat_VK_FORMAT_R8_UNORM, Extent: VkExtent3D{Width: 4, Height: 4, Depth: 1},
+			MipLevels: 1, ArrayLayers: 1, Samples: VkSampleCountFlagBits_VK_SAMPLE_COUNT_4_BIT,
+		}, 64},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		img := &ImageObject{Info: test.info}
+		assert.For(ctx, "size").That(img.size()).Equals(test.expected)
+	}
+}
+
+func TestFootprint(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	h := &capture.Header{Abi: device.AndroidARMv7a}
+	s := api.NewStateWithEmptyAllocator(h.Abi.MemoryLayout)
+
+	dev, mem, buffer := VkDevice(1), VkDeviceMemory(0x10), VkBuffer(0x20)
+	allocInfo := s.AllocDataOrPanic(ctx, VkMemoryAllocateInfo{
+		SType:          VkStructureType_VK_STRUCTURE_TYPE_MEMORY_ALLOCATE_INFO,
+		AllocationSize: 1024,
+	})
+	bufferInfo := s.AllocDataOrPanic(ctx, VkBufferCreateInfo{
+		SType: VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO,
+		Size:  256,
+		Usage: VkBufferUsageFlags(VkBufferUsageFlagBits_VK_BUFFER_USAGE_VERTEX_BUFFER_BIT),
+	})
+	memData, bufferData := s.AllocDataOrPanic(ctx, mem), s.AllocDataOrPanic(ctx, buffer)
+
+	cb := CommandBuilder{Thread: 0}
+	cmds := []api.Cmd{
+		cb.VkAllocateMemory(dev, allocInfo.Ptr(), memory.Nullptr, memData.Ptr(), VkResult_VK_SUCCESS).
+			AddRead(allocInfo.Data()).AddWrite(memData.Data()),
+		cb.VkCreateBuffer(dev, bufferInfo.Ptr(), memory.Nullptr, bufferData.Ptr(), VkResult_VK_SUCCESS).
+			AddRead(bufferInfo.Data()).AddWrite(bufferData.Data()),
+		cb.VkDestroyBuffer(dev, buffer, memory.Nullptr),
+		cb.VkFreeMemory(dev, mem, memory.Nullptr),
+	}
+	c, err := capture.New(ctx, "test", h, cmds)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	footprint, err := resolve.Footprint(ctx, c.Footprint(2))
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	// The buffer is aliased by the device memory, and so is not counted in
+	// the live and peak bytes.
+	assert.For(ctx, "PeakBytes").That(footprint.PeakBytes).Equals(uint64(1024))
+	assert.For(ctx, "PeakCommand").That(footprint.PeakCommand).Equals(uint64(0))
+	assert.For(ctx, "Ranges").ThatSlice(footprint.Ranges).DeepEquals([]*service.FootprintRange{
+		{
+			FirstCommand: 0, LastCommand: 1, LiveBytes: 1024, PeakBytes: 1024, Created: 2,
+			Live: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_BufferMemory, Bytes: 256, Count: 1},
+				{Kind: api.MemoryKind_DeviceMemory, Bytes: 1024, Count: 1},
+			},
+			Peak: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_BufferMemory, Bytes: 256, Count: 1},
+				{Kind: api.MemoryKind_DeviceMemory, Bytes: 1024, Count: 1},
+			},
+		},
+		{
+			FirstCommand: 2, LastCommand: 3, LiveBytes: 0, PeakBytes: 1024, Deleted: 2,
+			Live: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_BufferMemory},
+				{Kind: api.MemoryKind_DeviceMemory},
+			},
+			Peak: []*service.FootprintTotal{
+				{Kind: api.MemoryKind_BufferMemory, Bytes: 256, Count: 1},
+				{Kind: api.MemoryKind_DeviceMemory, Bytes: 1024, Count: 1},
+			},
+		},
+	})
+
+	if !assert.For(ctx, "Objects").ThatSlice(footprint.Objects).IsLength(2) {
+		return
+	}
+	m, b := footprint.Objects[0], footprint.Objects[1]
+	assert.For(ctx, "Memory").That(m.Handle).Equals("DeviceMemory<16>")
+	assert.For(ctx, "Memory size").That(m.Size).Equals(uint64(1024))
+	assert.For(ctx, "Memory aliased").That(m.Aliased).Equals(false)
+	assert.For(ctx, "Memory created").That(m.Created).DeepEquals(c.Command(0))
+	assert.For(ctx, "Memory deleted").That(m.Deleted).DeepEquals(c.Command(3))
+	assert.For(ctx, "Buffer").That(b.Handle).Equals("Buffer<32>")
+	assert.For(ctx, "Buffer size").That(b.Size).Equals(uint64(256))
+	assert.For(ctx, "Buffer aliased").That(b.Aliased).Equals(true)
+	assert.For(ctx, "Buffer created").That(b.Created).DeepEquals(c.Command(1))
+	assert.For(ctx, "Buffer deleted").That(b.Deleted).DeepEquals(c.Command(2))
+}
@@ -0,0 +1,491 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+// Indices of the redraws performed for each draw, and of the variants created
+// for each graphics pipeline.
+const (
+	testDepth      = iota // The stencil and depth tests as set by the pipeline.
+	testStencil           // Just the stencil test.
+	testRasterized        // No tests at all.
+	testCount
+)
+
+// fragmentTests is a transform that redraws each of the draws submitted by the
+// requested vkQueueSubmit commands with a scissor rectangle isolating a single
+// pixel, and with all framebuffer writes masked. Occlusion queries around each
+// redraw report whether the draws generated a fragment for the pixel, and
+// whether it passed the stencil and depth tests. The original draw is then
+// issued unmodified.
+//
+// The redraws use variants of each graphics pipeline that have the writes
+// masked and the tests disabled, which are created along with the original
+// pipeline.
+//
+// Submissions that execute secondary command buffers are not tested, and so
+// have no results.
+type fragmentTests struct {
+	x, y     uint32
+	draws    map[api.CmdID]struct{}
+	res      replay.Result
+	results  []replay.FragmentTests
+	variants map[VkPipeline]*pipelineVariants
+	posted   int  // Number of submissions that post query results.
+	done     int  // Number of query results received.
+	failed   bool // True if res has been called with an error.
+}
+
+// pipelineVariants holds the variants of a graphics pipeline used for the
+// redraws, indexed by the test* constants.
+type pipelineVariants struct {
+	tests     [testCount]VkPipeline
+	viewports uint32
+}
+
+func newFragmentTests(ctx context.Context, req fragmentTestsRequest, res replay.Result) *fragmentTests {
+	draws := make(map[api.CmdID]struct{}, len(req.draws))
+	for _, id := range req.draws {
+		draws[id] = struct{}{}
+	}
+	return &fragmentTests{
+		x:        req.x,
+		y:        req.y,
+		draws:    draws,
+		res:      res,
+		variants: map[VkPipeline]*pipelineVariants{},
+	}
+}
+
+func (t *fragmentTests) Transform(ctx context.Context, id api.CmdID, cmd api.Cmd, out transform.Writer) {
+	switch cmd := cmd.(type) {
+	case *VkCreateGraphicsPipelines:
+		out.MutateAndWrite(ctx, id, cmd)
+		t.createVariants(ctx, cmd, cmd.Device, cmd.PCreateInfos, cmd.CreateInfoCount, cmd.PPipelines, out)
+		return
+	case *RecreateGraphicsPipeline:
+		out.MutateAndWrite(ctx, id, cmd)
+		t.createVariants(ctx, cmd, cmd.Device, cmd.PCreateInfo, 1, cmd.PPipeline, out)
+		return
+	case *VkQueueSubmit:
+		if _, ok := t.draws[id]; ok {
+			t.test(ctx, id, cmd, out)
+			return
+		}
+	}
+	out.MutateAndWrite(ctx, id, cmd)
+}
+
+func (t *fragmentTests) Flush(ctx context.Context, out transform.Writer) {
+	if t.posted == 0 {
+		// No query results will be posted, so return what we have now.
+		t.res(t.results, nil)
+	}
+}
+
+// createVariants creates the pipeline variants for each of the count graphics
+// pipelines created by cmd.
+func (t *fragmentTests) createVariants(ctx context.Context, cmd api.Cmd, device VkDevice,
+	infos VkGraphicsPipelineCreateInfoᶜᵖ, count uint32, pipelines VkPipelineᵖ, out transform.Writer) {
+
+	s := out.State()
+	l := s.MemoryLayout
+	cb := CommandBuilder{Thread: cmd.Thread()}
+
+	handles := pipelines.Slice(0, uint64(count), l).Read(ctx, cmd, s, nil)
+	for i, info := range infos.Slice(0, uint64(count), l).Read(ctx, cmd, s, nil) {
+		if info.PViewportState == (VkPipelineViewportStateCreateInfoᶜᵖ{}) {
+			continue // Rasterization is disabled.
+		}
+
+		var allocated []api.AllocResult
+		alloc := func(v ...interface{}) api.AllocResult {
+			res := s.AllocDataOrPanic(ctx, v...)
+			allocated = append(allocated, res)
+			return res
+		}
+
+		// The scissor and stencil write mask are made dynamic, so that they can
+		// be set for the redraws.
+		viewport := info.PViewportState.Slice(0, 1, l).Index(0, l).Read(ctx, cmd, s, nil)
+		viewport.ScissorCount = viewport.ViewportCount
+		viewport.PScissors = NewVkRect2Dᶜᵖ(memory.Nullptr)
+		info.PViewportState = NewVkPipelineViewportStateCreateInfoᶜᵖ(alloc(viewport).Ptr())
+
+		dynamicStates := []VkDynamicState{}
+		dynamic := VkPipelineDynamicStateCreateInfo{
+			SType: VkStructureType_VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO,
+			PNext: NewVoidᶜᵖ(memory.Nullptr),
+		}
+		if info.PDynamicState != (VkPipelineDynamicStateCreateInfoᶜᵖ{}) {
+			dynamic = info.PDynamicState.Slice(0, 1, l).Index(0, l).Read(ctx, cmd, s, nil)
+			dynamicStates = dynamic.PDynamicStates.Slice(0, uint64(dynamic.DynamicStateCount), l).Read(ctx, cmd, s, nil)
+		}
+		for _, d := range []VkDynamicState{
+			VkDynamicState_VK_DYNAMIC_STATE_SCISSOR,
+			VkDynamicState_VK_DYNAMIC_STATE_STENCIL_WRITE_MASK,
+		} {
+			if !hasDynamicState(dynamicStates, d) {
+				dynamicStates = append(dynamicStates, d)
+			}
+		}
+		dynamic.DynamicStateCount = uint32(len(dynamicStates))
+		dynamic.PDynamicStates = NewVkDynamicStateᶜᵖ(alloc(dynamicStates).Ptr())
+		info.PDynamicState = NewVkPipelineDynamicStateCreateInfoᶜᵖ(alloc(dynamic).Ptr())
+
+		if info.PColorBlendState != (VkPipelineColorBlendStateCreateInfoᶜᵖ{}) {
+			blend := info.PColorBlendState.Slice(0, 1, l).Index(0, l).Read(ctx, cmd, s, nil)
+			attachments := blend.PAttachments.Slice(0, uint64(blend.AttachmentCount), l).Read(ctx, cmd, s, nil)
+			for i := range attachments {
+				attachments[i].ColorWriteMask = 0
+			}
+			if len(attachments) > 0 {
+				blend.PAttachments = NewVkPipelineColorBlendAttachmentStateᶜᵖ(alloc(attachments).Ptr())
+			}
+			info.PColorBlendState = NewVkPipelineColorBlendStateCreateInfoᶜᵖ(alloc(blend).Ptr())
+		}
+
+		// Derivative pipelines may refer to other pipelines of the same call.
+		info.Flags &^= VkPipelineCreateFlags(VkPipelineCreateFlagBits_VK_PIPELINE_CREATE_DERIVATIVE_BIT)
+		info.BasePipelineHandle = 0
+		info.BasePipelineIndex = -1
+
+		var depthStencil *VkPipelineDepthStencilStateCreateInfo
+		if info.PDepthStencilState != (VkPipelineDepthStencilStateCreateInfoᶜᵖ{}) {
+			ds := info.PDepthStencilState.Slice(0, 1, l).Index(0, l).Read(ctx, cmd, s, nil)
+			ds.DepthWriteEnable = 0
+			depthStencil = &ds
+		}
+
+		variants := &pipelineVariants{viewports: viewport.ViewportCount}
+		for test := range variants.tests {
+			if depthStencil != nil {
+				ds := *depthStencil
+				if test >= testStencil {
+					ds.DepthTestEnable = 0
+					ds.DepthBoundsTestEnable = 0
+				}
+				if test >= testRasterized {
+					ds.StencilTestEnable = 0
+				}
+				info.PDepthStencilState = NewVkPipelineDepthStencilStateCreateInfoᶜᵖ(alloc(ds).Ptr())
+			}
+
+			handle := VkPipeline(newUnusedID(false, func(x uint64) bool {
+				_, ok := GetState(s).GraphicsPipelines[VkPipeline(x)]
+				return ok
+			}))
+			infoData, handleData := alloc(info), alloc(handle)
+			create := cb.VkCreateGraphicsPipelines(device, 0, 1, infoData.Ptr(),
+				memory.Nullptr, handleData.Ptr(), VkResult_VK_SUCCESS)
+			// The original observations hold the remaining create state, such as
+			// the shader stages.
+			create.Extras().Add(cmd.Extras().All()...)
+			for _, a := range allocated {
+				create.AddRead(a.Data())
+			}
+			create.AddWrite(handleData.Data())
+			out.MutateAndWrite(ctx, api.CmdNoID, create)
+
+			variants.tests[test] = handle
+		}
+		t.variants[handles[i]] = variants
+
+		for _, a := range allocated {
+			a.Free()
+		}
+	}
+}
+
+// test emits the vkQueueSubmit cmd, with each of the submitted primary
+// command buffers rebuilt to redraw its draws, and the query readback.
+func (t *fragmentTests) test(ctx context.Context, id api.CmdID, cmd *VkQueueSubmit, out transform.Writer) {
+	s := out.State()
+	l := s.MemoryLayout
+	st := GetState(s)
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	cmd.Extras().Observations().ApplyReads(s.Memory[memory.ApplicationPool])
+
+	queue := st.Queues[cmd.Queue]
+	if queue == nil {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+	device := queue.Device
+
+	submits := cmd.PSubmits.Slice(0, uint64(cmd.SubmitCount), l).Read(ctx, cmd, s, nil)
+	buffers := make([][]VkCommandBuffer, len(submits))
+	draws := 0
+	for i, submit := range submits {
+		buffers[i] = submit.PCommandBuffers.Slice(0, uint64(submit.CommandBufferCount), l).Read(ctx, cmd, s, nil)
+		for _, b := range buffers[i] {
+			o := st.CommandBuffers[b]
+			if o == nil {
+				out.MutateAndWrite(ctx, id, cmd)
+				return
+			}
+			for _, c := range o.Commands {
+				switch c.recreateData.(type) {
+				case *RecreateCmdExecuteCommandsData:
+					// Draws in secondary command buffers are not redrawn.
+					out.MutateAndWrite(ctx, id, cmd)
+					return
+				case *RecreateCmdDrawData, *RecreateCmdDrawIndexedData,
+					*RecreateCmdDrawIndirectData, *RecreateCmdDrawIndexedIndirectData:
+					draws++
+				}
+			}
+		}
+	}
+
+	idx := len(t.results)
+	t.results = append(t.results, replay.FragmentTests{Command: id})
+	if draws == 0 {
+		out.MutateAndWrite(ctx, id, cmd)
+		return
+	}
+
+	var allocated []api.AllocResult
+	alloc := func(v ...interface{}) api.AllocResult {
+		res := s.AllocDataOrPanic(ctx, v...)
+		allocated = append(allocated, res)
+		return res
+	}
+	var cleanup []func()
+
+	queries := uint32(draws * testCount)
+	pool := VkQueryPool(newUnusedID(false, func(x uint64) bool {
+		_, ok := st.QueryPools[VkQueryPool(x)]
+		return ok
+	}))
+	poolInfo := alloc(VkQueryPoolCreateInfo{
+		SType:      VkStructureType_VK_STRUCTURE_TYPE_QUERY_POOL_CREATE_INFO,
+		PNext:      NewVoidᶜᵖ(memory.Nullptr),
+		QueryType:  VkQueryType_VK_QUERY_TYPE_OCCLUSION,
+		QueryCount: queries,
+	})
+	poolData := alloc(pool)
+	out.MutateAndWrite(ctx, api.CmdNoID, cb.VkCreateQueryPool(device,
+		poolInfo.Ptr(), memory.Nullptr, poolData.Ptr(), VkResult_VK_SUCCESS,
+	).AddRead(poolInfo.Data()).AddWrite(poolData.Data()))
+
+	query := uint32(0)
+	for i := range submits {
+		for j, b := range buffers[i] {
+			o := st.CommandBuffers[b]
+			rebuilt, cmds, c := rebuildCommandBuffer(ctx, cb, o, s, nil, t.redraws(st, o, pool, &query))
+			for _, c := range cmds {
+				out.MutateAndWrite(ctx, api.CmdNoID, c)
+			}
+			cleanup = append(cleanup, c...)
+			buffers[i][j] = rebuilt
+		}
+		submits[i].PCommandBuffers = NewVkCommandBufferᶜᵖ(alloc(buffers[i]).Ptr())
+	}
+
+	submit := cb.VkQueueSubmit(cmd.Queue, cmd.SubmitCount, alloc(submits).Ptr(), cmd.Fence, cmd.Result)
+	submit.Extras().Add(cmd.Extras().All()...)
+	for _, a := range allocated {
+		submit.AddRead(a.Data())
+	}
+	out.MutateAndWrite(ctx, id, submit)
+
+	size := uint64(queries * 4)
+	tmp := s.AllocOrPanic(ctx, size)
+	writeEach(ctx, out,
+		cb.VkQueueWaitIdle(cmd.Queue, VkResult_VK_SUCCESS),
+		cb.Custom(func(ctx context.Context, s *api.State, b *builder.Builder) error {
+			b.ReserveMemory(tmp.Range())
+			if err := cb.VkGetQueryPoolResults(device, pool, 0, queries, memory.Size(size), tmp.Ptr(), 4,
+				VkQueryResultFlags(VkQueryResultFlagBits_VK_QUERY_RESULT_WAIT_BIT),
+				VkResult_VK_SUCCESS).Mutate(ctx, s, b); err != nil {
+				return err
+			}
+			b.Post(value.ObservedPointer(tmp.Address()), size, func(r binary.Reader, err error) error {
+				if err == nil {
+					res := &t.results[idx]
+					for i := 0; i < draws; i++ {
+						res.DepthPassed = r.Uint32() != 0 || res.DepthPassed
+						res.StencilPassed = r.Uint32() != 0 || res.StencilPassed
+						res.Rasterized = r.Uint32() != 0 || res.Rasterized
+					}
+					err = r.Error()
+				}
+				if err != nil {
+					err = fmt.Errorf("Could not read fragment test results for command %v: %v", id, err)
+					if !t.failed {
+						t.failed = true
+						t.res(nil, err)
+					}
+					return err
+				}
+				t.done++
+				if t.done == t.posted && !t.failed {
+					t.res(t.results, nil)
+				}
+				return nil
+			})
+			return nil
+		}),
+		cb.VkDestroyQueryPool(device, pool, memory.Nullptr),
+	)
+	tmp.Free()
+	t.posted++
+
+	for _, f := range cleanup {
+		f()
+	}
+	for _, a := range allocated {
+		a.Free()
+	}
+}
+
+// redraws returns the recreate data of the commands of the command buffer o,
+// with each draw preceded by the redraws wrapped in occlusion queries. query
+// is the index of the next unused query of pool, and is advanced by the
+// number of queries used.
+func (t *fragmentTests) redraws(st *State, o *CommandBufferObject, pool VkQueryPool, query *uint32) []interface{} {
+	first := *query
+	out := []interface{}{nil} // Replaced by the query pool reset below.
+
+	var pipeline VkPipeline
+	var scissor *RecreateCmdSetScissorData
+	var stencilWriteMask []interface{}
+	var framebuffer *FramebufferObject
+	for _, c := range o.Commands {
+		switch d := c.recreateData.(type) {
+		case *RecreateCmdBindPipelineData:
+			if d.PipelineBindPoint == VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS {
+				pipeline = d.Pipeline
+			}
+		case *RecreateCmdSetScissorData:
+			scissor = d
+		case *RecreateCmdSetStencilWriteMaskData:
+			if d.FaceMask == VkStencilFaceFlags(VkStencilFaceFlagBits_VK_STENCIL_FRONT_AND_BACK) {
+				stencilWriteMask = nil // Overrides the masks set before.
+			}
+			stencilWriteMask = append(stencilWriteMask, d)
+		case *RecreateCmdBeginRenderPassData:
+			framebuffer = st.Framebuffers[d.Framebuffer]
+		case *RecreateCmdDrawData, *RecreateCmdDrawIndexedData,
+			*RecreateCmdDrawIndirectData, *RecreateCmdDrawIndexedIndirectData:
+
+			variants := t.variants[pipeline]
+			rect, ok := t.pixelRect(st, pipeline, scissor, framebuffer)
+			if variants != nil && ok {
+				scissors := U32ːVkRect2Dᵐ{}
+				for i := uint32(0); i < variants.viewports; i++ {
+					scissors[i] = rect
+				}
+				out = append(out,
+					&RecreateCmdSetScissorData{FirstScissor: 0, Scissors: scissors},
+					&RecreateCmdSetStencilWriteMaskData{
+						FaceMask:  VkStencilFaceFlags(VkStencilFaceFlagBits_VK_STENCIL_FRONT_AND_BACK),
+						WriteMask: 0,
+					})
+			}
+			for test := 0; test < testCount; test++ {
+				if variants != nil && ok {
+					out = append(out, &RecreateCmdBindPipelineData{
+						PipelineBindPoint: VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS,
+						Pipeline:          variants.tests[test],
+					})
+				}
+				out = append(out, &RecreateCmdBeginQueryData{QueryPool: pool, Query: *query})
+				if variants != nil && ok {
+					out = append(out, d)
+				}
+				out = append(out, &RecreateCmdEndQueryData{QueryPool: pool, Query: *query})
+				*query++
+			}
+			if variants != nil && ok {
+				// Restore the state changed by the redraws.
+				out = append(out, &RecreateCmdBindPipelineData{
+					PipelineBindPoint: VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS,
+					Pipeline:          pipeline,
+				})
+				if scissor != nil {
+					out = append(out, scissor)
+				}
+				out = append(out, stencilWriteMask...)
+			}
+		}
+		out = append(out, c.recreateData)
+	}
+
+	// The first command of a primary command buffer is outside any render pass,
+	// so the queries are reset there.
+	out[0] = &RecreateCmdResetQueryPoolData{QueryPool: pool, FirstQuery: first, QueryCount: *query - first}
+	return out
+}
+
+// pixelRect returns the scissor rectangle isolating the pixel for a draw
+// using pipeline, or false if the scissor rectangle used by the draw excludes
+// the pixel. scissor is the last dynamic scissor set, and framebuffer is the
+// framebuffer of the current render pass.
+func (t *fragmentTests) pixelRect(st *State, pipeline VkPipeline, scissor *RecreateCmdSetScissorData, framebuffer *FramebufferObject) (VkRect2D, bool) {
+	if framebuffer == nil || t.x >= framebuffer.Width || t.y >= framebuffer.Height {
+		return VkRect2D{}, false
+	}
+	// Framebuffer reads are flipped vertically, so that the first row is the
+	// bottom one.
+	x, y := int32(t.x), int32(framebuffer.Height-1-t.y)
+
+	var box *VkRect2D
+	if p := st.GraphicsPipelines[pipeline]; p != nil {
+		dynamic := false
+		if p.DynamicState != nil {
+			for _, d := range p.DynamicState.DynamicStates {
+				dynamic = dynamic || d == VkDynamicState_VK_DYNAMIC_STATE_SCISSOR
+			}
+		}
+		if dynamic && scissor != nil && scissor.FirstScissor == 0 {
+			if r, ok := scissor.Scissors[0]; ok {
+				box = &r
+			}
+		} else if !dynamic && p.ViewportState != nil {
+			if r, ok := p.ViewportState.Scissors[0]; ok {
+				box = &r
+			}
+		}
+	}
+	if box != nil {
+		if x < box.Offset.X || y < box.Offset.Y ||
+			x >= box.Offset.X+int32(box.Extent.Width) || y >= box.Offset.Y+int32(box.Extent.Height) {
+			return VkRect2D{}, false
+		}
+	}
+	return VkRect2D{Offset: VkOffset2D{X: x, Y: y}, Extent: VkExtent2D{Width: 1, Height: 1}}, true
+}
+
+func hasDynamicState(states []VkDynamicState, state VkDynamicState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import "github.com/google/gapid/gapis/api"
+
+// remapper is the interface implemented by the types remapped on replay.
+type remapper interface {
+	remap(cmd api.Cmd, s *api.State) (key interface{}, remap bool)
+}
+
+var _ api.HandleRemapper = API{}
+
+// RemapHandle implements api.HandleRemapper.
+func (API) RemapHandle(v interface{}, cmd api.Cmd, s *api.State) (key interface{}, remap bool) {
+	if r, ok := v.(remapper); ok {
+		return r.remap(cmd, s)
+	}
+	return nil, false
+}
@@ -39,6 +39,7 @@ var (
 	// Interface compliance tests
 	_ = replay.QueryIssues(API{})
 	_ = replay.QueryFramebufferAttachment(API{})
+	_ = replay.QueryFragmentTests(API{})
 	_ = replay.Support(API{})
 )
 
@@ -83,6 +84,16 @@ type framebufferRequest struct {
 	wireframeOverlay bool
 }
 
+// fragmentTestsConfig is a replay.Config used by fragmentTestsRequests.
+type fragmentTestsConfig struct{}
+
+// fragmentTestsRequest requests the fragment test results of the given
+// vkQueueSubmit commands for the pixel at (x, y).
+type fragmentTestsRequest struct {
+	draws []api.CmdID
+	x, y  uint32
+}
+
 type deadCodeEliminationInfo struct {
 	dependencyGraph     *dependencygraph.DependencyGraph
 	deadCodeElimination *transform.DeadCodeElimination
@@ -481,6 +492,8 @@ func (a API) Replay(
 	injector := &transform.Injector{}
 	// Gathers and reports any issues found.
 	var issues *findIssues
+	// Redraws the requested submissions for the fragment tests.
+	var fragments *fragmentTests
 
 	earlyTerminator, err := NewVulkanTerminator(ctx, intent.Capture)
 	if err != nil {
@@ -534,6 +547,17 @@ func (a API) Replay(
 			default:
 				readFramebuffer.Color(after, req.width, req.height, req.framebufferIndex, rr.Result)
 			}
+
+		case fragmentTestsRequest:
+			for _, id := range req.draws {
+				if err := earlyTerminator.Add(ctx, id, []uint64{}); err != nil {
+					return err
+				}
+				if !config.DisableDeadCodeElimination {
+					dceInfo.deadCodeElimination.Request(id)
+				}
+			}
+			fragments = newFragmentTests(ctx, req, rr.Result)
 		}
 	}
 
@@ -549,6 +573,10 @@ func (a API) Replay(
 		transforms.Add(earlyTerminator)
 	}
 
+	if fragments != nil {
+		transforms.Add(fragments)
+	}
+
 	// Cleanup
 	transforms.Add(readFramebuffer, injector)
 	transforms.Add(&destroyResourcesAtEOS{})
@@ -638,6 +666,22 @@ func (a API) QueryFramebufferAttachment(
 	return res.(*image.Data), nil
 }
 
+func (a API) QueryFragmentTests(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr *replay.Manager,
+	draws []api.CmdID,
+	x, y uint32,
+	hints *service.UsageHints) ([]replay.FragmentTests, error) {
+
+	c, r := fragmentTestsConfig{}, fragmentTestsRequest{draws: draws, x: x, y: y}
+	res, err := mgr.Replay(ctx, intent, c, r, a, hints)
+	if err != nil {
+		return nil, err
+	}
+	return res.([]replay.FragmentTests), nil
+}
+
 func (a API) QueryIssues(
 	ctx context.Context,
 	intent replay.Intent,
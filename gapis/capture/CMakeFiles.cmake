@@ -21,8 +21,11 @@ set(files
     capture.go
     capture.pb.go
     capture.proto
+    capture_test.go
     context.go
     doc.go
+    json.go
+    splice.go
 )
 set(dirs
 
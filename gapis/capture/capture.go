@@ -62,7 +62,12 @@ func New(ctx context.Context, name string, header *Header, cmds []api.Cmd) (*pat
 	if err != nil {
 		return nil, err
 	}
+	return c.store(ctx)
+}
 
+// store stores the capture in the database and adds it to the list of
+// imported captures.
+func (c *Capture) store(ctx context.Context) (*path.Capture, error) {
 	id, err := database.Store(ctx, c)
 	if err != nil {
 		return nil, err
@@ -142,7 +147,12 @@ func ResolveFromPath(ctx context.Context, p *path.Capture) (*Capture, error) {
 }
 
 // Import imports the capture by name and data, and stores it in the database.
+// data can either be a .gfxtrace file or a capture exported by ExportJSON.
 func Import(ctx context.Context, name string, data []byte) (*path.Capture, error) {
+	if isJSON(data) {
+		return ImportJSON(ctx, name, data)
+	}
+
 	id, err := database.Store(ctx, &Record{
 		Name: name,
 		Data: data,
@@ -178,13 +188,22 @@ func (c *Capture) Export(ctx context.Context, w io.Writer) error {
 		return err
 	}
 
-	writeMsg := func(ctx context.Context, a atom_pb.Atom) error { return write.Marshal(a) }
+	return c.encode(ctx, func(a atom_pb.Atom) error { return write.Marshal(a) })
+}
 
-	if err := writeMsg(ctx, c.Header); err != nil {
+// encode passes the header, commands and resources of the capture to write,
+// as the messages stored in a .gfxtrace file.
+func (c *Capture) encode(ctx context.Context, write func(atom_pb.Atom) error) error {
+	if err := write(c.Header); err != nil {
 		return err
 	}
 
-	writeAtom := api.CmdToProto(func(a atom_pb.Atom) { writeMsg(ctx, a) })
+	var writeErr error
+	writeAtom := api.CmdToProto(func(a atom_pb.Atom) {
+		if writeErr == nil {
+			writeErr = write(a)
+		}
+	})
 
 	// IDs seen, so we can avoid encoding the same resource data multiple times.
 	seen := map[id.ID]bool{}
@@ -218,9 +237,12 @@ func (c *Capture) Export(ctx context.Context, w io.Writer) error {
 		if err := writeAtom(ctx, a); err != nil {
 			return err
 		}
+		if writeErr != nil {
+			return writeErr
+		}
 	}
 
-	return nil
+	return writeErr
 }
 
 func toProto(ctx context.Context, c *Capture) (*Record, error) {
@@ -240,36 +262,53 @@ func fromProto(ctx context.Context, r *Record) (*Capture, error) {
 		return nil, err
 	}
 
+	header, cmds, err := decode(ctx, func() (atom_pb.Atom, error) {
+		msg, err := reader.Unmarshal()
+		if errors.Cause(err) == io.EOF {
+			return nil, io.EOF
+		}
+		return msg, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return build(ctx, r.Name, header, cmds)
+}
+
+// decode reads the header and commands of a capture from the messages returned
+// by read, until read returns io.EOF.
+func decode(ctx context.Context, read func() (atom_pb.Atom, error)) (*Header, []api.Cmd, error) {
 	cmds := []api.Cmd{}
 	convert := api.ProtoToCmd(func(a api.Cmd) { cmds = append(cmds, a) })
 	var header *Header
 	for {
-		msg, err := reader.Unmarshal()
-		if errors.Cause(err) == io.EOF {
+		msg, err := read()
+		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, log.Err(ctx, err, "Failed to unmarshal")
+			return nil, nil, log.Err(ctx, err, "Failed to unmarshal")
 		}
 		if h, ok := msg.(*Header); ok {
 			header = h
 			continue
 		}
 		if err := convert(ctx, msg); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	if header == nil {
-		return nil, log.Err(ctx, nil, "Capture was missing header chunk")
+		return nil, nil, log.Err(ctx, nil, "Capture was missing header chunk")
 	}
 
 	// must invoke the converter with nil to flush the last atom
 	if err := convert(ctx, nil); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return build(ctx, r.Name, header, cmds)
+	return header, cmds, nil
 }
 
 // build creates a capture from the name, header and cmds.
@@ -19,12 +19,17 @@ import (
 	"testing"
 
 	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/gles"
 	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/api/vulkan"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/service/path"
 )
 
 func TestCaptureExportImport(t *testing.T) {
@@ -56,3 +61,322 @@ func TestCaptureExportImport(t *testing.T) {
 
 	assert.For(ctx, "got").That(ic.Commands).DeepEquals(cmds)
 }
+
+func TestCaptureExportImportJSON(t *testing.T) {
+	root := log.Testing(t)
+	ctx := database.Put(root, database.NewInMemory(root))
+	header := &capture.Header{Abi: device.AndroidARMv7a}
+
+	// The GLES commands have extras, and observe the names they read and
+	// write.
+	names, err := database.Store(ctx, []byte{5, 0, 0, 0})
+	if !assert.For(ctx, "database.Store").ThatError(err).Succeeded() {
+		return
+	}
+	rng := memory.Range{Base: 0x1000, Size: 4}
+	ptr := memory.BytePtr(rng.Base, memory.ApplicationPool)
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := gles.CommandBuilder{Thread: 0}
+	cmds := []api.Cmd{
+		testcmd.P,
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 1),
+			gles.NewStaticContextState(), gles.NewDynamicContextState(64, 64, false)),
+		cb.GlGenBuffers(1, ptr).AddWrite(rng, names),
+		cb.GlDeleteBuffers(1, ptr).AddRead(rng, names),
+		testcmd.Q,
+	}
+	p, err := capture.New(ctx, "test", header, cmds)
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err = capture.ExportJSON(capture.Put(ctx, p), p, buf)
+	if !assert.For(ctx, "capture.ExportJSON").ThatError(err).Succeeded() {
+		return
+	}
+
+	// Import into a new database, so the resources can only be found if they
+	// were exported with the commands.
+	ctx = database.Put(root, database.NewInMemory(root))
+	ip, err := capture.Import(ctx, "imported", buf.Bytes())
+	if !assert.For(ctx, "capture.Import").ThatError(err).Succeeded() {
+		return
+	}
+
+	ic, err := capture.Resolve(capture.Put(ctx, ip))
+	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() {
+		return
+	}
+
+	assert.For(ctx, "abi").That(ic.Header.Abi.Name).Equals(header.Abi.Name)
+	assert.For(ctx, "got").That(ic.Commands).DeepEquals(cmds)
+
+	observed := 0
+	for _, cmd := range ic.Commands {
+		extras := cmd.Extras()
+		if extras == nil || extras.Observations() == nil {
+			continue
+		}
+		o := extras.Observations()
+		for _, r := range append(append([]api.CmdObservation{}, o.Reads...), o.Writes...) {
+			data, err := database.Resolve(ctx, r.ID)
+			if assert.For(ctx, "database.Resolve").ThatError(err).Succeeded() {
+				assert.For(ctx, "resource").That(data).DeepEquals([]byte{5, 0, 0, 0})
+			}
+			observed++
+		}
+	}
+	assert.For(ctx, "observations").That(observed).Equals(2)
+}
+
+func TestCaptureSplice(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := &capture.Header{Abi: device.WindowsX86_64}
+	a, err := capture.New(ctx, "a", header, []api.Cmd{testcmd.P, testcmd.Q})
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	b, err := capture.New(ctx, "b", header, []api.Cmd{testcmd.Q, testcmd.P})
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	p, err := capture.Splice(ctx, "spliced", []*path.Commands{
+		{Capture: a, From: []uint64{1}, To: []uint64{1}},
+		{Capture: b, From: []uint64{0}, To: []uint64{1}},
+	})
+	if !assert.For(ctx, "capture.Splice").ThatError(err).Succeeded() {
+		return
+	}
+
+	c, err := capture.Resolve(capture.Put(ctx, p))
+	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() {
+		return
+	}
+
+	assert.For(ctx, "got").That(c.Commands).DeepEquals([]api.Cmd{testcmd.Q, testcmd.Q, testcmd.P})
+
+	_, err = capture.Splice(ctx, "invalid", []*path.Commands{
+		{Capture: a, From: []uint64{5}, To: []uint64{6}},
+	})
+	assert.For(ctx, "out of range").ThatError(err).Failed()
+}
+
+func TestCaptureSpliceGLES(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := &capture.Header{Abi: device.AndroidARMv7a}
+
+	rng := memory.Range{Base: 0x1000, Size: 4}
+	ptr := memory.BytePtr(rng.Base, memory.ApplicationPool)
+	name := func(n byte) id.ID {
+		id, err := database.Store(ctx, []byte{n, 0, 0, 0})
+		assert.For(ctx, "database.Store").ThatError(err).Succeeded()
+		return id
+	}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := gles.CommandBuilder{Thread: 0}
+	// Both captures create buffer 1 and texture 1.
+	cmds := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 1),
+			gles.NewStaticContextState(), gles.NewDynamicContextState(64, 64, false)),
+		cb.GlGenBuffers(1, ptr).AddWrite(rng, name(1)),
+		cb.GlBindBuffer(gles.GLenum_GL_ARRAY_BUFFER, 1),
+		cb.GlGenTextures(1, ptr).AddWrite(rng, name(1)),
+		cb.GlBindTexture(gles.GLenum_GL_TEXTURE_2D, 1),
+	}
+	a, err := capture.New(ctx, "a", header, cmds)
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	b, err := capture.New(ctx, "b", header, append(cmds[:len(cmds):len(cmds)],
+		cb.GlDeleteBuffers(1, ptr).AddRead(rng, name(1))))
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	// The commands of b use the context of a, where the names are taken.
+	p, err := capture.Splice(ctx, "spliced", []*path.Commands{
+		{Capture: a, From: []uint64{0}, To: []uint64{5}},
+		{Capture: b, From: []uint64{2}, To: []uint64{6}},
+	})
+	if !assert.For(ctx, "capture.Splice").ThatError(err).Succeeded() {
+		return
+	}
+	c, err := capture.Resolve(capture.Put(ctx, p))
+	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() ||
+		!assert.For(ctx, "commands").ThatSlice(c.Commands).IsLength(11) {
+		return
+	}
+
+	observed := func(o []api.CmdObservation) id.ID {
+		if len(o) != 1 {
+			return id.ID{}
+		}
+		return o[0].ID
+	}
+	got := c.Commands[6:]
+	assert.For(ctx, "buffer created").That(observed(got[0].Extras().Observations().Writes)).Equals(name(2))
+	assert.For(ctx, "buffer bound").That(got[1].(*gles.GlBindBuffer).Buffer).Equals(gles.BufferId(2))
+	assert.For(ctx, "texture created").That(observed(got[2].Extras().Observations().Writes)).Equals(name(2))
+	assert.For(ctx, "texture bound").That(got[3].(*gles.GlBindTexture).Texture).Equals(gles.TextureId(2))
+	assert.For(ctx, "buffer deleted").That(observed(got[4].Extras().Observations().Reads)).Equals(name(2))
+}
+
+func TestCaptureSpliceGLESPastArray(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := &capture.Header{Abi: device.AndroidARMv7a}
+
+	ptr := memory.BytePtr(0x1000, memory.ApplicationPool)
+	names := func(n ...byte) id.ID {
+		data := []byte{}
+		for _, n := range n {
+			data = append(data, n, 0, 0, 0)
+		}
+		id, err := database.Store(ctx, data)
+		assert.For(ctx, "database.Store").ThatError(err).Succeeded()
+		return id
+	}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := gles.CommandBuilder{Thread: 0}
+	cmds := func(gen api.Cmd) []api.Cmd {
+		return []api.Cmd{
+			cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+			api.WithExtras(
+				cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 1),
+				gles.NewStaticContextState(), gles.NewDynamicContextState(64, 64, false)),
+			gen,
+		}
+	}
+	a, err := capture.New(ctx, "a", header, cmds(
+		cb.GlGenBuffers(1, ptr).AddWrite(memory.Range{Base: 0x1000, Size: 4}, names(1))))
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	// The observation of the name of the buffer also holds the next word.
+	b, err := capture.New(ctx, "b", header, cmds(
+		cb.GlGenBuffers(1, ptr).AddWrite(memory.Range{Base: 0x1000, Size: 8}, names(1, 1))))
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	p, err := capture.Splice(ctx, "spliced", []*path.Commands{
+		{Capture: a, From: []uint64{0}, To: []uint64{2}},
+		{Capture: b, From: []uint64{2}, To: []uint64{2}},
+	})
+	if !assert.For(ctx, "capture.Splice").ThatError(err).Succeeded() {
+		return
+	}
+	c, err := capture.Resolve(capture.Put(ctx, p))
+	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() ||
+		!assert.For(ctx, "commands").ThatSlice(c.Commands).IsLength(4) {
+		return
+	}
+	writes := c.Commands[3].Extras().Observations().Writes
+	if assert.For(ctx, "writes").ThatSlice(writes).IsLength(1) {
+		assert.For(ctx, "buffer created").That(writes[0].ID).Equals(names(2, 1))
+	}
+}
+
+func TestCaptureSpliceNoFreeHandle(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := &capture.Header{Abi: device.AndroidARMv7a}
+
+	rng := memory.Range{Base: 0x1000, Size: 4}
+	ptr := memory.BytePtr(rng.Base, memory.ApplicationPool)
+	last, err := database.Store(ctx, []byte{0xff, 0xff, 0xff, 0xff})
+	if !assert.For(ctx, "database.Store").ThatError(err).Succeeded() {
+		return
+	}
+	ctxHandle := memory.BytePtr(1, memory.ApplicationPool)
+	cb := gles.CommandBuilder{Thread: 0}
+	// Both captures create the buffer with the largest name.
+	cmds := []api.Cmd{
+		cb.EglCreateContext(memory.Nullptr, memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle),
+		api.WithExtras(
+			cb.EglMakeCurrent(memory.Nullptr, memory.Nullptr, memory.Nullptr, ctxHandle, 1),
+			gles.NewStaticContextState(), gles.NewDynamicContextState(64, 64, false)),
+		cb.GlGenBuffers(1, ptr).AddWrite(rng, last),
+	}
+	a, err := capture.New(ctx, "a", header, cmds)
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	b, err := capture.New(ctx, "b", header, cmds)
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	_, err = capture.Splice(ctx, "spliced", []*path.Commands{
+		{Capture: a, From: []uint64{0}, To: []uint64{2}},
+		{Capture: b, From: []uint64{2}, To: []uint64{2}},
+	})
+	assert.For(ctx, "capture.Splice").ThatError(err).Failed()
+}
+
+func TestCaptureSpliceVulkan(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	header := &capture.Header{Abi: device.AndroidARMv7a}
+	s := api.NewStateWithEmptyAllocator(header.Abi.MemoryLayout)
+
+	dev := vulkan.VkDevice(1)
+	bufferInfo := s.AllocDataOrPanic(ctx, vulkan.VkBufferCreateInfo{
+		SType: vulkan.VkStructureType_VK_STRUCTURE_TYPE_BUFFER_CREATE_INFO,
+		Size:  256,
+		Usage: vulkan.VkBufferUsageFlags(vulkan.VkBufferUsageFlagBits_VK_BUFFER_USAGE_UNIFORM_TEXEL_BUFFER_BIT),
+	})
+	viewInfo := func(buffer vulkan.VkBuffer) api.AllocResult {
+		return s.AllocDataOrPanic(ctx, vulkan.VkBufferViewCreateInfo{
+			SType:  vulkan.VkStructureType_VK_STRUCTURE_TYPE_BUFFER_VIEW_CREATE_INFO,
+			Buffer: buffer,
+			Format: vulkan.VkFormat_VK_FORMAT_R8G8B8A8_UNORM,
+			Range:  256,
+		})
+	}
+	captured := viewInfo(0x20)
+	buffer, view := s.AllocDataOrPanic(ctx, vulkan.VkBuffer(0x20)), s.AllocDataOrPanic(ctx, vulkan.VkBufferView(0x30))
+
+	cb := vulkan.CommandBuilder{Thread: 0}
+	createBuffer := cb.VkCreateBuffer(dev, bufferInfo.Ptr(), memory.Nullptr, buffer.Ptr(), vulkan.VkResult_VK_SUCCESS).
+		AddRead(bufferInfo.Data()).AddWrite(buffer.Data())
+	a, err := capture.New(ctx, "a", header, []api.Cmd{createBuffer})
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+	b, err := capture.New(ctx, "b", header, []api.Cmd{
+		createBuffer,
+		cb.VkCreateBufferView(dev, captured.Ptr(), memory.Nullptr, view.Ptr(), vulkan.VkResult_VK_SUCCESS).
+			AddRead(captured.Data()).AddWrite(view.Data()),
+	})
+	if !assert.For(ctx, "capture.New").ThatError(err).Succeeded() {
+		return
+	}
+
+	p, err := capture.Splice(ctx, "spliced", []*path.Commands{
+		{Capture: a, From: []uint64{0}, To: []uint64{0}},
+		{Capture: b, From: []uint64{0}, To: []uint64{1}},
+	})
+	if !assert.For(ctx, "capture.Splice").ThatError(err).Succeeded() {
+		return
+	}
+	c, err := capture.Resolve(capture.Put(ctx, p))
+	if !assert.For(ctx, "capture.Resolve").ThatError(err).Succeeded() ||
+		!assert.For(ctx, "commands").ThatSlice(c.Commands).IsLength(3) {
+		return
+	}
+
+	// The buffer of b is given a new handle, which is also the buffer of the
+	// structure read by vkCreateBufferView.
+	_, remapped := s.AllocDataOrPanic(ctx, vulkan.VkBuffer(0x21)).Data()
+	_, expected := viewInfo(0x21).Data()
+	assert.For(ctx, "buffer").That(c.Commands[1].Extras().Observations().Writes[0].ID).Equals(remapped)
+	assert.For(ctx, "view info").That(c.Commands[2].Extras().Observations().Reads[0].ID).Equals(expected)
+}
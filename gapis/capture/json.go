@@ -0,0 +1,116 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/atom/atom_pb"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// jsonMessage is a single line of a capture exported as JSON.
+type jsonMessage struct {
+	// Type is the full name of the message type.
+	Type string `json:"type"`
+	// Message is the message in the proto3 JSON mapping.
+	Message json.RawMessage `json:"message"`
+}
+
+// ExportJSON encodes the given capture and associated resources and writes
+// it to the supplied io.Writer as line-oriented JSON, producing output
+// suitable for use with Import.
+func ExportJSON(ctx context.Context, p *path.Capture, w io.Writer) error {
+	c, err := ResolveFromPath(ctx, p)
+	if err != nil {
+		return err
+	}
+	return c.ExportJSON(ctx, w)
+}
+
+// ExportJSON encodes the given capture and associated resources and writes
+// it to the supplied io.Writer as line-oriented JSON, producing output
+// suitable for use with Import.
+//
+// Each line holds one of the messages of the .gfxtrace format, in the same
+// order: the header first, then the commands, each preceded by the resources
+// it observes and followed by its extras.
+func (c *Capture) ExportJSON(ctx context.Context, w io.Writer) error {
+	m := jsonpb.Marshaler{OrigName: true}
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	return c.encode(ctx, func(a atom_pb.Atom) error {
+		buf := &bytes.Buffer{}
+		if err := m.Marshal(buf, a); err != nil {
+			return err
+		}
+		return e.Encode(jsonMessage{proto.MessageName(a), buf.Bytes()})
+	})
+}
+
+// ImportJSON imports the capture by name and line-oriented JSON data, as
+// written by ExportJSON, and stores it in the database.
+func ImportJSON(ctx context.Context, name string, data []byte) (*path.Capture, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	u := jsonpb.Unmarshaler{}
+	line := 0
+	header, cmds, err := decode(ctx, func() (atom_pb.Atom, error) {
+		for {
+			text, err := r.ReadBytes('\n')
+			if err == io.EOF && len(text) > 0 {
+				err = nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			line++
+			if len(bytes.TrimSpace(text)) == 0 {
+				continue
+			}
+			msg := jsonMessage{}
+			if err := json.Unmarshal(text, &msg); err != nil {
+				return nil, log.Errf(ctx, err, "Line %d", line)
+			}
+			typ := proto.MessageType(msg.Type)
+			if typ == nil {
+				return nil, log.Errf(ctx, nil, "Line %d: unknown message type '%v'", line, msg.Type)
+			}
+			a := reflect.New(typ.Elem()).Interface().(atom_pb.Atom)
+			if err := u.Unmarshal(bytes.NewReader(msg.Message), a); err != nil {
+				return nil, log.Errf(ctx, err, "Line %d: %v", line, msg.Type)
+			}
+			return a, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, name, header, cmds)
+}
+
+// isJSON returns true if data looks like a capture exported by ExportJSON
+// rather than a .gfxtrace file.
+func isJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
@@ -0,0 +1,457 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Splice returns a path to a new capture with the given name, holding the
+// commands of each of the ranges in order. The ranges can be taken from any
+// captures of the same APIs, taken on the same device.
+//
+// The handles of the objects created by the commands of a capture are given
+// new values if they are already used by the commands of another capture.
+// Handles are remapped when they are parameters or results of the commands,
+// elements of arrays of handles written by the commands, or held in the
+// arrays and structures read by the commands as found by api.ReadHandles,
+// using the api.HandleRemapper of the APIs. The memory pools other than the application pool
+// are created by the mutation of the commands, so they are numbered by the
+// state of the new capture.
+//
+// Splice returns an error if the commands of the new capture fail to mutate
+// the state of the capture.
+func Splice(ctx context.Context, name string, ranges []*path.Commands) (*path.Capture, error) {
+	if len(ranges) == 0 {
+		return nil, log.Err(ctx, nil, "No command range to splice")
+	}
+
+	var first *Capture
+	s := &splicer{handles: map[id.ID]map[interface{}]uint64{}, taken: map[interface{}]bool{}}
+	cmds := []api.Cmd{}
+	for i, r := range ranges {
+		if len(r.From) != 1 || len(r.To) != 1 {
+			return nil, log.Errf(ctx, nil, "Range %d: subcommands cannot be spliced", i)
+		}
+		c, err := ResolveFromPath(ctx, r.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = c
+			s.state = api.NewStateWithEmptyAllocator(c.Header.Abi.MemoryLayout)
+			s.order = byteOrder(c.Header.Abi.MemoryLayout)
+		} else if err := compatible(ctx, first, c); err != nil {
+			return nil, log.Errf(ctx, err, "Range %d", i)
+		}
+
+		count := uint64(len(c.Commands))
+		from, to := r.From[0], r.To[0]
+		if to >= count {
+			to = count - 1
+		}
+		if count == 0 || from > to {
+			return nil, log.Errf(ctx, nil, "Range %d: [%d, %d] is out of the %d commands of the capture", i, r.From[0], r.To[0], count)
+		}
+
+		id := r.Capture.Id.ID()
+		handles, ok := s.handles[id]
+		if !ok {
+			handles = map[interface{}]uint64{}
+			s.handles[id] = handles
+		}
+		for _, cmd := range c.Commands[from : to+1] {
+			out, err := s.splice(ctx, handles, cmd)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, out)
+		}
+	}
+
+	c, err := build(ctx, name, first.Header, cmds)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validate(ctx); err != nil {
+		return nil, err
+	}
+	return c.store(ctx)
+}
+
+// compatible returns an error if the commands of the captures a and b cannot
+// be spliced together.
+func compatible(ctx context.Context, a, b *Capture) error {
+	if !proto.Equal(a.Header.Abi, b.Header.Abi) {
+		return log.Errf(ctx, nil, "Captures have different ABIs: %v and %v", a.Header.Abi, b.Header.Abi)
+	}
+	if a.Header.Device != nil && b.Header.Device != nil && !proto.Equal(a.Header.Device.Id, b.Header.Device.Id) {
+		return log.Errf(ctx, nil, "Captures were taken on different devices: %v and %v",
+			a.Header.Device.Name, b.Header.Device.Name)
+	}
+	apis := map[api.ID]bool{}
+	for _, x := range a.APIs {
+		apis[x.ID()] = true
+	}
+	if len(apis) != len(b.APIs) {
+		return log.Errf(ctx, nil, "Captures use different APIs")
+	}
+	for _, x := range b.APIs {
+		if !apis[x.ID()] {
+			return log.Errf(ctx, nil, "Captures use different APIs")
+		}
+	}
+	return nil
+}
+
+// validate returns an error if the commands of the capture fail to mutate
+// its initial state. Commands that were aborted when captured are expected
+// to abort.
+func (c *Capture) validate(ctx context.Context) error {
+	s := c.NewState()
+	for i, cmd := range c.Commands {
+		err := cmd.Mutate(ctx, s, nil)
+		switch {
+		case err == nil:
+		case err == context.Canceled:
+			return err
+		case api.IsErrCmdAborted(err) && cmd.Extras().Aborted() != nil:
+		default:
+			return log.Errf(ctx, err, "Command %d: %v", i, cmd)
+		}
+	}
+	return nil
+}
+
+// splicer holds the state of a splice.
+type splicer struct {
+	// state is the state mutated by the spliced commands.
+	state *api.State
+	// order is the byte order of the captures.
+	order binary.ByteOrder
+	// handles maps the remapping keys of the handles of each capture to the
+	// values of the handles in the spliced commands.
+	handles map[id.ID]map[interface{}]uint64
+	// taken is the set of remapping keys of the handles of the spliced
+	// commands.
+	taken map[interface{}]bool
+}
+
+// splice returns a copy of the command cmd, with the handles it uses remapped
+// by handles, and mutates it on the state.
+func (s *splicer) splice(ctx context.Context, handles map[interface{}]uint64, cmd api.Cmd) (api.Cmd, error) {
+	out := clone(cmd)
+	if r, ok := cmd.API().(api.HandleRemapper); ok {
+		observations := out.Extras().Observations()
+		v := reflect.ValueOf(out)
+		for v.Kind() != reflect.Struct {
+			v = v.Elem()
+		}
+		t := v.Type()
+		counts := api.ArrayCounts(out)
+		for i, count := 0, t.NumField(); i < count; i++ {
+			if _, ok := t.Field(i).Tag.Lookup("param"); !ok {
+				if _, ok := t.Field(i).Tag.Lookup("result"); !ok {
+					continue
+				}
+			}
+			field := v.Field(i)
+			if key, remap := r.RemapHandle(field.Interface(), out, s.state); remap {
+				value, err := s.handle(ctx, handles, r, out, key, field.Interface())
+				if err != nil {
+					return nil, err
+				}
+				field.Set(reflect.ValueOf(withValue(field.Interface(), value)))
+				continue
+			}
+			p, ok := field.Interface().(memory.Pointer)
+			if !ok || p.IsNullptr() || observations == nil {
+				continue
+			}
+			if err := s.remapArray(ctx, handles, r, out, p, counts[i], observations.Writes); err != nil {
+				return nil, err
+			}
+		}
+		if observations != nil {
+			if err := s.remapReads(ctx, handles, r, out, observations.Reads); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Mutation errors are reported by the validation of the spliced capture.
+	out.Mutate(ctx, s.state, nil)
+	return out, nil
+}
+
+// handle returns the value of the handle v with the remapping key, which is
+// given a new value if the key is already used by another capture. It fails
+// if all the values from the captured one to the maximum of the type of the
+// handle are used.
+func (s *splicer) handle(ctx context.Context, handles map[interface{}]uint64, r api.HandleRemapper,
+	cmd api.Cmd, key interface{}, v interface{}) (uint64, error) {
+
+	if value, ok := handles[key]; ok {
+		return value, nil
+	}
+	captured, max := handleValue(v), s.maxHandleValue(v)
+	for value := captured; ; value++ {
+		k, remap := key, true
+		if value != captured {
+			k, remap = r.RemapHandle(withValue(v, value), cmd, s.state)
+		}
+		if remap && !s.taken[k] {
+			s.taken[k] = true
+			handles[key] = value
+			return value, nil
+		}
+		if value >= max {
+			return 0, log.Errf(ctx, nil, "No free value for the handle %v of %v", v, cmd.CmdName())
+		}
+	}
+}
+
+// maxHandleValue returns the maximum value of the type of the handle v.
+func (s *splicer) maxHandleValue(v interface{}) uint64 {
+	if _, ok := v.(memory.Pointer); ok {
+		if size := uint(s.state.MemoryLayout.GetPointer().GetSize()); size > 0 && size < 8 {
+			return 1<<(8*size) - 1
+		}
+		return ^uint64(0)
+	}
+	switch t := reflect.TypeOf(v); t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 1<<uint(t.Bits()-1) - 1
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return ^uint64(0) >> uint(64-t.Bits())
+	}
+	return handleValue(v)
+}
+
+// remapReads remaps the handles held in the memory read by the command cmd,
+// observed by observations. The handles keep their captured values if they
+// were not remapped before.
+func (s *splicer) remapReads(ctx context.Context, handles map[interface{}]uint64, r api.HandleRemapper,
+	cmd api.Cmd, observations []api.CmdObservation) error {
+
+	data := map[int][]byte{}
+	var err error
+	// find returns the index of the observation holding rng, and its data.
+	find := func(rng memory.Range) (int, []byte) {
+		for i, o := range observations {
+			if rng.Base < o.Range.Base || rng.End() > o.Range.End() {
+				continue
+			}
+			if _, ok := data[i]; !ok {
+				res, e := database.Resolve(ctx, o.ID)
+				if e != nil {
+					err = e
+					return -1, nil
+				}
+				data[i] = append([]byte{}, res.([]byte)...)
+			}
+			return i, data[i][rng.Base-o.Range.Base : rng.End()-o.Range.Base]
+		}
+		return -1, nil
+	}
+	read := func(rng memory.Range) []byte {
+		_, d := find(rng)
+		return d
+	}
+
+	changed := map[int]bool{}
+	for _, h := range api.ReadHandles(cmd, s.state, r.RemapHandle, read) {
+		captured := handleValue(h.Value)
+		value, ok := handles[h.Key]
+		if !ok || value == captured || h.Range.Size != 4 && h.Range.Size != 8 {
+			continue
+		}
+		i, d := find(h.Range)
+		s.putUint(d, h.Range.Size, value)
+		changed[i] = true
+	}
+	if err != nil {
+		return err
+	}
+	for i := range changed {
+		id, err := database.Store(ctx, data[i])
+		if err != nil {
+			return err
+		}
+		observations[i].ID = id
+	}
+	return nil
+}
+
+// remapArray remaps the handles of the array of count elements at p written
+// by the command cmd, observed by observations. The handles are given new
+// values if they are already used by another capture. The observed memory
+// past the end of the array is left untouched.
+func (s *splicer) remapArray(ctx context.Context, handles map[interface{}]uint64, r api.HandleRemapper,
+	cmd api.Cmd, p memory.Pointer, count uint64, observations []api.CmdObservation) error {
+
+	el := p.ElementType()
+	if el == nil {
+		return nil
+	}
+	switch el.Kind() {
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return nil // Arrays of handles are arrays of 32 or 64 bit integers.
+	}
+	zero := reflect.Zero(el).Interface()
+	if _, remap := r.RemapHandle(zero, cmd, s.state); !remap {
+		// Zero handles are usually not remapped, try with a non-zero one.
+		if _, remap := r.RemapHandle(withValue(zero, 1), cmd, s.state); !remap {
+			return nil
+		}
+	}
+	size := p.ElementSize(s.state.MemoryLayout)
+	if size != 4 && size != 8 {
+		return nil
+	}
+
+	for i, o := range observations {
+		if !o.Range.Contains(p.Address()) {
+			continue
+		}
+		res, err := database.Resolve(ctx, o.ID)
+		if err != nil {
+			return err
+		}
+		data := append([]byte{}, res.([]byte)...)
+		changed := false
+		start := p.Address() - o.Range.Base
+		end := uint64(len(data))
+		if count < (end-start)/size {
+			end = start + count*size
+		}
+		for at := start; at+size <= end; at += size {
+			captured := s.uint(data[at:], size)
+			v := withValue(zero, captured)
+			key, remap := r.RemapHandle(v, cmd, s.state)
+			if !remap {
+				continue
+			}
+			value, err := s.handle(ctx, handles, r, cmd, key, v)
+			if err != nil {
+				return err
+			}
+			if value != captured {
+				s.putUint(data[at:], size, value)
+				changed = true
+			}
+		}
+		if changed {
+			id, err := database.Store(ctx, data)
+			if err != nil {
+				return err
+			}
+			observations[i].ID = id
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *splicer) uint(data []byte, size uint64) uint64 {
+	if size == 4 {
+		return uint64(s.order.Uint32(data))
+	}
+	return s.order.Uint64(data)
+}
+
+func (s *splicer) putUint(data []byte, size uint64, v uint64) {
+	if size == 4 {
+		s.order.PutUint32(data, uint32(v))
+	} else {
+		s.order.PutUint64(data, v)
+	}
+}
+
+// byteOrder returns the byte order of the memory layout l.
+func byteOrder(l *device.MemoryLayout) binary.ByteOrder {
+	if l.GetEndian() == device.BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// clone returns a shallow copy of the command cmd, with copies of its extras
+// and observations.
+func clone(cmd api.Cmd) api.Cmd {
+	v := reflect.ValueOf(cmd)
+	if v.Kind() != reflect.Ptr {
+		return cmd
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	out := c.Interface().(api.Cmd)
+	if e := out.Extras(); e != nil && len(*e) > 0 {
+		extras := make(api.CmdExtras, len(*e))
+		for i, x := range *e {
+			if o, ok := x.(*api.CmdObservations); ok {
+				x = &api.CmdObservations{
+					Reads:  append([]api.CmdObservation{}, o.Reads...),
+					Writes: append([]api.CmdObservation{}, o.Writes...),
+				}
+			}
+			extras[i] = x
+		}
+		*e = extras
+	}
+	return out
+}
+
+// handleValue returns the value of the handle v.
+func handleValue(v interface{}) uint64 {
+	if p, ok := v.(memory.Pointer); ok {
+		return p.Address()
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(r.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return r.Uint()
+	}
+	return 0
+}
+
+// withValue returns the handle v with the value value.
+func withValue(v interface{}, value uint64) interface{} {
+	if p, ok := v.(memory.Pointer); ok {
+		return p.Offset(value - p.Address())
+	}
+	r := reflect.New(reflect.TypeOf(v)).Elem()
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r.SetInt(int64(value))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		r.SetUint(value)
+	default:
+		return v
+	}
+	return r.Interface()
+}
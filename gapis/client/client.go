@@ -135,6 +135,17 @@ func (c *client) GetPerformanceCounters(ctx context.Context) ([]byte, error) {
 	return res.GetData(), nil
 }
 
+func (c *client) GetReplayQueue(ctx context.Context) (*service.ReplayQueue, error) {
+	res, err := c.client.GetReplayQueue(ctx, &service.GetReplayQueueRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetQueue(), nil
+}
+
 func (c *client) GetProfile(ctx context.Context, name string, debug int32) ([]byte, error) {
 	res, err := c.client.GetProfile(ctx, &service.GetProfileRequest{
 		Name:  name,
@@ -187,9 +198,10 @@ func (c *client) ImportCapture(ctx context.Context, name string, data []byte) (*
 	return res.GetCapture(), nil
 }
 
-func (c *client) ExportCapture(ctx context.Context, p *path.Capture) ([]byte, error) {
+func (c *client) ExportCapture(ctx context.Context, p *path.Capture, f service.CaptureFormat) ([]byte, error) {
 	res, err := c.client.ExportCapture(ctx, &service.ExportCaptureRequest{
 		Capture: p,
+		Format:  f,
 	})
 	if err != nil {
 		return nil, err
@@ -213,6 +225,34 @@ func (c *client) LoadCapture(ctx context.Context, path string) (*path.Capture, e
 	return res.GetCapture(), nil
 }
 
+func (c *client) SpliceCaptures(ctx context.Context, name string, ranges []*path.Commands) (*path.Capture, error) {
+	res, err := c.client.SpliceCaptures(ctx, &service.SpliceCapturesRequest{
+		Name:   name,
+		Ranges: ranges,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCapture(), nil
+}
+
+func (c *client) Eval(ctx context.Context, p *path.Capture, script string) (*service.EvalResult, error) {
+	res, err := c.client.Eval(ctx, &service.EvalRequest{
+		Capture: p,
+		Script:  script,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetResult(), nil
+}
+
 func (c *client) GetDevices(ctx context.Context) ([]*path.Device, error) {
 	res, err := c.client.GetDevices(ctx, &service.GetDevicesRequest{})
 	if err != nil {
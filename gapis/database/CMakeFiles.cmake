@@ -21,6 +21,7 @@ set(files
     database.go
     debug.go
     hash.go
+    inherit.go
     memory.go
     resolvable.go
 )
@@ -0,0 +1,49 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/gapid/core/context/keys"
+)
+
+var (
+	inheritedMutex sync.Mutex
+	inheritedKeys  []interface{}
+)
+
+// Inherit registers key as a context key whose value is copied from the
+// context of the first caller of a resolve to the context the resolve is
+// performed with. Resolves are otherwise performed with a context detached
+// from their callers, as they may be shared by many callers.
+func Inherit(key interface{}) {
+	inheritedMutex.Lock()
+	defer inheritedMutex.Unlock()
+	inheritedKeys = append(inheritedKeys, key)
+}
+
+// inherit returns ctx with the values of the inherited keys of from.
+func inherit(ctx context.Context, from context.Context) context.Context {
+	inheritedMutex.Lock()
+	defer inheritedMutex.Unlock()
+	for _, key := range inheritedKeys {
+		if v := from.Value(key); v != nil {
+			ctx = keys.WithValue(ctx, key, v)
+		}
+	}
+	return ctx
+}
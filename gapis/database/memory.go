@@ -139,7 +139,7 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 		// Build a cancellable context for the resolve from database's resolve
 		// context. We use this as we don't to cancel the resolve if a single
 		// caller cancel's their context.
-		resolveCtx, cancel := task.WithCancel(d.resolveCtx)
+		resolveCtx, cancel := task.WithCancel(inherit(d.resolveCtx, ctx))
 
 		rs = &resolveState{
 			ctx:      rc.bind(resolveCtx),
@@ -35,6 +35,9 @@ type Allocator interface {
 
 	// FreeList returns the free ranges this allocator can allocate from.
 	FreeList() interval.U64RangeList
+
+	// Clone returns a copy of the allocator, with the same allocations.
+	Clone() Allocator
 }
 
 // BasicAllocator is a simple memory range allocator
@@ -93,6 +96,18 @@ func (c *basicAllocator) FreeList() interval.U64RangeList {
 	return c.freeList.Clone()
 }
 
+// Clone implements Allocator.
+func (c *basicAllocator) Clone() Allocator {
+	allocations := make(map[uint64]uint64, len(c.allocations))
+	for base, count := range c.allocations {
+		allocations[base] = count
+	}
+	return &basicAllocator{
+		freeList:    c.freeList.Clone(),
+		allocations: allocations,
+	}
+}
+
 // NewBasicAllocator creates a new allocator which allocates
 // memory from the given list of free ranges. Memory is allocated
 // by finding the leftmost free block large enough to fit the
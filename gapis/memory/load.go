@@ -42,7 +42,10 @@ func LoadSlice(ctx context.Context, s Slice, pools Pools, l *device.MemoryLayout
 // LoadPointer loads the element from p.
 func LoadPointer(ctx context.Context, p Pointer, pools Pools, l *device.MemoryLayout) (interface{}, error) {
 	pool := pools[p.Pool()]
-	ioR := pool.At(p.Address()).NewReader(ctx)
+	// Only slice the element, as the writes of all the layers of a cloned
+	// pool are merged for the sliced range.
+	rng := Range{Base: p.Address(), Size: p.ElementSize(l)}
+	ioR := pool.Slice(rng).NewReader(ctx)
 	binR := endian.Reader(ioR, l.GetEndian())
 	d := NewDecoder(binR, l)
 	elPtr := reflect.New(p.ElementType())
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync/atomic"
 
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/math/interval"
@@ -35,12 +36,49 @@ import (
 // copies, but instead all writes are stored as lightweight records. Only when a
 // Pool slice has Get called will any resolving, loading or copying of binary
 // data occur.
+//
+// Pools are copy-on-write: a Pool returned by Clone shares the write records
+// of the original Pool. Subsequent writes to either Pool are recorded on top
+// of the shared records, which are never modified.
 type Pool struct {
-	writes  poolWriteList
+	writes  poolWriteList // Writes on top of base.
+	base    *poolLayer    // Writes shared with other Pools, or nil.
+	shared  uint32        // Non-zero if writes is shared with another Pool.
 	OnRead  func(Range)
 	OnWrite func(Range)
 }
 
+// maxPoolLayers is the maximum number of shared layers of writes under a Pool
+// that is written to. Deeper layers are merged, to bound the cost of slicing.
+const maxPoolLayers = 16
+
+// poolLayer is an immutable list of writes shared between Pools. The writes of
+// a layer are applied on top of the writes of its parent.
+type poolLayer struct {
+	writes poolWriteList
+	parent *poolLayer
+	depth  int // The number of layers, including this one.
+}
+
+// apply applies the writes of the layer and its parents that overlap span to
+// out, in the order they were made.
+func (l *poolLayer) apply(out *poolWriteList, span interval.U64Span) {
+	if l == nil {
+		return
+	}
+	l.parent.apply(out, span)
+	applyWrites(out, l.writes, span)
+}
+
+// applyWrites applies the writes that overlap span to out.
+func applyWrites(out *poolWriteList, writes poolWriteList, span interval.U64Span) {
+	i, c := interval.Intersect(&writes, span)
+	for _, w := range writes[i : i+c] {
+		j := interval.Replace(out, w.dst.Span())
+		(*out)[j].src = w.src
+	}
+}
+
 // Pools is a map of PoolID to *Pool.
 type Pools map[PoolID]*Pool
 
@@ -60,9 +98,16 @@ const (
 
 // Slice returns a Data referencing the subset of the Pool range.
 func (m *Pool) Slice(rng Range) Data {
-	i, c := interval.Intersect(&m.writes, rng.Span())
+	writes := m.writes
+	if m.base != nil {
+		// Only copy the shared writes that overlap the range.
+		writes = poolWriteList{}
+		m.base.apply(&writes, rng.Span())
+		applyWrites(&writes, m.writes, rng.Span())
+	}
+	i, c := interval.Intersect(&writes, rng.Span())
 	if c == 1 {
-		w := m.writes[i]
+		w := writes[i]
 		if rng == w.dst {
 			// Exact hit
 			return w.src
@@ -73,28 +118,91 @@ func (m *Pool) Slice(rng Range) Data {
 			return w.src.Slice(rng)
 		}
 	}
-	writes := make(poolWriteList, c)
-	copy(writes, m.writes[i:i+c])
-	return poolSlice{rng: rng, writes: writes}
+	if m.base != nil {
+		return poolSlice{rng: rng, writes: writes[i : i+c]}
+	}
+	out := make(poolWriteList, c)
+	copy(out, writes[i:i+c])
+	return poolSlice{rng: rng, writes: out}
 }
 
 // At returns an unbounded Data starting at p.
+// On a cloned Pool, this merges the shared writes of every layer above addr,
+// so Slice should be preferred when the size of the data is known.
 func (m *Pool) At(addr uint64) Data {
 	return m.Slice(Range{Base: addr, Size: ^uint64(0) - addr})
 }
 
 // Write copies the data src to the address dst.
 func (m *Pool) Write(dst uint64, src Data) {
+	m.own()
 	rng := Range{Base: dst, Size: src.Size()}
 	i := interval.Replace(&m.writes, rng.Span())
 	m.writes[i].src = src
 }
 
+// Clone returns a copy of the Pool holding the same writes. The write records
+// are shared between the two Pools, and subsequent writes to either Pool are
+// recorded separately, so neither cloning nor writing copies the records.
+// Subsequent writes to either Pool do not affect the other. The OnRead and
+// OnWrite callbacks are not copied.
+//
+// Clone can be called concurrently, as long as the Pool is not written to.
+func (m *Pool) Clone() *Pool {
+	atomic.StoreUint32(&m.shared, 1)
+	return &Pool{base: m.layer()}
+}
+
+// layer returns the layer holding all the writes of the Pool.
+func (m *Pool) layer() *poolLayer {
+	if len(m.writes) == 0 {
+		return m.base
+	}
+	l := &poolLayer{writes: m.writes, parent: m.base, depth: 1}
+	if m.base != nil {
+		l.depth += m.base.depth
+	}
+	return l
+}
+
+// own moves the writes of the Pool to a new shared layer if they are shared
+// with another Pool, so they are not modified by subsequent writes.
+func (m *Pool) own() {
+	if atomic.LoadUint32(&m.shared) == 0 {
+		return
+	}
+	m.base, m.writes = m.layer(), nil
+	if m.base != nil && m.base.depth > maxPoolLayers {
+		writes := poolWriteList{}
+		m.base.apply(&writes, allSpan)
+		m.base = &poolLayer{writes: writes, depth: 1}
+	}
+	atomic.StoreUint32(&m.shared, 0)
+}
+
+// allSpan is the span covering the whole address space.
+var allSpan = interval.U64Span{Start: 0, End: ^uint64(0)}
+
+// Clone returns a copy of the Pools, cloning each of the Pool.
+func (p Pools) Clone() Pools {
+	out := make(Pools, len(p))
+	for id, pool := range p {
+		out[id] = pool.Clone()
+	}
+	return out
+}
+
 // String returns the full history of writes performed to this pool.
 func (m *Pool) String() string {
-	l := make([]string, len(m.writes)+1)
+	writes := m.writes
+	if m.base != nil {
+		writes = poolWriteList{}
+		m.base.apply(&writes, allSpan)
+		applyWrites(&writes, m.writes, allSpan)
+	}
+	l := make([]string, len(writes)+1)
 	l[0] = fmt.Sprintf("Pool(%p):", m)
-	for i, w := range m.writes {
+	for i, w := range writes {
 		l[i+1] = fmt.Sprintf("(%d) %v <- %v", i, w.dst, w.src)
 	}
 	return strings.Join(l, "\n")
@@ -18,11 +18,13 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"reflect"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/gapis/database"
 	"github.com/pkg/errors"
 )
@@ -267,3 +269,98 @@ func TestSliceNesting(t *testing.T) {
 
 	checkData(ctx, outerPool.Slice(Range{Size: 11}), []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
 }
+
+func TestPoolClone(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	original := &Pool{}
+	original.Write(0, Blob([]byte{1, 2, 3, 4, 5, 6}))
+
+	clone := original.Clone()
+	checkData(ctx, clone.Slice(Range{Size: 6}), []byte{1, 2, 3, 4, 5, 6})
+
+	clone.Write(2, Blob([]byte{7, 8}))
+	checkData(ctx, original.Slice(Range{Size: 6}), []byte{1, 2, 3, 4, 5, 6})
+	checkData(ctx, clone.Slice(Range{Size: 6}), []byte{1, 2, 7, 8, 5, 6})
+
+	original.Write(4, Blob([]byte{9}))
+	checkData(ctx, original.Slice(Range{Size: 6}), []byte{1, 2, 3, 4, 9, 6})
+	checkData(ctx, clone.Slice(Range{Size: 6}), []byte{1, 2, 7, 8, 5, 6})
+
+	nested := clone.Clone()
+	nested.Write(0, Blob([]byte{0}))
+	checkData(ctx, clone.Slice(Range{Size: 6}), []byte{1, 2, 7, 8, 5, 6})
+	checkData(ctx, nested.Slice(Range{Size: 6}), []byte{0, 2, 7, 8, 5, 6})
+}
+
+func TestPoolForkIndependence(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	const size = 64
+	type forked struct {
+		pool     *Pool
+		expected []byte
+	}
+	write := func(f *forked, addr uint64, data ...byte) {
+		f.pool.Write(addr, Blob(data))
+		copy(f.expected[addr:], data)
+	}
+
+	all := []*forked{{&Pool{}, make([]byte, size)}}
+	write(all[0], 0, 1, 2, 3, 4, 5, 6, 7, 8)
+	for i := 0; i < 3*maxPoolLayers; i++ {
+		parent := all[len(all)-1]
+		if i%3 == 0 {
+			// Also fork older pools, and keep writing to them.
+			parent = all[i/2]
+		}
+		child := &forked{parent.pool.Clone(), append([]byte{}, parent.expected...)}
+		all = append(all, child)
+
+		b := byte(i + 10)
+		write(child, uint64(i*7)%(size-4), b, b, b, b)
+		write(parent, uint64(i*5+2)%(size-3), b+100, b+100, b+100)
+		checkData(ctx, child.pool.Slice(Range{Size: size}), child.expected)
+		checkData(ctx, parent.pool.Slice(Range{Size: size}), parent.expected)
+	}
+
+	for i, f := range all {
+		ctx := log.V{"pool": i}.Bind(ctx)
+		checkData(ctx, f.pool.Slice(Range{Size: size}), f.expected)
+		checkData(ctx, f.pool.Slice(Range{Base: 3, Size: 5}), f.expected[3:8])
+		if f.pool.base != nil {
+			assert.For(ctx, "depth").That(f.pool.base.depth <= maxPoolLayers+1).Equals(true)
+		}
+	}
+}
+
+func TestLoadPointerLayers(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	l := device.Little64
+
+	original := &Pool{}
+	original.Write(0x100, NewData(l, uint32(1), uint32(2), uint32(3)))
+	clone := original.Clone()
+	clone.Write(0x104, NewData(l, uint32(20)))
+	clone.Write(0x200, NewData(l, uint32(100)))
+	pools := Pools{ApplicationPool: clone}
+
+	for _, test := range []struct {
+		addr     uint64
+		expected uint32
+	}{
+		{0x100, 1},
+		{0x104, 20},
+		{0x108, 3},
+		{0x200, 100},
+	} {
+		p := NewPtr(test.addr, ApplicationPool, reflect.TypeOf(uint32(0)))
+		got, err := LoadPointer(ctx, p, pools, l)
+		if assert.For(ctx, "err").ThatError(err).Succeeded() {
+			assert.For(ctx, "value at 0x%x", test.addr).That(got).Equals(test.expected)
+		}
+	}
+}
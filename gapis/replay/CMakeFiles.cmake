@@ -20,11 +20,16 @@
 set(files
     batch.go
     context.go
+    crash.go
+    crash_test.go
     custom.go
     doc.go
+    dump.go
     events.go
     interfaces.go
     manager.go
+    prefix.go
+    prefix_test.go
     replay.go
     replay.pb.go
     replay.proto
@@ -37,4 +42,5 @@ set(dirs
     protocol
     scheduler
     value
+    vm
 )
@@ -18,15 +18,17 @@ import (
 	"context"
 
 	"github.com/google/gapid/core/app/benchmark"
-	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/config"
 	"github.com/google/gapid/gapis/replay/builder"
 	"github.com/google/gapid/gapis/replay/executor"
+	"github.com/google/gapid/gapis/replay/protocol"
 	"github.com/google/gapid/gapis/replay/scheduler"
 	"github.com/google/gapid/gapis/service/path"
 )
@@ -56,41 +58,164 @@ func (m *Manager) batch(ctx context.Context, e []scheduler.Executable, b schedul
 	}.Bind(ctx)
 	log.I(ctx, "Replay for %d requests", len(e))
 
+	// Hold the results until the replay is done, so that the requests of a
+	// replay that crashed report the crash instead of the broken postbacks.
+	results := make([]batchResult, len(e))
 	requests := make([]RequestAndResult, len(e))
-	for i, e := range e {
+	for i := range e {
+		r := &results[i]
 		requests[i] = RequestAndResult{
-			Request: e.Task,
-			Result:  Result(e.Result),
+			Request: e[i].Task,
+			Result: func(val interface{}, err error) {
+				if !r.done {
+					r.val, r.err, r.done = val, err, true
+				}
+			},
 		}
 	}
 	batch := b.Key.(batchKey)
-	err := m.execute(ctx, batch.device, batch.capture, batch.config, batch.generator, requests)
-	if err != nil {
-		for _, e := range requests {
+	err := m.execute(ctx, batch, requests)
+	for i, e := range e {
+		r := results[i]
+		switch {
+		case r.done && r.err == nil:
+			e.Result(r.val, nil)
+		case err != nil:
 			e.Result(nil, err)
+		case r.done:
+			e.Result(nil, r.err)
+		default:
+			e.Result(nil, log.Err(ctx, nil, "Replay completed without a result for the request"))
 		}
 	}
 }
 
+// batchResult is the first result reported for a request of a batch.
+type batchResult struct {
+	val  interface{}
+	err  error
+	done bool
+}
+
+// built is a replay payload built for a replay device.
+type built struct {
+	device    bind.Device
+	intent    Intent
+	abi       *device.ABI
+	payload   protocol.Payload
+	decoder   builder.ResponseDecoder
+	functions []builder.FunctionInfo
+	// ended receives the result of the postback at the end of the payload, or
+	// is nil if the payload has none.
+	ended <-chan error
+	// cmds are the identifiers of the capture commands written to the
+	// payload, in ascending order.
+	cmds []api.CmdID
+}
+
 func (m *Manager) execute(
 	ctx context.Context,
-	deviceID, captureID id.ID,
-	cfg Config,
-	generator Generator,
+	key batchKey,
 	requests []RequestAndResult) error {
 
 	executeCounter.Increment()
 
+	b, err := m.build(ctx, key, requests, buildOptions{
+		last:        api.CmdNoID,
+		cachePrefix: true,
+		endOfReplay: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	crashed, err := m.send(ctx, key, b)
+	if crashed {
+		return m.crashed(ctx, key, requests, b.cmds, err)
+	}
+	return err
+}
+
+// send sends the built payload b, which must end with the end of replay
+// postback, to the replay device and waits for the replay to finish. crashed is true if the replay device closed the connection
+// before reaching the end of the payload.
+func (m *Manager) send(ctx context.Context, key batchKey, b *built) (crashed bool, err error) {
+	ctx = log.V{
+		"capture": key.capture,
+		"device":  b.device.Instance().GetName(),
+	}.Bind(ctx)
+
+	connection, err := m.connect(ctx, b.device, b.abi)
+	if err != nil {
+		return false, log.Err(ctx, err, "Failed to connect to device")
+	}
+	defer connection.Close()
+
+	if config.DebugReplay {
+		log.I(ctx, "Sending payload")
+	}
+
+	if Events.OnReplay != nil {
+		Events.OnReplay(b.device, b.intent, key.config)
+	}
+
+	t0 := executeTimer.Start()
+	err = executor.Execute(
+		ctx,
+		b.payload,
+		b.decoder,
+		connection,
+		connection.Version,
+		b.abi.MemoryLayout,
+	)
+	executeTimer.Stop(t0)
+
+	// The postbacks are always decoded once Execute returns. A replay that
+	// was cancelled or preempted didn't crash.
+	_, lost := err.(executor.CommunicationError)
+	if endErr := <-b.ended; endErr != nil && (err == nil || lost) && !task.Stopped(ctx) {
+		if err == nil {
+			err = endErr
+		}
+		return true, err
+	}
+	return false, err
+}
+
+// buildOptions controls how the replay payloads are built.
+type buildOptions struct {
+	// last is the command after which the replay is terminated, or
+	// api.CmdNoID to replay all the commands.
+	last api.CmdID
+	// cachePrefix enables resuming from the prefix of the last replay built
+	// for the same batch key, and storing the prefix of this replay.
+	cachePrefix bool
+	// endOfReplay appends the end of replay postback to the payload, which is
+	// required to detect crashes.
+	endOfReplay bool
+}
+
+// build generates and builds the replay payload for the requests of the batch
+// key, without sending it to the device.
+func (m *Manager) build(
+	ctx context.Context,
+	key batchKey,
+	requests []RequestAndResult,
+	opts buildOptions) (*built, error) {
+
+	deviceID, captureID := key.device, key.capture
+	cfg, generator := key.config, key.generator
+
 	devicePath := path.NewDevice(deviceID)
 	d := bind.GetRegistry(ctx).Device(deviceID)
 	if d == nil {
-		return log.Errf(ctx, nil, "Unknown device %v", deviceID)
+		return nil, log.Errf(ctx, nil, "Unknown device %v", deviceID)
 	}
 
 	capturePath := path.NewCapture(captureID)
 	c, err := capture.ResolveFromPath(ctx, capturePath)
 	if err != nil {
-		return log.Err(ctx, err, "Failed to load capture")
+		return nil, log.Err(ctx, err, "Failed to load capture")
 	}
 
 	ctx = capture.Put(ctx, capturePath)
@@ -106,7 +231,7 @@ func (m *Manager) execute(
 
 	deviceABIs := d.Instance().GetConfiguration().GetABIs()
 	if len(deviceABIs) == 0 {
-		return log.Err(ctx, nil, "Replay device doesn't list any ABIs")
+		return nil, log.Err(ctx, nil, "Replay device doesn't list any ABIs")
 	}
 
 	replayABI := findABI(cml, deviceABIs)
@@ -116,11 +241,16 @@ func (m *Manager) execute(
 	}
 	ctx = log.V{"replay target ABI": replayABI}.Bind(ctx)
 
-	builder := builder.New(replayABI.MemoryLayout)
+	var out *adapter
+	if opts.cachePrefix {
+		out = newAdapter(c.NewState(), builder.New(replayABI.MemoryLayout), m.prefixes.get(key))
+	} else {
+		out = newUncachedAdapter(c.NewState(), builder.New(replayABI.MemoryLayout))
+	}
 
-	out := &adapter{
-		state:   c.NewState(),
-		builder: builder,
+	var w transform.Writer = out
+	if opts.last != api.CmdNoID {
+		w = terminateAfter(ctx, c, opts.last, out)
 	}
 
 	t0 := generatorReplayTimer.Start()
@@ -131,46 +261,46 @@ func (m *Manager) execute(
 		requests,
 		d.Instance(),
 		c,
-		out); err != nil {
-		return log.Err(ctx, err, "Replay returned error")
+		w); err != nil {
+		return nil, log.Err(ctx, err, "Replay returned error")
 	}
 	generatorReplayTimer.Stop(t0)
 
+	out.finish(ctx)
+	if opts.cachePrefix {
+		m.prefixes.put(key, out.written)
+	}
+	var end *endOfReplay
+	if opts.endOfReplay {
+		end = postEndOfReplay(out.builder)
+	}
+
 	if config.DebugReplay {
 		log.I(ctx, "Building payload...")
 	}
 
 	t0 = builderBuildTimer.Start()
-	payload, decoder, err := builder.Build(ctx)
+	payload, decoder, err := out.builder.Build(ctx)
 	if err != nil {
-		return log.Err(ctx, err, "Failed to build replay payload")
+		return nil, log.Err(ctx, err, "Failed to build replay payload")
 	}
 	builderBuildTimer.Stop(t0)
 
-	connection, err := m.gapir.Connect(ctx, d, replayABI)
-	if err != nil {
-		return log.Err(ctx, err, "Failed to connect to device")
+	var ended <-chan error
+	if end != nil {
+		decoder, ended = end.watch(decoder), end.ended
 	}
-	defer connection.Close()
 
-	if config.DebugReplay {
-		log.I(ctx, "Sending payload")
-	}
-
-	if Events.OnReplay != nil {
-		Events.OnReplay(d, intent, cfg)
-	}
-
-	t0 = executeTimer.Start()
-	err = executor.Execute(
-		ctx,
-		payload,
-		decoder,
-		connection,
-		replayABI.MemoryLayout,
-	)
-	executeTimer.Stop(t0)
-	return err
+	return &built{
+		device:    d,
+		intent:    intent,
+		abi:       replayABI,
+		payload:   payload,
+		decoder:   decoder,
+		functions: out.builder.Functions(),
+		ended:     ended,
+		cmds:      out.written.ids(),
+	}, nil
 }
 
 // adapter conforms to the the atom Writer interface, performing replay writes
@@ -178,6 +308,12 @@ func (m *Manager) execute(
 type adapter struct {
 	state   *api.State
 	builder *builder.Builder
+	cached  *prefix // The prefix of the last replay built for the same batch.
+	written *prefix // The prefix of this replay.
+	// matching is true while the commands written are the same as the first
+	// commands of cached. While matching, the commands only mutate the state.
+	matching bool
+	matched  int // The number of commands matched.
 }
 
 func (w *adapter) State() *api.State {
@@ -185,11 +321,26 @@ func (w *adapter) State() *api.State {
 }
 
 func (w *adapter) MutateAndWrite(ctx context.Context, id api.CmdID, cmd api.Cmd) {
-	w.builder.BeginAtom(uint64(id))
-	if err := cmd.Mutate(ctx, w.state, w.builder); err == nil {
-		w.builder.CommitAtom()
+	w.written.cmds = append(w.written.cmds, prefixCmd{id, cmd})
+	if w.matching {
+		if w.cached.matches(w.matched, id, cmd) {
+			w.matched++
+			cmd.Mutate(ctx, w.state, nil)
+			return
+		}
+		w.resume(ctx)
+	}
+	write(ctx, w.state, w.builder, id, cmd)
+	w.written.snapshot(w.builder, w.state)
+}
+
+// write mutates s with cmd, writing the replay instructions to b.
+func write(ctx context.Context, s *api.State, b *builder.Builder, id api.CmdID, cmd api.Cmd) {
+	b.BeginAtom(uint64(id))
+	if err := cmd.Mutate(ctx, s, b); err == nil {
+		b.CommitAtom()
 	} else {
-		w.builder.RevertAtom(err)
+		b.RevertAtom(err)
 		log.W(ctx, "Failed to write command %v (%T) for replay: %v", id, cmd, err)
 	}
 }
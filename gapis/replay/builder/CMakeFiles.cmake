@@ -25,6 +25,7 @@ set(files
     constant_encoder_test.go
     function_info.go
     mapped_memory_range.go
+    snapshot.go
 )
 set(dirs
     
@@ -20,6 +20,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
 
 	"github.com/google/gapid/core/data/binary"
 	"github.com/google/gapid/core/data/endian"
@@ -66,6 +68,7 @@ type Builder struct {
 	heap, temp      allocator
 	resourceIDToIdx map[id.ID]uint32
 	resources       []protocol.ResourceInfo
+	functions       map[uint32]FunctionInfo
 	reservedMemory  memory.RangeList // Reserved memory ranges for regular data.
 	pointerMemory   memory.RangeList // Reserved memory ranges for the pointer table.
 	mappedMemory    mappedMemoryRangeList
@@ -94,6 +97,7 @@ func New(memoryLayout *device.MemoryLayout) *Builder {
 		temp:            allocator{alignment: ptrAlignment},
 		resourceIDToIdx: map[id.ID]uint32{},
 		resources:       []protocol.ResourceInfo{},
+		functions:       map[uint32]FunctionInfo{},
 		reservedMemory:  memory.RangeList{},
 		pointerMemory:   memory.RangeList{},
 		mappedMemory:    mappedMemoryRangeList{},
@@ -347,6 +351,7 @@ func (b *Builder) String(s string) value.Pointer {
 // function will be pushed on to the stack.
 func (b *Builder) Call(f FunctionInfo) {
 	b.popStackMulti(f.Parameters)
+	b.functions[f.key()] = f
 	push := f.ReturnType != protocol.Type_Void
 	if push {
 		b.pushStack(f.ReturnType)
@@ -358,6 +363,17 @@ func (b *Builder) Call(f FunctionInfo) {
 	})
 }
 
+// Functions returns the information of all the functions that have been
+// called with Call, ordered by API index and function identifier.
+func (b *Builder) Functions() []FunctionInfo {
+	out := make([]FunctionInfo, 0, len(b.functions))
+	for _, f := range b.functions {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].key() < out[j].key() })
+	return out
+}
+
 // Copy pops the target address and then the source address from the top of the
 // stack, and then copies Count bytes from source to target.
 func (b *Builder) Copy(size uint64) {
@@ -591,6 +607,11 @@ func (b *Builder) Build(ctx context.Context) (protocol.Payload, ResponseDecoder,
 					d = nil
 				}
 			}
+			if r != nil {
+				// Drain the postbacks left by a failed decoder, which would
+				// otherwise block the replay.
+				io.Copy(ioutil.Discard, r)
+			}
 		}()
 	}
 	return payload, responseDecoder, nil
@@ -40,7 +40,7 @@ func TestCommitAtom(t *testing.T) {
 			func(b *Builder) {
 				b.BeginAtom(10)
 				b.Push(value.U8(1))
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 1})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 1, ""})
 				b.Store(value.AbsolutePointer(0x10000))
 				b.CommitAtom()
 			},
@@ -56,7 +56,7 @@ func TestCommitAtom(t *testing.T) {
 			func(b *Builder) {
 				b.BeginAtom(10)
 				b.Push(value.U8(1))
-				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1})
+				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1, ""})
 				b.CommitAtom()
 			},
 			[]asm.Instruction{
@@ -93,7 +93,7 @@ func TestCommitAtom(t *testing.T) {
 			"Unused clone",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0, ""})
 				b.Clone(0)
 				b.CommitAtom()
 			},
@@ -107,7 +107,7 @@ func TestCommitAtom(t *testing.T) {
 			"Unused clone",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 0})
+				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 0, ""})
 				b.Clone(0)
 				b.Store(value.AbsolutePointer(0x10000))
 				b.CommitAtom()
@@ -123,7 +123,7 @@ func TestCommitAtom(t *testing.T) {
 			"Unused clone of return value",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0, ""})
 				b.Clone(0)
 				b.CommitAtom()
 			},
@@ -138,9 +138,9 @@ func TestCommitAtom(t *testing.T) {
 			"Use one of three return values",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0})
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0})
-				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0, ""})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0, ""})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Uint8, 0, ""})
 				b.Clone(1)
 				b.Store(value.AbsolutePointer(0x10000))
 				b.CommitAtom()
@@ -173,7 +173,7 @@ func TestRevertAtom(t *testing.T) {
 			func(b *Builder) {
 				b.BeginAtom(10)
 				b.Push(value.U8(1))
-				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1})
+				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1, ""})
 				b.Store(value.AbsolutePointer(0x10000))
 				b.RevertAtom(nil)
 			},
@@ -184,12 +184,12 @@ func TestRevertAtom(t *testing.T) {
 			func(b *Builder) {
 				b.BeginAtom(10)
 				b.Push(value.U8(1))
-				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1})
+				b.Call(FunctionInfo{1, 123, protocol.Type_Uint8, 1, ""})
 				b.Store(value.AbsolutePointer(0x10000))
 				b.CommitAtom()
 				b.BeginAtom(20)
 				b.Push(value.U8(2))
-				b.Call(FunctionInfo{1, 234, protocol.Type_Uint8, 1})
+				b.Call(FunctionInfo{1, 234, protocol.Type_Uint8, 1, ""})
 				b.Store(value.AbsolutePointer(0x10000))
 				b.RevertAtom(nil)
 			},
@@ -253,7 +253,7 @@ func TestMapMemory(t *testing.T) {
 			func(b *Builder) {
 				b.BeginAtom(10)
 				b.Push(value.ObservedPointer(0x100004))
-				b.Call(FunctionInfo{0, 123, protocol.Type_VolatilePointer, 1})
+				b.Call(FunctionInfo{0, 123, protocol.Type_VolatilePointer, 1, ""})
 				b.CommitAtom()
 			},
 			[]asm.Instruction{
@@ -266,13 +266,13 @@ func TestMapMemory(t *testing.T) {
 			"MapMemory",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{0, 100, protocol.Type_AbsolutePointer, 0})
+				b.Call(FunctionInfo{0, 100, protocol.Type_AbsolutePointer, 0, ""})
 				b.MapMemory(memory.Range{Base: 0x100000, Size: 0x10})
 				b.CommitAtom()
 
 				b.BeginAtom(20)
 				b.Push(value.ObservedPointer(0x100004))
-				b.Call(FunctionInfo{0, 123, protocol.Type_Void, 1})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Void, 1, ""})
 				b.CommitAtom()
 			},
 			[]asm.Instruction{
@@ -291,7 +291,7 @@ func TestMapMemory(t *testing.T) {
 			"UnmapMemory",
 			func(b *Builder) {
 				b.BeginAtom(10)
-				b.Call(FunctionInfo{0, 100, protocol.Type_AbsolutePointer, 0})
+				b.Call(FunctionInfo{0, 100, protocol.Type_AbsolutePointer, 0, ""})
 				b.MapMemory(memory.Range{Base: 0x100000, Size: 0x10})
 				b.CommitAtom()
 
@@ -301,7 +301,7 @@ func TestMapMemory(t *testing.T) {
 
 				b.BeginAtom(30)
 				b.Push(value.ObservedPointer(0x100004))
-				b.Call(FunctionInfo{0, 123, protocol.Type_Void, 1})
+				b.Call(FunctionInfo{0, 123, protocol.Type_Void, 1, ""})
 				b.CommitAtom()
 			},
 			[]asm.Instruction{
@@ -323,3 +323,49 @@ func TestMapMemory(t *testing.T) {
 		assert.With(ctx).ThatSlice(b.instructions).Equals(test.expected)
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	ctx := log.Testing(t)
+	first := func(b *Builder) {
+		b.BeginAtom(10)
+		b.Push(b.String("first"))
+		b.Call(FunctionInfo{0, 123, protocol.Type_Void, 1, ""})
+		b.CommitAtom()
+	}
+	second := func(b *Builder, s string) {
+		b.BeginAtom(20)
+		b.Push(b.String(s))
+		b.Call(FunctionInfo{0, 234, protocol.Type_Void, 1, ""})
+		b.CommitAtom()
+	}
+	build := func(b *Builder) protocol.Payload {
+		payload, _, err := b.Build(ctx)
+		assert.For(ctx, "Build").ThatError(err).Succeeded()
+		return payload
+	}
+
+	expected := New(device.Little32)
+	first(expected)
+	second(expected, "second")
+
+	b := New(device.Little32)
+	first(b)
+	snapshot := b.Snapshot()
+	if !assert.For(ctx, "Snapshot").That(snapshot).IsNotNil() {
+		return
+	}
+	// Diverge from the snapshot before resuming from it.
+	second(b, "other")
+
+	for i := 0; i < 2; i++ {
+		resumed := snapshot.Builder()
+		second(resumed, "second")
+		assert.For(ctx, "resumed payload").That(build(resumed)).DeepEquals(build(expected))
+	}
+
+	b.BeginAtom(30)
+	assert.For(ctx, "Snapshot in atom").That(b.Snapshot()).IsNil()
+	b.CommitAtom()
+	b.Post(value.AbsolutePointer(0x10000), 4, func(binary.Reader, error) error { return nil })
+	assert.For(ctx, "Snapshot after post").That(b.Snapshot()).IsNil()
+}
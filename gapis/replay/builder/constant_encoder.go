@@ -44,6 +44,18 @@ func newConstantEncoder(memoryLayout *device.MemoryLayout) *constantEncoder {
 	}
 }
 
+// clone returns a copy of the encoder that can be modified without affecting
+// e.
+func (e *constantEncoder) clone(memoryLayout *device.MemoryLayout) *constantEncoder {
+	out := newConstantEncoder(memoryLayout)
+	for k, v := range e.constantMap {
+		out.constantMap[k] = v
+	}
+	// data is only ever appended to, so it can be shared until the next append.
+	out.data = e.data[:len(e.data):len(e.data)]
+	return out
+}
+
 func (e *constantEncoder) writeValues(v ...value.Value) value.Pointer {
 	if len(v) == 0 {
 		panic("Cannot write an empty list of values!")
@@ -23,4 +23,10 @@ type FunctionInfo struct {
 	ID         uint16        // The unique identifier for the function.
 	ReturnType protocol.Type // The returns type of the function.
 	Parameters int           // The number of parameters for the function.
+	Name       string        // The name of the function, used for diagnostics.
+}
+
+// key returns the identifier of the function that is unique across all APIs.
+func (f FunctionInfo) key() uint32 {
+	return uint32(f.ApiIndex)<<16 | uint32(f.ID)
 }
@@ -0,0 +1,72 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+// Snapshot is a copy of the state of a Builder between two atoms, from which
+// building can be resumed any number of times.
+type Snapshot struct {
+	b *Builder
+}
+
+// Snapshot returns a snapshot of the builder, or nil if the builder cannot be
+// snapshot. This is the case between BeginAtom and CommitAtom or RevertAtom,
+// and once data has been posted back, as the decoders of the postbacks belong
+// to the replay being built.
+func (b *Builder) Snapshot() *Snapshot {
+	if b.inAtom || len(b.stack) > 0 || len(b.decoders) > 0 {
+		return nil
+	}
+	return &Snapshot{b.clone()}
+}
+
+// Builder returns a new Builder that resumes building from the snapshot.
+func (s *Snapshot) Builder() *Builder {
+	return s.b.clone()
+}
+
+// clone returns a copy of the builder that can be modified without affecting
+// b. The stack and the postback decoders are not copied.
+func (b *Builder) clone() *Builder {
+	out := *b
+	out.constantMemory = b.constantMemory.clone(b.memoryLayout)
+	out.resourceIDToIdx = make(map[id.ID]uint32, len(b.resourceIDToIdx))
+	for k, v := range b.resourceIDToIdx {
+		out.resourceIDToIdx[k] = v
+	}
+	out.functions = make(map[uint32]FunctionInfo, len(b.functions))
+	for k, v := range b.functions {
+		out.functions[k] = v
+	}
+	out.Remappings = make(map[interface{}]value.Pointer, len(b.Remappings))
+	for k, v := range b.Remappings {
+		out.Remappings[k] = v
+	}
+	// Outside of an atom, the instructions and resources are only modified by
+	// appending, so they can be shared until the next append.
+	out.instructions = b.instructions[:len(b.instructions):len(b.instructions)]
+	out.resources = b.resources[:len(b.resources):len(b.resources)]
+	out.reservedMemory = append(memory.RangeList{}, b.reservedMemory...)
+	out.pointerMemory = append(memory.RangeList{}, b.pointerMemory...)
+	out.mappedMemory = append(mappedMemoryRangeList{}, b.mappedMemory...)
+	out.decoders = nil
+	out.stack = nil
+	return &out
+}
@@ -24,6 +24,10 @@ type contextMgrKeyTy string
 
 const contextMgrKey = contextMgrKeyTy("replayMgrID")
 
+type contextRunKeyTy string
+
+const contextRunKey = contextRunKeyTy("replayRun")
+
 // PutManager attaches a manager to a Context.
 func PutManager(ctx context.Context, m *Manager) context.Context {
 	return keys.WithValue(ctx, contextMgrKey, m)
@@ -38,3 +42,17 @@ func GetManager(ctx context.Context) *Manager {
 	}
 	return val.(*Manager)
 }
+
+// PutRun attaches a replay run index to a Context. Replay requests made with
+// contexts holding different run indices are never batched together, and each
+// run has its payload built and replayed independently of the other runs.
+func PutRun(ctx context.Context, run uint32) context.Context {
+	return keys.WithValue(ctx, contextRunKey, run)
+}
+
+// getRun returns the replay run index attached to ctx by PutRun, or 0 if the
+// context has no run index.
+func getRun(ctx context.Context) uint32 {
+	run, _ := ctx.Value(contextRunKey).(uint32)
+	return run
+}
@@ -0,0 +1,239 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/gapid/core/app/benchmark"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+// endOfReplayCode is the value posted back at the end of every replay.
+const endOfReplayCode = uint32(0x600dcafe)
+
+// errIncompleteReplay is the error of a replay that ended before the end of
+// its payload.
+const errIncompleteReplay = fault.Const("Replay ended before the end of the payload")
+
+// maxCrashes is the maximum number of crashing commands remembered by the
+// replay manager.
+const maxCrashes = 256
+
+var (
+	crashCounter          = benchmark.GlobalCounters.Integer("replay.crashes")
+	crashBisectionCounter = benchmark.GlobalCounters.Integer("replay.crashBisectionReplays")
+)
+
+// ErrCrashed is the error returned to the requests of a replay that crashed
+// the replay device.
+type ErrCrashed struct {
+	// Command is the first command of the capture whose inclusion crashes the
+	// replay, or api.CmdNoID if the crash couldn't be attributed to a command.
+	Command api.CmdID
+	// Cause is the error raised by the replay that crashed.
+	Cause error
+}
+
+func (e *ErrCrashed) Error() string {
+	if e.Command == api.CmdNoID {
+		return fmt.Sprintf("Replay device crashed: %v", e.Cause)
+	}
+	return fmt.Sprintf("Replay device crashed at command %d: %v", e.Command, e.Cause)
+}
+
+// endOfReplay is the postback at the end of a replay, used to detect the
+// replays that end before reaching it.
+type endOfReplay struct {
+	// ended receives errIncompleteReplay if the postbacks ended before the
+	// end of replay postback, or nil otherwise.
+	ended chan error
+	// closed is set once reading the postbacks failed, which happens when the
+	// replay device closed the connection. It is only accessed by the
+	// decoders of the postbacks, which run one after the other.
+	closed bool
+}
+
+// postEndOfReplay appends the end of replay postback to the replay built by
+// b. The postbacks of the replay must be decoded by a decoder returned by
+// watch.
+func postEndOfReplay(b *builder.Builder) *endOfReplay {
+	e := &endOfReplay{ended: make(chan error, 1)}
+	b.BeginAtom(uint64(api.CmdNoID))
+	b.Push(value.U32(endOfReplayCode))
+	b.Post(b.Buffer(1), 4, func(r binary.Reader, err error) error {
+		if err == nil {
+			if code := r.Uint32(); r.Error() != nil {
+				err = r.Error()
+			} else if code != endOfReplayCode {
+				err = fmt.Errorf("Unexpected end of replay code: 0x%x", code)
+			}
+		}
+		// An error of the decoder of an earlier postback is passed on to this
+		// one, and only means that the replay device crashed if the postbacks
+		// ended early.
+		if err != nil && e.closed {
+			e.ended <- errIncompleteReplay
+		} else {
+			e.ended <- nil
+		}
+		return err
+	})
+	b.CommitAtom()
+	return e
+}
+
+// watch returns the decoder d, reading the postbacks through a reader that
+// records when they end.
+func (e *endOfReplay) watch(d builder.ResponseDecoder) builder.ResponseDecoder {
+	return func(r io.Reader, err error) {
+		if r != nil {
+			r = closedReader{r, &e.closed}
+		}
+		d(r, err)
+	}
+}
+
+// closedReader is a reader that sets closed once reading r fails.
+type closedReader struct {
+	r      io.Reader
+	closed *bool
+}
+
+func (r closedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		*r.closed = true
+	}
+	return n, err
+}
+
+// terminateAfter returns a writer to out that drops all the commands of the
+// capture c that come after the command last, along with the commands
+// generated after it.
+func terminateAfter(ctx context.Context, c *capture.Capture, last api.CmdID, out transform.Writer) transform.Writer {
+	for _, a := range c.APIs {
+		t := transform.NewEarlyTerminator(a.ID())
+		t.Add(ctx, last, nil)
+		s := out.State()
+		if config.SeparateMutateStates {
+			s = api.NewStateWithAllocator(s.Allocator, s.MemoryLayout)
+		}
+		out = transform.TransformWriter{S: s, T: t, O: out}
+	}
+	return out
+}
+
+// crashed returns the error to report to the requests of the replay of the
+// batch key that crashed the replay device with the error cause. cmds are the
+// identifiers of the capture commands written to the replay that crashed.
+// The first command whose inclusion crashes the replay device is found by
+// bisection, once per batch key.
+func (m *Manager) crashed(ctx context.Context, key batchKey, requests []RequestAndResult, cmds []api.CmdID, cause error) error {
+	crashCounter.Increment()
+	log.E(ctx, "Replay device crashed: %v", cause)
+
+	m.mutex.Lock()
+	id, found := m.crashes[key]
+	m.mutex.Unlock()
+
+	if !found {
+		var err error
+		if id, err = m.bisectCrash(ctx, key, requests, cmds); err == nil {
+			m.mutex.Lock()
+			if len(m.crashes) >= maxCrashes {
+				m.crashes = map[batchKey]api.CmdID{}
+			}
+			m.crashes[key] = id
+			m.mutex.Unlock()
+		} else {
+			log.W(ctx, "Couldn't find the command crashing the replay: %v", err)
+			id = api.CmdNoID
+		}
+	}
+	return &ErrCrashed{Command: id, Cause: cause}
+}
+
+// bisectCrash returns the first of the commands cmds whose inclusion crashes
+// the replay of the batch key, by replaying successively smaller prefixes of
+// the commands. api.CmdNoID is returned if the replay only crashes in the
+// commands generated after the last command of the capture.
+func (m *Manager) bisectCrash(ctx context.Context, key batchKey, requests []RequestAndResult, cmds []api.CmdID) (api.CmdID, error) {
+	if len(cmds) == 0 {
+		return api.CmdNoID, nil
+	}
+
+	// The results of the bisection replays are ignored.
+	ignored := make([]RequestAndResult, len(requests))
+	for i, r := range requests {
+		ignored[i] = RequestAndResult{
+			Request: r.Request,
+			Result:  func(val interface{}, err error) {},
+		}
+	}
+
+	crashes := func(i int) (bool, error) {
+		if task.Stopped(ctx) {
+			return false, task.StopReason(ctx)
+		}
+		crashBisectionCounter.Increment()
+		ctx := log.V{"bisection": cmds[i]}.Bind(ctx)
+		// The prefix cache is left to the complete replays, which the
+		// truncated bisection replays would evict.
+		b, err := m.build(ctx, key, ignored, buildOptions{last: cmds[i], endOfReplay: true})
+		if err != nil {
+			return false, err
+		}
+		crashed, err := m.send(ctx, key, b)
+		if err != nil && !crashed {
+			return false, err
+		}
+		log.I(ctx, "Replay up to command %v crashed: %v", cmds[i], crashed)
+		return crashed, nil
+	}
+
+	// lo is the index of the last prefix that doesn't crash and hi the index of
+	// the first prefix that crashes.
+	lo, hi := -1, len(cmds)-1
+	if crashed, err := crashes(hi); err != nil {
+		return api.CmdNoID, err
+	} else if !crashed {
+		return api.CmdNoID, nil
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		crashed, err := crashes(mid)
+		if err != nil {
+			return api.CmdNoID, err
+		}
+		if crashed {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	log.E(ctx, "Replay device crashes at command %v", cmds[hi])
+	return cmds[hi], nil
+}
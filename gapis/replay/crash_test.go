@@ -0,0 +1,254 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/os/device/bind"
+	gapir "github.com/google/gapid/gapir/client"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/opcode"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/replay/value"
+	"github.com/google/gapid/gapis/replay/vm"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	errTestCrash    = fault.Const("Crashed")
+	errTestPostback = fault.Const("Postback failed")
+)
+
+var funcInfoCrash = builder.FunctionInfo{ApiIndex: 1, ID: 1, ReturnType: protocol.Type_Void, Parameters: 1, Name: "crash"}
+
+// crashCmd calls the crash function with the identifier of the command.
+type crashCmd struct {
+	testcmd.X
+	id api.CmdID
+}
+
+func (c *crashCmd) Mutate(ctx context.Context, s *api.State, b *builder.Builder) error {
+	if b != nil {
+		b.Push(value.U32(c.id))
+		b.Call(funcInfoCrash)
+	}
+	return nil
+}
+
+// crashGenerator replays each command of the capture as a crashCmd.
+type crashGenerator struct{}
+
+func (crashGenerator) Replay(
+	ctx context.Context,
+	intent Intent,
+	cfg Config,
+	requests []RequestAndResult,
+	device *device.Instance,
+	c *capture.Capture,
+	out transform.Writer) error {
+
+	for i := range c.Commands {
+		id := api.CmdID(i)
+		out.MutateAndWrite(ctx, id, &crashCmd{id: id})
+	}
+	return nil
+}
+
+// newCrashTest returns a manager replaying on a virtual machine that crashes
+// when the command crashAt is replayed, along with the key of a batch
+// replaying a capture of count commands with the crashGenerator.
+func newCrashTest(ctx context.Context, count int, crashAt api.CmdID) (context.Context, *Manager, batchKey) {
+	abi := device.WindowsX86_64
+	d := &bind.Simple{To: &device.Instance{
+		Id:            device.NewID(id.ID{1}),
+		Configuration: &device.Configuration{ABIs: []*device.ABI{abi}},
+	}}
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	bind.GetRegistry(ctx).AddDevice(ctx, d)
+
+	cmds := make([]api.Cmd, count)
+	for i := range cmds {
+		cmds[i] = &testcmd.X{}
+	}
+	p, err := capture.New(ctx, "test", &capture.Header{Abi: abi}, cmds)
+	if err != nil {
+		log.F(ctx, "Couldn't create capture: %v", err)
+	}
+
+	functions := vm.Functions{}
+	functions.Register(funcInfoCrash, func(ctx context.Context, m *vm.VM, pushReturn bool) error {
+		id, err := m.Stack.PopType(protocol.Type_Uint32)
+		if err != nil {
+			return err
+		}
+		if api.CmdID(id) == crashAt {
+			return errTestCrash
+		}
+		return nil
+	})
+
+	m := &Manager{
+		connect: func(ctx context.Context, d bind.Device, abi *device.ABI) (*gapir.Connection, error) {
+			client, server := net.Pipe()
+			go vm.Serve(ctx, server, abi.MemoryLayout, functions, nil)
+			return &gapir.Connection{ReadWriteCloser: client, Version: protocol.MaxVersion}, nil
+		},
+		crashes:  map[batchKey]api.CmdID{},
+		prefixes: newPrefixCache(),
+	}
+	key := batchKey{
+		capture:   p.Id.ID(),
+		device:    d.Instance().Id.ID(),
+		generator: crashGenerator{},
+	}
+	return ctx, m, key
+}
+
+// failedPostCmd posts back a value whose decoder fails.
+type failedPostCmd struct{ testcmd.X }
+
+func (c *failedPostCmd) Mutate(ctx context.Context, s *api.State, b *builder.Builder) error {
+	if b != nil {
+		b.Push(value.U32(1))
+		b.Post(b.Buffer(1), 4, func(r binary.Reader, err error) error {
+			if err == nil {
+				err = errTestPostback
+			}
+			return err
+		})
+	}
+	return nil
+}
+
+// failedPostGenerator replays each command of the capture as a crashCmd,
+// after a failedPostCmd.
+type failedPostGenerator struct{}
+
+func (failedPostGenerator) Replay(
+	ctx context.Context,
+	intent Intent,
+	cfg Config,
+	requests []RequestAndResult,
+	device *device.Instance,
+	c *capture.Capture,
+	out transform.Writer) error {
+
+	out.MutateAndWrite(ctx, api.CmdNoID, &failedPostCmd{})
+	return crashGenerator{}.Replay(ctx, intent, cfg, requests, device, c, out)
+}
+
+func ignoredRequests() []RequestAndResult {
+	return []RequestAndResult{{Result: func(val interface{}, err error) {}}}
+}
+
+// crashLog is a log delegate that logs the errors instead of failing the
+// test, as the replay manager logs the crashes as errors.
+type crashLog struct{ *testing.T }
+
+func (l crashLog) Error(args ...interface{}) { l.Log(args...) }
+
+func TestCrashBisection(t *testing.T) {
+	ctx := log.Testing(t)
+	mctx := log.PutHandler(ctx, log.TestHandler(crashLog{t}, log.Normal))
+	mctx = database.Put(mctx, database.NewInMemory(mctx))
+
+	const count = 37
+	for _, crashAt := range []api.CmdID{0, 1, 17, count - 1} {
+		ctx := log.V{"crashAt": crashAt}.Bind(ctx)
+		mctx, m, key := newCrashTest(mctx, count, crashAt)
+
+		err := m.execute(mctx, key, ignoredRequests())
+		crash, ok := err.(*ErrCrashed)
+		if !assert.For(ctx, "crashed").That(ok).Equals(true) {
+			continue
+		}
+		assert.For(ctx, "command").That(crash.Command).Equals(crashAt)
+
+		// The bisection replays didn't replace the prefix of the replay.
+		if p := m.prefixes.get(key); assert.For(ctx, "prefix").That(p).IsNotNil() {
+			assert.For(ctx, "prefix commands").ThatSlice(p.ids()).IsLength(count)
+		}
+	}
+
+	mctx, m, key := newCrashTest(mctx, count, api.CmdNoID)
+	assert.For(ctx, "no crash").ThatError(m.execute(mctx, key, ignoredRequests())).Succeeded()
+}
+
+func TestFailedPostbackIsNotCrash(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	for _, crashAt := range []api.CmdID{api.CmdNoID, 2} {
+		ctx := log.V{"crashAt": crashAt}.Bind(ctx)
+		mctx := log.PutHandler(ctx, log.TestHandler(crashLog{t}, log.Normal))
+		mctx, m, key := newCrashTest(mctx, 4, crashAt)
+		key.generator = failedPostGenerator{}
+
+		// The crash can't be detected once a postback failed, as the
+		// postbacks that follow are not decoded.
+		err := m.execute(mctx, key, ignoredRequests())
+		_, crashed := err.(*ErrCrashed)
+		assert.For(ctx, "crashed").That(crashed).Equals(false)
+		assert.For(ctx, "crashes").That(len(m.crashes)).Equals(0)
+	}
+}
+
+func TestDumpWithoutEndOfReplay(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	ctx, m, key := newCrashTest(ctx, 4, api.CmdNoID)
+
+	// posts returns the number of postbacks of the payload of b.
+	posts := func(b *built) int {
+		ops, err := opcode.Disassemble(bytes.NewReader(b.payload.Opcodes), device.LittleEndian)
+		assert.For(ctx, "Disassemble").ThatError(err).Succeeded()
+		count := 0
+		for _, op := range ops {
+			if _, ok := op.(opcode.Post); ok {
+				count++
+			}
+		}
+		return count
+	}
+
+	replayed, err := m.build(ctx, key, ignoredRequests(), buildOptions{last: api.CmdNoID, endOfReplay: true})
+	if assert.For(ctx, "build").ThatError(err).Succeeded() {
+		assert.For(ctx, "replay postbacks").That(posts(replayed)).Equals(1)
+	}
+
+	intent := Intent{Device: path.NewDevice(key.device), Capture: path.NewCapture(key.capture)}
+	d, err := m.Dump(ctx, func(ctx context.Context) error {
+		_, err := m.Replay(ctx, intent, nil, nil, crashGenerator{}, nil)
+		return err
+	})
+	if assert.For(ctx, "Dump").ThatError(err).Succeeded() {
+		assert.For(ctx, "dump postbacks").That(posts(&built{payload: d.Payload})).Equals(0)
+	}
+}
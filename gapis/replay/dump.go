@@ -0,0 +1,102 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+type contextDumpKeyTy string
+
+const contextDumpKey = contextDumpKeyTy("replayDump")
+
+// errDumped is returned by Replay to the queries made by Dump, once the
+// payload has been built.
+const errDumped = fault.Const("Replay payload dumped")
+
+// Dump holds the payload built for a replay request, for inspection.
+type Dump struct {
+	// The payload that would have been sent to the replay device, without the
+	// end of replay postback.
+	Payload protocol.Payload
+	// The memory layout of the replay device.
+	MemoryLayout *device.MemoryLayout
+	// The ABI of the replay device.
+	ABI *device.ABI
+	// The functions called by the payload.
+	Functions []builder.FunctionInfo
+}
+
+// Dump calls query, which is expected to make a replay request to m using the
+// context it is given. Instead of being scheduled and executed on the replay
+// device, the first replay request made by query only has its payload built
+// and returned. Any further replay request fails.
+func (m *Manager) Dump(ctx context.Context, query func(ctx context.Context) error) (*Dump, error) {
+	d := &Dump{}
+	err := query(keys.WithValue(ctx, contextDumpKey, d))
+	if d.MemoryLayout != nil {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, log.Err(ctx, nil, "No replay was requested")
+}
+
+// getDump returns the Dump attached to ctx by Manager.Dump, or nil if the
+// context does not belong to a dump query.
+func getDump(ctx context.Context) *Dump {
+	d, _ := ctx.Value(contextDumpKey).(*Dump)
+	return d
+}
+
+// dump builds the payload for req into d.
+func (m *Manager) dump(
+	ctx context.Context,
+	d *Dump,
+	intent Intent,
+	cfg Config,
+	req Request,
+	generator Generator) error {
+
+	if d.MemoryLayout != nil {
+		return errDumped
+	}
+
+	requests := []RequestAndResult{{
+		Request: req,
+		Result:  func(val interface{}, err error) {},
+	}}
+	// The payload is built from scratch, as it would be without the prefix
+	// cache, and without the end of replay postback added for the replay
+	// device.
+	b, err := m.build(ctx, newBatchKey(ctx, intent, cfg, generator), requests, buildOptions{last: api.CmdNoID})
+	if err != nil {
+		return err
+	}
+	d.Payload = b.payload
+	d.MemoryLayout = b.abi.MemoryLayout
+	d.ABI = b.abi
+	d.Functions = b.functions
+	return errDumped
+}
@@ -18,6 +18,8 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    cache.go
+    cache_test.go
     executor.go
 )
 set(dirs
@@ -0,0 +1,101 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+// compressedCacheSize is the maximum size in bytes of the compressed
+// resources held by compressedResources.
+const compressedCacheSize = 64 << 20
+
+// compressedResources holds the resources compressed for the replays, so that
+// the resources sent by several replays are only compressed once.
+var compressedResources = newCompressedCache(compressedCacheSize)
+
+// compressedCache holds compressed resources by identifier and compression.
+// As resource identifiers are hashes of their data, an entry never needs to be
+// invalidated. Resources are evicted in least recently used order.
+// compressedCache is safe for concurrent use.
+type compressedCache struct {
+	mutex   sync.Mutex
+	size    uint64 // The maximum size of the cache.
+	used    uint64 // The total size of the compressed resources in the cache.
+	entries map[compressedKey]*list.Element
+	lru     list.List // Of *compressedEntry, most recently used first.
+}
+
+type compressedKey struct {
+	id          string
+	compression protocol.Compression
+}
+
+type compressedEntry struct {
+	key  compressedKey
+	data []byte
+}
+
+func newCompressedCache(size uint64) *compressedCache {
+	return &compressedCache{size: size, entries: map[compressedKey]*list.Element{}}
+}
+
+// compress returns data, the data of the resource with the given identifier,
+// compressed with compression. The compressed data is taken from the cache if
+// present, and added to it otherwise.
+func (c *compressedCache) compress(id string, data []byte, compression protocol.Compression) ([]byte, error) {
+	key := compressedKey{id, compression}
+	if out, ok := c.get(key); ok {
+		resourcesCompressCacheHitsCounter.Increment()
+		return out, nil
+	}
+	out, err := protocol.Compress(data, compression)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, out)
+	return out, nil
+}
+
+func (c *compressedCache) get(key compressedKey) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*compressedEntry).data, true
+}
+
+func (c *compressedCache) add(key compressedKey, data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; ok || uint64(len(data)) > c.size {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&compressedEntry{key, data})
+	c.used += uint64(len(data))
+	for c.used > c.size {
+		e := c.lru.Back()
+		entry := e.Value.(*compressedEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.used -= uint64(len(entry.data))
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+func TestCompressedCache(t *testing.T) {
+	ctx := log.Testing(t)
+	a, b := bytes.Repeat([]byte("a"), 1024), bytes.Repeat([]byte("b"), 1024)
+
+	compress := func(c *compressedCache, id string, data []byte) []byte {
+		out, err := c.compress(id, data, protocol.Compression_Deflate)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		got, err := protocol.Decompress(out, protocol.Compression_Deflate)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		assert.For(ctx, "data").ThatSlice(got).Equals(data)
+		return out
+	}
+
+	first := compress(newCompressedCache(1024), "A", a)
+	c := newCompressedCache(uint64(len(first)))
+
+	// The second compression of a resource is taken from the cache.
+	hits := resourcesCompressCacheHitsCounter.GetInt64()
+	compress(c, "A", a)
+	compress(c, "A", a)
+	assert.For(ctx, "hits").That(resourcesCompressCacheHitsCounter.GetInt64() - hits).Equals(int64(1))
+
+	// Adding another resource evicts the least recently used one.
+	compress(c, "B", b)
+	_, found := c.get(compressedKey{"A", protocol.Compression_Deflate})
+	assert.For(ctx, "A cached").That(found).Equals(false)
+	_, found = c.get(compressedKey{"B", protocol.Compression_Deflate})
+	assert.For(ctx, "B cached").That(found).Equals(true)
+}
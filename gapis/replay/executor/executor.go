@@ -17,11 +17,11 @@ package executor
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 
+	"github.com/google/gapid/core/app/benchmark"
 	"github.com/google/gapid/core/data/binary"
 	"github.com/google/gapid/core/data/endian"
 	"github.com/google/gapid/core/data/id"
@@ -32,53 +32,69 @@ import (
 	"github.com/google/gapid/gapis/replay/protocol"
 )
 
+// resourceCacheSize is the maximum size in bytes of the resources the replay
+// devices may cache between replays.
+const resourceCacheSize = 256 << 20
+
+var (
+	resourcesRequestedCounter         = benchmark.GlobalCounters.Integer("replay.resources.requested")
+	resourcesRequestedBytesCounter    = benchmark.GlobalCounters.Integer("replay.resources.requestedBytes")
+	resourcesSentBytesCounter         = benchmark.GlobalCounters.Integer("replay.resources.sentBytes")
+	resourcesCachedCounter            = benchmark.GlobalCounters.Integer("replay.resources.cached")
+	resourcesCachedBytesCounter       = benchmark.GlobalCounters.Integer("replay.resources.cachedBytes")
+	resourcesCompressTimer            = benchmark.GlobalCounters.Duration("replay.resources.compressDuration")
+	resourcesCompressCacheHitsCounter = benchmark.GlobalCounters.Integer("replay.resources.compressCacheHits")
+)
+
+// CommunicationError is the error returned by Execute when the communication
+// with the replay device failed during the replay, which usually happens
+// because the replay device crashed.
+type CommunicationError struct{ Err error }
+
+func (e CommunicationError) Error() string { return e.Err.Error() }
+
 type executor struct {
 	payload      protocol.Payload
 	decoder      builder.ResponseDecoder
+	version      uint32
 	memoryLayout *device.MemoryLayout
 }
 
 // Execute sends the replay payload for execution on the target replay device
-// communicating on connection.
+// communicating on connection, using the given version of the replay
+// protocol.
 // decoder will be used for decoding all postback reponses. Once a postback
 // response is decoded, the corresponding handler in the handlers map will be
-// called.
+// called. decoder is always called, even if the replay fails to start.
 func Execute(
 	ctx context.Context,
 	payload protocol.Payload,
 	decoder builder.ResponseDecoder,
 	connection io.ReadWriteCloser,
+	version uint32,
 	memoryLayout *device.MemoryLayout) error {
 
 	return executor{
 		payload:      payload,
 		decoder:      decoder,
+		version:      version,
 		memoryLayout: memoryLayout,
 	}.execute(ctx, connection)
 }
 
 func (e executor) execute(ctx context.Context, connection io.ReadWriteCloser) error {
 	// Encode the payload
-	// TODO: Make this a proto.
-	buf := &bytes.Buffer{}
-	w := endian.Writer(buf, e.memoryLayout.GetEndian())
-	w.Uint32(e.payload.StackSize)
-	w.Uint32(e.payload.VolatileMemorySize)
-	w.Uint32(uint32(len(e.payload.Constants)))
-	w.Data(e.payload.Constants)
-	w.Uint32(uint32(len(e.payload.Resources)))
-	for _, r := range e.payload.Resources {
-		w.String(r.ID)
-		w.Uint32(r.Size)
-	}
-	w.Uint32(uint32(len(e.payload.Opcodes)))
-	w.Data(e.payload.Opcodes)
-
-	data := buf.Bytes()
+	data, err := e.payload.Encode(e.version, e.memoryLayout.GetEndian())
+	if err != nil {
+		err = log.Err(ctx, err, "Failed to encode the replay payload")
+		e.decoder(nil, err)
+		return err
+	}
 
 	// Store the payload to the database
 	id, err := database.Store(ctx, data)
 	if err != nil {
+		e.decoder(nil, err)
 		return err
 	}
 
@@ -108,13 +124,16 @@ func (e executor) execute(ctx context.Context, connection io.ReadWriteCloser) er
 		log.W(ctx, "Replay execute pipe reader Close failed: %v", closeErr)
 	}
 	if err != nil {
-		return log.Err(ctx, err, "Communicating with gapir")
+		return CommunicationError{log.Err(ctx, err, "Communicating with gapir")}
 	}
 	return nil
 }
 
 func (e executor) handleReplayCommunication(ctx context.Context, connection io.ReadWriteCloser, replayID id.ID, replaySize uint32, postbacks io.WriteCloser) error {
 	defer connection.Close()
+	if e.version != protocol.Version1 {
+		return e.handleVersionedReplayCommunication(ctx, connection, replayID, replaySize, postbacks)
+	}
 	bw := bufio.NewWriter(connection)
 	br := bufio.NewReader(connection)
 	w := endian.Writer(bw, e.memoryLayout.GetEndian())
@@ -185,24 +204,49 @@ func (e executor) handleGetData(ctx context.Context, r binary.Reader, w binary.W
 		return log.Err(ctx, err, "Failed to decode total expected size")
 	}
 
-	totalReturnedSize := 0
-
-	response := make([][]byte, 0, resourceCount)
-	db := database.Get(ctx)
-	for i := uint32(0); i < resourceCount; i++ {
-		idString := r.String()
+	ids := make([]string, resourceCount)
+	for i := range ids {
+		ids[i] = r.String()
 		if r.Error() != nil {
 			return r.Error()
 		}
+	}
+
+	response, err := e.getResources(ctx, ids, totalExpectedSize)
+	if err != nil {
+		return err
+	}
 
+	resourcesRequestedCounter.AddInt64(int64(resourceCount))
+	resourcesRequestedBytesCounter.AddInt64(int64(totalExpectedSize))
+	resourcesSentBytesCounter.AddInt64(int64(totalExpectedSize))
+
+	for _, b := range response {
+		w.Data(b)
+	}
+	if err := w.Error(); err != nil {
+		return log.Errf(ctx, err, "Failed to send resources")
+	}
+
+	return nil
+}
+
+// getResources returns the data of the resources with the given identifiers,
+// checking that their total size is totalExpectedSize.
+func (e executor) getResources(ctx context.Context, ids []string, totalExpectedSize uint64) ([][]byte, error) {
+	totalReturnedSize := 0
+
+	response := make([][]byte, 0, len(ids))
+	db := database.Get(ctx)
+	for _, idString := range ids {
 		rID, err := id.Parse(idString)
 		if err != nil {
-			return log.Errf(ctx, err, "Failed to parse resource id: %v", idString)
+			return nil, log.Errf(ctx, err, "Failed to parse resource id: %v", idString)
 		}
 
 		obj, err := db.Resolve(ctx, rID)
 		if err != nil {
-			return log.Errf(ctx, err, "Failed to resolve resource with id: %v", rID)
+			return nil, log.Errf(ctx, err, "Failed to resolve resource with id: %v", rID)
 		}
 
 		data := obj.([]byte)
@@ -211,16 +255,115 @@ func (e executor) handleGetData(ctx context.Context, r binary.Reader, w binary.W
 	}
 
 	if totalExpectedSize != uint64(totalReturnedSize) {
-		return log.Errf(ctx, nil, "Total resources size mismatch. expected: %v, got: %v",
+		return nil, log.Errf(ctx, nil, "Total resources size mismatch. expected: %v, got: %v",
 			totalExpectedSize, totalReturnedSize)
 	}
 
-	for _, b := range response {
-		w.Data(b)
-	}
+	return response, nil
+}
+
+// handleVersionedReplayCommunication is the equivalent of
+// handleReplayCommunication for the versions of the protocol that frame
+// messages as protobufs.
+func (e executor) handleVersionedReplayCommunication(ctx context.Context, connection io.ReadWriteCloser, replayID id.ID, replaySize uint32, postbacks io.Writer) error {
+	bw := bufio.NewWriter(connection)
+	br := bufio.NewReader(connection)
+	w := endian.Writer(bw, device.LittleEndian)
+
+	w.Uint8(uint8(protocol.ConnectionType_VersionedReplay))
+	w.Uint32(e.version)
 	if err := w.Error(); err != nil {
-		return log.Errf(ctx, err, "Failed to send resources")
+		return err
+	}
+	req := &protocol.ReplayRequest{PayloadId: replayID.String(), PayloadSize: replaySize}
+	if e.version >= protocol.Version3 {
+		req.ResourceCacheSize = resourceCacheSize
+	}
+	if err := protocol.WriteMessage(bw, req); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
 	}
 
-	return nil
+	for {
+		msg, err := br.ReadByte()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		switch protocol.MessageType(msg) {
+		case protocol.MessageType_Get:
+			req := &protocol.GetRequest{}
+			if err := protocol.ReadMessage(br, req); err != nil {
+				return fmt.Errorf("Failed to read replay resource request: %v", err)
+			}
+			res, err := e.getResponse(ctx, req)
+			if err != nil {
+				return fmt.Errorf("Failed to send replay resource data: %v", err)
+			}
+			if err := protocol.WriteMessage(bw, res); err != nil {
+				return fmt.Errorf("Failed to send replay resource data: %v", err)
+			}
+		case protocol.MessageType_Post:
+			req := &protocol.PostRequest{}
+			if err := protocol.ReadMessage(br, req); err != nil {
+				return fmt.Errorf("Failed to read replay postback data: %v", err)
+			}
+			if _, err := postbacks.Write(req.Data); err != nil {
+				return fmt.Errorf("Failed to read replay postback data: %v", err)
+			}
+		case protocol.MessageType_Cached:
+			req := &protocol.CachedResources{}
+			if err := protocol.ReadMessage(br, req); err != nil {
+				return fmt.Errorf("Failed to read replay cached resources: %v", err)
+			}
+			resourcesCachedCounter.AddInt64(int64(len(req.Ids)))
+			resourcesCachedBytesCounter.AddInt64(int64(req.TotalSize))
+		default:
+			return fmt.Errorf("Unknown message type: %v", msg)
+		}
+
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// getResponse returns the response to the GetRequest req, compressing the
+// resources if the replay device accepts it and it reduces their size. The
+// compressed resources are cached by identifier across replays.
+func (e executor) getResponse(ctx context.Context, req *protocol.GetRequest) (*protocol.GetResponse, error) {
+	data, err := e.getResources(ctx, req.Ids, req.TotalSize)
+	if err != nil {
+		return nil, err
+	}
+	resourcesRequestedCounter.AddInt64(int64(len(req.Ids)))
+	resourcesRequestedBytesCounter.AddInt64(int64(req.TotalSize))
+
+	res := &protocol.GetResponse{Data: data}
+	if e.version >= protocol.Version3 && req.Compression != protocol.Compression_None {
+		t0 := resourcesCompressTimer.Start()
+		compressed, size := make([][]byte, len(data)), uint64(0)
+		for i, d := range data {
+			if compressed[i], err = compressedResources.compress(req.Ids[i], d, req.Compression); err != nil {
+				return nil, log.Err(ctx, err, "Failed to compress resource")
+			}
+			size += uint64(len(compressed[i]))
+		}
+		resourcesCompressTimer.Stop(t0)
+		if size < req.TotalSize {
+			res = &protocol.GetResponse{Data: compressed, Compression: req.Compression}
+		}
+	}
+
+	size := 0
+	for _, d := range res.Data {
+		size += len(d)
+	}
+	resourcesSentBytesCounter.AddInt64(int64(size))
+	return res, nil
 }
@@ -62,6 +62,30 @@ type QueryFramebufferAttachment interface {
 		hints *service.UsageHints) (*image.Data, error)
 }
 
+// QueryFragmentTests is the interface implemented by types that can report
+// whether the given draw calls generated a fragment at a single framebuffer
+// location, and whether that fragment passed the stencil and depth tests.
+// Each draw call is redrawn with a scissor rectangle isolating the pixel, so
+// the results are independent of the other geometry drawn to the framebuffer.
+type QueryFragmentTests interface {
+	QueryFragmentTests(
+		ctx context.Context,
+		intent Intent,
+		mgr *Manager,
+		draws []api.CmdID,
+		x, y uint32,
+		hints *service.UsageHints) ([]FragmentTests, error)
+}
+
+// FragmentTests holds the results of the fragment tests for a single draw call
+// at a single framebuffer location, as returned by QueryFragmentTests.
+type FragmentTests struct {
+	Command       api.CmdID // The draw call.
+	Rasterized    bool      // True if a fragment was generated for the pixel.
+	StencilPassed bool      // True if a fragment passed the stencil test.
+	DepthPassed   bool      // True if a fragment passed the stencil and depth tests.
+}
+
 // Issue represents a single replay issue reported by QueryIssues.
 type Issue struct {
 	Command  api.CmdID        // The command that reported the issue.
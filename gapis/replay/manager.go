@@ -16,16 +16,20 @@ package replay
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
-
 	"time"
 
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
 	gapir "github.com/google/gapid/gapir/client"
+	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/replay/scheduler"
 	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
 )
 
 const (
@@ -40,9 +44,14 @@ const (
 // Manager is used discover replay devices and to send replay requests to those
 // discovered devices.
 type Manager struct {
-	gapir      *gapir.Client
+	gapir *gapir.Client
+	// connect opens a connection to a replay device. It is gapir.Connect,
+	// unless replaced by tests.
+	connect    func(ctx context.Context, d bind.Device, abi *device.ABI) (*gapir.Connection, error)
 	schedulers map[id.ID]*scheduler.Scheduler
-	mutex      sync.Mutex // guards schedulers
+	crashes    map[batchKey]api.CmdID // The commands found to crash the replays.
+	mutex      sync.Mutex             // guards schedulers and crashes
+	prefixes   *prefixCache
 }
 
 // batchKey is used as a key for the batch that's being formed.
@@ -53,6 +62,21 @@ type batchKey struct {
 	device    id.ID
 	config    Config
 	generator Generator
+	// run separates the batches of otherwise identical replay requests made
+	// with contexts annotated by PutRun.
+	run uint32
+}
+
+// newBatchKey returns the key of the batch for a replay request of intent,
+// with the given config and generator, made using the context ctx.
+func newBatchKey(ctx context.Context, intent Intent, cfg Config, generator Generator) batchKey {
+	return batchKey{
+		capture:   intent.Capture.Id.ID(),
+		device:    intent.Device.Id.ID(),
+		config:    cfg,
+		generator: generator,
+		run:       getRun(ctx),
+	}
 }
 
 // New returns a new Manager instance using the database db.
@@ -60,7 +84,10 @@ func New(ctx context.Context) *Manager {
 	out := &Manager{
 		gapir:      gapir.New(ctx),
 		schedulers: make(map[id.ID]*scheduler.Scheduler),
+		crashes:    make(map[batchKey]api.CmdID),
+		prefixes:   newPrefixCache(),
 	}
+	out.connect = out.gapir.Connect
 	bind.GetRegistry(ctx).Listen(bind.NewDeviceListener(out.createScheduler, out.destroyScheduler))
 	return out
 }
@@ -77,18 +104,17 @@ func (m *Manager) Replay(
 	hints *service.UsageHints) (val interface{}, err error) {
 
 	log.D(ctx, "Replay request")
+	if d := getDump(ctx); d != nil {
+		return nil, m.dump(ctx, d, intent, cfg, req, generator)
+	}
+
 	s, err := m.scheduler(ctx, intent.Device.Id.ID())
 	if err != nil {
 		return nil, err
 	}
 
 	b := scheduler.Batch{
-		Key: batchKey{
-			capture:   intent.Capture.Id.ID(),
-			device:    intent.Device.Id.ID(),
-			config:    cfg,
-			generator: generator,
-		},
+		Key:          newBatchKey(ctx, intent, cfg, generator),
 		Priority:     defaultPriority,
 		Precondition: defaultBatchDelay,
 	}
@@ -103,11 +129,48 @@ func (m *Manager) Replay(
 		if hints.Background {
 			b.Priority = lowestPriority
 			b.Precondition = backgroundBatchDelay
+			b.Preemptible = true
 		}
 	}
 	return s.Schedule(ctx, req, b)
 }
 
+// Queue returns the replay batches executing or queued on each of the replay
+// devices.
+func (m *Manager) Queue() *service.ReplayQueue {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	devices := make([]id.ID, 0, len(m.schedulers))
+	for d := range m.schedulers {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].String() < devices[j].String() })
+
+	now := time.Now()
+	out := &service.ReplayQueue{}
+	for _, d := range devices {
+		for _, s := range m.schedulers[d].Queue() {
+			key := s.Batch.Key.(batchKey)
+			b := &service.ReplayBatch{
+				Device:      path.NewDevice(key.device),
+				Capture:     path.NewCapture(key.capture),
+				Config:      fmt.Sprintf("%T", key.config),
+				Priority:    int32(s.Batch.Priority),
+				Preemptible: s.Batch.Preemptible,
+				Requests:    uint32(s.Tasks),
+				Clients:     s.Clients,
+				Executing:   s.Executing,
+				Age:         uint64(now.Sub(s.Queued)),
+			}
+			if s.Executing {
+				b.ExecutionTime = uint64(now.Sub(s.Started))
+			}
+			out.Batches = append(out.Batches, b)
+		}
+	}
+	return out
+}
+
 func (m *Manager) scheduler(ctx context.Context, deviceID id.ID) (*scheduler.Scheduler, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -124,6 +187,12 @@ func (m *Manager) createScheduler(ctx context.Context, device bind.Device) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.schedulers[deviceID] = scheduler.New(ctx, m.batch)
+	// The device may have been updated since its replays crashed.
+	for key := range m.crashes {
+		if key.device == deviceID {
+			delete(m.crashes, key)
+		}
+	}
 }
 
 func (m *Manager) destroyScheduler(ctx context.Context, device bind.Device) {
@@ -0,0 +1,269 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/google/gapid/core/app/benchmark"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay/builder"
+)
+
+const (
+	// prefixSnapshotInterval is the initial number of commands written between
+	// two snapshots of a prefix.
+	prefixSnapshotInterval = 1024
+	// maxPrefixSnapshots is the maximum number of snapshots held by a prefix.
+	// Once reached, every other snapshot is dropped and the interval between
+	// snapshots is doubled.
+	maxPrefixSnapshots = 32
+	// maxPrefixes is the maximum number of prefixes held by the cache.
+	maxPrefixes = 8
+)
+
+var (
+	prefixHitCounter     = benchmark.GlobalCounters.Integer("replay.prefixCache.hits")
+	prefixMissCounter    = benchmark.GlobalCounters.Integer("replay.prefixCache.misses")
+	prefixReusedCounter  = benchmark.GlobalCounters.Integer("replay.prefixCache.reusedCommands")
+	prefixRebuiltCounter = benchmark.GlobalCounters.Integer("replay.prefixCache.rebuiltCommands")
+)
+
+// prefix is the list of commands written for a replay, along with snapshots
+// of the builder and state taken along the way. A later replay that writes
+// the same leading commands can resume building from the last snapshot
+// before the commands differ, instead of building them all again.
+type prefix struct {
+	cmds      []prefixCmd
+	snapshots []prefixSnapshot // Ordered by count.
+	interval  int              // The number of commands between two snapshots.
+	complete  bool             // No more snapshots can be taken.
+	used      uint64           // The last time the prefix was used.
+}
+
+// prefixCmd is a command written to the replay adapter.
+type prefixCmd struct {
+	id  api.CmdID
+	cmd api.Cmd
+}
+
+// prefixSnapshot holds the builder and state after writing the first count
+// commands of a prefix.
+type prefixSnapshot struct {
+	count   int
+	builder *builder.Snapshot
+	state   *api.State
+}
+
+// matches returns true if the i'th command of the prefix is cmd with the
+// identifier id.
+func (p *prefix) matches(i int, id api.CmdID, cmd api.Cmd) bool {
+	if i >= len(p.cmds) {
+		return false
+	}
+	c := p.cmds[i]
+	// Only commands referenced by pointer are matched, as other types may not
+	// be comparable. Commands created by the transforms of each replay are
+	// never matched.
+	return c.id == id && reflect.TypeOf(cmd).Kind() == reflect.Ptr && c.cmd == cmd
+}
+
+// ids returns the distinct identifiers of the capture commands of the prefix,
+// in ascending order.
+func (p *prefix) ids() []api.CmdID {
+	out := make([]api.CmdID, 0, len(p.cmds))
+	for _, c := range p.cmds {
+		if c.id != api.CmdNoID {
+			out = append(out, c.id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	unique := out[:0]
+	for _, id := range out {
+		if len(unique) == 0 || id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// snapshotBefore returns the last snapshot taken after at most count
+// commands.
+func (p *prefix) snapshotBefore(count int) prefixSnapshot {
+	out := p.snapshots[0]
+	for _, s := range p.snapshots {
+		if s.count > count {
+			break
+		}
+		out = s
+	}
+	return out
+}
+
+// snapshot takes a snapshot of b and s if the interval since the last
+// snapshot has elapsed.
+func (p *prefix) snapshot(b *builder.Builder, s *api.State) {
+	if p.complete {
+		return
+	}
+	count := len(p.cmds)
+	if n := len(p.snapshots); n > 0 && count-p.snapshots[n-1].count < p.interval {
+		return
+	}
+	bs := b.Snapshot()
+	if bs == nil {
+		// The builder holds postbacks, which it will for the rest of the replay.
+		p.complete = true
+		return
+	}
+	state, err := s.Clone()
+	if err != nil {
+		p.complete = true
+		return
+	}
+	if len(p.snapshots) == maxPrefixSnapshots {
+		thinned := p.snapshots[:0]
+		for i, s := range p.snapshots {
+			if i%2 == 0 {
+				thinned = append(thinned, s)
+			}
+		}
+		p.snapshots = thinned
+		p.interval *= 2
+	}
+	p.snapshots = append(p.snapshots, prefixSnapshot{count, bs, state})
+}
+
+// prefixCache holds the prefixes of the last replays built for each batch
+// key.
+type prefixCache struct {
+	mutex    sync.Mutex
+	prefixes map[batchKey]*prefix
+	time     uint64
+}
+
+func newPrefixCache() *prefixCache {
+	return &prefixCache{prefixes: map[batchKey]*prefix{}}
+}
+
+// get returns the prefix of the last replay built for key, or nil if there is
+// none.
+func (c *prefixCache) get(key batchKey) *prefix {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	p := c.prefixes[key]
+	if p != nil {
+		c.time++
+		p.used = c.time
+	}
+	return p
+}
+
+// put stores the prefix of the last replay built for key, evicting the least
+// recently used prefix if the cache is full.
+func (c *prefixCache) put(key batchKey, p *prefix) {
+	if len(p.snapshots) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time++
+	p.used = c.time
+	c.prefixes[key] = p
+	for len(c.prefixes) > maxPrefixes {
+		var lru batchKey
+		oldest := c.time + 1
+		for k, p := range c.prefixes {
+			if p.used < oldest {
+				lru, oldest = k, p.used
+			}
+		}
+		delete(c.prefixes, lru)
+	}
+}
+
+// newAdapter returns an adapter writing the commands to b, resuming from
+// cached if it is not nil.
+func newAdapter(s *api.State, b *builder.Builder, cached *prefix) *adapter {
+	out := &adapter{
+		state:    s,
+		builder:  b,
+		cached:   cached,
+		matching: cached != nil,
+		written:  &prefix{interval: prefixSnapshotInterval},
+	}
+	if cached == nil {
+		out.written.snapshot(b, s)
+	}
+	return out
+}
+
+// newUncachedAdapter returns an adapter writing the commands to b, which
+// neither resumes from a cached prefix nor takes snapshots for the cache.
+func newUncachedAdapter(s *api.State, b *builder.Builder) *adapter {
+	return &adapter{
+		state:   s,
+		builder: b,
+		written: &prefix{complete: true},
+	}
+}
+
+// resume stops matching the commands of the cached prefix, and restores the
+// builder as it was after writing the matched commands.
+// The commands after the snapshot are written on a clone of the snapshot
+// state, as w.state has already been mutated by them. The builder then goes
+// on with w.state, which relies on the remapping keys of the builder holding
+// no pointers into the state they were made from.
+func (w *adapter) resume(ctx context.Context) {
+	w.matching = false
+	snapshot := w.cached.snapshotBefore(w.matched)
+	for _, s := range w.cached.snapshots {
+		if s.count <= w.matched {
+			w.written.snapshots = append(w.written.snapshots, s)
+		}
+	}
+	w.written.interval = w.cached.interval
+
+	state, err := snapshot.state.Clone()
+	if err != nil {
+		// Snapshot states are only taken if they can be cloned.
+		panic(err)
+	}
+	w.builder = snapshot.builder.Builder()
+	for _, c := range w.cached.cmds[snapshot.count:w.matched] {
+		write(ctx, state, w.builder, c.id, c.cmd)
+	}
+
+	if snapshot.count > 0 {
+		prefixHitCounter.Increment()
+	} else {
+		prefixMissCounter.Increment()
+	}
+	prefixReusedCounter.AddInt64(int64(snapshot.count))
+	prefixRebuiltCounter.AddInt64(int64(w.matched - snapshot.count))
+	log.D(ctx, "Resumed replay building after %d cached commands", snapshot.count)
+}
+
+// finish must be called once all the commands have been written, before
+// building the payload.
+func (w *adapter) finish(ctx context.Context) {
+	if w.matching {
+		w.resume(ctx)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/replay/value"
+)
+
+// remapState is a cloneable per-API state holding the namespace of the
+// objects of the remapCmds.
+type remapState struct{ namespace int }
+
+func (s *remapState) CloneState() (interface{}, error) {
+	out := *s
+	return &out, nil
+}
+
+// remapKey is the remapping key of an object, derived from the state as the
+// keys of the graphics APIs are.
+type remapKey struct {
+	namespace int
+	handle    uint32
+}
+
+// remapCmd creates or uses the object with the given handle, remapping the
+// handle on replay.
+type remapCmd struct {
+	testcmd.X
+	create bool
+	handle uint32
+}
+
+func (c *remapCmd) Mutate(ctx context.Context, s *api.State, b *builder.Builder) error {
+	st, ok := s.APIs[c.API()].(*remapState)
+	if !ok {
+		st = &remapState{namespace: 1}
+		s.APIs[c.API()] = st
+	}
+	if b == nil {
+		return nil
+	}
+	key := remapKey{st.namespace, c.handle}
+	if c.create {
+		ptr := b.AllocateMemory(4)
+		b.Call(builder.FunctionInfo{ID: 1, ReturnType: protocol.Type_Uint32, Name: "create"})
+		b.Store(ptr)
+		b.Remappings[key] = ptr
+		return nil
+	}
+	if ptr, found := b.Remappings[key]; found {
+		b.Load(protocol.Type_Uint32, ptr)
+	} else {
+		b.Push(value.U32(c.handle))
+	}
+	b.Call(builder.FunctionInfo{ID: 2, ReturnType: protocol.Type_Void, Parameters: 1, Name: "use"})
+	return nil
+}
+
+// buildPrefix writes cmds to an adapter resuming from cached, and returns the
+// built payload along with the prefix written.
+func buildPrefix(ctx context.Context, cached *prefix, cmds []api.Cmd) (protocol.Payload, *prefix) {
+	w := newAdapter(api.NewStateWithEmptyAllocator(device.Little64), builder.New(device.Little64), cached)
+	for i, cmd := range cmds {
+		w.MutateAndWrite(ctx, api.CmdID(i), cmd)
+	}
+	w.finish(ctx)
+	payload, _, err := w.builder.Build(ctx)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	return payload, w.written
+}
+
+func TestPrefixCache(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// The shared prefix creates the object and uses it for longer than the
+	// interval between two snapshots.
+	shared := []api.Cmd{&remapCmd{create: true, handle: 1}}
+	for i := 0; i < prefixSnapshotInterval+100; i++ {
+		shared = append(shared, &remapCmd{handle: 1})
+	}
+	first := append(append([]api.Cmd{}, shared...), &remapCmd{handle: 1})
+	second := append(append([]api.Cmd{}, shared...),
+		&remapCmd{create: true, handle: 2}, &remapCmd{handle: 2}, &remapCmd{handle: 1})
+
+	_, cached := buildPrefix(ctx, nil, first)
+	if !assert.For(ctx, "snapshots").ThatSlice(cached.snapshots).IsLength(2) {
+		return
+	}
+
+	reused := prefixReusedCounter.GetInt64()
+	got, written := buildPrefix(ctx, cached, second)
+	expected, _ := buildPrefix(ctx, nil, second)
+	assert.For(ctx, "reused").That(prefixReusedCounter.GetInt64() - reused).Equals(int64(prefixSnapshotInterval))
+	assert.For(ctx, "payload").That(got).DeepEquals(expected)
+	assert.For(ctx, "commands").ThatSlice(written.ids()).IsLength(len(second))
+
+	// A second build resuming from the same prefix gives the same payload.
+	got, _ = buildPrefix(ctx, cached, second)
+	assert.For(ctx, "payload").That(got).DeepEquals(expected)
+}
@@ -18,12 +18,16 @@
 # build and the file will be recreated, check in the new version.
 
 set(files
+    compression.go
     doc.go
+    message.go
     opcode.go
     payload.go
+    protocol_test.go
     replay_protocol.pb.go
     replay_protocol.proto
     type.go
+    version.go
 )
 set(dirs
 
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+)
+
+// Compress returns data compressed with c.
+func Compress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case Compression_None:
+		return data, nil
+	case Compression_Deflate:
+		buf := &bytes.Buffer{}
+		w, err := flate.NewWriter(buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported compression %v", c)
+	}
+}
+
+// Decompress returns the data compressed with c by Compress.
+func Decompress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case Compression_None:
+		return data, nil
+	case Compression_Deflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("Unsupported compression %v", c)
+	}
+}
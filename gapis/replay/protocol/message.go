@@ -0,0 +1,58 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// maxMessageSize is the largest size of a message accepted by ReadMessage.
+const maxMessageSize = 1 << 30
+
+// WriteMessage writes the message m to w, framed by its size.
+func WriteMessage(w io.Writer, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadMessage reads a message written by WriteMessage from r into m.
+func ReadMessage(r io.Reader, m proto.Message) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > maxMessageSize {
+		return fmt.Errorf("Message of %d bytes exceeds the maximum size", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
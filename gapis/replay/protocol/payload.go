@@ -14,6 +14,15 @@
 
 package protocol
 
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
 // ResourceInfo describes a resource used by a Payload.
 type ResourceInfo struct {
 	ID   string // The resource identifier as a string.
@@ -29,3 +38,82 @@ type Payload struct {
 	Resources          []ResourceInfo // Resources used by this replay payload.
 	Opcodes            []byte         // The encoded list of opcodes.
 }
+
+// Encode returns the payload encoded for the given version of the protocol.
+// byteOrder is the byte order of the replay device, used by Version1.
+func (p Payload) Encode(version uint32, byteOrder device.Endian) ([]byte, error) {
+	switch version {
+	case Version1:
+		buf := &bytes.Buffer{}
+		w := endian.Writer(buf, byteOrder)
+		w.Uint32(p.StackSize)
+		w.Uint32(p.VolatileMemorySize)
+		w.Uint32(uint32(len(p.Constants)))
+		w.Data(p.Constants)
+		w.Uint32(uint32(len(p.Resources)))
+		for _, r := range p.Resources {
+			w.String(r.ID)
+			w.Uint32(r.Size)
+		}
+		w.Uint32(uint32(len(p.Opcodes)))
+		w.Data(p.Opcodes)
+		return buf.Bytes(), w.Error()
+	case Version2, Version3:
+		data := &PayloadData{
+			Version:            version,
+			StackSize:          p.StackSize,
+			VolatileMemorySize: p.VolatileMemorySize,
+			Constants:          p.Constants,
+			Resources:          make([]*ResourceData, len(p.Resources)),
+			Opcodes:            p.Opcodes,
+		}
+		for i, r := range p.Resources {
+			data.Resources[i] = &ResourceData{Id: r.ID, Size: r.Size}
+		}
+		return proto.Marshal(data)
+	default:
+		return nil, fmt.Errorf("Unsupported protocol version %d", version)
+	}
+}
+
+// DecodePayload decodes a payload encoded by Payload.Encode for the given
+// version of the protocol. byteOrder is the byte order of the replay device,
+// used by Version1.
+func DecodePayload(data []byte, version uint32, byteOrder device.Endian) (Payload, error) {
+	p := Payload{}
+	switch version {
+	case Version1:
+		r := endian.Reader(bytes.NewReader(data), byteOrder)
+		p.StackSize = r.Uint32()
+		p.VolatileMemorySize = r.Uint32()
+		p.Constants = make([]byte, r.Uint32())
+		r.Data(p.Constants)
+		p.Resources = make([]ResourceInfo, r.Uint32())
+		for i := range p.Resources {
+			p.Resources[i].ID = r.String()
+			p.Resources[i].Size = r.Uint32()
+		}
+		p.Opcodes = make([]byte, r.Uint32())
+		r.Data(p.Opcodes)
+		return p, r.Error()
+	case Version2, Version3:
+		pd := &PayloadData{}
+		if err := proto.Unmarshal(data, pd); err != nil {
+			return p, err
+		}
+		if pd.Version < Version2 || pd.Version > MaxVersion {
+			return p, fmt.Errorf("Unsupported payload version %d", pd.Version)
+		}
+		p.StackSize = pd.StackSize
+		p.VolatileMemorySize = pd.VolatileMemorySize
+		p.Constants = pd.Constants
+		p.Resources = make([]ResourceInfo, len(pd.Resources))
+		for i, r := range pd.Resources {
+			p.Resources[i] = ResourceInfo{ID: r.Id, Size: r.Size}
+		}
+		p.Opcodes = pd.Opcodes
+		return p, nil
+	default:
+		return p, fmt.Errorf("Unsupported protocol version %d", version)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+func TestPayloadEncodeDecode(t *testing.T) {
+	ctx := log.Testing(t)
+	payload := protocol.Payload{
+		StackSize:          512,
+		VolatileMemorySize: 0x1000,
+		Constants:          []byte{1, 2, 3, 4},
+		Resources: []protocol.ResourceInfo{
+			{ID: "0123456789abcdef0123456789abcdef01234567", Size: 16},
+			{ID: "fedcba9876543210fedcba9876543210fedcba98", Size: 32},
+		},
+		Opcodes: []byte{5, 6, 7, 8, 9, 10, 11, 12},
+	}
+	for _, version := range []uint32{protocol.Version1, protocol.Version2, protocol.Version3} {
+		for _, byteOrder := range []device.Endian{device.LittleEndian, device.BigEndian} {
+			ctx := log.V{"version": version, "byte-order": byteOrder}.Bind(ctx)
+			data, err := payload.Encode(version, byteOrder)
+			if !assert.For(ctx, "Encode").ThatError(err).Succeeded() {
+				continue
+			}
+			got, err := protocol.DecodePayload(data, version, byteOrder)
+			if assert.For(ctx, "DecodePayload").ThatError(err).Succeeded() {
+				assert.For(ctx, "payload").That(got).DeepEquals(payload)
+			}
+		}
+	}
+
+	_, err := payload.Encode(protocol.MaxVersion+1, device.LittleEndian)
+	assert.For(ctx, "Encode unsupported version").ThatError(err).Failed()
+}
+
+func TestMessages(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	sent := []*protocol.GetRequest{
+		{Ids: []string{"a", "b"}, TotalSize: 10},
+		{},
+		{Ids: []string{"c"}, TotalSize: 1 << 40},
+	}
+	for _, m := range sent {
+		assert.For(ctx, "WriteMessage").ThatError(protocol.WriteMessage(buf, m)).Succeeded()
+	}
+	for _, expected := range sent {
+		got := &protocol.GetRequest{}
+		if assert.For(ctx, "ReadMessage").ThatError(protocol.ReadMessage(buf, got)).Succeeded() {
+			assert.For(ctx, "message").That(got).DeepEquals(expected)
+		}
+	}
+	err := protocol.ReadMessage(buf, &protocol.GetRequest{})
+	assert.For(ctx, "ReadMessage at end").ThatError(err).Failed()
+}
+
+func TestNegotiate(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		min, max uint32
+		expected uint32
+	}{
+		{protocol.Version1, protocol.Version1, protocol.Version1},
+		{protocol.Version1, protocol.Version2, protocol.Version2},
+		{protocol.Version2, protocol.Version3, protocol.Version3},
+		{protocol.Version2, 100, protocol.MaxVersion},
+		{0, 0, 0},
+		{100, 200, 0},
+	} {
+		got := protocol.Negotiate(test.min, test.max)
+		assert.For(ctx, "Negotiate(%v, %v)", test.min, test.max).That(got).Equals(test.expected)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	ctx := log.Testing(t)
+	data := bytes.Repeat([]byte("compressible resource data "), 100)
+	for _, c := range []protocol.Compression{protocol.Compression_None, protocol.Compression_Deflate} {
+		ctx := log.V{"compression": c}.Bind(ctx)
+		compressed, err := protocol.Compress(data, c)
+		if !assert.For(ctx, "Compress").ThatError(err).Succeeded() {
+			continue
+		}
+		if c != protocol.Compression_None {
+			assert.For(ctx, "compressed size").That(len(compressed) < len(data)).Equals(true)
+		}
+		got, err := protocol.Decompress(compressed, c)
+		if assert.For(ctx, "Decompress").ThatError(err).Succeeded() {
+			assert.For(ctx, "data").ThatSlice(got).Equals(data)
+		}
+	}
+
+	_, err := protocol.Compress(data, protocol.Compression(100))
+	assert.For(ctx, "Compress unsupported").ThatError(err).Failed()
+}
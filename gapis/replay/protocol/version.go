@@ -0,0 +1,51 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol
+
+// The versions of the replay protocol.
+const (
+	// Version1 is the original version of the protocol. The payload is encoded
+	// with the byte order of the replay device and the Get and Post messages
+	// are framed by hand. It is used with the replay devices that do not
+	// support Handshake connections.
+	Version1 = 1
+	// Version2 encodes the payload and the Get and Post messages as size
+	// framed protobuf messages.
+	Version2 = 2
+	// Version3 adds the compression of the resources sent to the replay
+	// device, and the resource cache of the replay device.
+	Version3 = 3
+
+	// MinVersion is the lowest version of the protocol supported.
+	MinVersion = Version1
+	// MaxVersion is the highest version of the protocol supported.
+	MaxVersion = Version3
+)
+
+// Negotiate returns the highest version of the protocol supported both by
+// this package and by a peer supporting the versions from min to max, or 0 if
+// there is no such version.
+func Negotiate(min, max uint32) uint32 {
+	if max > MaxVersion {
+		max = MaxVersion
+	}
+	if min < MinVersion {
+		min = MinVersion
+	}
+	if min > max {
+		return 0
+	}
+	return max
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/database"
+)
+
+type clientKeyTy string
+
+const clientKey = clientKeyTy("schedulerClient")
+
+func init() {
+	// Tasks scheduled by resolves are attributed to the client that requested
+	// the resolve.
+	database.Inherit(clientKey)
+}
+
+// PutClient returns a new context identifying the client that schedules the
+// tasks. Schedulers share their time fairly between clients.
+func PutClient(ctx context.Context, client string) context.Context {
+	return keys.WithValue(ctx, clientKey, client)
+}
+
+// GetClient returns the client identified by a context annotated by
+// PutClient, or an empty string if there is none.
+func GetClient(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey).(string)
+	return client
+}
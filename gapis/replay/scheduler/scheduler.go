@@ -18,13 +18,23 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/gapid/core/app/benchmark"
 	"github.com/google/gapid/core/event/task"
 )
 
+var (
+	batchCounter      = benchmark.GlobalCounters.Integer("replay.scheduler.batches")
+	taskCounter       = benchmark.GlobalCounters.Integer("replay.scheduler.tasks")
+	preemptionCounter = benchmark.GlobalCounters.Integer("replay.scheduler.preemptions")
+	queueTimer        = benchmark.GlobalCounters.Duration("replay.scheduler.queuedTotalDuration")
+	executeTimer      = benchmark.GlobalCounters.Duration("replay.scheduler.executeTotalDuration")
+)
+
 // Executor is the executor of Executables.
 // The executor can only work on one list of Executables at a time.
 type Executor func(context.Context, []Executable, Batch)
@@ -34,6 +44,7 @@ type Executable struct {
 	Task      Task        // The work to be done.
 	Cancelled task.Signal // Has this work been cancelled?
 	Result    Result      // The result callback.
+	Client    string      // The client that scheduled the task.
 }
 
 // Result is the result of an executed Task.
@@ -57,24 +68,72 @@ type Batch struct {
 	// Priority is used to prioritize batches.
 	// The larger numbers represent higher priorities.
 	Priority int
+
+	// Preemptible batches are cancelled when a batch of a higher priority is
+	// ready to be executed. The tasks that fail because of the cancellation
+	// are scheduled again.
+	Preemptible bool
+}
+
+// Status describes a batch queued or executing on a Scheduler.
+type Status struct {
+	Batch     Batch
+	Tasks     int       // The number of tasks in the batch.
+	Clients   []string  // The clients that scheduled the tasks.
+	Queued    time.Time // The time the first task of the batch was scheduled.
+	Executing bool      // True if the batch is executing.
+	Started   time.Time // The time the batch started executing.
 }
 
 // Scheduler schedules Tasks to Executors, batching where possible.
+//
+// The ready batch with the highest priority is executed first. Between batches
+// of the same priority, the batch holding the tasks of the client that waited
+// the longest since its last executed batch goes first.
 type Scheduler struct {
 	pending  chan *job
 	exec     Executor
 	queueLen uint32
+
+	mutex     sync.Mutex // guards bins and executing
+	bins      map[Batch]*bin
+	executing *execution
 }
 
 // New returns a new Scheduler that will execute Tasks with exec.
 func New(ctx context.Context, exec Executor) *Scheduler {
-	s := &Scheduler{exec: exec, pending: make(chan *job, 32)}
+	s := &Scheduler{exec: exec, pending: make(chan *job, 32), bins: map[Batch]*bin{}}
 	go s.run(ctx)
 	return s
 }
 
 // NumTasksQueued returns the number of queued tasks.
-func (s *Scheduler) NumTasksQueued() int { return int(s.queueLen) }
+func (s *Scheduler) NumTasksQueued() int { return int(atomic.LoadUint32(&s.queueLen)) }
+
+// Queue returns the status of the executing batch followed by the queued
+// batches, in the order they are expected to execute.
+func (s *Scheduler) Queue() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	out := []Status{}
+	if e := s.executing; e != nil {
+		st := e.bin.status()
+		st.Executing, st.Started = true, e.started
+		out = append(out, st)
+	}
+	queued := make([]Status, 0, len(s.bins))
+	for _, b := range s.bins {
+		queued = append(queued, b.status())
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		a, b := queued[i], queued[j]
+		if a.Batch.Priority != b.Batch.Priority {
+			return a.Batch.Priority > b.Batch.Priority
+		}
+		return a.Queued.Before(b.Queued)
+	})
+	return append(out, queued...)
+}
 
 // Schedule schedules task to be executed on exec.
 func (s *Scheduler) Schedule(ctx context.Context, t Task, b Batch) (val interface{}, err error) {
@@ -88,7 +147,7 @@ func (s *Scheduler) Schedule(ctx context.Context, t Task, b Batch) (val interfac
 	r := func(val interface{}, err error) { out <- res{val, err} }
 
 	select {
-	case s.pending <- &job{executable: Executable{t, c, r}, batch: b}:
+	case s.pending <- &job{executable: Executable{t, c, r, GetClient(ctx)}, batch: b}:
 	case <-c: // cancelled
 		return nil, task.StopReason(ctx)
 	}
@@ -102,14 +161,17 @@ func (s *Scheduler) Schedule(ctx context.Context, t Task, b Batch) (val interfac
 }
 
 func (s *Scheduler) run(ctx context.Context) {
-	bins := map[Batch]*bin{}
-
 	const (
 		caseShouldStop = iota
 		casePending
+		caseDone
 		casePreconditions
 	)
 
+	done := make(chan *execution)
+	served := map[string]uint64{} // The last batch executed for each client.
+	count := uint64(0)            // The number of batches executed.
+
 	interrupts := make([]reflect.SelectCase, casePreconditions, 100)
 	interrupts[caseShouldStop] = reflect.SelectCase{
 		Dir:  reflect.SelectRecv,
@@ -119,29 +181,83 @@ func (s *Scheduler) run(ctx context.Context) {
 		Dir:  reflect.SelectRecv,
 		Chan: reflect.ValueOf(s.pending),
 	}
+	interrupts[caseDone] = reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(done),
+	}
 
+	// addJob must be called with a locked mutex.
 	addJob := func(j *job) {
-		if b, ok := bins[j.batch]; ok {
+		if b, ok := s.bins[j.batch]; ok {
 			b.jobs = append(b.jobs, j)
 		} else {
-			interrupt := reflect.SelectCase{
-				Dir:  reflect.SelectRecv,
-				Chan: preconditionChan(j.batch.Precondition),
-			}
-			bins[j.batch] = &bin{
-				batch:     j.batch,
-				jobs:      []*job{j},
-				interrupt: interrupt,
+			s.bins[j.batch] = &bin{
+				batch:  j.batch,
+				jobs:   []*job{j},
+				queued: time.Now(),
+				interrupt: reflect.SelectCase{
+					Dir:  reflect.SelectRecv,
+					Chan: preconditionChan(j.batch.Precondition),
+				},
 			}
-			interrupts = append(interrupts, interrupt)
 		}
 		atomic.AddUint32(&s.queueLen, 1)
 	}
 
+	// starved returns the number of batches executed since the last batch of
+	// the client of b that waited the longest.
+	starved := func(b *bin) uint64 {
+		out := uint64(0)
+		for _, j := range b.jobs {
+			if n := count - served[j.executable.Client]; n > out {
+				out = n
+			}
+		}
+		return out
+	}
+
+	// schedule executes the next batch, or preempts the executing batch.
+	// It must be called with a locked mutex.
+	schedule := func() {
+		var best *bin
+		for _, b := range s.bins {
+			if !b.isReady() {
+				continue
+			}
+			switch {
+			case best == nil, best.batch.Priority < b.batch.Priority:
+				best = b
+			case best.batch.Priority > b.batch.Priority:
+			case starved(best) < starved(b),
+				starved(best) == starved(b) && b.queued.Before(best.queued):
+				best = b
+			}
+		}
+		if best == nil {
+			return
+		}
+		if e := s.executing; e != nil {
+			if e.bin.batch.Preemptible && e.bin.batch.Priority < best.batch.Priority {
+				e.preempt()
+			}
+			return
+		}
+		// Execute the batch.
+		delete(s.bins, best.batch)
+		atomic.AddUint32(&s.queueLen, -uint32(len(best.jobs)))
+		count++
+		for _, j := range best.jobs {
+			served[j.executable.Client] = count
+		}
+		s.executing = best.exec(ctx, s.exec, done)
+	}
+
 	for !task.Stopped(ctx) {
 		i, v, ok := reflect.Select(interrupts)
+		s.mutex.Lock()
 		switch i {
 		case caseShouldStop: // <-task.ShouldStop(ctx)
+			s.mutex.Unlock()
 			return
 		case casePending: // j := <-s.pending:
 			j := v.Interface().(*job)
@@ -149,38 +265,34 @@ func (s *Scheduler) run(ctx context.Context) {
 			// If so, adjust priorites to the min, execute once and broadcast
 			// results.
 			addJob(j)
+		case caseDone: // e := <-done:
+			e := v.Interface().(*execution)
+			s.executing = nil
+			for _, j := range e.requeued {
+				addJob(j)
+			}
 		default: // precondition
 			if ok {
 				// Received a value on the chan instead of a the chan being closed.
 				// Once passed, the must always pass.
-				for _, b := range bins {
+				for _, b := range s.bins {
 					if b.interrupt == interrupts[i] {
 						b.interrupt.Chan = reflect.ValueOf(task.FiredSignal)
 					}
 				}
 			}
-			// Collect any remaining pending jobs
-			s.collect(addJob)
-			// Find the highest priority bin to execute.
-			var best *bin
-			for _, b := range bins {
-				if b.isReady() {
-					if best == nil || best.batch.Priority < b.batch.Priority {
-						best = b
-					}
-				}
-			}
-			// Execute the batch.
-			best.exec(ctx, s.exec)
-			// Drop the batch.
-			delete(bins, best.batch)
-			atomic.AddUint32(&s.queueLen, -uint32(len(best.jobs)))
-			// Rebuild interrupts.
-			interrupts = interrupts[:casePreconditions]
-			for _, b := range bins {
+		}
+		// Collect any remaining pending jobs
+		s.collect(addJob)
+		schedule()
+		// Rebuild interrupts, waiting on the preconditions not yet satisfied.
+		interrupts = interrupts[:casePreconditions]
+		for _, b := range s.bins {
+			if !b.ready {
 				interrupts = append(interrupts, b.interrupt)
 			}
 		}
+		s.mutex.Unlock()
 	}
 }
 
@@ -214,11 +326,16 @@ func preconditionChan(p interface{}) reflect.Value {
 type bin struct {
 	batch     Batch
 	jobs      []*job
+	queued    time.Time
 	interrupt reflect.SelectCase
+	ready     bool
 }
 
 // isReady returns true if the bin is ready to be executed.
 func (b *bin) isReady() bool {
+	if b.ready {
+		return true
+	}
 	i, _, ok := reflect.Select([]reflect.SelectCase{
 		b.interrupt,
 		reflect.SelectCase{Dir: reflect.SelectDefault},
@@ -228,17 +345,86 @@ func (b *bin) isReady() bool {
 		// Once passed, the must always pass.
 		b.interrupt.Chan = reflect.ValueOf(task.FiredSignal)
 	}
-	return i == 0
+	b.ready = i == 0
+	return b.ready
+}
+
+func (b *bin) status() Status {
+	out := Status{Batch: b.batch, Tasks: len(b.jobs), Queued: b.queued}
+	seen := map[string]bool{}
+	for _, j := range b.jobs {
+		if c := j.executable.Client; !seen[c] {
+			seen[c] = true
+			out.Clients = append(out.Clients, c)
+		}
+	}
+	return out
 }
 
-func (b *bin) exec(ctx context.Context, exec Executor) {
+// exec starts executing the bin, sending the execution to done once
+// finished.
+func (b *bin) exec(ctx context.Context, exec Executor, done chan<- *execution) *execution {
+	stop := task.ShouldStop(ctx)
+	ctx, cancel := task.WithCancel(ctx)
+	e := &execution{bin: b, started: time.Now(), cancel: cancel}
 	l := make([]Executable, 0, len(b.jobs))
 	for _, j := range b.jobs {
 		if !j.executable.Cancelled.Fired() {
-			l = append(l, j.executable)
+			l = append(l, e.wrap(j))
+		}
+	}
+	batchCounter.Increment()
+	taskCounter.AddInt64(int64(len(l)))
+	queueTimer.AddDuration(e.started.Sub(b.queued))
+	go func() {
+		defer cancel()
+		exec(ctx, l, b.batch)
+		executeTimer.Stop(e.started)
+		select {
+		case done <- e:
+		case <-stop:
+		}
+	}()
+	return e
+}
+
+// execution is a bin being executed.
+type execution struct {
+	bin       *bin
+	started   time.Time
+	cancel    task.CancelFunc
+	mutex     sync.Mutex // guards preempted and requeued
+	preempted bool
+	requeued  []*job // The jobs to schedule again, after a preemption.
+}
+
+// preempt cancels the execution.
+func (e *execution) preempt() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.preempted {
+		e.preempted = true
+		preemptionCounter.Increment()
+		e.cancel()
+	}
+}
+
+// wrap returns the executable of j, with a result that schedules j again if
+// it fails after a preemption.
+func (e *execution) wrap(j *job) Executable {
+	out := j.executable
+	out.Result = func(val interface{}, err error) {
+		e.mutex.Lock()
+		requeue := err != nil && e.preempted
+		if requeue {
+			e.requeued = append(e.requeued, j)
+		}
+		e.mutex.Unlock()
+		if !requeue {
+			j.executable.Result(val, err)
 		}
 	}
-	exec(ctx, l, b.batch)
+	return out
 }
 
 type job struct {
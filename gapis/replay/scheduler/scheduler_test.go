@@ -44,10 +44,12 @@ func (t *testExecutor) exec(ctx context.Context, l []Executable, b Batch) {
 	tasks := make([]int, len(l))
 	for i, e := range l {
 		tasks[i] = e.Task.(int)
-		e.Result(t.val, t.err)
 	}
 	sort.Ints(tasks)
 	t.got = append(t.got, tasks)
+	for _, e := range l {
+		e.Result(t.val, t.err)
+	}
 }
 
 func setup(t *testing.T) (context.Context, *testExecutor, *Scheduler, *sync.WaitGroup) {
@@ -259,3 +261,91 @@ func TestCancel(t *testing.T) {
 	}
 	assert.To(t).For("sum").That(sum).Equals(3)
 }
+
+func TestPreemption(t *testing.T) {
+	ctx := log.Testing(t)
+	got := [][]int{}
+	started := make(chan struct{})
+	exec := func(ctx context.Context, l []Executable, b Batch) {
+		tasks := []int{}
+		for _, e := range l {
+			tasks = append(tasks, e.Task.(int))
+		}
+		got = append(got, tasks)
+		if b.Preemptible && len(got) == 1 {
+			close(started)
+			<-task.ShouldStop(ctx)
+			for _, e := range l {
+				e.Result(nil, task.StopReason(ctx))
+			}
+			return
+		}
+		for _, e := range l {
+			e.Result(321, nil)
+		}
+	}
+	s := New(ctx, exec)
+
+	wg := sync.WaitGroup{}
+	schedule := func(i int, b Batch) {
+		wg.Add(1)
+		go func() {
+			val, err := s.Schedule(ctx, i, b)
+			assert.To(t).For("val %v", i).That(val).Equals(321)
+			assert.To(t).For("err %v", i).ThatError(err).Succeeded()
+			wg.Done()
+		}()
+	}
+	schedule(1, Batch{Key: 1, Priority: 0, Preemptible: true})
+	<-started
+	schedule(2, Batch{Key: 2, Priority: 1})
+	wg.Wait()
+	assert.To(t).For("got").ThatSlice(got).DeepEquals([][]int{[]int{1}, []int{2}, []int{1}})
+}
+
+func TestClientFairness(t *testing.T) {
+	ctx := log.Testing(t)
+	got := []int{}
+	release := make(chan struct{})
+	exec := func(ctx context.Context, l []Executable, b Batch) {
+		if len(got) == 0 {
+			<-release
+		}
+		for _, e := range l {
+			got = append(got, e.Task.(int))
+			e.Result(321, nil)
+		}
+	}
+	s := New(ctx, exec)
+
+	wg := sync.WaitGroup{}
+	for i, client := range []string{"a", "a", "a", "b"} {
+		wg.Add(1)
+		go func(i int, ctx context.Context) {
+			_, err := s.Schedule(ctx, i, Batch{Key: i})
+			assert.To(t).For("err %v", i).ThatError(err).Succeeded()
+			wg.Done()
+		}(i, PutClient(ctx, client))
+		if i == 0 {
+			for len(s.Queue()) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		} else {
+			waitForQueued(s, i)
+		}
+	}
+
+	queue := s.Queue()
+	if assert.To(t).For("queue").ThatSlice(queue).IsLength(4) {
+		for i, status := range queue {
+			assert.To(t).For("key %v", i).That(status.Batch.Key).Equals(i)
+			assert.To(t).For("executing %v", i).That(status.Executing).Equals(i == 0)
+		}
+		assert.To(t).For("clients").ThatSlice(queue[3].Clients).Equals([]string{"b"})
+	}
+
+	close(release)
+	wg.Wait()
+	// Client b waited for the batch of client a, so goes first.
+	assert.To(t).For("got").ThatSlice(got).Equals([]int{0, 3, 1, 2})
+}
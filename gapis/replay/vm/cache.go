@@ -0,0 +1,79 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ResourceCache holds the resources fetched by replays, so that later replays
+// served with the same cache do not need to fetch them again. Resources are
+// evicted in least recently used order. ResourceCache is safe for concurrent
+// use.
+type ResourceCache struct {
+	mutex   sync.Mutex
+	size    uint64 // The maximum size of the cache.
+	used    uint64 // The total size of the resources in the cache.
+	entries map[string]*list.Element
+	lru     list.List // Of *cacheEntry, most recently used first.
+}
+
+type cacheEntry struct {
+	id   string
+	data []byte
+}
+
+// NewResourceCache returns a new resource cache holding at most size bytes
+// of resources.
+func NewResourceCache(size uint64) *ResourceCache {
+	return &ResourceCache{size: size, entries: map[string]*list.Element{}}
+}
+
+// get returns the data of the resource with the given identifier, and true if
+// the resource is in the cache.
+func (c *ResourceCache) get(id string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).data, true
+}
+
+// add adds the resource with the given identifier and data to the cache,
+// evicting resources until the cache holds at most max bytes, or the size of
+// the cache if lower.
+func (c *ResourceCache) add(id string, data []byte, max uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.size < max {
+		max = c.size
+	}
+	if _, ok := c.entries[id]; ok || uint64(len(data)) > max {
+		return
+	}
+	c.entries[id] = c.lru.PushFront(&cacheEntry{id, data})
+	c.used += uint64(len(data))
+	for c.used > max {
+		e := c.lru.Back()
+		entry := e.Value.(*cacheEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.id)
+		c.used -= uint64(len(entry.data))
+	}
+}
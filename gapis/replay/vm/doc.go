@@ -0,0 +1,22 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vm implements the replay virtual machine in Go.
+//
+// The virtual machine interprets the opcodes of the replay payloads built by
+// the builder package, like gapir does, but calls Go functions instead of the
+// graphics driver. It can serve replays on the connections used by the
+// executor package, which makes it a GPU-free replay backend for tests and a
+// tool to validate the output of the builder.
+package vm
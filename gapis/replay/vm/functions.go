@@ -0,0 +1,126 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+// FunctionID identifies a function that can be called by the virtual machine.
+type FunctionID struct {
+	API uint8  // The index of the API of the function.
+	ID  uint16 // The identifier of the function in its API.
+}
+
+// Function is the implementation of a function called by the virtual machine.
+// The function pops its parameters from the stack of vm, last parameter first,
+// and pushes its return value if pushReturn is true.
+type Function func(ctx context.Context, vm *VM, pushReturn bool) error
+
+// Functions maps the functions that can be called by the virtual machine to
+// their implementations.
+type Functions map[FunctionID]Function
+
+// Register sets the implementation of the function described by info to f.
+func (f Functions) Register(info builder.FunctionInfo, impl Function) {
+	f[FunctionID{info.ApiIndex, info.ID}] = impl
+}
+
+// Fake returns a Function that logs the calls of the function called name and
+// described by info, and returns the zero value of its return type.
+func Fake(name string, info builder.FunctionInfo) Function {
+	return func(ctx context.Context, vm *VM, pushReturn bool) error {
+		args := make([]string, info.Parameters)
+		for i := range args {
+			v, err := vm.Stack.Pop()
+			if err != nil {
+				return err
+			}
+			args[len(args)-1-i] = v.String()
+		}
+		log.D(ctx, "[%d] %s(%s)", vm.Label(), name, strings.Join(args, ", "))
+		if pushReturn {
+			return vm.Push(info.ReturnType, 0)
+		}
+		return nil
+	}
+}
+
+var (
+	// The identifiers of the builtin functions, which must match the ones of
+	// gapir/cc/interpreter.h.
+	postFunctionID       = FunctionID{0, 0xff00}
+	resourceFunctionID   = FunctionID{0, 0xff01}
+	printStackFunctionID = FunctionID{0, 0xff80}
+
+	builtins = Functions{
+		postFunctionID:       post,
+		resourceFunctionID:   resource,
+		printStackFunctionID: printStack,
+	}
+)
+
+// post sends count bytes at address to the server.
+func post(ctx context.Context, vm *VM, pushReturn bool) error {
+	count, err := vm.Stack.PopType(protocol.Type_Uint32)
+	if err != nil {
+		return err
+	}
+	addr, err := vm.PopPointer()
+	if err != nil {
+		return err
+	}
+	data, err := vm.Read(addr, count)
+	if err != nil {
+		return err
+	}
+	return vm.server.Post(ctx, data)
+}
+
+// resource loads the resource of the given index to address.
+func resource(ctx context.Context, vm *VM, pushReturn bool) error {
+	index, err := vm.Stack.PopType(protocol.Type_Uint32)
+	if err != nil {
+		return err
+	}
+	addr, err := vm.PopPointer()
+	if err != nil {
+		return err
+	}
+	if index >= uint64(len(vm.payload.Resources)) {
+		return log.Errf(ctx, nil, "Resource index %d out of bounds: the payload has %d resources",
+			index, len(vm.payload.Resources))
+	}
+	info := vm.payload.Resources[index]
+	data, err := vm.server.Resources(ctx, []protocol.ResourceInfo{info})
+	if err != nil {
+		return log.Errf(ctx, err, "Can't fetch resource: %s", info.ID)
+	}
+	return vm.Write(addr, data)
+}
+
+// printStack logs the values of the stack.
+func printStack(ctx context.Context, vm *VM, pushReturn bool) error {
+	log.D(ctx, "Stack size: %d", vm.Stack.Len())
+	for i, v := range vm.Stack.values {
+		log.D(ctx, "(%d) %v", i, v)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/google/gapid/core/fault"
+)
+
+// ErrInvalidAddress is the error returned when accessing memory that is not
+// mapped by the virtual machine.
+const ErrInvalidAddress = fault.Const("Invalid address")
+
+const (
+	// baseAddress is the address of the first region of memory. The addresses
+	// below, including the address of unobserved pointers, are never mapped.
+	baseAddress = 0x10000000
+	// regionAlignment is the alignment of the regions of memory.
+	regionAlignment = 0x1000
+)
+
+// region is a block of memory of the virtual machine.
+type region struct {
+	base     uint64
+	data     []byte
+	readOnly bool
+}
+
+// memory is the address space of the virtual machine.
+type memory struct {
+	regions []*region
+	next    uint64
+}
+
+// alloc maps a new region holding data.
+func (m *memory) alloc(data []byte, readOnly bool) *region {
+	if m.next == 0 {
+		m.next = baseAddress
+	}
+	r := &region{base: m.next, data: data, readOnly: readOnly}
+	m.regions = append(m.regions, r)
+	// Leave at least a gap of regionAlignment bytes between regions so that
+	// out of bound accesses are detected.
+	size := (uint64(len(data)) + regionAlignment - 1) &^ (regionAlignment - 1)
+	m.next += size + regionAlignment
+	return r
+}
+
+// slice returns the size bytes of memory at addr.
+func (m *memory) slice(addr, size uint64, write bool) ([]byte, error) {
+	for _, r := range m.regions {
+		if addr < r.base || addr-r.base >= uint64(len(r.data)) {
+			continue
+		}
+		offset := addr - r.base
+		if size > uint64(len(r.data))-offset {
+			return nil, fmt.Errorf("%v: [0x%x, 0x%x) exceeds [0x%x, 0x%x)",
+				ErrInvalidAddress, addr, addr+size, r.base, r.base+uint64(len(r.data)))
+		}
+		if write && r.readOnly {
+			return nil, fmt.Errorf("%v: 0x%x is read-only", ErrInvalidAddress, addr)
+		}
+		return r.data[offset : offset+size], nil
+	}
+	return nil, fmt.Errorf("%v: 0x%x", ErrInvalidAddress, addr)
+}
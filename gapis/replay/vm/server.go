@@ -0,0 +1,258 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+// Serve handles the requests of the server on connection, as gapir would,
+// running the replays with the virtual machine. The replay device has the
+// given memory layout, and the commands of the replays are implemented by
+// functions. If cache is not nil, the resources fetched by the replays are
+// kept in cache for the later replays, when the server allows it.
+func Serve(ctx context.Context, connection io.ReadWriteCloser, memoryLayout *device.MemoryLayout, functions Functions, cache *ResourceCache) error {
+	defer connection.Close()
+	br, bw := bufio.NewReader(connection), bufio.NewWriter(connection)
+	c := &serverConnection{
+		r:       endian.Reader(br, memoryLayout.GetEndian()),
+		w:       endian.Writer(bw, memoryLayout.GetEndian()),
+		br:      br,
+		bw:      bw,
+		version: protocol.Version1,
+		cache:   cache,
+	}
+
+	ty := protocol.ConnectionType(c.r.Uint8())
+	if err := c.r.Error(); err != nil {
+		return log.Err(ctx, err, "Failed to read the connection type")
+	}
+	switch ty {
+	case protocol.ConnectionType_Replay:
+		id, size := c.r.String(), c.r.Uint32()
+		if err := c.r.Error(); err != nil {
+			return log.Err(ctx, err, "Failed to read the replay request")
+		}
+		return c.replay(ctx, id, size, memoryLayout, functions)
+	case protocol.ConnectionType_VersionedReplay:
+		r := endian.Reader(br, device.LittleEndian)
+		c.version = r.Uint32()
+		if err := r.Error(); err != nil {
+			return log.Err(ctx, err, "Failed to read the protocol version")
+		}
+		if c.version < protocol.Version2 || c.version > protocol.MaxVersion {
+			return log.Errf(ctx, nil, "Unsupported protocol version: %v", c.version)
+		}
+		req := &protocol.ReplayRequest{}
+		if err := protocol.ReadMessage(br, req); err != nil {
+			return log.Err(ctx, err, "Failed to read the replay request")
+		}
+		if c.version >= protocol.Version3 && cache != nil {
+			c.cacheSize = req.ResourceCacheSize
+		}
+		return c.replay(ctx, req.PayloadId, req.PayloadSize, memoryLayout, functions)
+	case protocol.ConnectionType_Handshake:
+		r, w := endian.Reader(br, device.LittleEndian), endian.Writer(bw, device.LittleEndian)
+		min, max := r.Uint32(), r.Uint32()
+		if err := r.Error(); err != nil {
+			return log.Err(ctx, err, "Failed to read the handshake")
+		}
+		w.Uint32(protocol.Negotiate(min, max))
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return bw.Flush()
+	case protocol.ConnectionType_Ping:
+		c.w.String("PONG")
+		return c.flush()
+	case protocol.ConnectionType_Shutdown:
+		return nil
+	}
+	return log.Errf(ctx, nil, "Unknown connection type: %v", ty)
+}
+
+// serverConnection is the Server of the replays served on a connection.
+type serverConnection struct {
+	r       binary.Reader
+	w       binary.Writer
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	version uint32
+	// cache holds the resources between replays, if cacheSize is not 0.
+	cache     *ResourceCache
+	cacheSize uint64
+	// cached holds the resources of the replay found in the cache.
+	cached map[string][]byte
+}
+
+// replay fetches the payload with the given identifier and size and runs it.
+func (c *serverConnection) replay(ctx context.Context, id string, size uint32, memoryLayout *device.MemoryLayout, functions Functions) error {
+	cached := &protocol.CachedResources{}
+	c.cached = map[string][]byte{}
+	addCached := func(r protocol.ResourceInfo) {
+		if _, ok := c.cached[r.ID]; ok || c.cacheSize == 0 {
+			return
+		}
+		if data, ok := c.cache.get(r.ID); ok {
+			c.cached[r.ID] = data
+			cached.Ids = append(cached.Ids, r.ID)
+			cached.TotalSize += uint64(r.Size)
+		}
+	}
+
+	addCached(protocol.ResourceInfo{ID: id, Size: size})
+	data, err := c.Resources(ctx, []protocol.ResourceInfo{{ID: id, Size: size}})
+	if err != nil {
+		return log.Errf(ctx, err, "Can't load replay request: %s", id)
+	}
+	payload, err := protocol.DecodePayload(data, c.version, memoryLayout.GetEndian())
+	if err != nil {
+		return log.Err(ctx, err, "Failed to decode the replay payload")
+	}
+
+	for _, r := range payload.Resources {
+		addCached(r)
+	}
+	if len(cached.Ids) > 0 {
+		if err := c.writeMessage(protocol.MessageType_Cached, cached); err != nil {
+			return err
+		}
+	}
+	return New(memoryLayout, payload, functions, c).Run(ctx)
+}
+
+func (c *serverConnection) Resources(ctx context.Context, resources []protocol.ResourceInfo) ([]byte, error) {
+	if c.cacheSize == 0 {
+		return c.fetch(ctx, resources)
+	}
+	missing, size := []protocol.ResourceInfo{}, uint64(0)
+	for _, r := range resources {
+		if _, ok := c.cached[r.ID]; !ok {
+			missing = append(missing, r)
+		}
+		size += uint64(r.Size)
+	}
+	fetched := []byte{}
+	if len(missing) > 0 {
+		var err error
+		if fetched, err = c.fetch(ctx, missing); err != nil {
+			return nil, err
+		}
+	}
+	data := make([]byte, 0, size)
+	for _, r := range resources {
+		if d, ok := c.cached[r.ID]; ok {
+			data = append(data, d...)
+			continue
+		}
+		d := append([]byte{}, fetched[:r.Size]...)
+		fetched = fetched[r.Size:]
+		c.cache.add(r.ID, d, c.cacheSize)
+		data = append(data, d...)
+	}
+	return data, nil
+}
+
+// fetch requests the resources from the server.
+func (c *serverConnection) fetch(ctx context.Context, resources []protocol.ResourceInfo) ([]byte, error) {
+	size := uint64(0)
+	for _, r := range resources {
+		size += uint64(r.Size)
+	}
+	if c.version != protocol.Version1 {
+		return c.versionedResources(ctx, resources, size)
+	}
+	c.w.Uint8(uint8(protocol.MessageType_Get))
+	c.w.Uint32(uint32(len(resources)))
+	c.w.Uint64(size)
+	for _, r := range resources {
+		c.w.String(r.ID)
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	c.r.Data(data)
+	if err := c.r.Error(); err != nil {
+		return nil, fmt.Errorf("GET %d resources returned unexpected size: %v", len(resources), err)
+	}
+	return data, nil
+}
+
+func (c *serverConnection) versionedResources(ctx context.Context, resources []protocol.ResourceInfo, size uint64) ([]byte, error) {
+	req := &protocol.GetRequest{Ids: make([]string, len(resources)), TotalSize: size}
+	for i, r := range resources {
+		req.Ids[i] = r.ID
+	}
+	if c.version >= protocol.Version3 {
+		req.Compression = protocol.Compression_Deflate
+	}
+	if err := c.writeMessage(protocol.MessageType_Get, req); err != nil {
+		return nil, err
+	}
+	res := &protocol.GetResponse{}
+	if err := protocol.ReadMessage(c.br, res); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, size)
+	for _, d := range res.Data {
+		d, err := protocol.Decompress(d, res.Compression)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, d...)
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("GET %d resources returned unexpected size. Expected: 0x%x, Got: 0x%x", len(resources), size, len(data))
+	}
+	return data, nil
+}
+
+func (c *serverConnection) Post(ctx context.Context, data []byte) error {
+	if c.version != protocol.Version1 {
+		return c.writeMessage(protocol.MessageType_Post, &protocol.PostRequest{Data: data})
+	}
+	c.w.Uint8(uint8(protocol.MessageType_Post))
+	c.w.Uint32(uint32(len(data)))
+	c.w.Data(data)
+	return c.flush()
+}
+
+func (c *serverConnection) writeMessage(ty protocol.MessageType, m proto.Message) error {
+	if err := c.bw.WriteByte(uint8(ty)); err != nil {
+		return err
+	}
+	if err := protocol.WriteMessage(c.bw, m); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+func (c *serverConnection) flush() error {
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
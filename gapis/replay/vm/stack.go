@@ -0,0 +1,135 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+const (
+	// ErrStackOverflow is the error returned when pushing to a full stack.
+	ErrStackOverflow = fault.Const("Stack overflow")
+	// ErrStackUnderflow is the error returned when popping from an empty stack.
+	ErrStackUnderflow = fault.Const("Stack underflow")
+)
+
+// Value is a value of the stack of the virtual machine.
+type Value struct {
+	Type protocol.Type // The type of the value.
+	Bits uint64        // The bits of the value, truncated to the size of the type.
+}
+
+// Int returns the value of a signed integer type, sign-extended to 64 bits.
+func (v Value) Int() int64 {
+	switch v.Type {
+	case protocol.Type_Int8:
+		return int64(int8(v.Bits))
+	case protocol.Type_Int16:
+		return int64(int16(v.Bits))
+	case protocol.Type_Int32:
+		return int64(int32(v.Bits))
+	}
+	return int64(v.Bits)
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case protocol.Type_Bool:
+		return fmt.Sprint(v.Bits != 0)
+	case protocol.Type_Int8, protocol.Type_Int16, protocol.Type_Int32, protocol.Type_Int64:
+		return fmt.Sprint(v.Int())
+	case protocol.Type_Float:
+		return fmt.Sprint(math.Float32frombits(uint32(v.Bits)))
+	case protocol.Type_Double:
+		return fmt.Sprint(math.Float64frombits(v.Bits))
+	case protocol.Type_AbsolutePointer:
+		return fmt.Sprintf("0x%x", v.Bits)
+	case protocol.Type_ConstantPointer:
+		return fmt.Sprintf("constant(0x%x)", v.Bits)
+	case protocol.Type_VolatilePointer:
+		return fmt.Sprintf("volatile(0x%x)", v.Bits)
+	}
+	return fmt.Sprint(v.Bits)
+}
+
+// Stack is the stack of the virtual machine.
+type Stack struct {
+	values []Value
+	size   int
+}
+
+// Len returns the number of values on the stack.
+func (s *Stack) Len() int { return len(s.values) }
+
+// Push pushes v to the top of the stack.
+func (s *Stack) Push(v Value) error {
+	if len(s.values) >= s.size {
+		return ErrStackOverflow
+	}
+	s.values = append(s.values, v)
+	return nil
+}
+
+// Pop removes and returns the value at the top of the stack.
+func (s *Stack) Pop() (Value, error) {
+	v, err := s.Top()
+	if err == nil {
+		s.values = s.values[:len(s.values)-1]
+	}
+	return v, err
+}
+
+// PopType removes and returns the bits of the value at the top of the stack,
+// which must be of type ty.
+func (s *Stack) PopType(ty protocol.Type) (uint64, error) {
+	v, err := s.Top()
+	if err != nil {
+		return 0, err
+	}
+	if v.Type != ty {
+		return 0, fmt.Errorf("Pop type (%v) doesn't match with the type at the top of the stack (%v)", ty, v.Type)
+	}
+	s.values = s.values[:len(s.values)-1]
+	return v.Bits, nil
+}
+
+// Top returns the value at the top of the stack.
+func (s *Stack) Top() (Value, error) {
+	if len(s.values) == 0 {
+		return Value{}, ErrStackUnderflow
+	}
+	return s.values[len(s.values)-1], nil
+}
+
+// discard removes the count values at the top of the stack.
+func (s *Stack) discard(count uint32) error {
+	if int(count) > len(s.values) {
+		return ErrStackUnderflow
+	}
+	s.values = s.values[:len(s.values)-int(count)]
+	return nil
+}
+
+// clone pushes a copy of the n-th value from the top of the stack.
+func (s *Stack) clone(n uint32) error {
+	if int(n) >= len(s.values) {
+		return fmt.Errorf("Cloning from invalid index: %d (size: %d)", n, len(s.values))
+	}
+	return s.Push(s.values[len(s.values)-1-int(n)])
+}
@@ -0,0 +1,406 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/replay/opcode"
+	"github.com/google/gapid/gapis/replay/protocol"
+)
+
+// Server is the interface to the server of a replay.
+type Server interface {
+	// Resources returns the concatenated data of the resources.
+	Resources(ctx context.Context, resources []protocol.ResourceInfo) ([]byte, error)
+	// Post sends postback data to the server.
+	Post(ctx context.Context, data []byte) error
+}
+
+// VM is a replay virtual machine.
+type VM struct {
+	// Stack is the stack of the virtual machine.
+	Stack Stack
+
+	memoryLayout *device.MemoryLayout
+	payload      protocol.Payload
+	functions    Functions
+	server       Server
+	memory       memory
+	constants    *region
+	volatile     *region
+	label        uint32
+}
+
+// New returns a virtual machine for the replay payload, built for a device of
+// the memory layout. The commands of the payload are implemented by functions,
+// and the resources and postbacks are exchanged with server.
+func New(memoryLayout *device.MemoryLayout, payload protocol.Payload, functions Functions, server Server) *VM {
+	vm := &VM{
+		Stack:        Stack{size: int(payload.StackSize)},
+		memoryLayout: memoryLayout,
+		payload:      payload,
+		functions:    functions,
+		server:       server,
+	}
+	vm.constants = vm.memory.alloc(payload.Constants, true)
+	vm.volatile = vm.memory.alloc(make([]byte, payload.VolatileMemorySize), false)
+	return vm
+}
+
+// MemoryLayout returns the memory layout of the replay device.
+func (vm *VM) MemoryLayout() *device.MemoryLayout { return vm.memoryLayout }
+
+// Label returns the last label reached by the virtual machine.
+func (vm *VM) Label() uint32 { return vm.label }
+
+// Alloc maps size bytes of writable memory, returning its address.
+func (vm *VM) Alloc(size uint64) uint64 {
+	return vm.memory.alloc(make([]byte, size), false).base
+}
+
+// Read returns the size bytes of memory at addr. The returned slice aliases
+// the memory of the virtual machine.
+func (vm *VM) Read(addr, size uint64) ([]byte, error) {
+	return vm.memory.slice(addr, size, false)
+}
+
+// Write writes data to the memory at addr.
+func (vm *VM) Write(addr uint64, data []byte) error {
+	buf, err := vm.memory.slice(addr, uint64(len(data)), true)
+	if err != nil {
+		return err
+	}
+	copy(buf, data)
+	return nil
+}
+
+// Push pushes the value v of type ty to the top of the stack.
+func (vm *VM) Push(ty protocol.Type, v uint64) error {
+	size, err := vm.sizeOf(ty)
+	if err != nil {
+		return err
+	}
+	return vm.Stack.Push(Value{Type: ty, Bits: truncate(v, size)})
+}
+
+// PopPointer removes the pointer at the top of the stack, returning its
+// absolute address.
+func (vm *VM) PopPointer() (uint64, error) {
+	v, err := vm.Stack.Pop()
+	if err != nil {
+		return 0, err
+	}
+	return vm.absolute(v)
+}
+
+// Run interprets all the opcodes of the payload.
+func (vm *VM) Run(ctx context.Context) error {
+	ctx = log.Enter(ctx, "VM")
+	r := endian.Reader(bytes.NewReader(vm.payload.Opcodes), vm.memoryLayout.GetEndian())
+	for i := 0; i < len(vm.payload.Opcodes)/4; i++ {
+		op, err := opcode.Decode(r)
+		if err == nil {
+			err = vm.interpret(ctx, op)
+		}
+		if err != nil {
+			return log.Errf(ctx, err, "Interpreter stopped at opcode %d (%+v). Last reached label: %d", i, op, vm.label)
+		}
+	}
+	return nil
+}
+
+func (vm *VM) interpret(ctx context.Context, op interface{}) error {
+	switch op := op.(type) {
+	case opcode.Call:
+		return vm.call(ctx, FunctionID{op.ApiIndex, op.FunctionID}, op.PushReturn)
+	case opcode.PushI:
+		v := uint64(op.Value)
+		switch op.DataType {
+		case protocol.Type_Int32, protocol.Type_Int64:
+			// Sign extension for signed types
+			if v&0x80000 != 0 {
+				v |= 0xfffffffffff00000
+			}
+		case protocol.Type_Float:
+			// Shifting the value into the exponent for floating point types
+			v <<= 23
+		case protocol.Type_Double:
+			v <<= 52
+		}
+		return vm.Push(op.DataType, v)
+	case opcode.LoadC:
+		return vm.pushFrom(op.DataType, vm.constants.base+uint64(op.Address))
+	case opcode.LoadV:
+		return vm.pushFrom(op.DataType, vm.volatile.base+uint64(op.Address))
+	case opcode.Load:
+		addr, err := vm.PopPointer()
+		if err != nil {
+			return err
+		}
+		return vm.pushFrom(op.DataType, addr)
+	case opcode.Pop:
+		return vm.Stack.discard(op.Count)
+	case opcode.StoreV:
+		return vm.popTo(vm.volatile.base + uint64(op.Address))
+	case opcode.Store:
+		addr, err := vm.PopPointer()
+		if err != nil {
+			return err
+		}
+		return vm.popTo(addr)
+	case opcode.Resource:
+		if err := vm.Stack.Push(Value{Type: protocol.Type_Uint32, Bits: uint64(op.ID)}); err != nil {
+			return err
+		}
+		return vm.call(ctx, resourceFunctionID, false)
+	case opcode.Post:
+		return vm.call(ctx, postFunctionID, false)
+	case opcode.Copy:
+		target, source, err := vm.popTargetAndSource()
+		if err != nil {
+			return err
+		}
+		src, err := vm.Read(source, uint64(op.Count))
+		if err != nil {
+			return err
+		}
+		return vm.Write(target, src)
+	case opcode.Clone:
+		return vm.Stack.clone(op.Index)
+	case opcode.Strcpy:
+		target, source, err := vm.popTargetAndSource()
+		if err != nil {
+			return err
+		}
+		// Requires that the whole count is available, even if source is shorter.
+		dst, err := vm.memory.slice(target, uint64(op.MaxSize), true)
+		if err != nil {
+			return err
+		}
+		i := 0
+		for ; i < len(dst)-1; i++ {
+			c, err := vm.Read(source+uint64(i), 1)
+			if err != nil {
+				return err
+			}
+			if c[0] == 0 {
+				break
+			}
+			dst[i] = c[0]
+		}
+		for ; i < len(dst); i++ {
+			dst[i] = 0
+		}
+		return nil
+	case opcode.Extend:
+		v, err := vm.Stack.Pop()
+		if err != nil {
+			return err
+		}
+		data := uint64(op.Value)
+		switch v.Type {
+		case protocol.Type_Float:
+			// Masking out the mantissa end extending it with the new bits for
+			// floating point types
+			v.Bits |= data & 0x007fffff
+		case protocol.Type_Double:
+			exponent := v.Bits & 0xfff0000000000000
+			v.Bits = ((v.Bits<<26)|data)&0x000fffffffffffff | exponent
+		default:
+			// Extending the value with 26 new LSB
+			v.Bits = (v.Bits << 26) | data
+		}
+		return vm.Push(v.Type, v.Bits)
+	case opcode.Add:
+		return vm.add(op.Count)
+	case opcode.Label:
+		vm.label = op.Value
+		return nil
+	}
+	return fmt.Errorf("Unknown opcode %T", op)
+}
+
+func (vm *VM) call(ctx context.Context, id FunctionID, pushReturn bool) error {
+	f, ok := builtins[id]
+	if !ok {
+		f, ok = vm.functions[id]
+	}
+	if !ok {
+		return fmt.Errorf("Invalid function id(%d), in api(%d)", id.ID, id.API)
+	}
+	if err := f(ctx, vm, pushReturn); err != nil {
+		return fmt.Errorf("Error raised when calling function with id %d, in api(%d): %v", id.ID, id.API, err)
+	}
+	return nil
+}
+
+func (vm *VM) add(count uint32) error {
+	if count < 2 {
+		return nil
+	}
+	top, err := vm.Stack.Top()
+	if err != nil {
+		return err
+	}
+	ty := top.Type
+	switch ty {
+	case protocol.Type_Bool, protocol.Type_VolatilePointer:
+		return fmt.Errorf("Cannot add values of type %v", ty)
+	case protocol.Type_ConstantPointer:
+		ty = protocol.Type_AbsolutePointer
+	}
+	sum := uint64(0)
+	for i := uint32(0); i < count; i++ {
+		var v uint64
+		if ty == protocol.Type_AbsolutePointer {
+			v, err = vm.PopPointer()
+		} else {
+			v, err = vm.Stack.PopType(ty)
+		}
+		if err != nil {
+			return err
+		}
+		switch ty {
+		case protocol.Type_Float:
+			sum = uint64(math.Float32bits(math.Float32frombits(uint32(sum)) + math.Float32frombits(uint32(v))))
+		case protocol.Type_Double:
+			sum = math.Float64bits(math.Float64frombits(sum) + math.Float64frombits(v))
+		default:
+			sum += v
+		}
+	}
+	return vm.Push(ty, sum)
+}
+
+// popTargetAndSource pops the target and then the source pointers of a copy.
+func (vm *VM) popTargetAndSource() (target, source uint64, err error) {
+	if target, err = vm.PopPointer(); err != nil {
+		return 0, 0, err
+	}
+	if source, err = vm.PopPointer(); err != nil {
+		return 0, 0, err
+	}
+	return target, source, nil
+}
+
+// pushFrom pushes the value of type ty loaded from addr.
+func (vm *VM) pushFrom(ty protocol.Type, addr uint64) error {
+	size, err := vm.sizeOf(ty)
+	if err != nil {
+		return err
+	}
+	data, err := vm.Read(addr, size)
+	if err != nil {
+		return err
+	}
+	return vm.Stack.Push(Value{Type: ty, Bits: vm.decode(data)})
+}
+
+// popTo pops the value at the top of the stack and stores it at addr.
+// Constant and volatile pointers are stored as absolute pointers.
+func (vm *VM) popTo(addr uint64) error {
+	v, err := vm.Stack.Pop()
+	if err != nil {
+		return err
+	}
+	switch v.Type {
+	case protocol.Type_ConstantPointer, protocol.Type_VolatilePointer:
+		if v.Bits, err = vm.absolute(v); err != nil {
+			return err
+		}
+		v.Type = protocol.Type_AbsolutePointer
+	}
+	size, err := vm.sizeOf(v.Type)
+	if err != nil {
+		return err
+	}
+	data, err := vm.memory.slice(addr, size, true)
+	if err != nil {
+		return err
+	}
+	vm.encode(data, v.Bits)
+	return nil
+}
+
+// absolute returns the absolute address of the pointer v.
+func (vm *VM) absolute(v Value) (uint64, error) {
+	switch v.Type {
+	case protocol.Type_AbsolutePointer:
+		return v.Bits, nil
+	case protocol.Type_ConstantPointer:
+		return vm.constants.base + v.Bits, nil
+	case protocol.Type_VolatilePointer:
+		return vm.volatile.base + v.Bits, nil
+	}
+	return 0, fmt.Errorf("Value of type %v is not a pointer", v.Type)
+}
+
+// sizeOf returns the size in bytes of values of type ty.
+func (vm *VM) sizeOf(ty protocol.Type) (uint64, error) {
+	switch ty {
+	case protocol.Type_Bool, protocol.Type_Int8, protocol.Type_Uint8:
+		return 1, nil
+	case protocol.Type_Int16, protocol.Type_Uint16:
+		return 2, nil
+	case protocol.Type_Int32, protocol.Type_Uint32, protocol.Type_Float,
+		protocol.Type_ConstantPointer, protocol.Type_VolatilePointer:
+		return 4, nil
+	case protocol.Type_Int64, protocol.Type_Uint64, protocol.Type_Double:
+		return 8, nil
+	case protocol.Type_AbsolutePointer:
+		return uint64(vm.memoryLayout.GetPointer().GetSize()), nil
+	}
+	return 0, fmt.Errorf("Invalid type %v", ty)
+}
+
+// decode returns the integer encoded in data with the byte order of the
+// device.
+func (vm *VM) decode(data []byte) uint64 {
+	v := uint64(0)
+	for i := range data {
+		if vm.memoryLayout.GetEndian() == device.BigEndian {
+			v |= uint64(data[i]) << (8 * uint(len(data)-1-i))
+		} else {
+			v |= uint64(data[i]) << (8 * uint(i))
+		}
+	}
+	return v
+}
+
+// encode writes v to data with the byte order of the device.
+func (vm *VM) encode(data []byte, v uint64) {
+	for i := range data {
+		if vm.memoryLayout.GetEndian() == device.BigEndian {
+			data[i] = byte(v >> (8 * uint(len(data)-1-i)))
+		} else {
+			data[i] = byte(v >> (8 * uint(i)))
+		}
+	}
+}
+
+// truncate returns v truncated to size bytes.
+func truncate(v, size uint64) uint64 {
+	if size >= 8 {
+		return v
+	}
+	return v & (1<<(8*size) - 1)
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/gapid/core/app/benchmark"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/executor"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/replay/value"
+	"github.com/google/gapid/gapis/replay/vm"
+)
+
+var funcInfoAdd = builder.FunctionInfo{ApiIndex: 1, ID: 10, ReturnType: protocol.Type_Uint32, Parameters: 2}
+
+func add(ctx context.Context, m *vm.VM, pushReturn bool) error {
+	a, err := m.Stack.PopType(protocol.Type_Uint32)
+	if err != nil {
+		return err
+	}
+	b, err := m.Stack.PopType(protocol.Type_Uint32)
+	if err != nil {
+		return err
+	}
+	if pushReturn {
+		return m.Push(protocol.Type_Uint32, a+b)
+	}
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	cached := benchmark.GlobalCounters.Integer("replay.resources.cached")
+	for _, version := range []uint32{protocol.Version1, protocol.Version2, protocol.Version3} {
+		t.Run(fmt.Sprintf("Version%d", version), func(t *testing.T) {
+			cache := vm.NewResourceCache(1 << 20)
+			before := cached.GetInt64()
+			testServe(t, version, cache)
+			testServe(t, version, cache)
+			expected := int64(0)
+			if version >= protocol.Version3 {
+				expected = 2 // The payload and its resource.
+			}
+			assert.For(log.Testing(t), "cached resources").That(cached.GetInt64() - before).Equals(expected)
+		})
+	}
+}
+
+func testServe(t *testing.T, version uint32, cache *vm.ResourceCache) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	ml := device.Little64
+
+	resource := []byte("resource data")
+	resourceID, err := database.Store(ctx, resource)
+	if !assert.For(ctx, "database.Store").ThatError(err).Succeeded() {
+		return
+	}
+
+	type postback struct {
+		name string
+		got  interface{}
+	}
+	postbacks := make(chan postback, 8)
+	post := func(name string, read func(r binary.Reader) interface{}) builder.Postback {
+		return func(r binary.Reader, err error) error {
+			if err != nil {
+				postbacks <- postback{name, err}
+				return err
+			}
+			postbacks <- postback{name, read(r)}
+			return r.Error()
+		}
+	}
+	readBytes := func(n int) func(r binary.Reader) interface{} {
+		return func(r binary.Reader) interface{} {
+			data := make([]byte, n)
+			r.Data(data)
+			return data
+		}
+	}
+
+	b := builder.New(ml)
+
+	b.BeginAtom(0)
+	rng := memory.Range{Base: 0x10000, Size: uint64(len(resource))}
+	b.Write(rng, resourceID)
+	b.Post(value.ObservedPointer(rng.Base), rng.Size, post("resource", readBytes(len(resource))))
+	b.CommitAtom()
+
+	b.BeginAtom(1)
+	b.Push(value.U32(20))
+	b.Push(value.U32(22))
+	b.Call(funcInfoAdd)
+	sum := b.AllocateMemory(4)
+	b.Store(sum)
+	b.Post(sum, 4, post("call", func(r binary.Reader) interface{} { return r.Uint32() }))
+	b.CommitAtom()
+
+	b.BeginAtom(2)
+	b.Push(value.S64(-123456789012))
+	s64 := b.AllocateMemory(8)
+	b.Store(s64)
+	b.Post(s64, 8, post("s64", func(r binary.Reader) interface{} { return r.Int64() }))
+	b.Push(value.F64(3.14159))
+	f64 := b.AllocateMemory(8)
+	b.Store(f64)
+	b.Post(f64, 8, post("f64", func(r binary.Reader) interface{} { return r.Float64() }))
+	b.CommitAtom()
+
+	b.BeginAtom(3)
+	str := b.AllocateMemory(8)
+	b.Push(b.String("abc"))
+	b.Push(str)
+	b.Strcpy(8)
+	b.Post(str, 8, post("strcpy", readBytes(8)))
+	b.CommitAtom()
+
+	payload, decoder, err := b.Build(ctx)
+	if !assert.For(ctx, "Build").ThatError(err).Succeeded() {
+		return
+	}
+
+	functions := vm.Functions{}
+	functions.Register(funcInfoAdd, add)
+
+	client, server := net.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- vm.Serve(ctx, server, ml, functions, cache) }()
+
+	err = executor.Execute(ctx, payload, decoder, client, version, ml)
+	assert.For(ctx, "Execute").ThatError(err).Succeeded()
+	assert.For(ctx, "Serve").ThatError(<-served).Succeeded()
+
+	for _, expected := range []postback{
+		{"resource", resource},
+		{"call", uint32(42)},
+		{"s64", int64(-123456789012)},
+		{"f64", 3.14159},
+		{"strcpy", []byte("abc\x00\x00\x00\x00\x00")},
+	} {
+		got := <-postbacks
+		assert.For(ctx, "postback %v", expected.name).That(got).DeepEquals(expected)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		min, max uint32
+		expected uint32
+	}{
+		{protocol.Version1, protocol.Version1, protocol.Version1},
+		{protocol.Version1, 100, protocol.MaxVersion},
+		{0, protocol.Version2, protocol.Version2},
+		{protocol.Version2, protocol.Version3, protocol.Version3},
+		{100, 200, 0},
+	} {
+		client, server := net.Pipe()
+		served := make(chan error, 1)
+		go func() { served <- vm.Serve(ctx, server, device.Little64, vm.Functions{}, nil) }()
+
+		w := endian.Writer(client, device.LittleEndian)
+		r := endian.Reader(client, device.LittleEndian)
+		w.Uint8(uint8(protocol.ConnectionType_Handshake))
+		w.Uint32(test.min)
+		w.Uint32(test.max)
+		got := r.Uint32()
+		client.Close()
+
+		ctx := log.V{"min": test.min, "max": test.max}.Bind(ctx)
+		assert.For(ctx, "Handshake").ThatError(r.Error()).Succeeded()
+		assert.For(ctx, "Serve").ThatError(<-served).Succeeded()
+		assert.For(ctx, "version").That(got).Equals(test.expected)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	ctx := log.Testing(t)
+	ml := device.Little64
+	for _, test := range []struct {
+		name string
+		f    func(b *builder.Builder)
+	}{
+		{"unknown function", func(b *builder.Builder) {
+			b.Call(builder.FunctionInfo{ApiIndex: 2, ID: 1, ReturnType: protocol.Type_Void})
+		}},
+		{"stack underflow", func(b *builder.Builder) {
+			b.Call(builder.FunctionInfo{ApiIndex: 1, ID: 10, ReturnType: protocol.Type_Void})
+		}},
+		{"unobserved pointer", func(b *builder.Builder) {
+			b.Post(value.ObservedPointer(0x10000), 4, func(binary.Reader, error) error { return nil })
+		}},
+		{"write to constant", func(b *builder.Builder) {
+			b.Push(value.U32(1))
+			b.Store(b.String("abc"))
+		}},
+	} {
+		b := builder.New(ml)
+		b.BeginAtom(0)
+		test.f(b)
+		b.CommitAtom()
+		payload, _, err := b.Build(ctx)
+		if !assert.For(ctx, "%v: Build", test.name).ThatError(err).Succeeded() {
+			continue
+		}
+		functions := vm.Functions{}
+		functions.Register(funcInfoAdd, add)
+		err = vm.New(ml, payload, functions, nil).Run(ctx)
+		assert.For(ctx, "%v: Run", test.name).ThatError(err).Failed()
+	}
+}
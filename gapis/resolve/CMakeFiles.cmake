@@ -22,23 +22,34 @@ set(files
     atoms.go
     command_tree.go
     commands.go
+    compat_coverage.go
     constant_set.go
     contexts.go
+    cpp_export.go
     doc.go
     errors.go
     events.go
     filter.go
     find.go
     follow.go
+    footprint.go
     framebuffer_attachment.go
     framebuffer_attachment_data.go
     framebuffer_changes.go
+    framebuffer_comparison.go
     get.go
     get_set_test.go
+    image_stats.go
     index_limits.go
     memory.go
     mesh.go
+    pixel_history.go
+    pixel_history_test.go
+    replay_determinism.go
+    replay_determinism_test.go
+    replay_payload.go
     report.go
+    report_test.go
     requests_test.go
     resolvables.pb.go
     resolvables.proto
@@ -49,8 +60,11 @@ set(files
     service.go
     set.go
     state.go
+    state_checkpoint.go
+    state_checkpoint_test.go
     state_tree.go
     state_tree_test.go
+    stats.go
     synchronization_data.go
     thumbnail.go
 )
@@ -0,0 +1,98 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CompatCoverage resolves the commands and extensions of the capture that the
+// compatibility layers do not handle for replay on the device of the path.
+func CompatCoverage(ctx context.Context, p *path.CompatCoverage) (*service.CompatCoverage, error) {
+	obj, err := database.Build(ctx, &CompatCoverageResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.CompatCoverage), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *CompatCoverageResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	p := r.Path
+	ctx = capture.Put(ctx, p.Capture)
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := p.Device
+	if d == nil {
+		devices, err := devices.ForReplay(ctx, p.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		d = devices[0]
+	}
+	device, err := Device(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	commands, exts := map[string]struct{}{}, map[string]struct{}{}
+	for _, a := range c.APIs {
+		provider, ok := a.(api.CompatCoverageProvider)
+		if !ok {
+			continue
+		}
+		report, err := provider.CompatCoverage(ctx, c.Commands, device)
+		if err != nil {
+			return nil, err
+		}
+		for _, cmd := range report.Commands {
+			commands[cmd] = struct{}{}
+		}
+		for _, ext := range report.Extensions {
+			exts[ext] = struct{}{}
+		}
+	}
+
+	return &service.CompatCoverage{
+		Device:     d,
+		Commands:   sortedStrings(commands),
+		Extensions: sortedStrings(exts),
+	}, nil
+}
+
+func sortedStrings(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for s := range m {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api/cpp"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CppExport resolves the C++ export of the capture at the given path.
+func CppExport(ctx context.Context, p *path.CppExport) (*service.CppExport, error) {
+	obj, err := database.Build(ctx, &CppExportResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.CppExport), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *CppExportResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Path.Capture)
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.APIs) > 1 {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrCppExportMultipleApis()}
+	}
+	var target *cpp.Target
+	for _, a := range c.APIs {
+		p, ok := a.(cpp.Provider)
+		if !ok {
+			return nil, &service.ErrDataUnavailable{Reason: messages.ErrCppExportUnsupportedApi(a.Name())}
+		}
+		target = p.CppTarget()
+	}
+	if target == nil {
+		target = &cpp.Target{}
+	}
+
+	files, err := cpp.Export(ctx, c.Commands, target, c.NewState())
+	if err != nil {
+		return nil, err
+	}
+
+	out := &service.CppExport{Files: make([]*service.CppExportFile, len(files))}
+	for i, f := range files {
+		file := &service.CppExportFile{Name: f.Name, Data: f.Data}
+		if f.Data == nil {
+			file.Resource = path.NewBlob(f.Resource)
+		}
+		out.Files[i] = file
+	}
+	return out, nil
+}
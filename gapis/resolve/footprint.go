@@ -0,0 +1,248 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Footprint resolves the memory footprint of the objects of the capture at
+// the given path.
+func Footprint(ctx context.Context, p *path.Footprint) (*service.MemoryFootprint, error) {
+	obj, err := database.Build(ctx, &FootprintResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.MemoryFootprint), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *FootprintResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Path.Capture)
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Identify the resources the same way as Resources does, so that the
+	// objects can be matched with the resources it lists.
+	resources := map[api.Resource]id.ID{}
+	var currentCmdIndex uint64
+	var currentCmdResourceCount int
+
+	state := c.NewState()
+	state.OnResourceCreated = func(r api.Resource) {
+		currentCmdResourceCount++
+		resources[r] = genResourceID(currentCmdIndex, currentCmdResourceCount)
+	}
+
+	t := &footprintTracker{
+		capture:   r.Path.Capture,
+		resources: resources,
+		objects:   map[api.ID]map[interface{}]*service.FootprintObject{},
+		live:      map[api.MemoryKind]*service.FootprintTotal{},
+		out:       &service.MemoryFootprint{},
+	}
+	rangeSize := r.Path.RangeSize
+
+	for i, cmd := range c.Commands {
+		idx := uint64(i)
+		currentCmdResourceCount = 0
+		currentCmdIndex = idx
+		if err := cmd.Mutate(ctx, state, nil); err != nil && err == context.Canceled {
+			return nil, err
+		}
+
+		flags := cmd.CmdFlags()
+		if rangeSize == 0 && flags.IsStartOfFrame() && t.current != nil && idx > 0 {
+			// The command starts a new frame, so it ends the current one.
+			t.endRange(idx - 1)
+		}
+		if t.current == nil {
+			t.beginRange(idx)
+		}
+		a := cmd.API()
+		if p, ok := a.(api.FootprintProvider); ok && p.AffectsFootprint(cmd) {
+			t.update(idx, a.ID(), p.Footprint(ctx, state))
+		}
+
+		var end bool
+		if rangeSize > 0 {
+			end = (idx+1)%rangeSize == 0
+		} else {
+			end = flags.IsEndOfFrame()
+		}
+		if end {
+			t.endRange(idx)
+		}
+	}
+	if t.current != nil {
+		t.endRange(uint64(len(c.Commands) - 1))
+	}
+
+	return t.out, nil
+}
+
+// footprintTracker tracks the objects that hold memory while the commands of
+// a capture are mutated.
+type footprintTracker struct {
+	capture   *path.Capture
+	resources map[api.Resource]id.ID
+	// The live objects of each API, by key.
+	objects map[api.ID]map[interface{}]*service.FootprintObject
+	// The live totals by kind.
+	live map[api.MemoryKind]*service.FootprintTotal
+	// The number of bytes held by the live objects that are not aliased.
+	liveBytes uint64
+	// The range being built, and its peaks by kind.
+	current *service.FootprintRange
+	peaks   map[api.MemoryKind]*service.FootprintTotal
+	out     *service.MemoryFootprint
+}
+
+// update replaces the live objects of the API a with objs, after the command
+// at idx.
+func (t *footprintTracker) update(idx uint64, a api.ID, objs []api.FootprintObject) {
+	prev := t.objects[a]
+	next := make(map[interface{}]*service.FootprintObject, len(objs))
+	created := []*service.FootprintObject{}
+	for _, o := range objs {
+		obj, ok := prev[o.Key]
+		if !ok {
+			obj = &service.FootprintObject{
+				Kind:    o.Kind,
+				Handle:  o.Handle,
+				Aliased: o.Aliased,
+				Created: t.capture.Command(idx),
+			}
+			if o.Resource != nil {
+				if id, ok := t.resources[o.Resource]; ok {
+					obj.Resource = path.NewID(id)
+				}
+			}
+			t.total(o.Kind).Count++
+			created = append(created, obj)
+		}
+		obj.Label = o.Label
+		t.resize(obj, o.Size)
+		next[o.Key] = obj
+	}
+	for k, obj := range prev {
+		if _, ok := next[k]; !ok {
+			t.remove(obj)
+			obj.Deleted = t.capture.Command(idx)
+			t.current.Deleted++
+		}
+	}
+	t.objects[a] = next
+
+	sort.Slice(created, func(i, j int) bool { return created[i].Handle < created[j].Handle })
+	t.out.Objects = append(t.out.Objects, created...)
+	t.current.Created += uint32(len(created))
+
+	t.updatePeaks(idx)
+}
+
+// resize changes the size of the live object obj to size, updating the
+// totals.
+func (t *footprintTracker) resize(obj *service.FootprintObject, size uint64) {
+	total := t.total(obj.Kind)
+	total.Bytes = total.Bytes - obj.Size + size
+	if !obj.Aliased {
+		t.liveBytes = t.liveBytes - obj.Size + size
+	}
+	obj.Size = size
+	if size > obj.PeakSize {
+		obj.PeakSize = size
+	}
+}
+
+// remove removes the deleted object obj from the totals. The size of obj is
+// kept, so that it can be reported.
+func (t *footprintTracker) remove(obj *service.FootprintObject) {
+	total := t.total(obj.Kind)
+	total.Bytes -= obj.Size
+	total.Count--
+	if !obj.Aliased {
+		t.liveBytes -= obj.Size
+	}
+}
+
+// total returns the live total of the objects of kind k.
+func (t *footprintTracker) total(k api.MemoryKind) *service.FootprintTotal {
+	total, ok := t.live[k]
+	if !ok {
+		total = &service.FootprintTotal{Kind: k}
+		t.live[k] = total
+	}
+	return total
+}
+
+// updatePeaks updates the peaks of the range being built and of the capture
+// with the live totals after the command at idx.
+func (t *footprintTracker) updatePeaks(idx uint64) {
+	if t.liveBytes > t.current.PeakBytes {
+		t.current.PeakBytes = t.liveBytes
+	}
+	if t.liveBytes > t.out.PeakBytes {
+		t.out.PeakBytes = t.liveBytes
+		t.out.PeakCommand = idx
+	}
+	for k, total := range t.live {
+		if peak, ok := t.peaks[k]; !ok || total.Bytes > peak.Bytes {
+			snapshot := *total
+			t.peaks[k] = &snapshot
+		}
+	}
+}
+
+// beginRange starts a new range at the command idx. The peaks of the range
+// start at the totals left alive by the previous range.
+func (t *footprintTracker) beginRange(idx uint64) {
+	t.current = &service.FootprintRange{FirstCommand: idx}
+	t.peaks = map[api.MemoryKind]*service.FootprintTotal{}
+	for k, total := range t.live {
+		snapshot := *total
+		t.peaks[k] = &snapshot
+	}
+	t.current.PeakBytes = t.liveBytes
+}
+
+// endRange ends the range being built at the command idx.
+func (t *footprintTracker) endRange(idx uint64) {
+	r := t.current
+	r.LastCommand = idx
+	r.LiveBytes = t.liveBytes
+	for _, total := range t.live {
+		snapshot := *total
+		r.Live = append(r.Live, &snapshot)
+	}
+	for _, peak := range t.peaks {
+		r.Peak = append(r.Peak, peak)
+	}
+	sort.Slice(r.Live, func(i, j int) bool { return r.Live[i].Kind < r.Live[j].Kind })
+	sort.Slice(r.Peak, func(i, j int) bool { return r.Peak[i].Kind < r.Peak[j].Kind })
+	t.out.Ranges = append(t.out.Ranges, r)
+	t.current = nil
+}
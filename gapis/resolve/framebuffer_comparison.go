@@ -0,0 +1,160 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// FramebufferComparison resolves the comparison between the replay devices of
+// the framebuffer at the given path. Unlike the framebuffers of each device,
+// the comparison is not cached, as the replay devices and their failures
+// change over time.
+func FramebufferComparison(ctx context.Context, p *path.FramebufferComparison) (*service.FramebufferComparison, error) {
+	ctx = capture.Put(ctx, p.After.Capture)
+
+	attachment := api.FramebufferAttachment(p.Attachment)
+	var format *image.Format
+	switch {
+	case attachment == api.FramebufferAttachment_Depth:
+		format = image.D_F32
+	case attachment >= api.FramebufferAttachment_Color0 && attachment <= api.FramebufferAttachment_Color3:
+		format = image.RGBA_F32
+	default:
+		return nil, &service.ErrInvalidPath{
+			Reason: messages.ErrInvalidEnumValue(p.Attachment, "FramebufferAttachment"),
+			Path:   p.Path(),
+		}
+	}
+
+	fbInfo, err := FramebufferAttachmentInfo(ctx, p.After, attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := devices.ForReplay(ctx, p.After.Capture)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("No compatible replay devices found")
+	}
+
+	// Replay on all the devices in parallel.
+	out := &service.FramebufferComparison{
+		Framebuffers: make([]*service.DeviceFramebuffer, len(devices)),
+	}
+	images := make([]*image.Data, len(devices))
+	wg := sync.WaitGroup{}
+	for i, d := range devices {
+		i, d := i, d
+		out.Framebuffers[i] = &service.DeviceFramebuffer{Device: d}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			iip, data, err := readFramebuffer(ctx, d, p.After, attachment, fbInfo, format)
+			if err != nil {
+				log.W(ctx, "Couldn't read the framebuffer of device %v: %v", d.Id.ID(), err)
+				out.Framebuffers[i].Error = err.Error()
+				return
+			}
+			out.Framebuffers[i].Image = iip
+			images[i] = &image.Data{
+				Bytes:  data,
+				Width:  fbInfo.width,
+				Height: fbInfo.height,
+				Depth:  1,
+				Format: format,
+			}
+		}()
+	}
+	wg.Wait()
+
+	for a := range images {
+		for b := a + 1; b < len(images); b++ {
+			if images[a] == nil || images[b] == nil {
+				continue
+			}
+			diff, err := framebufferDifference(images[a], images[b])
+			if err != nil {
+				return nil, err
+			}
+			diff.A, diff.B = uint32(a), uint32(b)
+			out.Differences = append(out.Differences, diff)
+		}
+	}
+	return out, nil
+}
+
+// readFramebuffer returns the path to the framebuffer attachment replayed on
+// the device d, and its data converted to the F32 format f.
+func readFramebuffer(
+	ctx context.Context,
+	d *path.Device,
+	after *path.Command,
+	attachment api.FramebufferAttachment,
+	fbInfo framebufferAttachmentInfo,
+	f *image.Format) (*path.ImageInfo, []byte, error) {
+
+	iip, err := FramebufferAttachment(ctx, d, after, attachment,
+		&service.RenderSettings{MaxWidth: fbInfo.width, MaxHeight: fbInfo.height},
+		&service.UsageHints{Primary: true},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := ImageInfo(ctx, iip)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Width != fbInfo.width || info.Height != fbInfo.height {
+		return nil, nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+	if info, err = info.Convert(ctx, f); err != nil {
+		return nil, nil, err
+	}
+	boxedBytes, err := database.Resolve(ctx, info.Bytes.ID())
+	if err != nil {
+		return nil, nil, err
+	}
+	return iip, boxedBytes.([]byte), nil
+}
+
+// framebufferDifference returns the difference between the two framebuffers
+// a and b.
+func framebufferDifference(a, b *image.Data) (*service.FramebufferDifference, error) {
+	m, err := image.ComputeDifferenceMetrics(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return &service.FramebufferDifference{
+		MeanSquareError: float32(m.MeanSquareError),
+		MaxDifference:   float32(m.MaxDifference),
+		DifferentPixels: m.DifferentPixels,
+		Pixels:          m.Pixels,
+	}, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// ImageStats resolves and returns the per-channel statistics of the image at
+// p.
+func ImageStats(ctx context.Context, p *path.ImageStats) (*image.Stats, error) {
+	var info *image.Info
+	switch parent := p.Parent().(type) {
+	case *path.ImageInfo:
+		ii, err := ImageInfo(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		info = ii
+	case *path.ResourceData:
+		obj, err := ResolveInternal(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		ii, err := resourceImage(obj, p.Level, p.Layer)
+		if err != nil {
+			return nil, err
+		}
+		info = ii
+	default:
+		return nil, fmt.Errorf("Unexpected ImageStats parent %T", parent)
+	}
+	return info.Stats(ctx, p.HistogramBins, float64(p.LowPercentile), float64(p.HighPercentile))
+}
+
+// resourceImage returns the image at the given mip-level and layer of the
+// texture resource data obj.
+func resourceImage(obj interface{}, level, layer uint32) (*image.Info, error) {
+	data, ok := obj.(*api.ResourceData)
+	if !ok {
+		return nil, fmt.Errorf("Resource data was %T, expected *api.ResourceData", obj)
+	}
+	texture := data.GetTexture()
+	if texture == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrNotATexture()}
+	}
+	info := texture.Image(level, layer)
+	if info == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrNoTextureImage(level, layer)}
+	}
+	return info, nil
+}
@@ -0,0 +1,298 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// pixelHistoryWorkers is the number of framebuffer reads that are requested in
+// parallel, allowing the replay manager to batch them.
+const pixelHistoryWorkers = 32
+
+// PixelHistory resolves and returns the pixel history for the path p.
+func PixelHistory(ctx context.Context, p *path.PixelHistory) (*service.PixelHistory, error) {
+	obj, err := database.Build(ctx, &PixelHistoryResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.PixelHistory), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *PixelHistoryResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	p := r.Path
+	ctx = capture.Put(ctx, p.After.Capture)
+
+	attachment := api.FramebufferAttachment(p.Attachment)
+	if attachment < api.FramebufferAttachment_Color0 || attachment > api.FramebufferAttachment_Color3 {
+		return nil, &service.ErrInvalidPath{
+			Reason: messages.ErrInvalidEnumValue(p.Attachment, "FramebufferAttachment"),
+			Path:   p.Path(),
+		}
+	}
+
+	fbInfo, err := FramebufferAttachmentInfo(ctx, p.After, attachment)
+	if err != nil {
+		return nil, err
+	}
+	if p.X >= fbInfo.width {
+		return nil, errPathOOB(uint64(p.X), "X", 0, uint64(fbInfo.width)-1, p)
+	}
+	if p.Y >= fbInfo.height {
+		return nil, errPathOOB(uint64(p.Y), "Y", 0, uint64(fbInfo.height)-1, p)
+	}
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	after := p.After.Indices[0]
+	if after >= uint64(len(c.Commands)) {
+		return nil, errPathOOB(after, "Index", 0, uint64(len(c.Commands))-1, p.After)
+	}
+
+	draws := frameDrawCalls(c.Commands, after)
+	if len(draws) == 0 {
+		return &service.PixelHistory{}, nil
+	}
+
+	devices, err := devices.ForReplay(ctx, p.After.Capture)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("No compatible replay devices found")
+	}
+	replayDevice := devices[0]
+
+	// Read the pixel before and after each draw call.
+	reader := pixelReader{
+		device:     replayDevice,
+		capture:    p.After.Capture,
+		attachment: attachment,
+		width:      fbInfo.width,
+		height:     fbInfo.height,
+		x:          p.X,
+		y:          p.Y,
+	}
+	indices := []uint64{}
+	for i, d := range draws {
+		if d > 0 && (i == 0 || draws[i-1] != d-1) {
+			indices = append(indices, uint64(d)-1)
+		}
+		indices = append(indices, uint64(d))
+	}
+	pixels, err := reader.read(ctx, indices)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the fragment test results, if supported by the API.
+	var tests map[api.CmdID]replay.FragmentTests
+	if q, ok := c.Commands[after].API().(replay.QueryFragmentTests); ok {
+		intent := replay.Intent{Device: replayDevice, Capture: p.After.Capture}
+		results, err := q.QueryFragmentTests(ctx, intent, replay.GetManager(ctx), draws, p.X, p.Y, nil)
+		if err != nil {
+			log.W(ctx, "Couldn't get the fragment test results: %v", err)
+		} else {
+			tests = make(map[api.CmdID]replay.FragmentTests, len(results))
+			for _, t := range results {
+				tests[t.Command] = t
+			}
+		}
+	}
+
+	return &service.PixelHistory{
+		Entries: pixelHistoryEntries(p.After.Capture, draws, pixels, tests),
+	}, nil
+}
+
+// pixelHistoryEntries returns the entries of the draw calls draws, given the
+// pixel values after each command and the fragment test results, which may
+// be missing. The draw calls that didn't rasterize the pixel are dropped.
+// Without the fragment test results, all the draw calls are kept, as a draw
+// call that failed the tests leaves the pixel unchanged too.
+func pixelHistoryEntries(
+	capture *path.Capture,
+	draws []api.CmdID,
+	pixels map[uint64]*service.PixelValue,
+	tests map[api.CmdID]replay.FragmentTests) []*service.PixelHistoryEntry {
+
+	out := []*service.PixelHistoryEntry{}
+	for _, d := range draws {
+		entry := &service.PixelHistoryEntry{
+			Command: capture.Command(uint64(d)),
+			Post:    pixels[uint64(d)],
+		}
+		if d > 0 {
+			entry.Pre = pixels[uint64(d)-1]
+		}
+		if t, ok := tests[d]; ok {
+			entry.TestsKnown = true
+			entry.Rasterized = t.Rasterized
+			entry.StencilPassed = t.StencilPassed
+			entry.DepthPassed = t.DepthPassed
+		}
+		if !entry.TestsKnown || entry.Rasterized {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// frameDrawCalls returns the draw calls in the frame containing the command
+// with index after, up to and including after.
+func frameDrawCalls(cmds []api.Cmd, after uint64) []api.CmdID {
+	start := uint64(0)
+	for i := after; i > 0; i-- {
+		f := cmds[i].CmdFlags()
+		if f.IsStartOfFrame() {
+			start = i
+			break
+		}
+		if i < after && f.IsEndOfFrame() {
+			start = i + 1
+			break
+		}
+	}
+	draws := []api.CmdID{}
+	for i := start; i <= after; i++ {
+		if cmds[i].CmdFlags().IsDrawCall() {
+			draws = append(draws, api.CmdID(i))
+		}
+	}
+	return draws
+}
+
+// pixelReader reads a single pixel of the framebuffer after commands using
+// framebuffer attachment replays.
+type pixelReader struct {
+	device        *path.Device
+	capture       *path.Capture
+	attachment    api.FramebufferAttachment
+	width, height uint32
+	x, y          uint32
+}
+
+// read returns the value of the pixel after each of the commands with the
+// given indices.
+func (r pixelReader) read(ctx context.Context, indices []uint64) (map[uint64]*service.PixelValue, error) {
+	events := &task.Events{}
+	pool, shutdown := task.Pool(0, pixelHistoryWorkers)
+	defer shutdown(ctx)
+	executor := task.Batch(pool, events)
+
+	mutex := sync.Mutex{}
+	out := make(map[uint64]*service.PixelValue, len(indices))
+	var firstErr error
+	for _, i := range indices {
+		i := i
+		executor(ctx, func(ctx context.Context) error {
+			v, err := r.after(ctx, r.capture.Command(i))
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return nil
+			}
+			out[i] = v
+			return nil
+		})
+	}
+	events.Wait(ctx)
+	return out, firstErr
+}
+
+// after returns the value of the pixel after the command cmd.
+func (r pixelReader) after(ctx context.Context, cmd *path.Command) (*service.PixelValue, error) {
+	color, err := r.channels(ctx, cmd, r.attachment, image.RGBA_F32)
+	if err != nil {
+		return nil, err
+	}
+	out := &service.PixelValue{
+		Red:   color[0],
+		Green: color[1],
+		Blue:  color[2],
+		Alpha: color[3],
+	}
+	if _, err := FramebufferAttachmentInfo(ctx, cmd, api.FramebufferAttachment_Depth); err == nil {
+		depth, err := r.channels(ctx, cmd, api.FramebufferAttachment_Depth, image.D_F32)
+		if err != nil {
+			return nil, err
+		}
+		out.Depth, out.HasDepth = depth[0], true
+	}
+	return out, nil
+}
+
+// channels returns the channel values of the pixel of attachment after cmd,
+// converted to the F32 format f.
+func (r pixelReader) channels(ctx context.Context, cmd *path.Command, attachment api.FramebufferAttachment, f *image.Format) ([]float32, error) {
+	iip, err := FramebufferAttachment(ctx, r.device, cmd, attachment,
+		&service.RenderSettings{MaxWidth: r.width, MaxHeight: r.height},
+		&service.UsageHints{Background: true},
+	)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ImageInfo(ctx, iip)
+	if err != nil {
+		return nil, err
+	}
+	if info.Width != r.width || info.Height != r.height {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+	if info, err = info.Convert(ctx, f); err != nil {
+		return nil, err
+	}
+	boxedBytes, err := database.Resolve(ctx, info.Bytes.ID())
+	if err != nil {
+		return nil, err
+	}
+	data := boxedBytes.([]byte)
+
+	count := len(f.Channels())
+	offset := int(r.y*r.width+r.x) * count * 4
+	if offset+count*4 > len(data) {
+		return nil, fmt.Errorf("Framebuffer data too short for pixel (%v, %v)", r.x, r.y)
+	}
+	out := make([]float32, count)
+	er := endian.Reader(bytes.NewReader(data[offset:]), device.LittleEndian)
+	for i := range out {
+		out[i] = er.Float32()
+	}
+	return out, er.Error()
+}
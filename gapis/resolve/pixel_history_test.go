@@ -0,0 +1,102 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestFrameDrawCalls(t *testing.T) {
+	ctx := log.Testing(t)
+	cmd := func(f api.CmdFlags) api.Cmd { return &testcmd.A{Flags: f} }
+	draw, eof, sof := cmd(api.DrawCall), cmd(api.EndOfFrame), cmd(api.StartOfFrame)
+	other := cmd(0)
+
+	for _, test := range []struct {
+		name     string
+		cmds     []api.Cmd
+		after    uint64
+		expected []api.CmdID
+	}{
+		{"First frame", []api.Cmd{
+			draw, other, draw, eof, draw,
+		}, 2, []api.CmdID{0, 2}},
+		{"Up to after", []api.Cmd{
+			draw, other, draw, eof, draw,
+		}, 1, []api.CmdID{0}},
+		{"After end of frame", []api.Cmd{
+			draw, eof, other, draw, draw, eof, draw,
+		}, 4, []api.CmdID{3, 4}},
+		{"After is end of frame", []api.Cmd{
+			draw, eof, draw, draw, eof, draw,
+		}, 4, []api.CmdID{2, 3}},
+		{"Start of frame", []api.Cmd{
+			draw, draw, sof, draw, other, draw,
+		}, 5, []api.CmdID{3, 5}},
+		{"Draw starting the frame", []api.Cmd{
+			draw, eof, cmd(api.DrawCall | api.StartOfFrame), draw,
+		}, 3, []api.CmdID{2, 3}},
+		{"No draws", []api.Cmd{
+			draw, eof, other, other,
+		}, 3, []api.CmdID{}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		got := frameDrawCalls(test.cmds, test.after)
+		assert.For(ctx, "draws").ThatSlice(got).Equals(test.expected)
+	}
+}
+
+func TestPixelHistoryEntries(t *testing.T) {
+	ctx := log.Testing(t)
+	c := &path.Capture{}
+	pixels := map[uint64]*service.PixelValue{
+		0: {Red: 0.1},
+		1: {Red: 0.2},
+		2: {Red: 0.2},
+		3: {Red: 0.2},
+	}
+	draws := []api.CmdID{1, 2, 3}
+
+	// Draw 1 changed the pixel, draw 2 was rasterized but failed the depth
+	// test and draw 3 didn't cover the pixel.
+	tests := map[api.CmdID]replay.FragmentTests{
+		1: {Command: 1, Rasterized: true, StencilPassed: true, DepthPassed: true},
+		2: {Command: 2, Rasterized: true, StencilPassed: true},
+		3: {Command: 3},
+	}
+	got := pixelHistoryEntries(c, draws, pixels, tests)
+	assert.For(ctx, "entries").That(got).DeepEquals([]*service.PixelHistoryEntry{
+		{Command: c.Command(1), Pre: pixels[0], Post: pixels[1], TestsKnown: true,
+			Rasterized: true, StencilPassed: true, DepthPassed: true},
+		{Command: c.Command(2), Pre: pixels[1], Post: pixels[2], TestsKnown: true,
+			Rasterized: true, StencilPassed: true},
+	})
+
+	// Without the fragment tests, the draw calls that left the pixel unchanged
+	// are kept, with unknown test results.
+	got = pixelHistoryEntries(c, draws, pixels, nil)
+	assert.For(ctx, "unknown entries").That(got).DeepEquals([]*service.PixelHistoryEntry{
+		{Command: c.Command(1), Pre: pixels[0], Post: pixels[1]},
+		{Command: c.Command(2), Pre: pixels[1], Post: pixels[2]},
+		{Command: c.Command(3), Pre: pixels[2], Post: pixels[3]},
+	})
+}
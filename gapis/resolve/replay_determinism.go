@@ -0,0 +1,354 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	// minDeterminismRuns is the smallest number of runs that can be compared.
+	minDeterminismRuns = 2
+	// determinismBatchSize is the number of checkpoints whose framebuffers are
+	// read by each replay of a run.
+	determinismBatchSize = 64
+)
+
+// ReplayDeterminism resolves the comparison between several replays of the
+// commands at the given path. The comparison is not cached, as each request
+// is a new check, and the default replay device may change between requests.
+func ReplayDeterminism(ctx context.Context, p *path.ReplayDeterminism) (*service.ReplayDeterminism, error) {
+	ctx = capture.Put(ctx, p.Commands.Capture)
+
+	attachment := api.FramebufferAttachment(p.Attachment)
+	var format *image.Format
+	switch {
+	case attachment == api.FramebufferAttachment_Depth:
+		format = image.D_F32
+	case attachment >= api.FramebufferAttachment_Color0 && attachment <= api.FramebufferAttachment_Color3:
+		format = image.RGBA_F32
+	default:
+		return nil, &service.ErrInvalidPath{
+			Reason: messages.ErrInvalidEnumValue(p.Attachment, "FramebufferAttachment"),
+			Path:   p.Path(),
+		}
+	}
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	count := uint64(len(c.Commands))
+	from, to := p.Commands.From[0], p.Commands.To[0]
+	if to >= count {
+		return nil, errPathOOB(to, "To", 0, count-1, p.Commands)
+	}
+	if from > to {
+		return nil, errPathOOB(from, "From", 0, to, p.Commands)
+	}
+
+	device := p.Device
+	if device == nil {
+		devices, err := devices.ForReplay(ctx, p.Commands.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		device = devices[0]
+	}
+
+	runs := p.Runs
+	if runs < minDeterminismRuns {
+		runs = minDeterminismRuns
+	}
+
+	// Compare the framebuffer after each draw call and clear, and after the
+	// last command of the range.
+	out := &service.ReplayDeterminism{Device: device, Runs: runs}
+	checkpoints := []determinismCheckpoint{}
+	for i := from; i <= to; i++ {
+		cmd := c.Commands[i]
+		if f := cmd.CmdFlags(); i != to && !f.IsDrawCall() && !f.IsClear() {
+			continue
+		}
+		query, ok := cmd.API().(replay.QueryFramebufferAttachment)
+		if !ok {
+			continue
+		}
+		after := p.Commands.Capture.Command(i)
+		fbInfo, err := FramebufferAttachmentInfo(ctx, after, attachment)
+		if err != nil {
+			continue // No framebuffer to compare.
+		}
+		out.Checkpoints = append(out.Checkpoints, after)
+		checkpoints = append(checkpoints, determinismCheckpoint{after, fbInfo, query})
+	}
+
+	reader := determinismReader{
+		device:     device,
+		capture:    p.Commands.Capture,
+		attachment: attachment,
+		runs:       int(runs),
+	}
+
+	// Find the first command whose issues differ between the first run and
+	// another. The framebuffers are only compared up to that command.
+	issues, err := reader.issues(ctx, c.APIs, api.CmdID(from), api.CmdID(to))
+	if err != nil {
+		return nil, err
+	}
+	issuesDiverged, issuesRun := api.CmdNoID, 0
+	for run := 1; run < reader.runs; run++ {
+		if id, ok := firstIssueDivergence(issues[0], issues[run]); ok && id < issuesDiverged {
+			issuesDiverged, issuesRun = id, run
+		}
+	}
+
+	diverged := func(after *path.Command, run int) {
+		out.DivergedAfter, out.DivergedRun = after, uint32(run)
+		id := api.CmdID(after.Indices[0])
+		if a, b := issues[0][id], issues[run][id]; !stringsEqual(a, b) {
+			out.FirstRunIssues, out.DivergedRunIssues = a, b
+		}
+	}
+
+	for i, cp := range checkpoints {
+		if api.CmdID(cp.after.Indices[0]) > issuesDiverged {
+			checkpoints = checkpoints[:i]
+			break
+		}
+	}
+	out.Checkpoints = out.Checkpoints[:len(checkpoints)]
+
+	for start := 0; start < len(checkpoints); start += determinismBatchSize {
+		end := start + determinismBatchSize
+		if end > len(checkpoints) {
+			end = len(checkpoints)
+		}
+		batch := checkpoints[start:end]
+		data, err := reader.read(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, cp := range batch {
+			for run := 1; run < reader.runs; run++ {
+				a, b := data[0][i], data[run][i]
+				if framebuffersIdentical(a, b) {
+					continue
+				}
+				log.W(ctx, "Replay %d diverged after command %v", run, cp.after.Indices)
+				diff, err := framebufferRunDifference(a, b, format)
+				if err != nil {
+					return nil, err
+				}
+				diff.A, diff.B = 0, uint32(run)
+				out.Difference = diff
+				diverged(cp.after, run)
+				return out, nil
+			}
+		}
+	}
+
+	if issuesDiverged != api.CmdNoID {
+		log.W(ctx, "Replay %d issues diverged after command %v", issuesRun, issuesDiverged)
+		diverged(p.Commands.Capture.Command(uint64(issuesDiverged)), issuesRun)
+	}
+	return out, nil
+}
+
+// determinismCheckpoint is a command after which the framebuffers of the runs
+// are compared.
+type determinismCheckpoint struct {
+	after *path.Command
+	info  framebufferAttachmentInfo
+	query replay.QueryFramebufferAttachment
+}
+
+// determinismReader reads the framebuffer attachment after checkpoints, in
+// several independent replays of the capture.
+type determinismReader struct {
+	device     *path.Device
+	capture    *path.Capture
+	attachment api.FramebufferAttachment
+	runs       int
+}
+
+// read returns the framebuffer data after each of the checkpoints, indexed by
+// run then by checkpoint. The checkpoints of each run are read by a replay of
+// their own.
+func (r determinismReader) read(ctx context.Context, checkpoints []determinismCheckpoint) ([][]*image.Data, error) {
+	out := make([][]*image.Data, r.runs)
+	mutex := sync.Mutex{}
+	var firstErr error
+	wg := sync.WaitGroup{}
+	for run := range out {
+		out[run] = make([]*image.Data, len(checkpoints))
+		ctx := replay.PutRun(ctx, uint32(run))
+		for i, cp := range checkpoints {
+			run, i, cp := run, i, cp
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := r.after(ctx, cp)
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					return
+				}
+				out[run][i] = data
+			}()
+		}
+	}
+	wg.Wait()
+	return out, firstErr
+}
+
+// issues returns the issues reported for the commands from to to in each run,
+// indexed by run then by command. The issues of a command are formatted and
+// sorted, so that the runs can be compared.
+func (r determinismReader) issues(ctx context.Context, apis []api.API, from, to api.CmdID) ([]map[api.CmdID][]string, error) {
+	out := make([]map[api.CmdID][]string, r.runs)
+	mutex := sync.Mutex{}
+	var firstErr error
+	wg := sync.WaitGroup{}
+	intent := replay.Intent{Device: r.device, Capture: r.capture}
+	for run := range out {
+		out[run] = map[api.CmdID][]string{}
+		ctx := replay.PutRun(ctx, uint32(run))
+		for _, a := range apis {
+			query, ok := a.(replay.QueryIssues)
+			if !ok {
+				continue
+			}
+			run := run
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				issues, err := query.QueryIssues(ctx, intent, replay.GetManager(ctx), nil)
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = log.Errf(ctx, err, "Couldn't get the issues of run %d", run)
+					}
+					return
+				}
+				for _, issue := range issues {
+					if issue.Command < from || issue.Command > to {
+						continue
+					}
+					out[run][issue.Command] = append(out[run][issue.Command], fmt.Sprintf("%v: %v", issue.Severity, issue.Error))
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	for _, issues := range out {
+		for _, list := range issues {
+			sort.Strings(list)
+		}
+	}
+	return out, firstErr
+}
+
+// after replays the capture and returns the framebuffer attachment after the
+// checkpoint cp. The framebuffer is not cached in the database, so that every
+// call issues a new replay request.
+func (r determinismReader) after(ctx context.Context, cp determinismCheckpoint) (*image.Data, error) {
+	intent := replay.Intent{Device: r.device, Capture: r.capture}
+	res, err := cp.query.QueryFramebufferAttachment(
+		ctx,
+		intent,
+		replay.GetManager(ctx),
+		cp.after.Indices,
+		cp.info.width,
+		cp.info.height,
+		r.attachment,
+		cp.info.index,
+		replay.WireframeMode_None,
+		nil,
+	)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Couldn't get the framebuffer after %v", cp.after)
+	}
+	return res, nil
+}
+
+// framebuffersIdentical returns true if the framebuffers a and b have the same
+// dimensions, format and bytes.
+func framebuffersIdentical(a, b *image.Data) bool {
+	return a.Width == b.Width && a.Height == b.Height && a.Depth == b.Depth &&
+		a.Format.Key() == b.Format.Key() && bytes.Equal(a.Bytes, b.Bytes)
+}
+
+// firstIssueDivergence returns the first command whose issues differ between
+// the runs a and b, and true, or false if the issues of all the commands are
+// identical.
+func firstIssueDivergence(a, b map[api.CmdID][]string) (api.CmdID, bool) {
+	first, found := api.CmdNoID, false
+	for _, m := range []map[api.CmdID][]string{a, b} {
+		for id := range m {
+			if id < first && !stringsEqual(a[id], b[id]) {
+				first, found = id, true
+			}
+		}
+	}
+	return first, found
+}
+
+// stringsEqual returns true if a and b hold the same strings in the same order.
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// framebufferRunDifference returns the difference between the framebuffers a
+// and b, once converted to the F32 format f.
+func framebufferRunDifference(a, b *image.Data, f *image.Format) (*service.FramebufferDifference, error) {
+	a, err := a.Convert(f)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = b.Convert(f); err != nil {
+		return nil, err
+	}
+	return framebufferDifference(a, b)
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func TestFirstIssueDivergence(t *testing.T) {
+	ctx := log.Testing(t)
+	type issues map[api.CmdID][]string
+
+	for _, test := range []struct {
+		name     string
+		a, b     issues
+		expected api.CmdID
+		diverged bool
+	}{
+		{"No issues", issues{}, issues{}, 0, false},
+		{"Identical", issues{
+			3: {"Error: a", "Warning: b"},
+			7: {"Error: c"},
+		}, issues{
+			3: {"Error: a", "Warning: b"},
+			7: {"Error: c"},
+		}, 0, false},
+		{"Issue missing", issues{
+			3: {"Error: a"},
+			7: {"Error: c"},
+		}, issues{
+			7: {"Error: c"},
+		}, 3, true},
+		{"Issue added", issues{
+			7: {"Error: c"},
+		}, issues{
+			5: {"Error: a"},
+			7: {"Error: c"},
+			9: {"Error: d"},
+		}, 5, true},
+		{"Issue changed", issues{
+			3: {"Error: a"},
+			7: {"Error: c"},
+			9: {"Error: d"},
+		}, issues{
+			3: {"Error: a"},
+			7: {"Error: c", "Warning: e"},
+			9: {"Error: f"},
+		}, 7, true},
+	} {
+		got, diverged := firstIssueDivergence(test.a, test.b)
+		assert.For(ctx, "%v diverged", test.name).That(diverged).Equals(test.diverged)
+		if test.diverged {
+			assert.For(ctx, "%v command", test.name).That(got).Equals(test.expected)
+		}
+	}
+}
+
+func TestFramebufferRunDifference(t *testing.T) {
+	ctx := log.Testing(t)
+	rgba := func(bytes ...byte) *image.Data {
+		return &image.Data{Width: 2, Height: 1, Depth: 1, Bytes: bytes, Format: image.RGBA_U8_NORM}
+	}
+	a := rgba(0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff)
+	b := rgba(0, 0, 0, 0xff, 0xff, 0, 0xff, 0xff)
+
+	assert.For(ctx, "identical").That(framebuffersIdentical(a, rgba(a.Bytes...))).Equals(true)
+	assert.For(ctx, "different bytes").That(framebuffersIdentical(a, b)).Equals(false)
+	assert.For(ctx, "different format").That(framebuffersIdentical(a,
+		&image.Data{Width: 2, Height: 1, Depth: 1, Bytes: a.Bytes, Format: image.R_U16_NORM})).Equals(false)
+
+	diff, err := framebufferRunDifference(a, b, image.RGBA_F32)
+	if assert.For(ctx, "err").ThatError(err).Succeeded() {
+		assert.For(ctx, "max difference").That(diff.MaxDifference).Equals(float32(1))
+		assert.For(ctx, "mean square error").That(diff.MeanSquareError).Equals(float32(1.0 / 8))
+		assert.For(ctx, "different pixels").That(diff.DifferentPixels).Equals(uint64(1))
+		assert.For(ctx, "pixels").That(diff.Pixels).Equals(uint64(2))
+	}
+}
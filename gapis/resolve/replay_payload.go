@@ -0,0 +1,282 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/replay/opcode"
+	"github.com/google/gapid/gapis/replay/protocol"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// maxAnnotatedStringLength is the maximum number of characters of a constant
+// string shown in the annotation of an instruction.
+const maxAnnotatedStringLength = 64
+
+// ReplayPayload resolves the disassembly of the replay payload at the given
+// path. If the path has no device, the first replay device found now is used.
+func ReplayPayload(ctx context.Context, p *path.ReplayPayload) (*service.ReplayPayload, error) {
+	if p.Device == nil {
+		devices, err := devices.ForReplay(ctx, p.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("No compatible replay devices found")
+		}
+		p = &path.ReplayPayload{Capture: p.Capture, Device: devices[0], After: p.After}
+	}
+	obj, err := database.Build(ctx, &ReplayPayloadResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.ReplayPayload), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *ReplayPayloadResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Path.Capture)
+
+	intent := replay.Intent{
+		Device:  r.Path.Device,
+		Capture: r.Path.Capture,
+	}
+
+	var query func(ctx context.Context) error
+	if r.Path.After != nil {
+		q, err := r.framebufferQuery(ctx, intent)
+		if err != nil {
+			return nil, err
+		}
+		query = q
+	} else {
+		q, err := r.issuesQuery(ctx, intent)
+		if err != nil {
+			return nil, err
+		}
+		query = q
+	}
+
+	dump, err := replay.GetManager(ctx).Dump(ctx, query)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't build the replay payload")
+	}
+	out, err := disassemblePayload(dump)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dump.Payload.Encode(protocol.MaxVersion, dump.MemoryLayout.GetEndian())
+	if err != nil {
+		return nil, err
+	}
+	id, err := database.Store(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	out.Data = path.NewBlob(id)
+	out.Abi = dump.ABI
+	return out, nil
+}
+
+// framebufferQuery returns the query that reads the color framebuffer after
+// the command of the path.
+func (r *ReplayPayloadResolvable) framebufferQuery(ctx context.Context, intent replay.Intent) (func(ctx context.Context) error, error) {
+	cmd, err := Cmd(ctx, r.Path.After)
+	if err != nil {
+		return nil, err
+	}
+	a := cmd.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+	query, ok := a.(replay.QueryFramebufferAttachment)
+	if !ok {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+	info, err := FramebufferAttachmentInfo(ctx, r.Path.After, api.FramebufferAttachment_Color0)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := query.QueryFramebufferAttachment(
+			ctx,
+			intent,
+			replay.GetManager(ctx),
+			r.Path.After.Indices,
+			info.width,
+			info.height,
+			api.FramebufferAttachment_Color0,
+			info.index,
+			replay.WireframeMode_None,
+			&service.UsageHints{Primary: true},
+		)
+		return err
+	}, nil
+}
+
+// issuesQuery returns the query that looks for replay issues, using the first
+// API of the capture that supports it.
+func (r *ReplayPayloadResolvable) issuesQuery(ctx context.Context, intent replay.Intent) (func(ctx context.Context) error, error) {
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range c.APIs {
+		if query, ok := a.(replay.QueryIssues); ok {
+			return func(ctx context.Context) error {
+				_, err := query.QueryIssues(ctx, intent, replay.GetManager(ctx), &service.UsageHints{Primary: true})
+				return err
+			}, nil
+		}
+	}
+	return nil, log.Err(ctx, nil, "No API of the capture supports replay issues")
+}
+
+// disassemblePayload returns the annotated disassembly of the payload of d.
+func disassemblePayload(d *replay.Dump) (*service.ReplayPayload, error) {
+	p := d.Payload
+	ops, err := opcode.Disassemble(bytes.NewReader(p.Opcodes), d.MemoryLayout.GetEndian())
+	if err != nil {
+		return nil, err
+	}
+
+	functions := map[[2]uint32]builder.FunctionInfo{}
+	for _, f := range d.Functions {
+		functions[[2]uint32{uint32(f.ApiIndex), uint32(f.ID)}] = f
+	}
+
+	out := &service.ReplayPayload{
+		StackSize:          p.StackSize,
+		VolatileMemorySize: p.VolatileMemorySize,
+		ConstantMemorySize: uint32(len(p.Constants)),
+		OpcodesSize:        uint32(len(p.Opcodes)),
+		Resources:          make([]*service.ReplayPayloadResource, len(p.Resources)),
+		Instructions:       make([]*service.ReplayPayloadInstruction, len(ops)),
+	}
+	for i, r := range p.Resources {
+		out.Resources[i] = &service.ReplayPayloadResource{Id: r.ID, Size: r.Size}
+	}
+
+	command := uint64(api.CmdNoID)
+	var last interface{}
+	for i, op := range ops {
+		inst := &service.ReplayPayloadInstruction{}
+		switch op := op.(type) {
+		case opcode.Call:
+			inst.Opcode = "Call"
+			inst.Operands = fmt.Sprintf("api: %d, function: %d, push-return: %v", op.ApiIndex, op.FunctionID, op.PushReturn)
+			if f, ok := functions[[2]uint32{uint32(op.ApiIndex), uint32(op.FunctionID)}]; ok && f.Name != "" {
+				inst.Annotation = f.Name
+			}
+		case opcode.PushI:
+			inst.Opcode = "PushI"
+			inst.Operands = fmt.Sprintf("%v 0x%x", op.DataType, op.Value)
+			if op.DataType == protocol.Type_ConstantPointer {
+				inst.Annotation = constantString(p.Constants, uint64(op.Value))
+			}
+		case opcode.Extend:
+			inst.Opcode = "Extend"
+			inst.Operands = fmt.Sprintf("0x%x", op.Value)
+			if push, ok := last.(opcode.PushI); ok && push.DataType == protocol.Type_ConstantPointer {
+				inst.Annotation = constantString(p.Constants, uint64(push.Value)<<26|uint64(op.Value))
+			}
+		case opcode.LoadC:
+			inst.Opcode = "LoadC"
+			inst.Operands = fmt.Sprintf("%v 0x%x", op.DataType, op.Address)
+		case opcode.LoadV:
+			inst.Opcode = "LoadV"
+			inst.Operands = fmt.Sprintf("%v 0x%x", op.DataType, op.Address)
+		case opcode.Load:
+			inst.Opcode = "Load"
+			inst.Operands = fmt.Sprintf("%v", op.DataType)
+		case opcode.Pop:
+			inst.Opcode = "Pop"
+			inst.Operands = fmt.Sprintf("%d", op.Count)
+		case opcode.StoreV:
+			inst.Opcode = "StoreV"
+			inst.Operands = fmt.Sprintf("0x%x", op.Address)
+		case opcode.Store:
+			inst.Opcode = "Store"
+		case opcode.Resource:
+			inst.Opcode = "Resource"
+			inst.Operands = fmt.Sprintf("%d", op.ID)
+			if int(op.ID) < len(p.Resources) {
+				r := p.Resources[op.ID]
+				inst.Annotation = fmt.Sprintf("%v (%d bytes)", r.ID, r.Size)
+			}
+		case opcode.Post:
+			inst.Opcode = "Post"
+		case opcode.Copy:
+			inst.Opcode = "Copy"
+			inst.Operands = fmt.Sprintf("%d", op.Count)
+		case opcode.Clone:
+			inst.Opcode = "Clone"
+			inst.Operands = fmt.Sprintf("%d", op.Index)
+		case opcode.Strcpy:
+			inst.Opcode = "Strcpy"
+			inst.Operands = fmt.Sprintf("%d", op.MaxSize)
+		case opcode.Add:
+			inst.Opcode = "Add"
+			inst.Operands = fmt.Sprintf("%d", op.Count)
+		case opcode.Label:
+			inst.Opcode = "Label"
+			inst.Operands = fmt.Sprintf("%d", op.Value)
+			command = uint64(op.Value)
+		default:
+			inst.Opcode = fmt.Sprintf("%T", op)
+		}
+		inst.Command = command
+		out.Instructions[i] = inst
+		last = op
+	}
+	return out, nil
+}
+
+// constantString returns the quoted null-terminated string at addr in the
+// constant memory, or an empty string if there is no printable string there.
+func constantString(constants []byte, addr uint64) string {
+	if addr >= uint64(len(constants)) {
+		return ""
+	}
+	data := constants[addr:]
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 {
+		return ""
+	}
+	s := string(data[:end])
+	for _, r := range s {
+		if !strconv.IsPrint(r) && r != '\n' && r != '\t' {
+			return ""
+		}
+	}
+	if len(s) > maxAnnotatedStringLength {
+		return strconv.Quote(s[:maxAnnotatedStringLength]) + "..."
+	}
+	return strconv.Quote(s)
+}
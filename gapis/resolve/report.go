@@ -80,6 +80,14 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 		items[i].Tags = append(items[i].Tags, t)
 	}
 
+	// Statically analyze the commands of the APIs that support it.
+	analyzers := []api.Analyzer{}
+	for _, a := range c.APIs {
+		if p, ok := a.(api.AnalysisProvider); ok {
+			analyzers = append(analyzers, p.NewAnalyzer(ctx))
+		}
+	}
+
 	issues := map[api.CmdID][]replay.Issue{}
 
 	if r.Path.Device != nil {
@@ -104,7 +112,12 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 						Severity: service.Severity_ErrorLevel,
 						Error:    err,
 					}
-					issues[api.CmdNoID] = append(issues[api.CmdNoID], issue)
+					if crash, ok := err.(*replay.ErrCrashed); ok {
+						// Report the command found to crash the replay device.
+						issue.Command = crash.Command
+						issue.Severity = service.Severity_FatalLevel
+					}
+					issues[issue.Command] = append(issues[issue.Command], issue)
 					continue
 				}
 				for _, issue := range apiIssues {
@@ -129,6 +142,10 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 				messages.ErrTraceAssert(as.Reason)))
 		}
 
+		for _, a := range analyzers {
+			a.PreMutate(ctx, cmd, state)
+		}
+
 		err := cmd.Mutate(ctx, state, nil /* no builder, just mutate */)
 
 		if len(items) == 0 {
@@ -140,6 +157,18 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 					messages.ErrMessage(fmt.Sprintf("%v", lastError))))
 			}
 		}
+
+		if err == nil {
+			for _, a := range analyzers {
+				for _, issue := range a.PostMutate(ctx, cmd, state) {
+					item := r.newReportItem(issue.Severity, uint64(i), issue.Message)
+					if len(issue.Subcommand) > 0 {
+						item.Item.Command = r.Path.Capture.Command(uint64(i), issue.Subcommand...)
+					}
+					items = append(items, item)
+				}
+			}
+		}
 	}
 
 	// Gather report items from the state mutator, and collect together all the
@@ -152,8 +181,11 @@ func (r *ReportResolvable) Resolve(ctx context.Context) (interface{}, error) {
 				builder.Add(ctx, item)
 			}
 			for _, issue := range issues[api.CmdID(i)] {
-				item := r.newReportItem(log.Severity(issue.Severity), uint64(issue.Command),
-					messages.ErrReplayDriver(issue.Error.Error()))
+				msg := messages.ErrReplayDriver(issue.Error.Error())
+				if crash, ok := issue.Error.(*replay.ErrCrashed); ok {
+					msg = messages.ErrReplayCrashed(crash.Cause.Error())
+				}
+				item := r.newReportItem(log.Severity(issue.Severity), uint64(issue.Command), msg)
 				if int(issue.Command) < len(c.Commands) {
 					item.Tags = append(item.Tags, getAtomNameTag(c.Commands[issue.Command]))
 				}
@@ -0,0 +1,135 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/api/testcmd/test_pb"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/box"
+)
+
+func init() {
+	// Captures are stored as protos, analyzedCmds are stored as the Str of a
+	// testcmd.X. The recorded events are not stored.
+	protoconv.Register(func(ctx context.Context, c *analyzedCmd) (*test_pb.X, error) {
+		str := fmt.Sprintf("%v %v", c.name, c.fail)
+		return &test_pb.X{Data: box.NewValue(testcmd.X{Str: str})}, nil
+	}, func(ctx context.Context, p *test_pb.X) (*analyzedCmd, error) {
+		var x testcmd.X
+		if err := p.Data.AssignTo(&x); err != nil {
+			return nil, err
+		}
+		c := &analyzedCmd{}
+		_, err := fmt.Sscanf(x.Str, "%v %v", &c.name, &c.fail)
+		return c, err
+	})
+}
+
+// analyzedAPI is an API that records the calls of its analyzer to events.
+type analyzedAPI struct {
+	testcmd.API
+	events *[]string
+}
+
+func (a analyzedAPI) NewAnalyzer(ctx context.Context) api.Analyzer {
+	return recordingAnalyzer(a)
+}
+
+// recordingAnalyzer is an api.Analyzer that records its calls, along with
+// the last command mutated on the state it is given. It reports an issue
+// with each command.
+type recordingAnalyzer analyzedAPI
+
+func (a recordingAnalyzer) PreMutate(ctx context.Context, cmd api.Cmd, s *api.State) {
+	*a.events = append(*a.events, fmt.Sprintf("pre %v after %v", cmd.CmdName(), s.APIs[cmd.API()]))
+}
+
+func (a recordingAnalyzer) PostMutate(ctx context.Context, cmd api.Cmd, s *api.State) []api.Issue {
+	*a.events = append(*a.events, fmt.Sprintf("post %v after %v", cmd.CmdName(), s.APIs[cmd.API()]))
+	return []api.Issue{{Severity: log.Warning, Message: messages.ErrMessage(cmd.CmdName())}}
+}
+
+// analyzedCmd is a command of the analyzedAPI, that records its mutation and
+// fails if fail is true.
+type analyzedCmd struct {
+	testcmd.X
+	name   string
+	fail   bool
+	events *[]string
+}
+
+func (c *analyzedCmd) CmdName() string { return c.name }
+func (c *analyzedCmd) API() api.API    { return analyzedAPI{events: c.events} }
+func (c *analyzedCmd) Mutate(ctx context.Context, s *api.State, b *builder.Builder) error {
+	*c.events = append(*c.events, "mutate "+c.name)
+	if c.fail {
+		return fmt.Errorf("%v failed", c.name)
+	}
+	s.APIs[c.API()] = c.name
+	return nil
+}
+
+func TestReportAnalyzers(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	events := []string{}
+	c := newPathTest(ctx,
+		&analyzedCmd{name: "a", events: &events},
+		&analyzedCmd{name: "b", fail: true, events: &events},
+		&analyzedCmd{name: "c", events: &events},
+	)
+
+	report, err := Report(ctx, c.Report(nil, nil))
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+
+	// Each command is passed to the analyzer before and after its mutation.
+	// Commands that fail to mutate are not passed after their mutation.
+	assert.For(ctx, "events").ThatSlice(events).Equals([]string{
+		"pre a after <nil>",
+		"mutate a",
+		"post a after a",
+		"pre b after a",
+		"mutate b",
+		"pre c after a",
+		"mutate c",
+		"post c after c",
+	})
+
+	// The issues found by the analyzer are reported with their command.
+	got := []string{}
+	for _, item := range report.Items {
+		got = append(got, fmt.Sprintf("%v %v", item.Command.Indices, item.Severity))
+	}
+	assert.For(ctx, "items").ThatSlice(got).Equals([]string{
+		fmt.Sprintf("[0] %v", service.Severity_WarningLevel),
+		fmt.Sprintf("[1] %v", service.Severity_ErrorLevel),
+		fmt.Sprintf("[2] %v", service.Severity_WarningLevel),
+	})
+}
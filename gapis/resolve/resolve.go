@@ -288,6 +288,8 @@ func ResolveInternal(ctx context.Context, p path.Node) (interface{}, error) {
 		return Field(ctx, p)
 	case *path.ImageInfo:
 		return ImageInfo(ctx, p)
+	case *path.ImageStats:
+		return ImageStats(ctx, p)
 	case *path.MapIndex:
 		return MapIndex(ctx, p)
 	case *path.Memory:
@@ -298,6 +300,20 @@ func ResolveInternal(ctx context.Context, p path.Node) (interface{}, error) {
 		return Parameter(ctx, p)
 	case *path.Report:
 		return Report(ctx, p)
+	case *path.Stats:
+		return Stats(ctx, p)
+	case *path.Footprint:
+		return Footprint(ctx, p)
+	case *path.CppExport:
+		return CppExport(ctx, p)
+	case *path.ReplayPayload:
+		return ReplayPayload(ctx, p)
+	case *path.FramebufferComparison:
+		return FramebufferComparison(ctx, p)
+	case *path.ReplayDeterminism:
+		return ReplayDeterminism(ctx, p)
+	case *path.CompatCoverage:
+		return CompatCoverage(ctx, p)
 	case *path.ResourceData:
 		return ResourceData(ctx, p)
 	case *path.Resources:
@@ -314,6 +330,8 @@ func ResolveInternal(ctx context.Context, p path.Node) (interface{}, error) {
 		return StateTreeNode(ctx, p)
 	case *path.StateTreeNodeForPath:
 		return StateTreeNodeForPath(ctx, p)
+	case *path.PixelHistory:
+		return PixelHistory(ctx, p)
 	case *path.Thumbnail:
 		return Thumbnail(ctx, p)
 	default:
@@ -50,6 +50,12 @@ func APIState(ctx context.Context, p *path.State) (interface{}, error) {
 func (r *GlobalStateResolvable) Resolve(ctx context.Context) (interface{}, error) {
 	ctx = capture.Put(ctx, r.Path.After.Capture)
 	cmdIdx := r.Path.After.Indices[0]
+
+	s, err := globalStateFromCheckpoint(ctx, r.Path)
+	if s != nil || err != nil {
+		return s, err
+	}
+
 	allCmds, err := Cmds(ctx, r.Path.After.Capture)
 	if err != nil {
 		return nil, err
@@ -58,8 +64,7 @@ func (r *GlobalStateResolvable) Resolve(ctx context.Context) (interface{}, error
 	if err != nil {
 		return nil, err
 	}
-	s, err := capture.NewState(ctx)
-	if err != nil {
+	if s, err = capture.NewState(ctx); err != nil {
 		return nil, err
 	}
 	for _, cmd := range cmds {
@@ -96,14 +101,19 @@ func apiState(ctx context.Context, cmds []api.Cmd, p *path.State) (interface{},
 	if api == nil {
 		return nil, &service.ErrDataUnavailable{Reason: messages.ErrStateUnavailable()}
 	}
-	s, err := capture.NewState(ctx)
+	s, err := globalStateFromCheckpoint(ctx, p)
 	if err != nil {
 		return nil, err
 	}
-	for _, a := range cmds[:cmdIdx+1] {
-		if err := a.Mutate(ctx, s, nil); err != nil && err == context.Canceled {
+	if s == nil {
+		if s, err = capture.NewState(ctx); err != nil {
 			return nil, err
 		}
+		for _, a := range cmds[:cmdIdx+1] {
+			if err := a.Mutate(ctx, s, nil); err != nil && err == context.Canceled {
+				return nil, err
+			}
+		}
 	}
 	res, found := s.APIs[api]
 	if !found {
@@ -111,3 +121,19 @@ func apiState(ctx context.Context, cmds []api.Cmd, p *path.State) (interface{},
 	}
 	return res, nil
 }
+
+// globalStateFromCheckpoint returns the global state at p built from the nearest
+// state checkpoint, or nil if the state cannot be built from checkpoints.
+func globalStateFromCheckpoint(ctx context.Context, p *path.State) (*api.State, error) {
+	checkpoint, err := canCheckpoint(ctx, p.After)
+	if err != nil || !checkpoint {
+		return nil, err
+	}
+	s, err := stateFromCheckpoint(ctx, p.After.Capture, p.After.Indices[0])
+	if _, ok := err.(api.ErrStateNotCloneable); ok {
+		// Not all the API states can be cloned, the caller mutates the state
+		// from the first command instead.
+		return nil, nil
+	}
+	return s, err
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	// minCheckpointInterval is the smallest number of commands between two
+	// state checkpoints.
+	minCheckpointInterval = 10000
+	// maxCheckpoints is the largest number of state checkpoints of a capture.
+	// Each checkpoint holds a full copy of the state for the lifetime of the
+	// database, so large captures use fewer, more distant checkpoints.
+	maxCheckpoints = 32
+)
+
+// checkpointInterval returns the number of commands between two state
+// checkpoints of a capture of count commands.
+func checkpointInterval(count uint64) uint64 {
+	interval := (count + maxCheckpoints - 1) / maxCheckpoints
+	interval = (interval + minCheckpointInterval - 1) / minCheckpointInterval * minCheckpointInterval
+	if interval < minCheckpointInterval {
+		return minCheckpointInterval
+	}
+	return interval
+}
+
+// stateCheckpoint resolves a copy of the global state after mutating the
+// commands up to, but not including, index. index must be a multiple of
+// interval.
+// The returned state can be freely mutated.
+func stateCheckpoint(ctx context.Context, c *path.Capture, index, interval uint64) (*api.State, error) {
+	obj, err := database.Build(ctx, &StateCheckpointResolvable{Capture: c, Index: index, Interval: interval})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*api.State).Clone()
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *StateCheckpointResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Capture)
+	if r.Index == 0 {
+		return capture.NewState(ctx)
+	}
+	cmds, err := NCmds(ctx, r.Capture, r.Index)
+	if err != nil {
+		return nil, err
+	}
+	start := r.Index - r.Interval
+	s, err := stateCheckpoint(ctx, r.Capture, start, r.Interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds[start:r.Index] {
+		if err := cmd.Mutate(ctx, s, nil); err != nil && err == context.Canceled {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// canCheckpoint returns true if the state at p can be built from a state
+// checkpoint. This is only the case for top-level commands of captures that
+// do not use any synchronized API, as the commands of these APIs may be
+// reordered when building the state.
+func canCheckpoint(ctx context.Context, p *path.Command) (bool, error) {
+	if len(p.Indices) != 1 {
+		return false, nil
+	}
+	c, err := capture.ResolveFromPath(ctx, p.Capture)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range c.APIs {
+		if _, ok := a.(sync.SynchronizedAPI); ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stateFromCheckpoint returns the global state after the command at index,
+// starting from the nearest checkpoint before the command.
+func stateFromCheckpoint(ctx context.Context, c *path.Capture, index uint64) (*api.State, error) {
+	cmds, err := NCmds(ctx, c, index+1)
+	if err != nil {
+		return nil, err
+	}
+	interval := checkpointInterval(uint64(len(cmds)))
+	start := index - index%interval
+	s, err := stateCheckpoint(ctx, c, start, interval)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds[start : index+1] {
+		if err := cmd.Mutate(ctx, s, nil); err != nil && err == context.Canceled {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/protoconv"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/api/testcmd/test_pb"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/service/box"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func init() {
+	// Captures are stored as protos, counterCmds are stored as the Str of a
+	// testcmd.X.
+	protoconv.Register(func(ctx context.Context, c *counterCmd) (*test_pb.X, error) {
+		str := fmt.Sprintf("%d %v %v", c.N, c.cloneable, c.failClone)
+		return &test_pb.X{Data: box.NewValue(testcmd.X{Str: str})}, nil
+	}, func(ctx context.Context, p *test_pb.X) (*counterCmd, error) {
+		var x testcmd.X
+		if err := p.Data.AssignTo(&x); err != nil {
+			return nil, err
+		}
+		c := &counterCmd{}
+		_, err := fmt.Sscanf(x.Str, "%d %v %v", &c.N, &c.cloneable, &c.failClone)
+		return c, err
+	})
+}
+
+// checkpointState is a per-API state that records the values of all the
+// mutated counterCmds.
+type checkpointState struct {
+	Values    []uint64
+	cloneable bool
+}
+
+func (s *checkpointState) clone() *checkpointState {
+	return &checkpointState{append([]uint64{}, s.Values...), s.cloneable}
+}
+
+// cloneableState is a checkpointState that implements api.StateCloner.
+type cloneableState struct{ *checkpointState }
+
+func (s cloneableState) CloneState() (interface{}, error) {
+	if !s.cloneable {
+		return nil, fmt.Errorf("Clone failed")
+	}
+	return cloneableState{s.clone()}, nil
+}
+
+// counterCmd appends N to the checkpointState, and writes it to the
+// application pool.
+type counterCmd struct {
+	testcmd.X
+	N         uint64
+	cloneable bool
+	failClone bool
+}
+
+func (c *counterCmd) Mutate(ctx context.Context, s *api.State, b *builder.Builder) error {
+	var st *checkpointState
+	switch v := s.APIs[c.API()].(type) {
+	case nil:
+		st = &checkpointState{cloneable: !c.failClone}
+		if c.cloneable {
+			s.APIs[c.API()] = cloneableState{st}
+		} else {
+			s.APIs[c.API()] = st
+		}
+	case cloneableState:
+		st = v.checkpointState
+	case *checkpointState:
+		st = v
+	}
+	st.Values = append(st.Values, c.N)
+	s.Memory[memory.ApplicationPool].Write(c.N%0x100*8, memory.Blob([]byte{byte(c.N), byte(c.N >> 8)}))
+	return nil
+}
+
+func values(s *api.State) []uint64 {
+	switch v := s.APIs[testcmd.API{}].(type) {
+	case cloneableState:
+		return v.Values
+	case *checkpointState:
+		return v.Values
+	}
+	return nil
+}
+
+func newCheckpointCapture(ctx context.Context, count int, cmd counterCmd) *path.Capture {
+	cmds := make([]api.Cmd, count)
+	for i := range cmds {
+		c := cmd
+		c.N = uint64(i)
+		cmds[i] = &c
+	}
+	return newPathTest(ctx, cmds...)
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		count    uint64
+		expected uint64
+	}{
+		{0, minCheckpointInterval},
+		{1, minCheckpointInterval},
+		{maxCheckpoints * minCheckpointInterval, minCheckpointInterval},
+		{maxCheckpoints*minCheckpointInterval + 1, 2 * minCheckpointInterval},
+		{2000000, 70000},
+	} {
+		interval := checkpointInterval(test.count)
+		assert.For(ctx, "checkpointInterval(%v)", test.count).That(interval).Equals(test.expected)
+		assert.For(ctx, "checkpoints(%v)", test.count).That((test.count+interval-1)/interval <= maxCheckpoints).Equals(true)
+	}
+}
+
+func TestStateFromCheckpoint(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	const count = 2*minCheckpointInterval + 500
+	c := newCheckpointCapture(ctx, count, counterCmd{cloneable: true})
+	ctx = capture.Put(ctx, c)
+
+	for _, idx := range []uint64{0, 1, minCheckpointInterval - 1, minCheckpointInterval, minCheckpointInterval + 1, count - 1} {
+		ctx := log.V{"index": idx}.Bind(ctx)
+		p := c.Command(idx).StateAfter()
+
+		got, err := globalStateFromCheckpoint(ctx, p)
+		if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+			continue
+		}
+
+		// Build the expected state by mutating all the commands from the start.
+		expected, err := capture.NewState(ctx)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		cmds, err := NCmds(ctx, c, idx+1)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		for _, cmd := range cmds[:idx+1] {
+			assert.For(ctx, "err").ThatError(cmd.Mutate(ctx, expected, nil)).Succeeded()
+		}
+
+		assert.For(ctx, "values").ThatSlice(values(got)).Equals(values(expected))
+		rng := memory.Range{Base: 0, Size: 0x100 * 8}
+		gotMem, expectedMem := make([]byte, rng.Size), make([]byte, rng.Size)
+		err = got.Memory[memory.ApplicationPool].Slice(rng).Get(ctx, 0, gotMem)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		err = expected.Memory[memory.ApplicationPool].Slice(rng).Get(ctx, 0, expectedMem)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		assert.For(ctx, "memory").ThatSlice(gotMem).Equals(expectedMem)
+	}
+
+	// States returned from checkpoints do not alias the checkpoints.
+	p := c.Command(minCheckpointInterval).StateAfter()
+	s, err := globalStateFromCheckpoint(ctx, p)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	s.APIs[testcmd.API{}].(cloneableState).Values[0] = 42
+	s, err = globalStateFromCheckpoint(ctx, p)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "value").That(values(s)[0]).Equals(uint64(0))
+}
+
+func TestStateFromCheckpointErrors(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	// API states that cannot be cloned are built from the first command.
+	c := newCheckpointCapture(ctx, minCheckpointInterval+1, counterCmd{})
+	s, err := globalStateFromCheckpoint(capture.Put(ctx, c), c.Command(minCheckpointInterval).StateAfter())
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "state").That(s).IsNil()
+
+	// Errors raised when cloning the state are returned.
+	c = newCheckpointCapture(ctx, minCheckpointInterval+1, counterCmd{cloneable: true, failClone: true})
+	_, err = globalStateFromCheckpoint(capture.Put(ctx, c), c.Command(minCheckpointInterval).StateAfter())
+	assert.For(ctx, "err").ThatError(err).HasMessage("Clone failed")
+}
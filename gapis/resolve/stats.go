@@ -0,0 +1,152 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Stats resolves the command statistics of the capture at the given path.
+func Stats(ctx context.Context, p *path.Stats) (*service.CaptureStats, error) {
+	obj, err := database.Build(ctx, &StatsResolvable{p})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*service.CaptureStats), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *StatsResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = capture.Put(ctx, r.Path.Capture)
+
+	c, err := capture.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	contexts, err := Contexts(ctx, r.Path.Capture.Contexts())
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		name string
+		api  api.ID
+	}
+	counts := map[key]*service.CommandCount{}
+	threads := map[uint64]struct{}{}
+
+	out := &service.CaptureStats{
+		NumCommands: uint64(len(c.Commands)),
+		Total:       &service.FrameStats{},
+		NumContexts: uint32(len(contexts.List)),
+	}
+	var frame *service.FrameStats
+
+	for i, cmd := range c.Commands {
+		idx := uint64(i)
+		flags := cmd.CmdFlags()
+		threads[cmd.Thread()] = struct{}{}
+
+		a := cmd.API()
+		var apiID api.ID
+		if a != nil {
+			apiID = a.ID()
+		}
+		k := key{cmd.CmdName(), apiID}
+		count, ok := counts[k]
+		if !ok {
+			count = &service.CommandCount{Name: k.name}
+			if a != nil {
+				count.Api = &path.API{Id: path.NewID(id.ID(apiID))}
+				count.ApiName = a.Name()
+			}
+			counts[k] = count
+		}
+		count.Count++
+
+		if o := cmd.Extras().Observations(); o != nil {
+			out.NumObservations += uint64(len(o.Reads) + len(o.Writes))
+			for _, r := range o.Reads {
+				out.ObservedReadBytes += r.Range.Size
+			}
+			for _, w := range o.Writes {
+				out.ObservedWriteBytes += w.Range.Size
+			}
+		}
+
+		if flags.IsStartOfFrame() && frame != nil {
+			out.Frames = append(out.Frames, frame)
+			frame = nil
+		}
+		if frame == nil {
+			frame = &service.FrameStats{FirstCommand: idx}
+		}
+		frame.LastCommand = idx
+		if flags.IsDrawCall() {
+			frame.DrawCalls++
+		}
+		if p, ok := a.(api.StatsProvider); ok {
+			s := p.CmdStats(ctx, cmd)
+			frame.Triangles += s.Triangles
+			frame.TextureUploadBytes += s.TextureUploadBytes
+			frame.BufferUploadBytes += s.BufferUploadBytes
+			if s.StateChange {
+				frame.StateChanges++
+			}
+		}
+		if flags.IsEndOfFrame() {
+			out.Frames = append(out.Frames, frame)
+			frame = nil
+		}
+	}
+	if frame != nil {
+		out.Frames = append(out.Frames, frame)
+	}
+
+	for _, f := range out.Frames {
+		out.Total.DrawCalls += f.DrawCalls
+		out.Total.Triangles += f.Triangles
+		out.Total.TextureUploadBytes += f.TextureUploadBytes
+		out.Total.BufferUploadBytes += f.BufferUploadBytes
+		out.Total.StateChanges += f.StateChanges
+	}
+	if len(c.Commands) > 0 {
+		out.Total.LastCommand = uint64(len(c.Commands) - 1)
+	}
+
+	out.NumThreads = uint32(len(threads))
+	out.Commands = make([]*service.CommandCount, 0, len(counts))
+	for _, c := range counts {
+		out.Commands = append(out.Commands, c)
+	}
+	sort.Slice(out.Commands, func(i, j int) bool {
+		a, b := out.Commands[i], out.Commands[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+
+	return out, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package script implements a small query language over the commands and
+// state of a capture.
+//
+// A script is either a query, run for each command of the capture:
+//
+//   select <expr> {, <expr>} [where <expr>] [limit <count>]
+//
+// or a list of expressions, evaluated once after the command at the given
+// index, or after the last command of the capture:
+//
+//   <expr> {, <expr>} [at <index>]
+//
+// The expressions use the syntax of Go expressions, and are evaluated with the
+// following variables:
+//
+//   cmd      the current command
+//   index    the index of the current command
+//   frame    the index of the frame of the current command
+//   state    the api.State after the current command
+//   context  the API context bound to the thread of the current command
+//   <api>    the state of each API of the capture, by name ("gles", "vulkan")
+//
+// Fields of structures are accessed by name. Only the methods that read the
+// values they are called on can be called, such as the Get, Contains and
+// KeysSorted methods of maps. The parameters of commands are accessed by their
+// API name, such as cmd.target. Maps, slices and arrays can be indexed, with
+// keys converted to the type of the map keys. Accessing a field or an index of
+// nil returns nil.
+//
+// The following functions are available:
+//
+//   name(cmd)            the name of the command
+//   thread(cmd)          the thread of the command
+//   param(cmd, name)     the parameter of the command with the given name
+//   result(cmd)          the result of the command
+//   isDrawCall(cmd)      true if the command is a draw call
+//   isClear(cmd)         true if the command is a clear
+//   isStartOfFrame(cmd)  true if the command starts a frame, as eglSwapBuffers
+//   isEndOfFrame(cmd)    true if the command ends a frame, as vkQueuePresentKHR
+//   len(v)               the length of a string, slice, array or map
+//   str(v)               the string representation of v
+//   hex(v)               v as a hexadecimal number
+//   contains(s, sub)     true if the string s contains sub
+//   hasPrefix(s, prefix) true if the string s starts with prefix
+package script
@@ -0,0 +1,521 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// env holds the variables expressions are evaluated with.
+type env struct {
+	ctx  context.Context
+	vars map[string]interface{}
+}
+
+// bind binds the variables for the command cmd at index i, in the frame, to
+// the state after the command.
+func (e *env) bind(i, frame uint64, cmd api.Cmd, s *api.State) {
+	e.vars["cmd"] = cmd
+	e.vars["index"] = i
+	e.vars["frame"] = frame
+	e.vars["context"] = nil
+	if a := cmd.API(); a != nil {
+		if c := a.Context(s, cmd.Thread()); c != nil {
+			e.vars["context"] = c
+		}
+	}
+	for a, state := range s.APIs {
+		e.vars[a.Name()] = state
+	}
+}
+
+// eval returns the value of the expression x.
+func (e *env) eval(x ast.Expr) (interface{}, error) {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return literal(x)
+	case *ast.Ident:
+		switch x.Name {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if v, ok := e.vars[x.Name]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Undefined: %s", x.Name)
+	case *ast.ParenExpr:
+		return e.eval(x.X)
+	case *ast.SelectorExpr:
+		v, err := e.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return e.field(v, x.Sel.Name)
+	case *ast.IndexExpr:
+		v, err := e.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		i, err := e.eval(x.Index)
+		if err != nil {
+			return nil, err
+		}
+		return index(v, i)
+	case *ast.CallExpr:
+		return e.call(x)
+	case *ast.UnaryExpr:
+		v, err := e.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return unary(x.Op, v)
+	case *ast.BinaryExpr:
+		a, err := e.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		if x.Op == token.LAND || x.Op == token.LOR {
+			t, err := truth(a)
+			if err != nil || t == (x.Op == token.LOR) {
+				return t, err
+			}
+			b, err := e.eval(x.Y)
+			if err != nil {
+				return nil, err
+			}
+			return truth(b)
+		}
+		b, err := e.eval(x.Y)
+		if err != nil {
+			return nil, err
+		}
+		return binary(x.Op, a, b)
+	}
+	return nil, fmt.Errorf("Unsupported expression: %T", x)
+}
+
+func literal(x *ast.BasicLit) (interface{}, error) {
+	switch x.Kind {
+	case token.INT:
+		if i, err := strconv.ParseInt(x.Value, 0, 64); err == nil {
+			return i, nil
+		}
+		return strconv.ParseUint(x.Value, 0, 64)
+	case token.FLOAT:
+		return strconv.ParseFloat(x.Value, 64)
+	case token.STRING:
+		return strconv.Unquote(x.Value)
+	case token.CHAR:
+		r, _, _, err := strconv.UnquoteChar(x.Value[1:len(x.Value)-1], '\'')
+		return int64(r), err
+	}
+	return nil, fmt.Errorf("Unsupported literal: %v", x.Value)
+}
+
+// field returns the field name of v. The fields of commands are their
+// parameters.
+func (e *env) field(v interface{}, name string) (interface{}, error) {
+	if cmd, ok := v.(api.Cmd); ok {
+		if p, err := api.GetParameter(e.ctx, cmd, name); err == nil {
+			return p, nil
+		}
+	}
+	r := indirect(reflect.ValueOf(v))
+	if !r.IsValid() {
+		return nil, nil
+	}
+	switch r.Kind() {
+	case reflect.Struct:
+		if f := r.FieldByName(name); f.IsValid() && f.CanInterface() {
+			return f.Interface(), nil
+		}
+	case reflect.Map:
+		if r.Type().Key().Kind() == reflect.String {
+			return value(r.MapIndex(reflect.ValueOf(name).Convert(r.Type().Key()))), nil
+		}
+	}
+	return nil, fmt.Errorf("%T has no field %s", v, name)
+}
+
+// index returns the element i of v.
+func index(v, i interface{}) (interface{}, error) {
+	r := indirect(reflect.ValueOf(v))
+	if !r.IsValid() {
+		return nil, nil
+	}
+	switch r.Kind() {
+	case reflect.Map:
+		key, err := convert(i, r.Type().Key())
+		if err != nil {
+			return nil, err
+		}
+		return value(r.MapIndex(key)), nil
+	case reflect.Slice, reflect.Array, reflect.String:
+		n, ok := integer(i)
+		if !ok {
+			return nil, fmt.Errorf("Invalid index %v", format(i))
+		}
+		if n < 0 || n >= int64(r.Len()) {
+			return nil, fmt.Errorf("Index %d out of range [0, %d)", n, r.Len())
+		}
+		return r.Index(int(n)).Interface(), nil
+	}
+	return nil, fmt.Errorf("%T cannot be indexed", v)
+}
+
+// call returns the result of the call of a function or method.
+func (e *env) call(x *ast.CallExpr) (interface{}, error) {
+	args := make([]interface{}, len(x.Args))
+	for i, arg := range x.Args {
+		v, err := e.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch f := x.Fun.(type) {
+	case *ast.Ident:
+		b, ok := builtins[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("Undefined function: %s", f.Name)
+		}
+		if len(args) != b.args {
+			return nil, fmt.Errorf("%s takes %d arguments, got %d", f.Name, b.args, len(args))
+		}
+		return b.f(e, args)
+	case *ast.SelectorExpr:
+		v, err := e.eval(f.X)
+		if err != nil {
+			return nil, err
+		}
+		return method(v, f.Sel.Name, args)
+	}
+	return nil, fmt.Errorf("Unsupported call: %T", x.Fun)
+}
+
+// method returns the result of the method name of v, called with args.
+func method(v interface{}, name string, args []interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if !methods[name] {
+		return nil, fmt.Errorf("Method %s cannot be called by scripts", name)
+	}
+	r := reflect.ValueOf(v)
+	m := r.MethodByName(name)
+	for !m.IsValid() && (r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface) && !r.IsNil() {
+		r = r.Elem()
+		m = r.MethodByName(name)
+	}
+	if !m.IsValid() {
+		return nil, fmt.Errorf("%T has no method %s", v, name)
+	}
+	t := m.Type()
+	if t.IsVariadic() || t.NumIn() != len(args) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, t.NumIn(), len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var err error
+		if in[i], err = convert(arg, t.In(i)); err != nil {
+			return nil, err
+		}
+	}
+	out := m.Call(in)
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:n-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return value(out[0]), nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// methods are the names of the methods that can be called by scripts. They
+// are the accessors of the generated maps, pointers, objects and commands,
+// which do not modify the values they are called on.
+var methods = map[string]bool{
+	"Contains":       true,
+	"Get":            true,
+	"KeysSorted":     true,
+	"Range":          true,
+	"Address":        true,
+	"IsNullptr":      true,
+	"GetID":          true,
+	"String":         true,
+	"Name":           true,
+	"CmdName":        true,
+	"Thread":         true,
+	"CmdFlags":       true,
+	"IsDrawCall":     true,
+	"IsClear":        true,
+	"IsStartOfFrame": true,
+	"IsEndOfFrame":   true,
+}
+
+func unary(op token.Token, v interface{}) (interface{}, error) {
+	switch op {
+	case token.NOT:
+		t, err := truth(v)
+		return !t, err
+	case token.ADD:
+		if _, ok := number(v); ok {
+			return v, nil
+		}
+	case token.SUB:
+		if n, ok := number(v); ok {
+			return binaryNumbers(token.SUB, num{kind: reflect.Int64}, n)
+		}
+	}
+	return nil, fmt.Errorf("Invalid operation: %v%v", op, format(v))
+}
+
+func binary(op token.Token, a, b interface{}) (interface{}, error) {
+	switch op {
+	case token.EQL:
+		return equal(a, b), nil
+	case token.NEQ:
+		return !equal(a, b), nil
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		c, ok := compare(a, b)
+		if !ok {
+			break
+		}
+		switch op {
+		case token.LSS:
+			return c < 0, nil
+		case token.LEQ:
+			return c <= 0, nil
+		case token.GTR:
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case token.ADD:
+		if sa, ok := a.(string); ok {
+			if sb, ok := b.(string); ok {
+				return sa + sb, nil
+			}
+		}
+		fallthrough
+	default:
+		na, okA := number(a)
+		nb, okB := number(b)
+		if okA && okB {
+			return binaryNumbers(op, na, nb)
+		}
+	}
+	return nil, fmt.Errorf("Invalid operation: %v %v %v", format(a), op, format(b))
+}
+
+// truth returns the boolean value of v.
+func truth(v interface{}) (bool, error) {
+	if isNil(v) {
+		return false, nil
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Bool:
+		return r.Bool(), nil
+	case reflect.String:
+		return r.Len() > 0, nil
+	}
+	if n, ok := number(v); ok {
+		return n.i != 0 || n.u != 0 || n.f != 0, nil
+	}
+	return true, nil
+}
+
+// format returns the string representation of v.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// indirect returns the value pointed by r, following pointers and
+// interfaces. The returned value is invalid if r is nil.
+func indirect(r reflect.Value) reflect.Value {
+	for r.IsValid() && (r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface) {
+		r = r.Elem()
+	}
+	return r
+}
+
+// value returns the interface of r, or nil if r is invalid.
+func value(r reflect.Value) interface{} {
+	if !r.IsValid() {
+		return nil
+	}
+	return r.Interface()
+}
+
+// isNil returns true if v is nil, a nil pointer, map, slice or interface, or
+// a null pointer of application memory.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if p, ok := v.(memory.Pointer); ok {
+		return p.IsNullptr()
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return r.IsNil()
+	}
+	return false
+}
+
+// convert returns v as a value of type t.
+func convert(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	r := reflect.ValueOf(v)
+	if r.Type().AssignableTo(t) {
+		return r, nil
+	}
+	_, isNumber := number(v)
+	_, isNumberType := number(reflect.Zero(t).Interface())
+	if (isNumber && isNumberType) || (r.Kind() == reflect.String && t.Kind() == reflect.String) {
+		return r.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("Cannot use %v as %v", format(v), t)
+}
+
+// str returns the string representation of v, if v is a string or a value
+// with a string representation.
+func str(v interface{}) (string, bool) {
+	if r := reflect.ValueOf(v); r.Kind() == reflect.String {
+		if s, ok := v.(fmt.Stringer); ok {
+			return s.String(), true
+		}
+		return r.String(), true
+	}
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	return "", false
+}
+
+// builtin is a function that can be called by scripts.
+type builtin struct {
+	args int
+	f    func(e *env, args []interface{}) (interface{}, error)
+}
+
+var builtins map[string]builtin
+
+func init() {
+	cmdFunc := func(f func(e *env, cmd api.Cmd) (interface{}, error)) builtin {
+		return builtin{1, func(e *env, args []interface{}) (interface{}, error) {
+			cmd, ok := args[0].(api.Cmd)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a command", format(args[0]))
+			}
+			return f(e, cmd)
+		}}
+	}
+	stringsFunc := func(f func(a, b string) bool) builtin {
+		return builtin{2, func(e *env, args []interface{}) (interface{}, error) {
+			a, okA := str(args[0])
+			b, okB := str(args[1])
+			if !okA || !okB {
+				return nil, fmt.Errorf("%v and %v are not strings", format(args[0]), format(args[1]))
+			}
+			return f(a, b), nil
+		}}
+	}
+	builtins = map[string]builtin{
+		"name": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.CmdName(), nil
+		}),
+		"thread": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.Thread(), nil
+		}),
+		"result": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return api.GetResult(e.ctx, cmd)
+		}),
+		"isDrawCall": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.CmdFlags().IsDrawCall(), nil
+		}),
+		"isClear": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.CmdFlags().IsClear(), nil
+		}),
+		"isStartOfFrame": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.CmdFlags().IsStartOfFrame(), nil
+		}),
+		"isEndOfFrame": cmdFunc(func(e *env, cmd api.Cmd) (interface{}, error) {
+			return cmd.CmdFlags().IsEndOfFrame(), nil
+		}),
+		"param": {2, func(e *env, args []interface{}) (interface{}, error) {
+			cmd, ok := args[0].(api.Cmd)
+			name, okName := args[1].(string)
+			if !ok || !okName {
+				return nil, fmt.Errorf("param takes a command and a parameter name")
+			}
+			return api.GetParameter(e.ctx, cmd, name)
+		}},
+		"len": {1, func(e *env, args []interface{}) (interface{}, error) {
+			switch r := indirect(reflect.ValueOf(args[0])); r.Kind() {
+			case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+				return int64(r.Len()), nil
+			}
+			return nil, fmt.Errorf("%T has no length", args[0])
+		}},
+		"str": {1, func(e *env, args []interface{}) (interface{}, error) {
+			return format(args[0]), nil
+		}},
+		"hex": {1, func(e *env, args []interface{}) (interface{}, error) {
+			if p, ok := args[0].(memory.Pointer); ok {
+				return fmt.Sprintf("0x%x", p.Address()), nil
+			}
+			n, ok := number(args[0])
+			if !ok || n.kind == reflect.Float64 {
+				return nil, fmt.Errorf("%v is not an integer", format(args[0]))
+			}
+			if n.kind == reflect.Int64 && n.i < 0 {
+				return fmt.Sprintf("-0x%x", uint64(-n.i)), nil
+			}
+			return fmt.Sprintf("0x%x", n.u|uint64(n.i)), nil
+		}},
+		"contains":  stringsFunc(strings.Contains),
+		"hasPrefix": stringsFunc(strings.HasPrefix),
+	}
+}
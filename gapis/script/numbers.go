@@ -0,0 +1,232 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// num is a number value widened to 64 bits.
+type num struct {
+	kind reflect.Kind // reflect.Int64, reflect.Uint64 or reflect.Float64
+	i    int64
+	u    uint64
+	f    float64
+}
+
+func (n num) int() int64 {
+	switch n.kind {
+	case reflect.Uint64:
+		return int64(n.u)
+	case reflect.Float64:
+		return int64(n.f)
+	}
+	return n.i
+}
+
+func (n num) float() float64 {
+	switch n.kind {
+	case reflect.Int64:
+		return float64(n.i)
+	case reflect.Uint64:
+		return float64(n.u)
+	}
+	return n.f
+}
+
+// number returns v as a num, if v is a number.
+func number(v interface{}) (num, bool) {
+	if v == nil {
+		return num{}, false
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return num{kind: reflect.Int64, i: r.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return num{kind: reflect.Uint64, u: r.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return num{kind: reflect.Float64, f: r.Float()}, true
+	}
+	return num{}, false
+}
+
+// integer returns v as an int64, if v is an integer.
+func integer(v interface{}) (int64, bool) {
+	n, ok := number(v)
+	if !ok || n.kind == reflect.Float64 {
+		return 0, false
+	}
+	return n.int(), true
+}
+
+// binaryNumbers returns the result of the operation op on a and b.
+// Operations are performed on float64 if either operand is a float, on uint64
+// if both operands are unsigned, and on int64 otherwise.
+func binaryNumbers(op token.Token, a, b num) (interface{}, error) {
+	switch {
+	case a.kind == reflect.Float64 || b.kind == reflect.Float64:
+		x, y := a.float(), b.float()
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			return x / y, nil
+		}
+	case a.kind == reflect.Uint64 && b.kind == reflect.Uint64:
+		x, y := a.u, b.u
+		if y == 0 && (op == token.QUO || op == token.REM) {
+			return nil, fmt.Errorf("Division by zero")
+		}
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			return x / y, nil
+		case token.REM:
+			return x % y, nil
+		case token.AND:
+			return x & y, nil
+		case token.OR:
+			return x | y, nil
+		case token.XOR:
+			return x ^ y, nil
+		case token.AND_NOT:
+			return x &^ y, nil
+		case token.SHL:
+			return x << y, nil
+		case token.SHR:
+			return x >> y, nil
+		}
+	default:
+		x, y := a.int(), b.int()
+		if y == 0 && (op == token.QUO || op == token.REM) {
+			return nil, fmt.Errorf("Division by zero")
+		}
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			return x / y, nil
+		case token.REM:
+			return x % y, nil
+		case token.AND:
+			return x & y, nil
+		case token.OR:
+			return x | y, nil
+		case token.XOR:
+			return x ^ y, nil
+		case token.AND_NOT:
+			return x &^ y, nil
+		case token.SHL, token.SHR:
+			if y < 0 {
+				return nil, fmt.Errorf("Negative shift count %d", y)
+			}
+			if op == token.SHL {
+				return x << uint64(y), nil
+			}
+			return x >> uint64(y), nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid operation: %v", op)
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// Numbers compare with numbers, strings and values with a string
+// representation compare with strings.
+func compare(a, b interface{}) (int, bool) {
+	na, okA := number(a)
+	nb, okB := number(b)
+	if okA && okB {
+		switch {
+		case na.kind == reflect.Float64 || nb.kind == reflect.Float64:
+			return compareFloats(na.float(), nb.float()), true
+		case na.kind == reflect.Uint64 && nb.kind == reflect.Uint64:
+			return compareUints(na.u, nb.u), true
+		case na.kind == reflect.Uint64 && na.u > 1<<63-1:
+			return 1, true
+		case nb.kind == reflect.Uint64 && nb.u > 1<<63-1:
+			return -1, true
+		default:
+			return compareInts(na.int(), nb.int()), true
+		}
+	}
+	_, isStrA := a.(string)
+	_, isStrB := b.(string)
+	if isStrA || isStrB {
+		sa, okA := str(a)
+		sb, okB := str(b)
+		if okA && okB {
+			return strings.Compare(sa, sb), true
+		}
+	}
+	return 0, false
+}
+
+// equal returns true if a and b are equal.
+func equal(a, b interface{}) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUints(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
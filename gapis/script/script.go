@@ -0,0 +1,266 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/pkg/errors"
+)
+
+// ErrNoCommands is the error returned when running a script on a capture
+// without commands.
+const ErrNoCommands = fault.Const("The capture has no commands")
+
+// Script is a parsed script.
+type Script struct {
+	// query is true if the script is run for each command.
+	query bool
+	// columns is the source of each selected expression.
+	columns []string
+	// exprs are the selected expressions.
+	exprs []ast.Expr
+	// where is the condition of the query, or nil.
+	where ast.Expr
+	// limit is the maximum number of rows of the query, or 0 for no limit.
+	limit uint64
+	// at is the index of the command to evaluate the expressions after, or -1
+	// for the last command.
+	at int64
+}
+
+// Result is the result of a script.
+type Result struct {
+	// Columns is the source of each expression of the script.
+	Columns []string
+	// Rows holds the values of the expressions, for each command selected by
+	// a query, or for the single command a list of expressions is evaluated
+	// at.
+	Rows []Row
+}
+
+// Row is a row of a Result.
+type Row struct {
+	// Command is the index of the command the row was evaluated for.
+	Command uint64
+	// Values are the string representations of the values of the
+	// expressions.
+	Values []string
+}
+
+// clause is a part of the source of a script, started by a keyword.
+type clause struct {
+	keyword    string
+	start, end int
+	// commas are the offsets of the top-level commas of the clause.
+	commas []int
+}
+
+// Parse parses the script source.
+func Parse(source string) (*Script, error) {
+	// Scripts can span several lines, but the expressions are parsed as Go
+	// expressions, which are terminated by new lines.
+	source = strings.NewReplacer("\n", " ", "\r", " ").Replace(source)
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("script", -1, len(source))
+	var errs scanner.ErrorList
+	s := scanner.Scanner{}
+	s.Init(file, []byte(source), errs.Add, 0)
+
+	clauses := []*clause{{}}
+	depth, prev := 0, token.ILLEGAL
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+		current := clauses[len(clauses)-1]
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMA:
+			if depth == 0 {
+				current.commas = append(current.commas, offset)
+			}
+		case token.SELECT:
+			// select is a Go keyword, so it is never part of an expression.
+			if prev != token.ILLEGAL {
+				return nil, fault.Const("select must start the script")
+			}
+			current.keyword = tok.String()
+			current.start = offset + len(current.keyword)
+		case token.IDENT:
+			if depth != 0 || prev == token.PERIOD {
+				break
+			}
+			switch lit {
+			case "where", "limit", "at":
+				current.end = offset
+				clauses = append(clauses, &clause{keyword: lit, start: offset + len(lit)})
+			}
+		}
+		prev = tok
+	}
+	if errs.Len() > 0 {
+		return nil, errs.Err()
+	}
+	clauses[len(clauses)-1].end = len(source)
+
+	out := &Script{at: -1}
+	for i, c := range clauses {
+		text := strings.TrimSpace(source[c.start:c.end])
+		var err error
+		switch {
+		case i == 0:
+			out.query = c.keyword == "select"
+			err = out.parseColumns(source, c)
+		case c.keyword == "where" && out.query && out.where == nil:
+			out.where, err = parseExpr(text)
+		case c.keyword == "limit" && out.query && out.limit == 0:
+			out.limit, err = strconv.ParseUint(text, 0, 64)
+		case c.keyword == "at" && !out.query && out.at < 0:
+			out.at, err = strconv.ParseInt(text, 0, 64)
+		default:
+			err = fmt.Errorf("Unexpected '%s' clause", c.keyword)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *Script) parseColumns(source string, c *clause) error {
+	start := c.start
+	for _, end := range append(c.commas, c.end) {
+		text := strings.TrimSpace(source[start:end])
+		expr, err := parseExpr(text)
+		if err != nil {
+			return err
+		}
+		s.columns = append(s.columns, text)
+		s.exprs = append(s.exprs, expr)
+		start = end + 1
+	}
+	return nil
+}
+
+func parseExpr(text string) (ast.Expr, error) {
+	if text == "" {
+		return nil, fault.Const("Missing expression")
+	}
+	expr, err := parser.ParseExpr(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing '%s'", text)
+	}
+	return expr, nil
+}
+
+// Run runs the script on the commands cmds, starting from the state s.
+// The state is mutated by the commands. Panics of the commands and of the
+// methods called by the script are returned as errors.
+func (s *Script) Run(ctx context.Context, cmds []api.Cmd, state *api.State) (res *Result, err error) {
+	current := -1
+	defer func() {
+		if r := recover(); r != nil {
+			cause, ok := r.(error)
+			if !ok {
+				cause = fault.Const(fmt.Sprint(r))
+			}
+			res, err = nil, log.Errf(ctx, cause, "Panic at command %d", current)
+		}
+	}()
+
+	if len(cmds) == 0 {
+		return nil, ErrNoCommands
+	}
+	at := s.at
+	if at < 0 {
+		at = int64(len(cmds)) - 1
+	}
+	if !s.query && at >= int64(len(cmds)) {
+		return nil, log.Errf(ctx, nil, "Command %d out of bounds: the capture has %d commands", at, len(cmds))
+	}
+
+	out := &Result{Columns: s.columns, Rows: []Row{}}
+	e := &env{ctx: ctx, vars: map[string]interface{}{"state": state}}
+	frame, empty := uint64(0), true
+	for i, cmd := range cmds {
+		current = i
+		flags := cmd.CmdFlags()
+		if flags.IsStartOfFrame() && !empty {
+			// The command starts a new frame, so it ends the current one.
+			frame, empty = frame+1, true
+		}
+		if err := cmd.Mutate(ctx, state, nil); err != nil && err == context.Canceled {
+			return nil, err
+		}
+		if s.query || int64(i) == at {
+			e.bind(uint64(i), frame, cmd, state)
+			row, err := s.row(e)
+			if err != nil {
+				return nil, log.Errf(ctx, err, "Command %d: %v", i, cmd)
+			}
+			if row != nil {
+				out.Rows = append(out.Rows, *row)
+			}
+			if !s.query || (s.limit > 0 && uint64(len(out.Rows)) >= s.limit) {
+				break
+			}
+		}
+		empty = false
+		if flags.IsEndOfFrame() {
+			frame, empty = frame+1, true
+		}
+	}
+	return out, nil
+}
+
+// row returns the row of the selected values for the bound command, or nil if
+// the command does not match the query condition.
+func (s *Script) row(e *env) (*Row, error) {
+	if s.where != nil {
+		v, err := e.eval(s.where)
+		if err != nil {
+			return nil, err
+		}
+		if match, err := truth(v); err != nil || !match {
+			return nil, err
+		}
+	}
+	row := &Row{Command: e.vars["index"].(uint64), Values: make([]string, len(s.exprs))}
+	for i, expr := range s.exprs {
+		v, err := e.eval(expr)
+		if err != nil {
+			return nil, err
+		}
+		row.Values[i] = format(v)
+	}
+	return row, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/testcmd"
+	"github.com/google/gapid/gapis/replay/builder"
+	"github.com/google/gapid/gapis/script"
+)
+
+func TestScript(t *testing.T) {
+	ctx := log.Testing(t)
+	cmds := []api.Cmd{
+		testcmd.P,
+		&testcmd.A{Flags: api.DrawCall | api.EndOfFrame},
+		testcmd.Q,
+		testcmd.P,
+	}
+	for _, test := range []struct {
+		source   string
+		expected script.Result
+	}{
+		{`select index, cmd.Str where name(cmd) == "X" && cmd.Str == "xyz"`, script.Result{
+			Columns: []string{"index", "cmd.Str"},
+			Rows:    []script.Row{{Command: 2, Values: []string{"2", "xyz"}}},
+		}},
+		{`select name(cmd), frame where index > 0 limit 2`, script.Result{
+			Columns: []string{"name(cmd)", "frame"},
+			Rows: []script.Row{
+				{Command: 1, Values: []string{"A", "0"}},
+				{Command: 2, Values: []string{"X", "1"}},
+			},
+		}},
+		{`select index where isDrawCall(cmd)`, script.Result{
+			Columns: []string{"index"},
+			Rows:    []script.Row{{Command: 1, Values: []string{"1"}}},
+		}},
+		{`cmd.Ref.Ref.Str, cmd.Map["dog"], len(cmd.Sli), hex(cmd.Ptr) at 0`, script.Result{
+			Columns: []string{"cmd.Ref.Ref.Str", `cmd.Map["dog"]`, "len(cmd.Sli)", "hex(cmd.Ptr)"},
+			Rows:    []script.Row{{Command: 0, Values: []string{"ddd", "woof", "3", "0x123"}}},
+		}},
+		{`cmd.Ref.Str, cmd.PMap[100].Str, cmd.Sli[1] && true, (1 + 2) * 3 at 2`, script.Result{
+			Columns: []string{"cmd.Ref.Str", "cmd.PMap[100].Str", "cmd.Sli[1] && true", "(1 + 2) * 3"},
+			Rows:    []script.Row{{Command: 2, Values: []string{"nil", "baldrick", "true", "9"}}},
+		}},
+		{`cmd.Ptr.Address(), cmd.Ptr.IsNullptr() at 0`, script.Result{
+			Columns: []string{"cmd.Ptr.Address()", "cmd.Ptr.IsNullptr()"},
+			Rows:    []script.Row{{Command: 0, Values: []string{"291", "false"}}},
+		}},
+		{`index, "str" + cmd.Str, hasPrefix(cmd.Str, "a")`, script.Result{
+			Columns: []string{"index", `"str" + cmd.Str`, `hasPrefix(cmd.Str, "a")`},
+			Rows:    []script.Row{{Command: 3, Values: []string{"3", "straaa", "true"}}},
+		}},
+	} {
+		s, err := script.Parse(test.source)
+		if !assert.For(ctx, "Parse(%v)", test.source).ThatError(err).Succeeded() {
+			continue
+		}
+		got, err := s.Run(ctx, cmds, api.NewStateWithEmptyAllocator(device.Little64))
+		if !assert.For(ctx, "Run(%v)", test.source).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For(ctx, "Run(%v)", test.source).That(*got).DeepEquals(test.expected)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, source := range []string{
+		``,
+		`select`,
+		`select index where`,
+		`select index limit x`,
+		`index at`,
+		`index where true`,
+		`select (index`,
+	} {
+		_, err := script.Parse(source)
+		assert.For(ctx, "Parse(%v)", source).ThatError(err).Failed()
+	}
+
+	cmds := []api.Cmd{testcmd.P}
+	for _, source := range []string{
+		`select undefined`,
+		`select cmd.Sli[3]`,
+		`select index / 0`,
+		`index at 1`,
+		`cmd.Ptr.Offset(1)`,
+	} {
+		s, err := script.Parse(source)
+		if !assert.For(ctx, "Parse(%v)", source).ThatError(err).Succeeded() {
+			continue
+		}
+		_, err = s.Run(ctx, cmds, api.NewStateWithEmptyAllocator(device.Little64))
+		assert.For(ctx, "Run(%v)", source).ThatError(err).Failed()
+	}
+}
+
+func TestScriptFrames(t *testing.T) {
+	ctx := log.Testing(t)
+	// Commands starting frames belong to the frame they start.
+	cmds := []api.Cmd{
+		testcmd.P,
+		&testcmd.A{Flags: api.StartOfFrame},
+		testcmd.P,
+		&testcmd.A{Flags: api.EndOfFrame},
+		&testcmd.A{Flags: api.StartOfFrame},
+		testcmd.P,
+	}
+	s, err := script.Parse(`select frame, isStartOfFrame(cmd), isEndOfFrame(cmd)`)
+	if !assert.For(ctx, "Parse").ThatError(err).Succeeded() {
+		return
+	}
+	got, err := s.Run(ctx, cmds, api.NewStateWithEmptyAllocator(device.Little64))
+	if !assert.For(ctx, "Run").ThatError(err).Succeeded() {
+		return
+	}
+	frames := []string{}
+	for _, row := range got.Rows {
+		frames = append(frames, row.Values[0]+" "+row.Values[1]+" "+row.Values[2])
+	}
+	assert.For(ctx, "frames").ThatSlice(frames).Equals([]string{
+		"0 false false",
+		"1 true false",
+		"1 false false",
+		"1 false true",
+		"2 true false",
+		"2 false false",
+	})
+}
+
+// panicCmd is a command that panics when mutated.
+type panicCmd struct{ testcmd.A }
+
+func (c *panicCmd) Mutate(context.Context, *api.State, *builder.Builder) error {
+	panic("mutate")
+}
+
+func TestScriptPanic(t *testing.T) {
+	ctx := log.Testing(t)
+	s, err := script.Parse(`select index`)
+	if !assert.For(ctx, "Parse").ThatError(err).Succeeded() {
+		return
+	}
+	_, err = s.Run(ctx, []api.Cmd{testcmd.P, &panicCmd{}}, api.NewStateWithEmptyAllocator(device.Little64))
+	assert.For(ctx, "Run").ThatError(err).Failed()
+}
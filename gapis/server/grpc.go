@@ -26,9 +26,11 @@ import (
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/log/log_pb"
 	"github.com/google/gapid/core/net/grpcutil"
+	"github.com/google/gapid/gapis/replay/scheduler"
 	"github.com/google/gapid/gapis/service"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 
 	xctx "golang.org/x/net/context"
 )
@@ -55,7 +57,13 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 			case keepAlive <- struct{}{}:
 			default:
 			}
-			return keys.Clone(c, ctx)
+			out := keys.Clone(c, ctx)
+			if p, ok := peer.FromContext(c); ok {
+				// Identify the clients by their address, for the replay
+				// schedulers to be fair between them.
+				out = scheduler.PutClient(out, p.Addr.String())
+			}
+			return out
 		},
 	}
 	return grpcutil.ServeWithListener(ctx, l, func(ctx context.Context, listener net.Listener, server *grpc.Server) error {
@@ -174,6 +182,14 @@ func (s *grpcServer) GetPerformanceCounters(ctx xctx.Context, req *service.GetPe
 	return &service.GetPerformanceCountersResponse{Res: &service.GetPerformanceCountersResponse_Data{Data: data}}, nil
 }
 
+func (s *grpcServer) GetReplayQueue(ctx xctx.Context, req *service.GetReplayQueueRequest) (*service.GetReplayQueueResponse, error) {
+	queue, err := s.handler.GetReplayQueue(s.bindCtx(ctx))
+	if err := service.NewError(err); err != nil {
+		return &service.GetReplayQueueResponse{Res: &service.GetReplayQueueResponse_Error{Error: err}}, nil
+	}
+	return &service.GetReplayQueueResponse{Res: &service.GetReplayQueueResponse_Queue{Queue: queue}}, nil
+}
+
 func (s *grpcServer) GetProfile(ctx xctx.Context, req *service.GetProfileRequest) (*service.GetProfileResponse, error) {
 	data, err := s.handler.GetProfile(s.bindCtx(ctx), req.Name, req.Debug)
 	if err := service.NewError(err); err != nil {
@@ -211,7 +227,7 @@ func (s *grpcServer) ImportCapture(ctx xctx.Context, req *service.ImportCaptureR
 }
 
 func (s *grpcServer) ExportCapture(ctx xctx.Context, req *service.ExportCaptureRequest) (*service.ExportCaptureResponse, error) {
-	data, err := s.handler.ExportCapture(s.bindCtx(ctx), req.Capture)
+	data, err := s.handler.ExportCapture(s.bindCtx(ctx), req.Capture, req.Format)
 	if err := service.NewError(err); err != nil {
 		return &service.ExportCaptureResponse{Res: &service.ExportCaptureResponse_Error{Error: err}}, nil
 	}
@@ -226,6 +242,22 @@ func (s *grpcServer) LoadCapture(ctx xctx.Context, req *service.LoadCaptureReque
 	return &service.LoadCaptureResponse{Res: &service.LoadCaptureResponse_Capture{Capture: capture}}, nil
 }
 
+func (s *grpcServer) SpliceCaptures(ctx xctx.Context, req *service.SpliceCapturesRequest) (*service.SpliceCapturesResponse, error) {
+	capture, err := s.handler.SpliceCaptures(s.bindCtx(ctx), req.Name, req.Ranges)
+	if err := service.NewError(err); err != nil {
+		return &service.SpliceCapturesResponse{Res: &service.SpliceCapturesResponse_Error{Error: err}}, nil
+	}
+	return &service.SpliceCapturesResponse{Res: &service.SpliceCapturesResponse_Capture{Capture: capture}}, nil
+}
+
+func (s *grpcServer) Eval(ctx xctx.Context, req *service.EvalRequest) (*service.EvalResponse, error) {
+	result, err := s.handler.Eval(s.bindCtx(ctx), req.Capture, req.Script)
+	if err := service.NewError(err); err != nil {
+		return &service.EvalResponse{Res: &service.EvalResponse_Error{Error: err}}, nil
+	}
+	return &service.EvalResponse{Res: &service.EvalResponse_Result{Result: result}}, nil
+}
+
 func (s *grpcServer) GetDevices(ctx xctx.Context, req *service.GetDevicesRequest) (*service.GetDevicesResponse, error) {
 	devices, err := s.handler.GetDevices(s.bindCtx(ctx))
 	if err := service.NewError(err); err != nil {
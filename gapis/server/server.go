@@ -33,8 +33,11 @@ import (
 	"github.com/google/gapid/core/os/device/bind"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/replay/devices"
 	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/script"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/stringtable"
@@ -110,11 +113,20 @@ func (s *server) ImportCapture(ctx context.Context, name string, data []uint8) (
 	return capture.Import(ctx, name, data)
 }
 
-func (s *server) ExportCapture(ctx context.Context, c *path.Capture) ([]byte, error) {
+func (s *server) ExportCapture(ctx context.Context, c *path.Capture, f service.CaptureFormat) ([]byte, error) {
 	ctx = log.Enter(ctx, "ExportCapture")
 	b := bytes.Buffer{}
-	if err := capture.Export(ctx, c, &b); err != nil {
-		return nil, err
+	switch f {
+	case service.CaptureFormat_PackFormat:
+		if err := capture.Export(ctx, c, &b); err != nil {
+			return nil, err
+		}
+	case service.CaptureFormat_JsonFormat:
+		if err := capture.ExportJSON(ctx, c, &b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported capture format: %v", f)
 	}
 	return b.Bytes(), nil
 }
@@ -129,6 +141,32 @@ func (s *server) LoadCapture(ctx context.Context, path string) (*path.Capture, e
 	return capture.Import(ctx, name, in)
 }
 
+func (s *server) SpliceCaptures(ctx context.Context, name string, ranges []*path.Commands) (*path.Capture, error) {
+	ctx = log.Enter(ctx, "SpliceCaptures")
+	return capture.Splice(ctx, name, ranges)
+}
+
+func (s *server) Eval(ctx context.Context, p *path.Capture, source string) (*service.EvalResult, error) {
+	ctx = log.Enter(ctx, "Eval")
+	sc, err := script.Parse(source)
+	if err != nil {
+		return nil, &service.ErrInvalidArgument{Reason: messages.ErrInvalidScript(err.Error())}
+	}
+	c, err := capture.ResolveFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	res, err := sc.Run(capture.Put(ctx, p), c.Commands, c.NewState())
+	if err != nil {
+		return nil, err
+	}
+	out := &service.EvalResult{Columns: res.Columns, Rows: make([]*service.EvalRow, len(res.Rows))}
+	for i, r := range res.Rows {
+		out.Rows[i] = &service.EvalRow{Command: r.Command, Values: r.Values}
+	}
+	return out, nil
+}
+
 func (s *server) GetDevices(ctx context.Context) ([]*path.Device, error) {
 	ctx = log.Enter(ctx, "GetDevices")
 	s.deviceScanDone.Wait(ctx)
@@ -243,6 +281,11 @@ func (s *server) GetPerformanceCounters(ctx context.Context) ([]byte, error) {
 	return json.Marshal(benchmark.GlobalCounters)
 }
 
+func (s *server) GetReplayQueue(ctx context.Context) (*service.ReplayQueue, error) {
+	ctx = log.Enter(ctx, "GetReplayQueue")
+	return replay.GetManager(ctx).Queue(), nil
+}
+
 func (s *server) GetProfile(ctx context.Context, name string, debug int32) ([]byte, error) {
 	ctx = log.Enter(ctx, "GetProfile")
 	p := pprof.Lookup(name)
@@ -62,26 +62,35 @@ func (n *Blob) Path() *Any                      { return &Any{&Any_Blob{n}} }
 func (n *Capture) Path() *Any                   { return &Any{&Any_Capture{n}} }
 func (n *ConstantSet) Path() *Any               { return &Any{&Any_ConstantSet{n}} }
 func (n *Command) Path() *Any                   { return &Any{&Any_Command{n}} }
+func (n *CompatCoverage) Path() *Any            { return &Any{&Any_CompatCoverage{n}} }
 func (n *Commands) Path() *Any                  { return &Any{&Any_Commands{n}} }
 func (n *CommandTree) Path() *Any               { return &Any{&Any_CommandTree{n}} }
 func (n *CommandTreeNode) Path() *Any           { return &Any{&Any_CommandTreeNode{n}} }
 func (n *CommandTreeNodeForCommand) Path() *Any { return &Any{&Any_CommandTreeNodeForCommand{n}} }
 func (n *Context) Path() *Any                   { return &Any{&Any_Context{n}} }
 func (n *Contexts) Path() *Any                  { return &Any{&Any_Contexts{n}} }
+func (n *CppExport) Path() *Any                 { return &Any{&Any_CppExport{n}} }
 func (n *Device) Path() *Any                    { return &Any{&Any_Device{n}} }
 func (n *Events) Path() *Any                    { return &Any{&Any_Events{n}} }
 func (n *Field) Path() *Any                     { return &Any{&Any_Field{n}} }
+func (n *Footprint) Path() *Any                 { return &Any{&Any_Footprint{n}} }
+func (n *FramebufferComparison) Path() *Any     { return &Any{&Any_FramebufferComparison{n}} }
 func (n *ImageInfo) Path() *Any                 { return &Any{&Any_ImageInfo{n}} }
+func (n *ImageStats) Path() *Any                { return &Any{&Any_ImageStats{n}} }
 func (n *MapIndex) Path() *Any                  { return &Any{&Any_MapIndex{n}} }
 func (n *Memory) Path() *Any                    { return &Any{&Any_Memory{n}} }
 func (n *Mesh) Path() *Any                      { return &Any{&Any_Mesh{n}} }
 func (n *Parameter) Path() *Any                 { return &Any{&Any_Parameter{n}} }
+func (n *PixelHistory) Path() *Any              { return &Any{&Any_PixelHistory{n}} }
+func (n *ReplayDeterminism) Path() *Any         { return &Any{&Any_ReplayDeterminism{n}} }
+func (n *ReplayPayload) Path() *Any             { return &Any{&Any_ReplayPayload{n}} }
 func (n *Report) Path() *Any                    { return &Any{&Any_Report{n}} }
 func (n *ResourceData) Path() *Any              { return &Any{&Any_ResourceData{n}} }
 func (n *Resources) Path() *Any                 { return &Any{&Any_Resources{n}} }
 func (n *Result) Path() *Any                    { return &Any{&Any_Result{n}} }
 func (n *Slice) Path() *Any                     { return &Any{&Any_Slice{n}} }
 func (n *State) Path() *Any                     { return &Any{&Any_State{n}} }
+func (n *Stats) Path() *Any                     { return &Any{&Any_Stats{n}} }
 func (n *StateTree) Path() *Any                 { return &Any{&Any_StateTree{n}} }
 func (n *StateTreeNode) Path() *Any             { return &Any{&Any_StateTreeNode{n}} }
 func (n *StateTreeNodeForPath) Path() *Any      { return &Any{&Any_StateTreeNodeForPath{n}} }
@@ -94,20 +103,28 @@ func (n Blob) Parent() Node                      { return nil }
 func (n Capture) Parent() Node                   { return nil }
 func (n ConstantSet) Parent() Node               { return n.Api }
 func (n Command) Parent() Node                   { return n.Capture }
+func (n CompatCoverage) Parent() Node            { return n.Capture }
 func (n Commands) Parent() Node                  { return n.Capture }
 func (n CommandTree) Parent() Node               { return n.Capture }
 func (n CommandTreeNode) Parent() Node           { return nil }
 func (n CommandTreeNodeForCommand) Parent() Node { return n.Command }
 func (n Context) Parent() Node                   { return n.Capture }
 func (n Contexts) Parent() Node                  { return n.Capture }
+func (n CppExport) Parent() Node                 { return n.Capture }
 func (n Device) Parent() Node                    { return nil }
 func (n Events) Parent() Node                    { return n.Capture }
 func (n Field) Parent() Node                     { return oneOfNode(n.Struct) }
+func (n Footprint) Parent() Node                 { return n.Capture }
+func (n FramebufferComparison) Parent() Node     { return n.After }
 func (n ImageInfo) Parent() Node                 { return nil }
+func (n ImageStats) Parent() Node                { return oneOfNode(n.Object) }
 func (n MapIndex) Parent() Node                  { return oneOfNode(n.Map) }
 func (n Memory) Parent() Node                    { return n.After }
 func (n Mesh) Parent() Node                      { return oneOfNode(n.Object) }
 func (n Parameter) Parent() Node                 { return n.Command }
+func (n PixelHistory) Parent() Node              { return n.After }
+func (n ReplayDeterminism) Parent() Node         { return n.Commands }
+func (n ReplayPayload) Parent() Node             { return n.Capture }
 func (n Report) Parent() Node                    { return n.Capture }
 func (n ResourceData) Parent() Node              { return n.After }
 func (n Resources) Parent() Node                 { return n.Capture }
@@ -115,6 +132,7 @@ func (n Result) Parent() Node                    { return n.Command }
 func (n Slice) Parent() Node                     { return oneOfNode(n.Array) }
 func (n State) Parent() Node                     { return n.After }
 func (n StateTree) Parent() Node                 { return n.After }
+func (n Stats) Parent() Node                     { return n.Capture }
 func (n StateTreeNode) Parent() Node             { return nil }
 func (n StateTreeNodeForPath) Parent() Node      { return nil }
 func (n Thumbnail) Parent() Node                 { return oneOfNode(n.Object) }
@@ -140,17 +158,46 @@ func (n CommandTreeNode) Text() string {
 func (n CommandTreeNodeForCommand) Text() string {
 	return fmt.Sprintf("%v.command-tree-node<%v>", n.Command.Text(), n.Tree)
 }
+func (n CompatCoverage) Text() string {
+	if n.Device != nil {
+		return fmt.Sprintf("%v.compat-coverage<%v>", n.Parent().Text(), n.Device.Text())
+	}
+	return fmt.Sprintf("%v.compat-coverage", n.Parent().Text())
+}
 func (n Context) Text() string   { return fmt.Sprintf("%v.[%x]", n.Parent().Text(), n.Id) }
 func (n Contexts) Text() string  { return fmt.Sprintf("%v.contexts", n.Parent().Text()) }
+func (n CppExport) Text() string { return fmt.Sprintf("%v.export-cpp", n.Parent().Text()) }
 func (n Device) Text() string    { return fmt.Sprintf("device<%x>", n.Id) }
 func (n Events) Text() string    { return fmt.Sprintf(".events", n.Parent().Text()) }
 func (n Field) Text() string     { return fmt.Sprintf("%v.%v", n.Parent().Text(), n.Name) }
+func (n Footprint) Text() string { return fmt.Sprintf("%v.footprint", n.Parent().Text()) }
+func (n FramebufferComparison) Text() string {
+	return fmt.Sprintf("%v.framebuffer-comparison<%v>", n.Parent().Text(), n.Attachment)
+}
 func (n ImageInfo) Text() string { return fmt.Sprintf("image-info<%x>", n.Id) }
+func (n ImageStats) Text() string {
+	if _, ok := n.Object.(*ImageStats_ResourceData); ok {
+		return fmt.Sprintf("%v.stats<%v, %v>", n.Parent().Text(), n.Level, n.Layer)
+	}
+	return fmt.Sprintf("%v.stats", n.Parent().Text())
+}
 func (n MapIndex) Text() string  { return fmt.Sprintf("%v[%x]", n.Parent().Text(), n.Key) }
 func (n Memory) Text() string    { return fmt.Sprintf("%v.memory-after", n.Parent().Text()) }
 func (n Mesh) Text() string      { return fmt.Sprintf("%v.mesh", n.Parent().Text()) }
 func (n Parameter) Text() string { return fmt.Sprintf("%v.%v", n.Parent().Text(), n.Name) }
-func (n Report) Text() string    { return fmt.Sprintf("%v.report", n.Parent().Text()) }
+func (n PixelHistory) Text() string {
+	return fmt.Sprintf("%v.pixel-history<%v>[%v, %v]", n.Parent().Text(), n.Attachment, n.X, n.Y)
+}
+func (n ReplayDeterminism) Text() string {
+	return fmt.Sprintf("%v.replay-determinism<%v, %v>", n.Parent().Text(), n.Runs, n.Attachment)
+}
+func (n ReplayPayload) Text() string {
+	if n.After != nil {
+		return fmt.Sprintf("%v.replay-payload<%v>", n.Parent().Text(), n.After.Indices)
+	}
+	return fmt.Sprintf("%v.replay-payload", n.Parent().Text())
+}
+func (n Report) Text() string { return fmt.Sprintf("%v.report", n.Parent().Text()) }
 func (n ResourceData) Text() string {
 	return fmt.Sprintf("%v.resource-data<%x>", n.Parent().Text(), n.Id)
 }
@@ -159,6 +206,7 @@ func (n Result) Text() string    { return fmt.Sprintf("%v.result", n.Parent().Te
 func (n Slice) Text() string     { return fmt.Sprintf("%v[%v:%v]", n.Parent().Text(), n.Start, n.End) }
 func (n State) Text() string     { return fmt.Sprintf("%v.state-after", n.Parent().Text()) }
 func (n StateTree) Text() string { return fmt.Sprintf("%v.state-tree") }
+func (n Stats) Text() string     { return fmt.Sprintf("%v.stats", n.Parent().Text()) }
 func (n StateTreeNode) Text() string {
 	return fmt.Sprintf("state-tree<%v>[%v]", n.Tree, printIndices(n.Indices))
 }
@@ -339,11 +387,42 @@ func (n *Capture) Resources() *Resources {
 	return &Resources{Capture: n}
 }
 
+// ReplayPayload returns the path node to the disassembly of the payload built
+// to replay the capture on the device d. If after is not nil, the payload is
+// the one that reads the color framebuffer after that command.
+func (n *Capture) ReplayPayload(d *Device, after *Command) *ReplayPayload {
+	return &ReplayPayload{Capture: n, Device: d, After: after}
+}
+
 // Report returns the path node to the capture's report.
 func (n *Capture) Report(d *Device, f *CommandFilter) *Report {
 	return &Report{Capture: n, Device: d, Filter: f}
 }
 
+// Stats returns the path node to the capture's command statistics.
+func (n *Capture) Stats() *Stats {
+	return &Stats{Capture: n}
+}
+
+// Footprint returns the path node to the memory footprint of the capture's
+// objects, reported for ranges of rangeSize commands. If rangeSize is 0, the
+// footprint is reported for each frame.
+func (n *Capture) Footprint(rangeSize uint64) *Footprint {
+	return &Footprint{Capture: n, RangeSize: rangeSize}
+}
+
+// CompatCoverage returns the path node to the commands and extensions of the
+// capture that the compatibility layers do not handle for replay on the
+// device d.
+func (n *Capture) CompatCoverage(d *Device) *CompatCoverage {
+	return &CompatCoverage{Capture: n, Device: d}
+}
+
+// CppExport returns the path node to the C++ export of the capture's commands.
+func (n *Capture) CppExport() *CppExport {
+	return &CppExport{Capture: n}
+}
+
 // Contexts returns the path node to the capture's contexts.
 func (n *Capture) Contexts() *Contexts {
 	return &Contexts{Capture: n}
@@ -417,6 +496,23 @@ func (n *Command) Mesh(faceted bool) *Mesh {
 	}
 }
 
+// FramebufferComparison returns the path node to the comparison between the
+// replay devices of the given framebuffer attachment after this command.
+func (n *Command) FramebufferComparison(attachment uint32) *FramebufferComparison {
+	return &FramebufferComparison{After: n, Attachment: attachment}
+}
+
+// PixelHistory returns the path node to the history of the pixel at (x, y)
+// of the given attachment, for the frame containing this command.
+func (n *Command) PixelHistory(attachment, x, y uint32) *PixelHistory {
+	return &PixelHistory{
+		After:      n,
+		Attachment: attachment,
+		X:          x,
+		Y:          y,
+	}
+}
+
 // StateAfter returns the path node to the state after this command.
 func (n *Command) StateAfter() *State {
 	return &State{After: n}
@@ -437,6 +533,13 @@ func (n *Commands) Last() *Command {
 	return &Command{Capture: n.Capture, Indices: n.To}
 }
 
+// ReplayDeterminism returns the path node to the determinism check of these
+// commands, replayed runs times on the device d, comparing the given
+// framebuffer attachment.
+func (n *Commands) ReplayDeterminism(d *Device, runs, attachment uint32) *ReplayDeterminism {
+	return &ReplayDeterminism{Commands: n, Device: d, Runs: runs, Attachment: attachment}
+}
+
 // Index returns the path to the i'th child of the StateTreeNode.
 func (n *StateTreeNode) Index(i ...uint64) *StateTreeNode {
 	newIndices := make([]uint64, len(n.Indices)+len(i))
@@ -490,6 +593,21 @@ func (n *ImageInfo) As(f *image.Format) *As {
 	}
 }
 
+// Stats returns the path to the per-channel statistics of the image.
+func (n *ImageInfo) Stats() *ImageStats {
+	return &ImageStats{Object: &ImageStats_ImageInfo{n}}
+}
+
+// Stats returns the path to the per-channel statistics of the resource's
+// texture image at the given mip-level and layer.
+func (n *ResourceData) Stats(level, layer uint32) *ImageStats {
+	return &ImageStats{
+		Level:  level,
+		Layer:  layer,
+		Object: &ImageStats_ResourceData{n},
+	}
+}
+
 // ToList unchains the parents of each node, returning them as a list, starting
 // with the root node.
 func ToList(n Node) []Node {
@@ -144,6 +144,11 @@ func (n *ConstantSet) Validate() error {
 	)
 }
 
+// Validate checks the path is valid.
+func (n *CompatCoverage) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
 // Validate checks the path is valid.
 func (n *Context) Validate() error {
 	return anyErr(
@@ -180,6 +185,16 @@ func (n *ImageInfo) Validate() error {
 	return checkNotNilAndValidate(n, n.Id, "id")
 }
 
+// Validate checks the path is valid.
+func (n *FramebufferComparison) Validate() error {
+	return checkNotNilAndValidate(n, n.After, "after")
+}
+
+// Validate checks the path is valid.
+func (n *ImageStats) Validate() error {
+	return checkNotNilAndValidate(n, protoutil.OneOf(n.Object), "object")
+}
+
 // Validate checks the path is valid.
 func (n *MapIndex) Validate() error {
 	return anyErr(
@@ -206,6 +221,21 @@ func (n *Parameter) Validate() error {
 	)
 }
 
+// Validate checks the path is valid.
+func (n *PixelHistory) Validate() error {
+	return checkNotNilAndValidate(n, n.After, "after")
+}
+
+// Validate checks the path is valid.
+func (n *ReplayDeterminism) Validate() error {
+	return checkNotNilAndValidate(n, n.Commands, "commands")
+}
+
+// Validate checks the path is valid.
+func (n *ReplayPayload) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
 // Validate checks the path is valid.
 func (n *Report) Validate() error {
 	return checkNotNilAndValidate(n, n.Capture, "capture")
@@ -224,6 +254,21 @@ func (n *Resources) Validate() error {
 	return checkNotNilAndValidate(n, n.Capture, "capture")
 }
 
+// Validate checks the path is valid.
+func (n *CppExport) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
+// Validate checks the path is valid.
+func (n *Footprint) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
+// Validate checks the path is valid.
+func (n *Stats) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
 // Validate checks the path is valid.
 func (n *Result) Validate() error {
 	return checkNotNilAndValidate(n, n.Command, "command")
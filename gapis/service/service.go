@@ -49,14 +49,22 @@ type Service interface {
 	// the new capture identifier.
 	ImportCapture(ctx context.Context, name string, data []uint8) (*path.Capture, error)
 
-	// ExportCapture returns a capture's data that can be consumed by
-	// ImportCapture or LoadCapture.
-	ExportCapture(ctx context.Context, c *path.Capture) ([]byte, error)
+	// ExportCapture returns a capture's data in the format f, that can be
+	// consumed by ImportCapture or LoadCapture.
+	ExportCapture(ctx context.Context, c *path.Capture, f CaptureFormat) ([]byte, error)
 
 	// LoadCapture imports capture data from a local file, returning the new
 	// capture identifier.
 	LoadCapture(ctx context.Context, path string) (*path.Capture, error)
 
+	// SpliceCaptures creates a new capture from command ranges of captures of
+	// the same APIs and device, returning the new capture identifier.
+	SpliceCaptures(ctx context.Context, name string, ranges []*path.Commands) (*path.Capture, error)
+
+	// Eval runs the script on the commands of the capture, returning the
+	// values of its expressions.
+	Eval(ctx context.Context, c *path.Capture, script string) (*EvalResult, error)
+
 	// GetDevices returns the full list of replay devices avaliable to the server.
 	// These include local replay devices and any connected Android devices.
 	// This list may change over time, as devices are connected and disconnected.
@@ -111,6 +119,10 @@ type Service interface {
 	// a JSON blob.
 	GetPerformanceCounters(ctx context.Context) ([]byte, error)
 
+	// GetReplayQueue returns the replay batches executing or queued on the
+	// replay devices.
+	GetReplayQueue(ctx context.Context) (*ReplayQueue, error)
+
 	// GetProfile returns the pprof profile with the given name.
 	GetProfile(ctx context.Context, name string, debug int32) ([]byte, error)
 
@@ -167,6 +179,8 @@ func NewValue(v interface{}) *Value {
 		return &Value{&Value_CommandTreeNode{v}}
 	case *ConstantSet:
 		return &Value{&Value_ConstantSet{v}}
+	case *CppExport:
+		return &Value{&Value_CppExport{v}}
 	case *Event:
 		return &Value{&Value_Event{v}}
 	case *Events:
@@ -177,8 +191,22 @@ func NewValue(v interface{}) *Value {
 		return &Value{&Value_Path{v}}
 	case path.Node:
 		return &Value{&Value_Path{v.Path()}}
+	case *PixelHistory:
+		return &Value{&Value_PixelHistory{v}}
+	case *ReplayPayload:
+		return &Value{&Value_ReplayPayload{v}}
+	case *FramebufferComparison:
+		return &Value{&Value_FramebufferComparison{v}}
+	case *ReplayDeterminism:
+		return &Value{&Value_ReplayDeterminism{v}}
+	case *CompatCoverage:
+		return &Value{&Value_CompatCoverage{v}}
 	case *Report:
 		return &Value{&Value_Report{v}}
+	case *CaptureStats:
+		return &Value{&Value_CaptureStats{v}}
+	case *MemoryFootprint:
+		return &Value{&Value_MemoryFootprint{v}}
 	case *Resources:
 		return &Value{&Value_Resources{v}}
 	case *StateTree:
@@ -193,6 +221,8 @@ func NewValue(v interface{}) *Value {
 		return &Value{&Value_ResourceData{v}}
 	case *image.Info:
 		return &Value{&Value_ImageInfo{v}}
+	case *image.Stats:
+		return &Value{&Value_ImageStats{v}}
 	case *device.Instance:
 		return &Value{&Value_Device{v}}
 
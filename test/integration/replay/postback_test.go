@@ -64,7 +64,7 @@ func doReplay(t *testing.T, f func(*builder.Builder)) {
 		t.Errorf("Build failed with error: %v", err)
 	}
 
-	err = executor.Execute(ctx, payload, decoder, connection, abi.MemoryLayout)
+	err = executor.Execute(ctx, payload, decoder, connection, connection.Version, abi.MemoryLayout)
 	if err != nil {
 		t.Errorf("Executor failed with error: %v", err)
 	}